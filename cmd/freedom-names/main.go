@@ -8,7 +8,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net"
 	"os"
 
@@ -19,6 +18,8 @@ import (
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/dnsserver"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/version"
@@ -33,7 +34,7 @@ import (
 //	--content-dir DIR       content-addressed blobstore directory
 //	--dns-addr HOST:PORT    DNS server listen address
 //
-// Unknown flags are ignored (the only bare positional the node understands is
+// --config FILE is handled earlier, by useConfigFlag. Unknown flags are ignored (the only bare positional the node understands is
 // "bootstrap", handled in main).
 func applyNodeFlags(cfg *config.Config, args []string) {
 	for i := 0; i < len(args); i++ {
@@ -77,8 +78,10 @@ Usage:
   freedom-names bootstrap          Run a bootstrap node (fixed p2p ports, DHT
                                    server mode, HTTP API on :8430, no DNS)
   freedom-names freedom <command>  Manage names (see: freedom-names freedom help)
+  freedom-names config check       Validate and print the effective configuration
 
 Flags:
+  --config FILE           Config file (default ~/.freedom/config.yaml, if present)
   --http-addr HOST:PORT   HTTP API listen address (default 127.0.0.1:8420)
   --authoring-addr HOST:PORT  Owner-key API (loopback only, default 127.0.0.1:8421)
   --api-bind HOST         Bind host of the HTTP API (port unchanged)
@@ -87,8 +90,10 @@ Flags:
   -h, --help              Show this help
   --version               Show the node version
 
-Configuration is otherwise driven by FREEDOM_* environment variables; flags
-take precedence. Docs: https://freedomnames.org
+Configuration is otherwise driven by the config file and FREEDOM_* environment
+variables; the environment overrides the file and flags override both. SIGHUP
+reloads rate limits, the hosting budget, upstream DNS, allowed hosts and
+logging. Docs: https://freedomnames.org
 `
 
 func main() {
@@ -98,6 +103,8 @@ func main() {
 		case "freedom":
 			cli.RunCLI(os.Args[2:])
 			return
+		case "config":
+			os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
 		case "-h", "--help", "help":
 			fmt.Print(nodeUsage)
 			return
@@ -116,11 +123,25 @@ func main() {
 	// for the DHT setup, the DNS gate and the /health + /info role field.
 	bootstrapMode := len(os.Args) > 1 && os.Args[1] == "bootstrap"
 
+	useConfigFlag(os.Args[1:])
 	cfg := config.LoadConfigForRole(bootstrapMode)
 	applyNodeFlags(cfg, os.Args[1:]) // flags override env for a spawned node
 
+	// Logging is configured before anything else starts; a bad log file is
+	// reported and the node carries on logging to standard error.
+	logger := logging.For(logging.Node)
+	if err := logging.Setup(cfg.LogOptions()); err != nil {
+		logger.Warn("log files disabled", "err", err)
+	}
+	defer logging.Close()
+
 	freedomDht := node.NewNode(ctx, cfg)
 	defer freedomDht.Shutdown()
+	// Per-node state for the HTTP API's /metrics (content bandwidth, hosted
+	// bytes); everything else is recorded into internal/metrics as it happens.
+	if err := metrics.Register(freedomDht.Collector()); err != nil {
+		logger.Warn("node metrics not exported", "err", err)
+	}
 
 	cache, err := resolver.NewMemoryCache()
 	if err != nil {
@@ -131,10 +152,10 @@ func main() {
 	// non-fatal: naming still works, the node just can't serve/fetch content.
 	var contentSvc *node.ContentService
 	if store, err := content.NewBlobStore(cfg.ContentDir); err != nil {
-		log.Printf("WARNING: content service disabled: %v", err)
+		logging.For(logging.Content).Warn("content service disabled", "err", err)
 	} else {
 		contentSvc = freedomDht.AttachContent(store, cfg)
-		log.Printf("Content store at %s", cfg.ContentDir)
+		logging.For(logging.Content).Info("content store opened", "dir", cfg.ContentDir)
 	}
 
 	// The BCH name registry resolves globally-unique bare names via Bitcoin
@@ -144,9 +165,13 @@ func main() {
 	if len(cfg.BCHElectrum) > 0 {
 		bchClient := bch.NewElectrumClient(cfg.BCHElectrum...)
 		defer bchClient.Close()
-		res = res.WithRegistry(bch.NewBCHRegistry(bchClient, cfg.BCHMinConf))
-		log.Printf("BCH registry enabled (%s via %d electrum server(s), starting with %s)",
-			cfg.BCHNetwork, len(cfg.BCHElectrum), cfg.BCHElectrum[0])
+		if headers, err := bch.NewHeaderChain(bchClient, cfg.BCHNetwork, cfg.BCHCheckpoint); err != nil {
+			logging.For(logging.BCH).Error("BCH registry disabled", "err", err)
+		} else {
+			res = res.WithRegistry(bch.NewBCHRegistry(bchClient, headers, cfg.BCHMinConf))
+			logging.For(logging.BCH).Info("BCH registry enabled",
+				"network", cfg.BCHNetwork, "servers", len(cfg.BCHElectrum), "first", cfg.BCHElectrum[0])
+		}
 	}
 
 	// Start the DNS server (resolves .fn, forwards everything else upstream).
@@ -157,27 +182,40 @@ func main() {
 	// others joining the network, not a resolver for local clients: nothing
 	// should point a stub resolver at it, and a forwarding listener is an open
 	// resolver surface that has no business on a public server.
+	var dnsServer *dnsserver.DNSServer
+	dnsLog := logging.For(logging.DNS)
 	if cfg.BootstrapMode {
-		log.Println("Bootstrap node: DNS server not started")
+		dnsLog.Info("bootstrap node: DNS server not started")
 	} else {
-		dnsServer := dnsserver.NewDNSServer(cfg.DNSAddr, cfg.UpstreamDNS, res, cfg.DNSRecursionAny)
+		dnsServer = dnsserver.NewDNSServer(cfg.DNSAddr, cfg.UpstreamDNS, res, cfg.DNSRecursionAny)
 		if cfg.DNSRecursionAny {
-			log.Printf("WARNING: FREEDOM_DNS_RECURSION=any - this node forwards queries for ANY client (open resolver)")
+			dnsLog.Warn("FREEDOM_DNS_RECURSION=any: this node forwards queries for ANY client (open resolver)")
 		}
 		if err := dnsServer.Start(); err != nil {
-			log.Printf("WARNING: DNS server disabled (DHT and HTTP API still running): %v", err)
+			dnsLog.Warn("DNS server disabled (DHT and HTTP API still running)", "err", err)
 			switch {
 			case bind.IsPrivilegedPort(err):
-				log.Printf("  %s is a privileged port. Use the default high port, or", cfg.DNSAddr)
-				log.Printf("  grant the capability once: sudo setcap cap_net_bind_service=+ep ./freedom-names")
+				dnsLog.Warn("privileged port: use the default high port, or grant the capability once: sudo setcap cap_net_bind_service=+ep ./freedom-names", "addr", cfg.DNSAddr)
 			case bind.IsAddrInUse(err):
-				log.Printf("  %s is already in use. Set FREEDOM_DNS_ADDR to a free port, e.g. FREEDOM_DNS_ADDR=:8054", cfg.DNSAddr)
+				dnsLog.Warn("address already in use: set FREEDOM_DNS_ADDR to a free port, e.g. FREEDOM_DNS_ADDR=:8054", "addr", cfg.DNSAddr)
 			}
+			dnsServer = nil
 		} else {
 			defer dnsServer.Shutdown()
 		}
 	}
 
+	// SIGHUP re-reads the configuration and applies what can change in place.
+	hosts := httpapi.NewHostList(cfg.HTTPAllowedHosts)
+	(&reloader{
+		bootstrapMode: bootstrapMode,
+		args:          os.Args[1:],
+		running:       cfg,
+		content:       contentSvc,
+		dns:           dnsServer,
+		hosts:         hosts,
+	}).watch()
+
 	// StartHTTPServer blocks until interrupted.
-	httpapi.StartHTTPServer(freedomDht, res, cache, contentSvc, cfg.HTTPAddr, cfg.AuthoringAddr, cfg.BootstrapMode, cfg.HTTPAllowedHosts)
+	httpapi.StartHTTPServer(freedomDht, res, cache, contentSvc, cfg.HTTPAddr, cfg.AuthoringAddr, cfg.BootstrapMode, hosts, cfg.HTTPTokensFile)
 }
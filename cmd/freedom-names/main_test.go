@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 )
 
-// TestHTTPAddrPrecedence guards the env -> flag chain. envOr cannot tell "unset"
+// TestHTTPAddrPrecedence guards the env -> flag chain. The loader cannot tell "unset"
 // from "set to the default", so a role-dependent default applied after the
 // config load would silently clobber an explicit FREEDOM_HTTP_ADDR. These cases
 // would catch that regression.
@@ -20,7 +27,7 @@ func TestHTTPAddrPrecedence(t *testing.T) {
 	})
 
 	t.Run("env set to the normal default still wins", func(t *testing.T) {
-		// The exact case envOr cannot distinguish: a bootstrap node explicitly
+		// The exact case the loader cannot distinguish: a bootstrap node explicitly
 		// pointed at 8420 must stay there, not be moved to 8430.
 		t.Setenv("FREEDOM_HTTP_ADDR", "127.0.0.1:8420")
 
@@ -48,3 +55,74 @@ func TestAuthoringAddrFlagWinsOverEnv(t *testing.T) {
 		t.Errorf("AuthoringAddr = %q, want flag value", cfg.AuthoringAddr)
 	}
 }
+
+func writeConfig(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "http_allowed_hosts: [node.internal]\n")
+	t.Setenv(config.FileEnv, path)
+	t.Setenv("FREEDOM_HTTP_ALLOWED_HOSTS", "")
+	t.Setenv("FREEDOM_DNS_ADDR", "")
+	t.Cleanup(func() { logging.Close() })
+
+	cfg := config.LoadConfig()
+	hosts := httpapi.NewHostList(cfg.HTTPAllowedHosts)
+	r := &reloader{running: cfg, hosts: hosts}
+
+	writeConfig(t, path, "http_allowed_hosts: [node.internal, fn.lan]\ndns_addr: :5300\n")
+	applied, restart, err := r.reload()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !slices.Equal(applied, []string{"http_allowed_hosts"}) || !slices.Equal(restart, []string{"dns_addr"}) {
+		t.Errorf("applied %v, restart %v", applied, restart)
+	}
+	if !slices.Equal(hosts.Get(), []string{"node.internal", "fn.lan"}) {
+		t.Errorf("hosts %v", hosts.Get())
+	}
+	if r.running.DNSAddr != ":8053" {
+		t.Errorf("DNSAddr changed in place to %q", r.running.DNSAddr)
+	}
+
+	// An invalid value keeps what the node has rather than resetting it.
+	writeConfig(t, path, "http_allowed_hosts: [other.lan]\ncontent_up_rate: fast\n")
+	if _, _, err := r.reload(); err == nil {
+		t.Error("invalid config applied")
+	}
+	if !slices.Equal(hosts.Get(), []string{"node.internal", "fn.lan"}) {
+		t.Errorf("hosts after a failed reload %v", hosts.Get())
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "upstream_dns: 9.9.9.9:53\n")
+	t.Setenv(config.FileEnv, "") // restored after --config sets it
+	t.Setenv("FREEDOM_UPSTREAM_DNS", "")
+	t.Setenv("FREEDOM_CONTENT_REPLICAS", "")
+
+	var stdout, stderr bytes.Buffer
+	if status := runConfig([]string{"check", "--config", path, "--dns-addr", ":5300"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("status %d: %s", status, stderr.String())
+	}
+	for _, want := range []string{path, "upstream_dns: 9.9.9.9:53", "dns_addr: :5300"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout.String())
+		}
+	}
+
+	writeConfig(t, path, "content_replicas: lots\n")
+	stdout.Reset()
+	if status := runConfig([]string{"check"}, &stdout, &stderr); status != 1 {
+		t.Errorf("invalid config: status %d", status)
+	}
+	if !strings.Contains(stderr.String(), "FREEDOM_CONTENT_REPLICAS") {
+		t.Errorf("problem not reported: %s", stderr.String())
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/dnsserver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+)
+
+// reloadable lists the settings (config file keys) a running node applies on
+// SIGHUP. They are the ones nothing holds on to: no listener, peer identity
+// or stored data depends on them. Changing any other takes a restart.
+var reloadable = []string{
+	"upstream_dns",
+	"http_allowed_hosts",
+	"content_host_budget",
+	"content_up_rate",
+	"content_down_rate",
+	"log_level",
+	"log_format",
+	"log_files",
+}
+
+// useConfigFlag applies --config FILE. It has to happen before the config is
+// loaded, since it picks where the rest comes from; it is kept in the
+// environment so a reload reads the same file.
+func useConfigFlag(args []string) {
+	for i, a := range args {
+		if a == "--config" && i+1 < len(args) {
+			os.Setenv(config.FileEnv, args[i+1])
+		}
+	}
+}
+
+// reloader re-reads the configuration on SIGHUP and applies the reloadable
+// settings to the running node.
+type reloader struct {
+	bootstrapMode bool
+	args          []string // command line, for applyNodeFlags
+	// running is the configuration in effect: a copy of what the node
+	// started with, with each reload's reloadable settings folded in.
+	// Diffing a reload against it is what tells apart "applied" from
+	// "needs a restart".
+	running *config.Config
+	content *node.ContentService // nil if the content service is disabled
+	dns     *dnsserver.DNSServer // nil if no DNS server runs
+	hosts   *httpapi.HostList
+}
+
+// watch reloads on every SIGHUP until the process exits.
+func (r *reloader) watch() {
+	logger := logging.For(logging.Config)
+	running := *r.running // the original stays as the rest of the node read it
+	r.running = &running
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			applied, restart, err := r.reload()
+			if err != nil {
+				logger.Warn("reload failed, configuration unchanged", "err", err)
+				continue
+			}
+			logger.Info("configuration reloaded", "applied", applied)
+			if len(restart) > 0 {
+				logger.Warn("changed settings take effect after a restart", "settings", restart)
+			}
+		}
+	}()
+}
+
+// reload applies the current configuration, returning the changed settings it
+// applied and the changed ones it could not. A config file that does not read
+// or holds an invalid value changes nothing: at startup a bad value falls
+// back to its default, but silently resetting a running node's setting to the
+// default is worse than keeping what it has.
+func (r *reloader) reload() (applied, restart []string, err error) {
+	next, problems, err := config.Load(r.bootstrapMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch len(problems) {
+	case 0:
+	case 1:
+		return nil, nil, fmt.Errorf("invalid setting %s", problems[0])
+	default:
+		return nil, nil, fmt.Errorf("%d invalid settings, first %s", len(problems), problems[0])
+	}
+	applyNodeFlags(next, r.args)
+	for _, key := range config.Changed(r.running, next) {
+		if slices.Contains(reloadable, key) {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+
+	cur := r.running
+	cur.UpstreamDNS = next.UpstreamDNS
+	cur.HTTPAllowedHosts = next.HTTPAllowedHosts
+	cur.ContentHostBudget = next.ContentHostBudget
+	cur.ContentUpRate = next.ContentUpRate
+	cur.ContentDownRate = next.ContentDownRate
+	cur.LogLevel, cur.LogLevels, cur.LogJSON, cur.LogFiles = next.LogLevel, next.LogLevels, next.LogJSON, next.LogFiles
+
+	if r.content != nil {
+		r.content.Retune(cur)
+	}
+	if r.dns != nil {
+		r.dns.SetUpstream(cur.UpstreamDNS)
+	}
+	r.hosts.Set(cur.HTTPAllowedHosts)
+	if err := logging.Setup(cur.LogOptions()); err != nil {
+		logging.For(logging.Config).Warn("log files disabled", "err", err)
+	}
+	return applied, restart, nil
+}
+
+// configUsage documents `freedom-names config`.
+const configUsage = `Usage:
+  freedom-names config check [bootstrap] [flags]
+
+Validates the configuration (config file, FREEDOM_* environment variables and
+node flags) and prints the effective result as a config file. Exits 1 if any
+setting is invalid.
+`
+
+// runConfig runs `freedom-names config`, returning the exit status.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+	args = args[1:]
+	useConfigFlag(args)
+	cfg, problems, err := config.Load(slices.Contains(args, "bootstrap"))
+	applyNodeFlags(cfg, args)
+
+	status := 0
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		status = 1
+	}
+	for _, p := range problems {
+		fmt.Fprintln(stderr, "invalid:", p)
+		status = 1
+	}
+	if cfg.File != "" {
+		fmt.Fprintf(stdout, "# from %s, the environment and flags\n", cfg.File)
+	} else {
+		fmt.Fprintln(stdout, "# no config file; from the environment and flags")
+	}
+	if err := cfg.WriteYAML(stdout); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return status
+}
@@ -0,0 +1,280 @@
+// Package apitoken keeps the bearer tokens that admit remote clients to a
+// node's HTTP API. A node whose API is bound beyond loopback refuses every
+// request without one (see httpapi.localAPIGuard), and each route needs its
+// own scope, so a laptop that only resolves names can be given a token that
+// cannot make the node fetch, host or publish anything.
+//
+// Tokens are created, listed and revoked with `freedom token`, which writes
+// the token file directly; the running node notices the file changed on the
+// next request. The file holds only SHA-256 hashes of the tokens, so reading
+// it does not give one away.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is one kind of access a token grants.
+type Scope string
+
+// The scopes, with what they admit (the full mapping is the route table in
+// internal/httpapi/routes.go).
+const (
+	// Resolve: /resolve, /resolve/batch and /record.
+	Resolve Scope = "resolve"
+	// ContentRead: fetching content (which the node keeps and hosts on a
+	// miss), /resolve-content and the content listings, status and export.
+	ContentRead Scope = "content-read"
+	// ContentWrite: uploading, importing, pinning, removing and collecting
+	// content.
+	ContentWrite Scope = "content-write"
+	// Publish: /publish.
+	Publish Scope = "publish"
+	// Admin: /peers, /info, /metrics, /events and /clear_cache.
+	Admin Scope = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{Resolve, ContentRead, ContentWrite, Publish, Admin}
+
+// ParseScopes parses a comma-separated scope list; "all" stands for every
+// scope.
+func ParseScopes(list string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range strings.Split(list, ",") {
+		s := Scope(strings.TrimSpace(name))
+		switch {
+		case s == "all":
+			return slices.Clone(Scopes), nil
+		case !slices.Contains(Scopes, s):
+			return nil, fmt.Errorf("unknown scope %q (want %s or all)", name, scopeNames())
+		case !slices.Contains(scopes, s):
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+func scopeNames() string {
+	names := make([]string, len(Scopes))
+	for i, s := range Scopes {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Token is a stored token. The token itself is shown once, when created;
+// only its hash is kept.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []Scope   `json:"scopes"`
+	Created time.Time `json:"created"`
+	Hash    string    `json:"hash"` // hex SHA-256 of the token
+}
+
+// Allows reports whether the token grants scope.
+func (t *Token) Allows(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// prefix starts every token, so one is recognisable in a config file or a
+// leaked log line.
+const prefix = "fnt_"
+
+// ErrNotFound is returned by Revoke for an ID no token has.
+var ErrNotFound = errors.New("no such token")
+
+// ErrInvalid is returned by Check for a token that is malformed, unknown or
+// revoked.
+var ErrInvalid = errors.New("invalid API token")
+
+// DefaultFile returns ~/.freedom/api-tokens.json.
+func DefaultFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".freedom", "api-tokens.json"), nil
+}
+
+// Store is a token file. Check rereads the file whenever it has changed, so a
+// node picks up tokens created or revoked while it runs.
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	stat   os.FileInfo // of the file tokens was read from; nil if it did not exist
+	tokens []Token
+}
+
+// Open returns the store kept in path. The file need not exist yet.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the token file.
+func (s *Store) Path() string { return s.path }
+
+// Create adds a token granting scopes and returns it, the only time it is
+// available.
+func (s *Store) Create(name string, scopes []Scope) (string, Token, error) {
+	if len(scopes) == 0 {
+		return "", Token{}, errors.New("a token needs at least one scope")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return "", Token{}, err
+	}
+	var id [4]byte
+	var secret [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", Token{}, err
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", Token{}, err
+	}
+	t := Token{
+		ID:      hex.EncodeToString(id[:]),
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	token := prefix + t.ID + "_" + base64.RawURLEncoding.EncodeToString(secret[:])
+	t.Hash = hashToken(token)
+	if err := s.writeLocked(append(slices.Clone(s.tokens), t)); err != nil {
+		return "", Token{}, err
+	}
+	return token, t, nil
+}
+
+// List returns the stored tokens, oldest first.
+func (s *Store) List() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(s.tokens), nil
+}
+
+// Revoke deletes the token with id.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(s.tokens, func(t Token) bool { return t.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.writeLocked(slices.Delete(slices.Clone(s.tokens), i, i+1))
+}
+
+// Check returns the stored token matching token, or ErrInvalid.
+func (s *Store) Check(token string) (*Token, error) {
+	rest, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return nil, err
+	}
+	hash := hashToken(token)
+	for i := range s.tokens {
+		t := &s.tokens[i]
+		if t.ID == id && subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, ErrInvalid
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshLocked rereads the file if it changed since it was last read.
+func (s *Store) refreshLocked() error {
+	st, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.stat, s.tokens = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.stat != nil && os.SameFile(s.stat, st) && st.ModTime().Equal(s.stat.ModTime()) && st.Size() == s.stat.Size() {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Tokens []Token `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("read %s: %w", s.path, err)
+	}
+	s.stat, s.tokens = st, file.Tokens
+	return nil
+}
+
+// writeLocked replaces the file with tokens. The file is written aside and
+// renamed into place, so a node reading it never sees half of it.
+func (s *Store) writeLocked(tokens []Token) error {
+	if tokens == nil {
+		tokens = []Token{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Tokens []Token `json:"tokens"`
+	}{tokens}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".api-tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.stat = nil // reread on next use, picking up the new file's stat
+	s.tokens = tokens
+	return nil
+}
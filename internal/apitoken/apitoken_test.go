@@ -0,0 +1,93 @@
+package apitoken
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateCheckRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-tokens.json")
+	s := Open(path)
+	token, created, err := s.Create("laptop", []Scope{Resolve, ContentRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, prefix+created.ID+"_") {
+		t.Errorf("token %q does not carry its ID %s", token, created.ID)
+	}
+
+	got, err := s.Check(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "laptop" || !got.Allows(ContentRead) || got.Allows(Publish) {
+		t.Errorf("checked token %+v", got)
+	}
+	for _, bad := range []string{"", "bogus", token + "x", prefix + created.ID + "_AAAA", strings.Replace(token, created.ID, "00000000", 1)} {
+		if _, err := s.Check(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Check(%q) = %v", bad, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := token[strings.LastIndex(token, "_")+1:]
+	if strings.Contains(string(data), secret) {
+		t.Error("token file holds the token itself")
+	}
+	if st, _ := os.Stat(path); st.Mode().Perm()&0077 != 0 {
+		t.Errorf("token file mode %v", st.Mode())
+	}
+
+	if err := s.Revoke(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Check(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("revoked token: %v", err)
+	}
+	if err := s.Revoke(created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second revoke: %v", err)
+	}
+}
+
+// TestStorePicksUpChanges checks a store sees tokens another process (the
+// CLI) wrote to the file after it was opened.
+func TestStorePicksUpChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-tokens.json")
+	node := Open(path)
+	if _, err := node.Check(prefix + "00000000_x"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("missing file: %v", err)
+	}
+
+	token, created, err := Open(path).Create("phone", []Scope{Resolve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.Check(token); err != nil {
+		t.Fatalf("token created elsewhere: %v", err)
+	}
+	if err := Open(path).Revoke(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.Check(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("token revoked elsewhere: %v", err)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("resolve, content-read,resolve")
+	if err != nil || len(scopes) != 2 || scopes[0] != Resolve || scopes[1] != ContentRead {
+		t.Errorf("resolve, content-read: %v %v", scopes, err)
+	}
+	if scopes, err := ParseScopes("all"); err != nil || len(scopes) != len(Scopes) {
+		t.Errorf("all: %v %v", scopes, err)
+	}
+	if _, err := ParseScopes("resolve,root"); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 )
 
 // ElectrumClient is a minimal Electrum Cash protocol client (the protocol
@@ -92,6 +94,9 @@ func (c *ElectrumClient) connect(ctx context.Context) error {
 			errs = append(errs, err)
 			continue
 		}
+		if i != c.lastGood {
+			metrics.ElectrumFailovers.Inc()
+		}
 		c.lastGood = i
 		return nil
 	}
@@ -160,7 +165,14 @@ func (c *ElectrumClient) Close() {
 
 // call performs one JSON-RPC request/response cycle, connecting if needed. On
 // any transport error the connection is dropped so the next call reconnects.
-func (c *ElectrumClient) call(ctx context.Context, method string, params any, result any) error {
+// The recorded latency includes waiting for the lock and any reconnect, since
+// that is what the caller experienced.
+func (c *ElectrumClient) call(ctx context.Context, method string, params any, result any) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ElectrumCallDuration.WithLabelValues(method, metrics.Result(err)).Observe(metrics.Since(start))
+	}()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -169,7 +181,7 @@ func (c *ElectrumClient) call(ctx context.Context, method string, params any, re
 			return err
 		}
 	}
-	err := c.callLocked(ctx, method, params, result)
+	err = c.callLocked(ctx, method, params, result)
 	if err != nil && !isElectrumRPCError(err) {
 		// Transport-level failure: force a reconnect on the next call.
 		c.closeLocked()
@@ -335,6 +347,55 @@ func (c *ElectrumClient) BlockHeight(ctx context.Context) (int64, error) {
 	return tip.Height, nil
 }
 
+// TipHeader returns the chain tip's height and raw 80-byte header, as the
+// server sees it.
+func (c *ElectrumClient) TipHeader(ctx context.Context) (int64, []byte, error) {
+	var tip struct {
+		Height int64  `json:"height"`
+		Hex    string `json:"hex"`
+	}
+	if err := c.call(ctx, "blockchain.headers.subscribe", nil, &tip); err != nil {
+		return 0, nil, err
+	}
+	raw, err := hex.DecodeString(tip.Hex)
+	if err != nil {
+		return 0, nil, fmt.Errorf("tip header: %w", err)
+	}
+	return tip.Height, raw, nil
+}
+
+// GetHeaders returns up to count raw headers starting at height start,
+// concatenated. Servers cap count (2016 on Fulcrum) and return fewer past
+// their tip.
+func (c *ElectrumClient) GetHeaders(ctx context.Context, start, count int64) ([]byte, error) {
+	var out struct {
+		Count int64  `json:"count"`
+		Hex   string `json:"hex"`
+	}
+	if err := c.call(ctx, "blockchain.block.headers", []any{start, count}, &out); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(out.Hex)
+}
+
+// electrumMerkle is the answer to blockchain.transaction.get_merkle: the
+// branch (display-order hex, leaf upwards) proving a transaction is at
+// position Pos of the block at BlockHeight.
+type electrumMerkle struct {
+	BlockHeight int64    `json:"block_height"`
+	Merkle      []string `json:"merkle"`
+	Pos         uint64   `json:"pos"`
+}
+
+// GetMerkle returns the Merkle inclusion proof of txid in the block at height.
+func (c *ElectrumClient) GetMerkle(ctx context.Context, txid string, height int64) (*electrumMerkle, error) {
+	var out electrumMerkle
+	if err := c.call(ctx, "blockchain.transaction.get_merkle", []any{txid, height}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 // scriptHash computes the Electrum protocol identifier for a locking script:
 // hex of sha256(script) with the byte order reversed.
 func scriptHash(script []byte) string {
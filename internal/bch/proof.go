@@ -0,0 +1,152 @@
+package bch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+)
+
+// ErrInvalidOwnerProof marks an OwnerProof whose transactions do not hold
+// together. Callers classify it with errors.Is.
+var ErrInvalidOwnerProof = errors.New("invalid owner proof")
+
+// VerifyOwnerProof redoes the registry's reasoning over the transactions in an
+// OwnerProof and returns the owner pubkey they establish for a bare name:
+// the claim carries an FN01 for the name and mints its NFT, each custody
+// transaction spends the NFT output of the one before, and the binding reveals
+// a pubkey whose hash160 is the last commitment the NFT carried.
+//
+// It needs nothing but the proof, and so cannot tell whether the transactions
+// were ever mined: a node could make them up. A client that does not trust
+// the node checks that too, with VerifyOwnerProofInChain.
+func VerifyOwnerProof(name string, p *registry.OwnerProof) ([]byte, error) {
+	label, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: no owner proof for %q", ErrInvalidOwnerProof, label)
+	}
+
+	claim, err := parseTx(p.Claim)
+	if err != nil {
+		return nil, fmt.Errorf("%w: claim tx: %v", ErrInvalidOwnerProof, err)
+	}
+	if tag, _, ok := parseFNMetadata(claim, label); !ok || tag != fnClaimTag {
+		return nil, fmt.Errorf("%w: claim tx has no FN01 for %q", ErrInvalidOwnerProof, label)
+	}
+	category := genesisCategory(claim)
+	if category == nil {
+		return nil, fmt.Errorf("%w: claim tx mints no token", ErrInvalidOwnerProof)
+	}
+	vout := tokenOutput(claim, category)
+	if vout < 0 {
+		return nil, fmt.Errorf("%w: claim tx does not hold the name NFT", ErrInvalidOwnerProof)
+	}
+	commitment := claim.Outputs[vout].Token.Commitment
+	prevID := txID(p.Claim)
+
+	if len(p.Custody) > maxCustodyHops {
+		return nil, fmt.Errorf("%w: %d custody hops, at most %d", ErrInvalidOwnerProof, len(p.Custody), maxCustodyHops)
+	}
+	for i, raw := range p.Custody {
+		tx, err := parseTx(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: custody tx %d: %v", ErrInvalidOwnerProof, i, err)
+		}
+		if !spends(tx, prevID, uint32(vout)) {
+			return nil, fmt.Errorf("%w: custody tx %d does not spend the name NFT", ErrInvalidOwnerProof, i)
+		}
+		vout = tokenOutput(tx, category)
+		if vout < 0 {
+			// Burned: the last commitment stands, and nothing can follow.
+			if i != len(p.Custody)-1 {
+				return nil, fmt.Errorf("%w: custody continues after the name NFT was burned", ErrInvalidOwnerProof)
+			}
+			break
+		}
+		commitment = tx.Outputs[vout].Token.Commitment
+		prevID = txID(raw)
+	}
+
+	bind, err := parseTx(p.Binding)
+	if err != nil {
+		return nil, fmt.Errorf("%w: binding tx: %v", ErrInvalidOwnerProof, err)
+	}
+	_, pubKey, ok := parseFNMetadata(bind, label)
+	if !ok {
+		return nil, fmt.Errorf("%w: binding tx has no FN01/FN02 for %q", ErrInvalidOwnerProof, label)
+	}
+	if !bytesEqual(hash160(pubKey), commitment) {
+		return nil, fmt.Errorf("%w: binding pubkey does not match the NFT commitment", ErrInvalidOwnerProof)
+	}
+	return pubKey, nil
+}
+
+// VerifyOwnerProofInChain does what VerifyOwnerProof does, and also checks
+// that every transaction of the proof was mined: its inclusion proof must lead
+// to the header headers has at that height. An error reading headers is
+// returned as is; anything wrong with the proof is ErrInvalidOwnerProof. See
+// registry.OwnerProof for what even this cannot show.
+func VerifyOwnerProofInChain(ctx context.Context, name string, p *registry.OwnerProof, headers *HeaderChain) ([]byte, error) {
+	pubKey, err := VerifyOwnerProof(name, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.CustodyBlocks) != len(p.Custody) {
+		return nil, fmt.Errorf("%w: %d custody blocks for %d custody hops", ErrInvalidOwnerProof, len(p.CustodyBlocks), len(p.Custody))
+	}
+	if err := checkInclusion(ctx, headers, "claim", p.Claim, p.ClaimBlock); err != nil {
+		return nil, err
+	}
+	for i, raw := range p.Custody {
+		if err := checkInclusion(ctx, headers, fmt.Sprintf("custody tx %d", i), raw, p.CustodyBlocks[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkInclusion(ctx, headers, "binding", p.Binding, p.BindingBlock); err != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
+
+// checkInclusion checks in shows raw (the proof's what) is in the block
+// headers has at in.Height.
+func checkInclusion(ctx context.Context, headers *HeaderChain, what string, raw []byte, in *registry.Inclusion) error {
+	if in == nil {
+		return fmt.Errorf("%w: %s has no block", ErrInvalidOwnerProof, what)
+	}
+	if len(raw) == 64 {
+		return fmt.Errorf("%w: %s is 64 bytes", ErrInvalidOwnerProof, what)
+	}
+	claimed, err := parseHeader(in.Header)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidOwnerProof, what, err)
+	}
+	if in.Height <= 0 {
+		return fmt.Errorf("%w: %s is not in a block", ErrInvalidOwnerProof, what)
+	}
+	header, err := headers.header(ctx, in.Height)
+	if err != nil {
+		return fmt.Errorf("%s block %d: %w", what, in.Height, err)
+	}
+	if !bytesEqual(claimed.hash, header.hash) {
+		return fmt.Errorf("%w: %s block %d is %s, not %s", ErrInvalidOwnerProof, what, in.Height, claimed.displayHash(), header.displayHash())
+	}
+	if !included(txID(raw), in, header) {
+		return fmt.Errorf("%w: %s is not in block %d", ErrInvalidOwnerProof, what, in.Height)
+	}
+	return nil
+}
+
+// spends reports whether tx has an input spending outpoint txid:vout.
+func spends(tx *parsedTx, txid []byte, vout uint32) bool {
+	for _, in := range tx.Inputs {
+		if in.PrevIndex == vout && bytesEqual(in.PrevTxID, txid) {
+			return true
+		}
+	}
+	return false
+}
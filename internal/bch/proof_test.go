@@ -0,0 +1,182 @@
+package bch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// makeRebindTx builds an FN02 that moves the name NFT at prev:vout to
+// holderScript and re-binds it to newOwnerPub, the way `freedom adopt` does.
+func makeRebindTx(t *testing.T, label string, newOwnerPub, holderScript []byte, key *secp256k1.PrivateKey, prevRaw []byte, vout uint32, category []byte) []byte {
+	t.Helper()
+	prev, err := parseTx(prevRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := prev.Outputs[vout]
+	tx := &transaction{
+		Version: 2,
+		Inputs: []txInput{{
+			PrevTxID:   txID(prevRaw),
+			PrevIndex:  vout,
+			PrevScript: out.Script,
+			PrevValue:  out.Value,
+			PrevToken:  out.Token,
+			Sequence:   0xffffffff,
+		}},
+		Outputs: []txOutput{
+			{Value: tokenDustLimit, Script: holderScript, Token: &tokenInfo{
+				CategoryID: category,
+				Capability: tokenCapabilityMutable,
+				Commitment: hash160(newOwnerPub),
+			}},
+			{Value: 0, Script: opReturnScript([]byte(fnRebindTag), []byte(label), newOwnerPub)},
+			{Value: dustLimit, Script: markerScript(label)},
+		},
+	}
+	raw, err := tx.Serialize([]*secp256k1.PrivateKey{key})
+	if err != nil {
+		t.Fatalf("serialize rebind: %v", err)
+	}
+	return raw
+}
+
+// TestOwnerProofRoundTrip resolves a name that changed hands once and checks
+// the proof the registry hands out verifies to the same owner, with no
+// electrum server involved.
+func TestOwnerProofRoundTrip(t *testing.T) {
+	m := newMockElectrum(t)
+	firstPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	secondPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+
+	fk, _ := secp256k1.GeneratePrivateKey()
+	holder := p2pkhScript(hash160(fk.PubKey().SerializeCompressed()))
+	category := mustHex(t, repeat("ab", 32))
+	claim := makeClaimTx(t, "moved", firstPub, holder, fk, category)
+	m.addTx(claim, 100, markerScript("moved"), holder)
+	rebind := makeRebindTx(t, "moved", secondPub, holder, fk, claim, 0, category)
+	m.addTx(rebind, 110, markerScript("moved"), holder)
+
+	client := NewElectrumClient(m.endpoint())
+	defer client.Close()
+	reg := m.registry(client, 1)
+
+	owner, proof, err := reg.ProveOwner(t.Context(), "moved.fn")
+	if err != nil {
+		t.Fatalf("ProveOwner: %v", err)
+	}
+	if !bytesEqual(owner, secondPub) || len(proof.Custody) != 1 {
+		t.Fatalf("owner is second %v, %d custody hops", bytesEqual(owner, secondPub), len(proof.Custody))
+	}
+	got, err := VerifyOwnerProof("Moved.fn", proof)
+	if err != nil {
+		t.Fatalf("VerifyOwnerProof: %v", err)
+	}
+	if !bytesEqual(got, secondPub) {
+		t.Fatal("verified a different owner than the registry resolved")
+	}
+}
+
+// TestOwnerProofRejectsTampering checks each way a relay could bend a proof
+// towards an owner of its choosing.
+func TestOwnerProofRejectsTampering(t *testing.T) {
+	ownerPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	attackerPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	fk, _ := secp256k1.GeneratePrivateKey()
+	ak, _ := secp256k1.GeneratePrivateKey()
+	holder := p2pkhScript(hash160(fk.PubKey().SerializeCompressed()))
+	category := mustHex(t, repeat("cd", 32))
+	claim := makeClaimTx(t, "target", ownerPub, holder, fk, category)
+
+	// A marker-only FN02 with the attacker's key, holding no NFT.
+	hijack := makeFakeRebind(t, "target", attackerPub, ak, mustHex(t, repeat("ee", 32)))
+	// A "custody" hop that moves some other outpoint.
+	unrelated := makeRebindTx(t, "target", attackerPub, holder, ak, hijack, 1, category)
+	// The attacker's own claim on a different category.
+	otherClaim := makeClaimTx(t, "target", attackerPub, holder, ak, mustHex(t, repeat("ff", 32)))
+
+	if _, err := VerifyOwnerProof("target.fn", &registry.OwnerProof{Claim: claim, Binding: claim}); err != nil {
+		t.Fatalf("honest proof rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		lookup string
+		proof  *registry.OwnerProof
+	}{
+		{"binding not matching the commitment", "target.fn", &registry.OwnerProof{Claim: claim, Binding: hijack}},
+		{"custody not spending the NFT", "target.fn", &registry.OwnerProof{Claim: claim, Custody: [][]byte{unrelated}, Binding: unrelated}},
+		{"claim for another name", "other.fn", &registry.OwnerProof{Claim: claim, Binding: claim}},
+		{"rebind posing as the claim", "target.fn", &registry.OwnerProof{Claim: hijack, Binding: hijack}},
+		{"binding from another claim", "target.fn", &registry.OwnerProof{Claim: claim, Binding: otherClaim}},
+		{"garbage claim", "target.fn", &registry.OwnerProof{Claim: []byte{1, 2, 3}, Binding: claim}},
+		{"no proof", "target.fn", nil},
+	} {
+		if _, err := VerifyOwnerProof(tc.lookup, tc.proof); !errors.Is(err, ErrInvalidOwnerProof) {
+			t.Errorf("%s: err = %v, want ErrInvalidOwnerProof", tc.name, err)
+		}
+	}
+}
+
+// TestOwnerProofInChain checks a proof against a header chain of the
+// verifier's own: the registry's proof passes, and transactions the node made
+// up, or placed in the wrong block, do not.
+func TestOwnerProofInChain(t *testing.T) {
+	m := newMockElectrum(t)
+	firstPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	secondPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	fk, _ := secp256k1.GeneratePrivateKey()
+	holder := p2pkhScript(hash160(fk.PubKey().SerializeCompressed()))
+	category := mustHex(t, repeat("ab", 32))
+	claim := makeClaimTx(t, "moved", firstPub, holder, fk, category)
+	m.addTx(claim, 100, markerScript("moved"), holder)
+	rebind := makeRebindTx(t, "moved", secondPub, holder, fk, claim, 0, category)
+	m.addTx(rebind, 110, markerScript("moved"), holder)
+
+	client := NewElectrumClient(m.endpoint())
+	defer client.Close()
+	_, proof, err := m.registry(client, 1).ProveOwner(t.Context(), "moved.fn")
+	if err != nil {
+		t.Fatalf("ProveOwner: %v", err)
+	}
+	headers := newHeaderChain(client, regtestParams, nil)
+	if got, err := VerifyOwnerProofInChain(t.Context(), "moved.fn", proof, headers); err != nil || !bytesEqual(got, secondPub) {
+		t.Fatalf("honest proof: %v", err)
+	}
+
+	// An unmined claim and binding for the name, to an owner of the node's
+	// choosing, with inclusions borrowed from the real ones.
+	forgedPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	forged := makeClaimTx(t, "moved", forgedPub, holder, fk, mustHex(t, repeat("ac", 32)))
+	if _, err := VerifyOwnerProof("moved.fn", &registry.OwnerProof{Claim: forged, Binding: forged}); err != nil {
+		t.Fatalf("forged proof is not even consistent: %v", err)
+	}
+	other := *proof.CustodyBlocks[0]
+	for name, tamper := range map[string]func(p *registry.OwnerProof){
+		"made-up claim": func(p *registry.OwnerProof) {
+			*p = registry.OwnerProof{Claim: forged, Binding: forged, ClaimBlock: proof.ClaimBlock, BindingBlock: proof.ClaimBlock}
+		},
+		"no claim block":       func(p *registry.OwnerProof) { p.ClaimBlock = nil },
+		"claim in wrong block": func(p *registry.OwnerProof) { p.ClaimBlock = &other },
+		"claim block at wrong height": func(p *registry.OwnerProof) {
+			in := *p.ClaimBlock
+			in.Height++
+			p.ClaimBlock = &in
+		},
+		"custody blocks missing": func(p *registry.OwnerProof) { p.CustodyBlocks = nil },
+		"binding not in its block": func(p *registry.OwnerProof) {
+			in := *p.BindingBlock
+			in.Pos++
+			p.BindingBlock = &in
+		},
+	} {
+		p := *proof
+		tamper(&p)
+		if _, err := VerifyOwnerProofInChain(t.Context(), "moved.fn", &p, headers); !errors.Is(err, ErrInvalidOwnerProof) {
+			t.Errorf("%s: err = %v, want ErrInvalidOwnerProof", name, err)
+		}
+	}
+}
@@ -6,14 +6,16 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
 )
 
+var logger = logging.For(logging.BCH)
+
 // reverseBytesHex decodes a display-order hex hash and returns internal order.
 func reverseBytesHex(h string) []byte {
 	b, err := hex.DecodeString(h)
@@ -25,6 +27,9 @@ func reverseBytesHex(h string) []byte {
 
 // bchRegistry resolves bare names ("mysite.fn") to their controlling owner's
 // Ed25519 public key by reading the Bitcoin Cash chain via an Electrum server.
+// It does not take the server's word for the chain: the tip comes from a
+// verified header chain, and every transaction that decides an answer (the
+// winning claim, each custody hop, the owning binding) is proven into it.
 //
 // A name is a mutable CashTokens NFT. The binding between the human name and
 // the NFT (and the owner's Ed25519 pubkey) is anchored by FN01/FN02 OP_RETURN
@@ -38,6 +43,7 @@ func reverseBytesHex(h string) []byte {
 //     wallet transfer left the commitment unbound).
 type bchRegistry struct {
 	client  *ElectrumClient
+	headers *HeaderChain
 	minConf int64
 
 	mu    sync.Mutex
@@ -79,13 +85,15 @@ const maxHistoryScan = 512
 // a stream of random <random>.fn queries.
 const maxOwnerCacheEntries = 4096
 
-// NewBCHRegistry builds a registry over the given electrum client.
-func NewBCHRegistry(client *ElectrumClient, minConf int64) *bchRegistry {
+// NewBCHRegistry builds a registry over the given electrum client, checking
+// what it reads against headers (built over the same client).
+func NewBCHRegistry(client *ElectrumClient, headers *HeaderChain, minConf int64) *bchRegistry {
 	if minConf < 1 {
 		minConf = 1
 	}
 	return &bchRegistry{
 		client:  client,
+		headers: headers,
 		minConf: minConf,
 		cache:   make(map[string]ownerCacheEntry),
 	}
@@ -113,7 +121,7 @@ func (r *bchRegistry) ResolveOwner(name string) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	pubKey, err := r.resolve(ctx, label)
+	pubKey, _, err := r.resolve(ctx, label)
 	if err != nil {
 		// Negative-cache a definitive not-found to blunt random-name floods.
 		// Transient failures (timeouts, server errors) are not cached.
@@ -168,7 +176,7 @@ func (r *bchRegistry) CategoryFor(ctx context.Context, label string) ([]byte, er
 // confirmed one (deterministic tiebreak on smaller txid). It returns the parsed
 // claim tx and its NFT category (the genesis input's prevout txid).
 func (r *bchRegistry) winningClaim(ctx context.Context, label string) (*parsedTx, []byte, error) {
-	tip, err := r.client.BlockHeight(ctx)
+	tip, err := r.headers.Tip(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("chain tip: %w", err)
 	}
@@ -179,7 +187,8 @@ func (r *bchRegistry) winningClaim(ctx context.Context, label string) (*parsedTx
 
 	scan, truncated := oldestHistory(history, label)
 	var claimTx *parsedTx
-	var claimTxID []byte
+	var claimTxID, claimRaw []byte
+	var claimHash string
 	var claimHeight int64 = -1
 	for _, h := range scan {
 		if !confirmed(h.Height, tip, r.minConf) {
@@ -199,7 +208,7 @@ func (r *bchRegistry) winningClaim(ctx context.Context, label string) (*parsedTx
 		txid := reverseBytesHex(h.TxHash)
 		if claimHeight == -1 || h.Height < claimHeight ||
 			(h.Height == claimHeight && bytes.Compare(txid, claimTxID) < 0) {
-			claimTx, claimTxID, claimHeight = tx, txid, h.Height
+			claimTx, claimTxID, claimRaw, claimHash, claimHeight = tx, txid, raw, h.TxHash, h.Height
 		}
 	}
 	if claimTx == nil {
@@ -208,6 +217,9 @@ func (r *bchRegistry) winningClaim(ctx context.Context, label string) (*parsedTx
 		}
 		return nil, nil, registry.ErrRegistryNotFound
 	}
+	if _, err := r.headers.VerifyTx(ctx, claimRaw, claimHash, claimHeight); err != nil {
+		return nil, nil, fmt.Errorf("claim for %q: %w", label, err)
+	}
 	category := genesisCategory(claimTx)
 	if category == nil {
 		return nil, nil, registry.ErrRegistryNotFound
@@ -215,18 +227,38 @@ func (r *bchRegistry) winningClaim(ctx context.Context, label string) (*parsedTx
 	return claimTx, category, nil
 }
 
-// resolve performs the full chain lookup for a normalized label.
-func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, error) {
-	tip, err := r.client.BlockHeight(ctx)
+// ProveOwner implements registry.Prover. It always reads the chain: the owner
+// cache keeps only the answer, not the transactions behind it.
+func (r *bchRegistry) ProveOwner(ctx context.Context, name string) ([]byte, *registry.OwnerProof, error) {
+	label, err := NormalizeName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.resolve(ctx, label)
+}
+
+// binding is a valid FN01/FN02 transaction for a name and the pubkey it
+// reveals, with where the server says it was mined.
+type binding struct {
+	pubKey []byte
+	raw    []byte
+	txHash string
+	height int64
+}
+
+// resolve performs the full chain lookup for a normalized label, returning the
+// owner pubkey and the transactions that decided it.
+func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, *registry.OwnerProof, error) {
+	tip, err := r.headers.Tip(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("chain tip: %w", err)
+		return nil, nil, fmt.Errorf("chain tip: %w", err)
 	}
 	history, err := r.client.GetHistory(ctx, scriptHash(markerScript(label)))
 	if err != nil {
-		return nil, fmt.Errorf("marker history for %q: %w", label, err)
+		return nil, nil, fmt.Errorf("marker history for %q: %w", label, err)
 	}
 	if len(history) == 0 {
-		return nil, registry.ErrRegistryNotFound
+		return nil, nil, registry.ErrRegistryNotFound
 	}
 
 	// Collect every valid FN01/FN02 binding for this name, keyed by the
@@ -234,9 +266,10 @@ func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, error)
 	// authoritative: it must match the live NFT commitment. There is no
 	// height-based fallback, so a stranger who merely pays the marker dust and
 	// posts an FN02 (without holding the NFT) can never hijack the name.
-	bindings := make(map[string][]byte) // hex(hash160(pubkey)) -> pubkey
+	bindings := make(map[string]binding) // hex(hash160(pubkey)) -> binding
 	var claimTx *parsedTx
-	var claimTxID []byte
+	var claimTxID, claimRaw []byte
+	var claimHash string
 	var claimHeight int64 = -1
 
 	// A truncated scan can miss an FN02 rebind, which is by nature at the recent
@@ -250,7 +283,7 @@ func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, error)
 		}
 		raw, err := r.client.GetRawTransaction(ctx, h.TxHash)
 		if err != nil {
-			return nil, fmt.Errorf("fetch tx %s: %w", h.TxHash, err)
+			return nil, nil, fmt.Errorf("fetch tx %s: %w", h.TxHash, err)
 		}
 		tx, err := parseTx(raw)
 		if err != nil {
@@ -260,7 +293,7 @@ func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, error)
 		if !ok {
 			continue
 		}
-		bindings[hex.EncodeToString(hash160(pubKey))] = pubKey
+		bindings[hex.EncodeToString(hash160(pubKey))] = binding{pubKey: pubKey, raw: raw, txHash: h.TxHash, height: h.Height}
 
 		if tag == fnClaimTag {
 			txid := reverseBytesHex(h.TxHash)
@@ -268,46 +301,62 @@ func (r *bchRegistry) resolve(ctx context.Context, label string) ([]byte, error)
 			// smaller txid so every resolver agrees even for same-block claims.
 			if claimHeight == -1 || h.Height < claimHeight ||
 				(h.Height == claimHeight && bytes.Compare(txid, claimTxID) < 0) {
-				claimTx, claimTxID, claimHeight = tx, txid, h.Height
+				claimTx, claimTxID, claimRaw, claimHash, claimHeight = tx, txid, raw, h.TxHash, h.Height
 			}
 		}
 	}
 
 	if claimTx == nil {
 		if truncated {
-			return nil, fmt.Errorf("claim for %q: %w", label, errHistoryTruncated)
+			return nil, nil, fmt.Errorf("claim for %q: %w", label, errHistoryTruncated)
 		}
-		return nil, registry.ErrRegistryNotFound
+		return nil, nil, registry.ErrRegistryNotFound
+	}
+	// Only the transactions that decide the answer are proven: the server
+	// picks which history entries to show, so proving the losing ones would
+	// cost a round trip each and settle nothing.
+	claimBlock, err := r.headers.VerifyTx(ctx, claimRaw, claimHash, claimHeight)
+	if err != nil {
+		return nil, nil, fmt.Errorf("claim for %q: %w", label, err)
 	}
 
 	// The NFT category is the prevout txid of the claim's genesis input (the
 	// input spending output index 0), per the CashTokens genesis rule.
 	category := genesisCategory(claimTx)
 	if category == nil {
-		return nil, registry.ErrRegistryNotFound
+		return nil, nil, registry.ErrRegistryNotFound
 	}
 
 	// Walk the NFT from the claim's mint output to the current UTXO, reading the
 	// live commitment.
-	commitment, err := r.currentCommitment(ctx, claimTxID, category)
+	commitment, custody, custodyBlocks, err := r.currentCommitment(ctx, claimRaw, claimTx, category)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// The owner is the revealed pubkey whose hash160 equals the live commitment.
 	// If none matches (e.g. the NFT was moved by a plain wallet transfer and not
 	// yet re-bound via `freedom adopt`), the name has no resolvable owner.
-	if pub, ok := bindings[hex.EncodeToString(commitment)]; ok {
-		return pub, nil
+	if b, ok := bindings[hex.EncodeToString(commitment)]; ok {
+		bindingBlock := claimBlock
+		if b.txHash != claimHash {
+			if bindingBlock, err = r.headers.VerifyTx(ctx, b.raw, b.txHash, b.height); err != nil {
+				return nil, nil, fmt.Errorf("owner binding for %q: %w", label, err)
+			}
+		}
+		return b.pubKey, &registry.OwnerProof{
+			Claim: claimRaw, Custody: custody, Binding: b.raw,
+			ClaimBlock: claimBlock, CustodyBlocks: custodyBlocks, BindingBlock: bindingBlock,
+		}, nil
 	}
 	if truncated {
 		// The owning binding may simply be in the part we never read. Reporting
 		// "unclaimed" here would negative-cache a name that is fine, which is a
 		// per-name denial of service anyone can trigger: the marker address is
 		// derived from the label alone, so anyone can pad its history with dust.
-		return nil, fmt.Errorf("owner binding for %q: %w", label, errHistoryTruncated)
+		return nil, nil, fmt.Errorf("owner binding for %q: %w", label, errHistoryTruncated)
 	}
-	return nil, registry.ErrRegistryNotFound
+	return nil, nil, registry.ErrRegistryNotFound
 }
 
 // genesisCategory returns the CashTokens category a claim tx mints: the prevout
@@ -321,98 +370,101 @@ func genesisCategory(tx *parsedTx) []byte {
 	return nil
 }
 
-// currentCommitment follows the name NFT from the mint output of the claim
-// transaction (claimTxID) to the current UTXO and returns its live commitment.
-// category is the NFT's token category (used to identify the token at each hop).
-func (r *bchRegistry) currentCommitment(ctx context.Context, claimTxID, category []byte) ([]byte, error) {
-	raw, err := r.client.GetRawTransaction(ctx, hex.EncodeToString(reverseBytes(claimTxID)))
-	if err != nil {
-		return nil, fmt.Errorf("fetch claim tx: %w", err)
-	}
-	tx, err := parseTx(raw)
-	if err != nil {
-		return nil, err
-	}
-
-	// Find the mint output: the output carrying our category token.
-	mintVout := -1
+// tokenOutput returns the index of the first output of tx carrying a token of
+// category, or -1 if none does.
+func tokenOutput(tx *parsedTx, category []byte) int {
 	for i, o := range tx.Outputs {
 		if o.Token != nil && bytesEqual(o.Token.CategoryID, category) {
-			mintVout = i
-			break
+			return i
 		}
 	}
+	return -1
+}
+
+// currentCommitment follows the name NFT from the mint output of the claim
+// transaction (raw, parsed as tx) to the current UTXO and returns its live
+// commitment, along with the raw transactions of each hop it followed and the
+// blocks they are in.
+// category is the NFT's token category (used to identify the token at each hop).
+func (r *bchRegistry) currentCommitment(ctx context.Context, raw []byte, tx *parsedTx, category []byte) ([]byte, [][]byte, []*registry.Inclusion, error) {
+	// Find the mint output: the output carrying our category token.
+	mintVout := tokenOutput(tx, category)
 	if mintVout < 0 {
-		return nil, registry.ErrRegistryNotFound
+		return nil, nil, nil, registry.ErrRegistryNotFound
 	}
 
-	curTxID := claimTxID
+	curTxID := txID(raw)
 	curVout := uint32(mintVout)
 	commitment := tx.Outputs[mintVout].Token.Commitment
 	curScript := tx.Outputs[mintVout].Script
 
+	var custody [][]byte
+	var blocks []*registry.Inclusion
 	for hop := 0; hop < maxCustodyHops; hop++ {
 		// Is (curTxID, curVout) still unspent at the holder address? If so, we
 		// are done. Otherwise find the tx that spent it and follow the token.
-		spendTx, spendRaw, found, err := r.findSpender(ctx, curScript, curTxID, curVout)
+		spendTx, spendRaw, block, err := r.findSpender(ctx, curScript, curTxID, curVout)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		if !found {
-			return commitment, nil // current UTXO reached
+		if spendTx == nil {
+			return commitment, custody, blocks, nil // current UTXO reached
 		}
+		custody = append(custody, spendRaw)
+		blocks = append(blocks, block)
 		// Locate the output in spendTx that carries our category token.
-		nextVout := -1
-		for i, o := range spendTx.Outputs {
-			if o.Token != nil && bytesEqual(o.Token.CategoryID, category) {
-				nextVout = i
-				commitment = o.Token.Commitment
-				curScript = o.Script
-				break
-			}
-		}
+		nextVout := tokenOutput(spendTx, category)
 		if nextVout < 0 {
 			// Token was burned; last known commitment stands.
-			return commitment, nil
+			return commitment, custody, blocks, nil
 		}
+		commitment = spendTx.Outputs[nextVout].Token.Commitment
+		curScript = spendTx.Outputs[nextVout].Script
 		curTxID = txID(spendRaw)
 		curVout = uint32(nextVout)
 	}
-	return commitment, nil
+	return commitment, custody, blocks, nil
 }
 
 // findSpender looks for the transaction that spends outpoint (txid:vout) locked
-// by script, by scanning that address's history. Returns found=false if the
-// outpoint is still unspent.
-func (r *bchRegistry) findSpender(ctx context.Context, script, txid []byte, vout uint32) (*parsedTx, []byte, bool, error) {
+// by script, by scanning that address's history, and returns it with the block
+// it is in. Returns a nil tx if the outpoint is still unspent. A spend counts
+// once it is mined and proven: one still in the mempool has not moved the NFT
+// yet, and nothing proves it exists.
+func (r *bchRegistry) findSpender(ctx context.Context, script, txid []byte, vout uint32) (*parsedTx, []byte, *registry.Inclusion, error) {
 	history, err := r.client.GetHistory(ctx, scriptHash(script))
 	if err != nil {
-		return nil, nil, false, err
+		return nil, nil, nil, err
 	}
 	scan, truncated := newestHistory(history, "custody hop")
 	for _, h := range scan {
 		raw, err := r.client.GetRawTransaction(ctx, h.TxHash)
 		if err != nil {
-			return nil, nil, false, err
+			return nil, nil, nil, err
 		}
 		tx, err := parseTx(raw)
 		if err != nil {
 			continue
 		}
-		for _, in := range tx.Inputs {
-			if in.PrevIndex == vout && bytesEqual(in.PrevTxID, txid) {
-				return tx, raw, true, nil
+		if spends(tx, txid, vout) {
+			if h.Height <= 0 {
+				return nil, nil, nil, nil
+			}
+			block, err := r.headers.VerifyTx(ctx, raw, h.TxHash, h.Height)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("custody hop: %w", err)
 			}
+			return tx, raw, block, nil
 		}
 	}
 	if truncated {
-		// found=false means "this outpoint is unspent", which stops the custody
+		// A nil tx means "this outpoint is unspent", which stops the custody
 		// walk and freezes the answer at the current holder. Saying that from a
 		// partial scan would keep resolving a transferred name to its previous
 		// owner, so fail the lookup instead.
-		return nil, nil, false, fmt.Errorf("custody hop: %w", errHistoryTruncated)
+		return nil, nil, nil, fmt.Errorf("custody hop: %w", errHistoryTruncated)
 	}
-	return nil, nil, false, nil
+	return nil, nil, nil, nil
 }
 
 // parseFNMetadata extracts the FN tag and revealed pubkey from a tx's
@@ -457,7 +509,7 @@ func oldestHistory(history []electrumHistoryItem, what string) ([]electrumHistor
 	if len(history) <= maxHistoryScan {
 		return history, false
 	}
-	log.Printf("registry: %s has %d history entries, scanning the oldest %d", what, len(history), maxHistoryScan)
+	logger.Warn("history too long, scanning the oldest entries", "of", what, "entries", len(history), "scanned", maxHistoryScan)
 	return history[:maxHistoryScan], true
 }
 
@@ -469,7 +521,7 @@ func oldestHistory(history []electrumHistoryItem, what string) ([]electrumHistor
 func newestHistory(history []electrumHistoryItem, what string) ([]electrumHistoryItem, bool) {
 	truncated := len(history) > maxHistoryScan
 	if truncated {
-		log.Printf("registry: %s has %d history entries, scanning the newest %d", what, len(history), maxHistoryScan)
+		logger.Warn("history too long, scanning the newest entries", "of", what, "entries", len(history), "scanned", maxHistoryScan)
 		history = history[len(history)-maxHistoryScan:]
 	}
 	out := make([]electrumHistoryItem, len(history))
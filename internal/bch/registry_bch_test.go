@@ -2,25 +2,41 @@ package bch
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net"
+	"sync"
 	"testing"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
 )
 
 // mockElectrum is an in-process Electrum server backed by a fixed set of raw
-// transactions. It answers the exact methods the registry uses.
+// transactions. It answers the exact methods the registry uses. On the first
+// header request it mines a chain (under regtestParams) whose blocks hold the
+// transactions added at their heights, reaching mockConfirmations past the
+// highest one, so what the mock says can be proven.
 type mockElectrum struct {
 	ln      net.Listener
 	txByID  map[string][]byte                // txid hex (display) -> raw bytes
 	history map[string][]electrumHistoryItem // scripthash -> history
 	unspent map[string][]electrumUTXO        // scripthash -> utxos
+	blocks  map[int64][]string               // height -> txids added there
+
+	chainOnce sync.Once
+	headers   []*blockHeader
 }
 
+// mockConfirmations is how many blocks the mock's chain extends past the
+// highest transaction in it.
+const mockConfirmations = 6
+
 func newMockElectrum(t *testing.T) *mockElectrum {
 	t.Helper()
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
@@ -32,6 +48,7 @@ func newMockElectrum(t *testing.T) *mockElectrum {
 		txByID:  map[string][]byte{},
 		history: map[string][]electrumHistoryItem{},
 		unspent: map[string][]electrumUTXO{},
+		blocks:  map[int64][]string{},
 	}
 	go m.serve()
 	t.Cleanup(func() { ln.Close() })
@@ -41,10 +58,35 @@ func newMockElectrum(t *testing.T) *mockElectrum {
 // endpoint returns a tcp:// electrum endpoint for the mock.
 func (m *mockElectrum) endpoint() string { return "tcp://" + m.ln.Addr().String() }
 
+// registry returns a BCH registry reading the mock through c.
+func (m *mockElectrum) registry(c *ElectrumClient, minConf int64) *bchRegistry {
+	return NewBCHRegistry(c, newHeaderChain(c, regtestParams, nil), minConf)
+}
+
+// chain mines the mock's chain once its transactions are all added.
+func (m *mockElectrum) chain() []*blockHeader {
+	m.chainOnce.Do(func() {
+		var top int64
+		for _, history := range m.history {
+			for _, h := range history {
+				top = max(top, h.Height)
+			}
+		}
+		m.headers = []*blockHeader{mineHeader(nil, 0, nil)}
+		for height := int64(1); height <= top+mockConfirmations; height++ {
+			m.headers = append(m.headers, mineHeader(m.headers[height-1], height, blockTxIDs(m.blocks[height])))
+		}
+	})
+	return m.headers
+}
+
 // addTx registers a raw tx and indexes it under the given scripts' histories.
 func (m *mockElectrum) addTx(raw []byte, height int64, scripts ...[]byte) string {
 	txidHex := hex.EncodeToString(reverseBytes(txID(raw)))
 	m.txByID[txidHex] = raw
+	if height > 0 {
+		m.blocks[height] = append(m.blocks[height], txidHex)
+	}
 	for _, s := range scripts {
 		sh := scriptHash(s)
 		m.history[sh] = append(m.history[sh], electrumHistoryItem{Height: height, TxHash: txidHex})
@@ -82,12 +124,19 @@ func (m *mockElectrum) handle(conn net.Conn) {
 }
 
 func (m *mockElectrum) dispatch(method string, params []any) any {
+	raw := make([]json.RawMessage, len(params))
+	for i, p := range params {
+		raw[i], _ = json.Marshal(p)
+	}
+	if result, err, ok := serveHeaders(method, raw, m.chain(), func(h int64) []string { return m.blocks[h] }); ok {
+		if err != nil {
+			return nil
+		}
+		return result
+	}
 	switch method {
 	case "server.version":
 		return []string{"mock", "1.5.3"}
-	case "blockchain.headers.subscribe":
-		// A tip far above any test height so claims count as confirmed.
-		return map[string]any{"height": 1000000}
 	case "blockchain.scripthash.get_history":
 		sh, _ := params[0].(string)
 		if h, ok := m.history[sh]; ok {
@@ -171,7 +220,7 @@ func TestBCHRegistryResolvesClaim(t *testing.T) {
 
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	got, err := reg.ResolveOwner("mysite.fn")
 	if err != nil {
@@ -187,7 +236,7 @@ func TestBCHRegistryUnclaimedNotFound(t *testing.T) {
 	m := newMockElectrum(t)
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	if _, err := reg.ResolveOwner("ghost.fn"); err == nil {
 		t.Fatal("expected not-found for an unclaimed name")
@@ -216,7 +265,7 @@ func TestBCHRegistryEarliestClaimWins(t *testing.T) {
 
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	got, err := reg.ResolveOwner("prize.fn")
 	if err != nil {
@@ -241,7 +290,7 @@ func TestBCHRegistryIgnoresUnconfirmed(t *testing.T) {
 
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	if _, err := reg.ResolveOwner("pending.fn"); err == nil {
 		t.Fatal("expected an unconfirmed-only claim to be not-found")
@@ -297,7 +346,7 @@ func TestBCHRegistryRejectsMetadataHijack(t *testing.T) {
 
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	got, err := reg.ResolveOwner("target.fn")
 	if err != nil {
@@ -310,3 +359,189 @@ func TestBCHRegistryRejectsMetadataHijack(t *testing.T) {
 		t.Fatal("attacker pubkey was returned")
 	}
 }
+
+// transferNFT sends the name NFT of category from w to script as a plain wallet
+// transfer would: same commitment, no FN02 metadata.
+func transferNFT(t *testing.T, w *Wallet, category, script []byte) []byte {
+	t.Helper()
+	ctx := context.Background()
+	utxos, err := w.utxos(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nft, ok := findNFT(utxos, category)
+	if !ok {
+		t.Fatal("wallet does not hold the NFT")
+	}
+	funding, total, err := selectFunding(utxos, estimateFee(2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, privs := w.newTx(append([]walletUTXO{nft}, funding...))
+	tx.Outputs = []txOutput{
+		{Value: nft.value, Script: script, Token: nft.token},
+		{Value: total - estimateFee(len(tx.Inputs), 2), Script: w.script()},
+	}
+	raw, err := tx.Serialize(privs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// TestBCHRegistryClaimTransferAdopt runs a name's life on the simulated chain
+// with the real wallet: claim, resolve once mined, transfer the NFT to another
+// wallet (the owner key stays until adopted), then adopt it to a new key.
+func TestBCHRegistryClaimTransferAdopt(t *testing.T) {
+	chain := newRegtest(t)
+	client := chain.client()
+	ctx := context.Background()
+	alice, bob := chain.wallet(client), chain.wallet(client)
+	chain.fund(alice.script(), 100000)
+	chain.fund(bob.script(), 100000)
+	chain.mine(1)
+	alicePub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	bobPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	reg := chain.registry(client, 1)
+	owner := func() []byte {
+		t.Helper()
+		pub, _, err := reg.ProveOwner(ctx, "mysite.fn")
+		if errors.Is(err, registry.ErrRegistryNotFound) {
+			return nil
+		}
+		if err != nil {
+			t.Fatalf("ProveOwner: %v", err)
+		}
+		return pub
+	}
+
+	claim, err := alice.BuildClaimTx(ctx, "mysite", alicePub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Broadcast(ctx, claim); err != nil {
+		t.Fatalf("broadcast claim: %v", err)
+	}
+	if got := owner(); got != nil {
+		t.Fatal("an unconfirmed claim resolved")
+	}
+	chain.mine(1)
+	if got := owner(); !bytes.Equal(got, alicePub) {
+		t.Fatal("the mined claim does not resolve to its owner key")
+	}
+	if _, nfts, _ := alice.Holdings(ctx); nfts != 1 {
+		t.Fatalf("alice holds %d name NFTs, want 1", nfts)
+	}
+
+	category, err := reg.CategoryFor(ctx, "mysite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.broadcast(transferNFT(t, alice, category, bob.script()))
+	chain.mine(1)
+	if got := owner(); !bytes.Equal(got, alicePub) {
+		t.Fatal("a plain transfer changed the owner key")
+	}
+	if _, err := alice.BuildRebindTx(ctx, "mysite", category, alicePub); err == nil {
+		t.Fatal("the old holder could still rebind")
+	}
+
+	rebind, err := bob.BuildRebindTx(ctx, "mysite", category, bobPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Broadcast(ctx, rebind); err != nil {
+		t.Fatalf("broadcast rebind: %v", err)
+	}
+	chain.mine(1)
+	if got := owner(); !bytes.Equal(got, bobPub) {
+		t.Fatal("the adopted name does not resolve to the new key")
+	}
+	if _, nfts, _ := bob.Holdings(ctx); nfts != 1 {
+		t.Fatalf("bob holds %d name NFTs, want 1", nfts)
+	}
+}
+
+// TestBCHRegistryFollowsReorg checks resolution follows the chain through
+// reorgs: a claim that is reorged out stops resolving, a competing claim mined
+// instead wins, and a rebind reorged out hands the name back.
+func TestBCHRegistryFollowsReorg(t *testing.T) {
+	chain := newRegtest(t)
+	client := chain.client()
+	ctx := context.Background()
+	alice, carol := chain.wallet(client), chain.wallet(client)
+	chain.fund(alice.script(), 100000)
+	chain.fund(carol.script(), 100000)
+	chain.mine(1)
+	alicePub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	carolPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	reg := chain.registry(client, 2)
+	owner := func() []byte {
+		t.Helper()
+		pub, _, err := reg.ProveOwner(ctx, "contested.fn")
+		if errors.Is(err, registry.ErrRegistryNotFound) {
+			return nil
+		}
+		if err != nil {
+			t.Fatalf("ProveOwner: %v", err)
+		}
+		return pub
+	}
+	claim := func(w *Wallet, pub []byte) string {
+		t.Helper()
+		raw, err := w.BuildClaimTx(ctx, "contested", pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chain.broadcast(raw)
+	}
+
+	aliceClaim := claim(alice, alicePub)
+	chain.mine(1)
+	if owner() != nil {
+		t.Fatal("resolved with one confirmation, want two")
+	}
+	chain.mine(1)
+	if got := owner(); !bytes.Equal(got, alicePub) {
+		t.Fatal("alice's claim does not resolve")
+	}
+
+	// The blocks holding alice's claim are replaced by a chain where carol's
+	// claim confirms instead.
+	chain.reorg(2)
+	if owner() != nil {
+		t.Fatal("a reorged-out claim still resolves")
+	}
+	chain.drop(aliceClaim)
+	claim(carol, carolPub)
+	chain.mine(2)
+	if got := owner(); !bytes.Equal(got, carolPub) {
+		t.Fatal("the claim that won the reorg does not resolve")
+	}
+
+	// Carol adopts the name to alice's key; the rebind is reorged out and
+	// never mined again.
+	category, err := reg.CategoryFor(ctx, "contested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := carol.BuildRebindTx(ctx, "contested", category, alicePub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebind := chain.broadcast(raw)
+	chain.mine(2)
+	if got := owner(); !bytes.Equal(got, alicePub) {
+		t.Fatal("the rebind did not take")
+	}
+	before := chain.tip()
+	chain.reorg(2)
+	chain.drop(rebind)
+	chain.mine(2)
+	if chain.tip() != before {
+		t.Fatalf("tip %d after the reorg, want %d", chain.tip(), before)
+	}
+	if got := owner(); !bytes.Equal(got, carolPub) {
+		t.Fatal("a reorged-out rebind still decides the owner")
+	}
+}
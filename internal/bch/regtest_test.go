@@ -0,0 +1,658 @@
+package bch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// regtest is a simulated Bitcoin Cash chain behind a local Electrum server, for
+// testing whole flows offline: the wallet builds and broadcasts real signed
+// transactions, the chain checks them as a node would (outpoints, signatures,
+// fees, CashTokens rules), and the test mines blocks, reorgs the tip and drops
+// transactions when it wants to. Where mockElectrum serves a fixed answer,
+// regtest derives every answer (history, UTXOs, tip) from the chain. Its blocks
+// have real headers under regtestParams, so SPV checks pass on it.
+type regtest struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu      sync.Mutex
+	headers []*blockHeader    // by height; headers[0] is the empty genesis block
+	blocks  [][]string        // txids (display hex) mined at height i+1
+	mempool []string          // unconfirmed txids, in arrival order
+	txs     map[string][]byte // every transaction ever seen, by display txid
+	faucets uint32            // keeps faucet transactions distinct
+}
+
+// regtestRelayFee is the relay fee the server reports, in BCH/kB: 1 sat/byte.
+const regtestRelayFee = 0.00001
+
+func newRegtest(t *testing.T) *regtest {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	r := &regtest{t: t, ln: ln, txs: map[string][]byte{}, headers: []*blockHeader{mineHeader(nil, 0, nil)}}
+	go r.serve()
+	t.Cleanup(func() { ln.Close() })
+	return r
+}
+
+// endpoint returns a tcp:// electrum endpoint for the chain.
+func (r *regtest) endpoint() string { return "tcp://" + r.ln.Addr().String() }
+
+// client returns an electrum client connected to the chain, closed when the
+// test ends.
+func (r *regtest) client() *ElectrumClient {
+	c := NewElectrumClient(r.endpoint())
+	r.t.Cleanup(c.Close)
+	return c
+}
+
+// registry returns a BCH registry reading the chain through c, checking it
+// with a header chain that starts from genesis.
+func (r *regtest) registry(c *ElectrumClient, minConf int64) *bchRegistry {
+	return NewBCHRegistry(c, newHeaderChain(c, regtestParams, nil), minConf)
+}
+
+// wallet returns a wallet with a fresh key, talking to the chain through c.
+func (r *regtest) wallet(c *ElectrumClient) *Wallet {
+	r.t.Helper()
+	priv, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	pkh := hash160(priv.PubKey().SerializeCompressed())
+	return &Wallet{priv: priv, pkh: pkh, network: "chipnet", client: c}
+}
+
+// fund pays value to script from a faucet: a transaction with no inputs,
+// standing in for a coinbase. Its output is at index 0, so it can fund a claim.
+// It waits in the mempool like any other transaction until the next block.
+func (r *regtest) fund(script []byte, value int64) string {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faucets++
+	tx := &transaction{Version: 2, LockTime: r.faucets, Outputs: []txOutput{{Value: value, Script: script}}}
+	raw, err := tx.Serialize(nil)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	id := displayTxID(raw)
+	r.txs[id] = raw
+	r.mempool = append(r.mempool, id)
+	return id
+}
+
+// broadcast submits raw as a client would, failing the test if the chain
+// rejects it.
+func (r *regtest) broadcast(raw []byte) string {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, err := r.acceptLocked(raw)
+	if err != nil {
+		r.t.Fatalf("broadcast: %v", err)
+	}
+	return id
+}
+
+// mine mines n blocks; the first takes the whole mempool.
+func (r *regtest) mine(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for range n {
+		r.blocks = append(r.blocks, r.mempool)
+		r.headers = append(r.headers, mineHeader(r.headers[len(r.headers)-1], int64(len(r.blocks)), blockTxIDs(r.mempool)))
+		r.mempool = nil
+	}
+}
+
+// tip returns the height of the last block.
+func (r *regtest) tip() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.blocks))
+}
+
+// reorg disconnects the top depth blocks. Their transactions go back to the
+// mempool ahead of those already waiting, as a node re-queues them, so the
+// next block mines them again unless the test drops them first.
+func (r *regtest) reorg(depth int) {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if depth > len(r.blocks) {
+		r.t.Fatalf("reorg %d blocks of %d", depth, len(r.blocks))
+	}
+	var requeued []string
+	for _, block := range r.blocks[len(r.blocks)-depth:] {
+		requeued = append(requeued, block...)
+	}
+	r.blocks = r.blocks[:len(r.blocks)-depth]
+	r.headers = r.headers[:len(r.blocks)+1]
+	r.mempool = append(requeued, r.mempool...)
+}
+
+// drop removes an unconfirmed transaction and everything in the mempool that
+// spends from it, as if a conflicting transaction had won: after a reorg, this
+// is how a test makes the other side of a double spend confirm.
+func (r *regtest) drop(txid string) {
+	r.t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Contains(r.mempool, txid) {
+		r.t.Fatalf("drop %s: not in the mempool", txid)
+	}
+	gone := map[string]bool{txid: true}
+	kept := r.mempool[:0]
+	for _, id := range r.mempool {
+		tx, _ := parseTx(r.txs[id])
+		for _, in := range tx.Inputs {
+			if gone[hex.EncodeToString(reverseBytes(in.PrevTxID))] {
+				gone[id] = true
+			}
+		}
+		if !gone[id] {
+			kept = append(kept, id)
+		}
+	}
+	r.mempool = kept
+}
+
+// regtestOutpoint names an output by display txid and index.
+type regtestOutpoint struct {
+	txid string
+	vout uint32
+}
+
+// regtestCoin is an unspent output and the height of the transaction that
+// made it (0 while unconfirmed).
+type regtestCoin struct {
+	out    parsedOutput
+	height int64
+}
+
+// regtestView is the chain state: confirmed blocks then the mempool.
+type regtestView struct {
+	coins   map[regtestOutpoint]regtestCoin
+	history map[string][]electrumHistoryItem // by scripthash
+}
+
+// viewLocked replays the chain and the mempool. Callers must hold r.mu.
+func (r *regtest) viewLocked() *regtestView {
+	v := &regtestView{coins: map[regtestOutpoint]regtestCoin{}, history: map[string][]electrumHistoryItem{}}
+	unconfirmed := map[string]bool{}
+	apply := func(id string, height int64) {
+		tx, _ := parseTx(r.txs[id])
+		touched := map[string]bool{}
+		for _, in := range tx.Inputs {
+			op := regtestOutpoint{hex.EncodeToString(reverseBytes(in.PrevTxID)), in.PrevIndex}
+			if unconfirmed[op.txid] {
+				height = -1 // Electrum's height for a transaction with unconfirmed parents
+			}
+			touched[scriptHash(v.coins[op].out.Script)] = true
+			delete(v.coins, op)
+		}
+		for i, o := range tx.Outputs {
+			v.coins[regtestOutpoint{id, uint32(i)}] = regtestCoin{out: o, height: max(height, 0)}
+			touched[scriptHash(o.Script)] = true
+		}
+		for sh := range touched {
+			v.history[sh] = append(v.history[sh], electrumHistoryItem{Height: height, TxHash: id})
+		}
+	}
+	for h, block := range r.blocks {
+		for _, id := range block {
+			apply(id, int64(h+1))
+		}
+	}
+	for _, id := range r.mempool {
+		apply(id, 0)
+		unconfirmed[id] = true
+	}
+	return v
+}
+
+// acceptLocked checks raw against the chain and the mempool and queues it.
+// Callers must hold r.mu.
+func (r *regtest) acceptLocked(raw []byte) (string, error) {
+	id := displayTxID(raw)
+	if _, ok := r.txs[id]; ok && (slices.Contains(r.mempool, id) || r.minedLocked(id)) {
+		return "", errors.New("transaction already known")
+	}
+	tx, unlocking, err := decodeSignedTx(raw)
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
+	}
+	if len(tx.Inputs) == 0 {
+		return "", errors.New("no inputs")
+	}
+
+	v := r.viewLocked()
+	var in, out int64
+	spent := map[regtestOutpoint]bool{}
+	for i := range tx.Inputs {
+		op := regtestOutpoint{hex.EncodeToString(reverseBytes(tx.Inputs[i].PrevTxID)), tx.Inputs[i].PrevIndex}
+		coin, ok := v.coins[op]
+		if !ok || spent[op] {
+			return "", fmt.Errorf("input %d: missing or spent outpoint %s:%d", i, op.txid, op.vout)
+		}
+		spent[op] = true
+		tx.Inputs[i].PrevScript = coin.out.Script
+		tx.Inputs[i].PrevValue = coin.out.Value
+		tx.Inputs[i].PrevToken = coin.out.Token
+		in += coin.out.Value
+	}
+	for i := range tx.Inputs {
+		if err := verifyP2PKH(tx, i, unlocking[i]); err != nil {
+			return "", fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	for _, o := range tx.Outputs {
+		out += o.Value
+	}
+	if in < out {
+		return "", fmt.Errorf("outputs %d sat exceed inputs %d sat", out, in)
+	}
+	if fee, min := in-out, int64(len(raw)); fee < min {
+		return "", fmt.Errorf("fee %d sat below the relay minimum %d", fee, min)
+	}
+	if err := checkTokens(tx); err != nil {
+		return "", err
+	}
+
+	r.txs[id] = raw
+	r.mempool = append(r.mempool, id)
+	return id, nil
+}
+
+func (r *regtest) minedLocked(id string) bool {
+	for _, block := range r.blocks {
+		if slices.Contains(block, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSignedTx decodes raw into the form it was signed in, with each input's
+// unlocking script. The fields describing what an input spends are left for
+// the caller to fill in from the chain.
+func decodeSignedTx(raw []byte) (*transaction, [][]byte, error) {
+	r := &byteReader{buf: raw}
+	version, err := r.readUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := &transaction{Version: int32(version)}
+	nIn, err := r.readVarInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlocking [][]byte
+	for range nIn {
+		var in txInput
+		if in.PrevTxID, err = r.readBytes(32); err != nil {
+			return nil, nil, err
+		}
+		if in.PrevIndex, err = r.readUint32(); err != nil {
+			return nil, nil, err
+		}
+		script, err := r.readVarBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		if in.Sequence, err = r.readUint32(); err != nil {
+			return nil, nil, err
+		}
+		tx.Inputs = append(tx.Inputs, in)
+		unlocking = append(unlocking, script)
+	}
+	nOut, err := r.readVarInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	for range nOut {
+		value, err := r.readInt64()
+		if err != nil {
+			return nil, nil, err
+		}
+		wrapped, err := r.readVarBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		token, script, err := splitTokenPrefix(wrapped)
+		if err != nil {
+			return nil, nil, err
+		}
+		tx.Outputs = append(tx.Outputs, txOutput{Value: value, Script: script, Token: token})
+	}
+	if tx.LockTime, err = r.readUint32(); err != nil {
+		return nil, nil, err
+	}
+	if r.pos != len(raw) {
+		return nil, nil, errors.New("trailing bytes")
+	}
+	return tx, unlocking, nil
+}
+
+// verifyP2PKH checks input i's unlocking script, <sig> <pubkey>, against the
+// P2PKH output it spends.
+func verifyP2PKH(tx *transaction, i int, unlocking []byte) error {
+	pkh := p2pkhHash(tx.Inputs[i].PrevScript)
+	if pkh == nil {
+		return errors.New("spends a non-P2PKH output")
+	}
+	pushes := parseOpReturn(append([]byte{opReturn}, unlocking...))
+	if len(pushes) != 2 || len(pushes[0]) == 0 {
+		return errors.New("unlocking script is not <sig> <pubkey>")
+	}
+	sigBytes, pubBytes := pushes[0], pushes[1]
+	if !bytes.Equal(hash160(pubBytes), pkh) {
+		return errors.New("pubkey does not match the output's hash")
+	}
+	hashType := sigBytes[len(sigBytes)-1]
+	if hashType != sigHashDefault {
+		return fmt.Errorf("unsupported sighash type 0x%x", hashType)
+	}
+	sig, err := ecdsa.ParseDERSignature(sigBytes[:len(sigBytes)-1])
+	if err != nil {
+		return err
+	}
+	pub, err := secp256k1.ParsePubKey(pubBytes)
+	if err != nil {
+		return err
+	}
+	if !sig.Verify(sha256d(tx.sigHashPreimage(i, uint32(hashType))), pub) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// checkTokens applies the CashTokens rules a node enforces on the tokens a
+// transaction spends and creates. A category is new (genesis) when an input
+// spends output 0 of the transaction whose id is the category; otherwise every
+// token output must come from the same category's inputs: a minting NFT may
+// create anything, a mutable NFT one NFT of any commitment, an immutable NFT
+// only itself, and fungible amounts are conserved.
+func checkTokens(tx *transaction) error {
+	genesis := map[string]bool{}
+	type spent struct {
+		immutable map[string]int // commitment -> count
+		mutable   int
+		minting   bool
+		amount    uint64
+	}
+	in := map[string]*spent{}
+	for _, i := range tx.Inputs {
+		if i.PrevIndex == 0 {
+			genesis[string(i.PrevTxID)] = true
+		}
+		t := i.PrevToken
+		if t == nil {
+			continue
+		}
+		s := in[string(t.CategoryID)]
+		if s == nil {
+			s = &spent{immutable: map[string]int{}}
+			in[string(t.CategoryID)] = s
+		}
+		s.amount += t.Amount
+		switch {
+		case t.Capability == tokenCapabilityMinting:
+			s.minting = true
+		case t.Capability == tokenCapabilityMutable:
+			s.mutable++
+		case len(t.Commitment) > 0:
+			s.immutable[string(t.Commitment)]++
+		}
+	}
+
+	created := map[string]uint64{}
+	for i, o := range tx.Outputs {
+		t := o.Token
+		if t == nil {
+			continue
+		}
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("output %d token: %w", i, err)
+		}
+		cat := string(t.CategoryID)
+		if genesis[cat] {
+			continue
+		}
+		s := in[cat]
+		if s == nil {
+			return fmt.Errorf("output %d: token category %x is neither spent nor created", i, reverseBytes(t.CategoryID))
+		}
+		created[cat] += t.Amount
+		hasNFT := t.Capability != tokenCapabilityNone || len(t.Commitment) > 0
+		switch {
+		case !hasNFT, s.minting:
+		case t.Capability == tokenCapabilityMinting:
+			return fmt.Errorf("output %d: minting NFT without a minting input", i)
+		case t.Capability == tokenCapabilityNone && s.immutable[string(t.Commitment)] > 0:
+			s.immutable[string(t.Commitment)]--
+		case s.mutable > 0:
+			s.mutable--
+		default:
+			return fmt.Errorf("output %d: NFT not backed by a spent NFT of its category", i)
+		}
+	}
+	for cat, amount := range created {
+		if !in[cat].minting && amount > in[cat].amount {
+			return fmt.Errorf("category %x: %d fungible tokens out, %d in", reverseBytes([]byte(cat)), amount, in[cat].amount)
+		}
+	}
+	return nil
+}
+
+// displayTxID is the txid of raw in display (reversed hex) order.
+func displayTxID(raw []byte) string { return hex.EncodeToString(reverseBytes(txID(raw))) }
+
+// --- electrum server ---
+
+func (r *regtest) serve() {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		go r.handle(conn)
+	}
+}
+
+func (r *regtest) handle(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 1<<20), 1<<20)
+	for sc.Scan() {
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			continue
+		}
+		msg := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if result, err := r.dispatch(req.Method, req.Params); err != nil {
+			msg["error"] = err
+		} else {
+			msg["result"] = result
+		}
+		resp, _ := json.Marshal(msg)
+		conn.Write(append(resp, '\n'))
+	}
+}
+
+// dispatch answers one Electrum Cash protocol call. Errors carry the codes
+// Fulcrum uses: 1 for a bad request or a rejected transaction, 2 for a
+// transaction it does not know, -32601 for a method it does not serve.
+func (r *regtest) dispatch(method string, params []json.RawMessage) (any, *electrumRPCError) {
+	str := func(i int) string {
+		var s string
+		if i < len(params) {
+			json.Unmarshal(params[i], &s)
+		}
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if result, err, ok := serveHeaders(method, params, r.headers, func(h int64) []string { return r.blocks[h-1] }); ok {
+		return result, err
+	}
+	switch method {
+	case "server.version":
+		return []string{"regtest", "1.5.3"}, nil
+	case "blockchain.relayfee":
+		return regtestRelayFee, nil
+	case "blockchain.scripthash.get_history":
+		history := r.viewLocked().history[str(0)]
+		if history == nil {
+			history = []electrumHistoryItem{}
+		}
+		return history, nil
+	case "blockchain.scripthash.listunspent":
+		v := r.viewLocked()
+		sh := str(0)
+		utxos := []electrumUTXO{}
+		for op, coin := range v.coins {
+			if scriptHash(coin.out.Script) != sh {
+				continue
+			}
+			utxos = append(utxos, electrumUTXO{
+				Height:    coin.height,
+				TxPos:     op.vout,
+				TxHash:    op.txid,
+				Value:     coin.out.Value,
+				TokenData: regtestTokenData(coin.out.Token),
+			})
+		}
+		slices.SortFunc(utxos, func(a, b electrumUTXO) int {
+			if a.Height != b.Height {
+				return int(a.Height - b.Height)
+			}
+			return int(a.TxPos) - int(b.TxPos)
+		})
+		return utxos, nil
+	case "blockchain.transaction.get":
+		raw, ok := r.txs[str(0)]
+		if !ok || !(slices.Contains(r.mempool, str(0)) || r.minedLocked(str(0))) {
+			return nil, &electrumRPCError{Code: 2, Message: "No such mempool or blockchain transaction"}
+		}
+		return hex.EncodeToString(raw), nil
+	case "blockchain.transaction.broadcast":
+		raw, err := hex.DecodeString(str(0))
+		if err != nil {
+			return nil, &electrumRPCError{Code: 1, Message: "bad transaction hex"}
+		}
+		id, err := r.acceptLocked(raw)
+		if err != nil {
+			return nil, &electrumRPCError{Code: 1, Message: "the transaction was rejected by network rules.\n\n" + err.Error()}
+		}
+		return id, nil
+	default:
+		return nil, &electrumRPCError{Code: -32601, Message: "unknown method " + method}
+	}
+}
+
+// regtestTokenData renders a token the way Fulcrum's listunspent does.
+func regtestTokenData(t *tokenInfo) *electrumTokenData {
+	if t == nil {
+		return nil
+	}
+	td := &electrumTokenData{
+		Category: hex.EncodeToString(reverseBytes(t.CategoryID)),
+		Amount:   strconv.FormatUint(t.Amount, 10),
+	}
+	if t.Capability != tokenCapabilityNone || len(t.Commitment) > 0 {
+		td.NFT = &struct {
+			Capability string `json:"capability"`
+			Commitment string `json:"commitment"`
+		}{Capability: map[byte]string{tokenCapabilityNone: "none", tokenCapabilityMutable: "mutable", tokenCapabilityMinting: "minting"}[t.Capability], Commitment: hex.EncodeToString(t.Commitment)}
+	}
+	return td
+}
+
+// --- tests of the simulator itself ---
+
+// TestRegtestRejects checks the chain turns away what a node would: double
+// spends, bad signatures, overspending and tokens out of thin air.
+func TestRegtestRejects(t *testing.T) {
+	chain := newRegtest(t)
+	client := chain.client()
+	w := chain.wallet(client)
+	chain.fund(w.script(), 100000)
+	chain.mine(1)
+	ctx := context.Background()
+	utxos, err := w.utxos(ctx)
+	if err != nil || len(utxos) != 1 {
+		t.Fatalf("utxos %+v, %v", utxos, err)
+	}
+
+	spend := func(mutate func(*transaction)) []byte {
+		tx, privs := w.newTx(utxos)
+		tx.Outputs = []txOutput{{Value: 90000, Script: w.script()}}
+		mutate(tx)
+		raw, err := tx.Serialize(privs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	other, _ := secp256k1.GeneratePrivateKey()
+	cases := map[string][]byte{
+		"overspend": spend(func(tx *transaction) { tx.Outputs[0].Value = 100001 }),
+		"no fee":    spend(func(tx *transaction) { tx.Outputs[0].Value = 100000 }),
+		"wrong key": func() []byte {
+			tx, _ := w.newTx(utxos)
+			tx.Outputs = []txOutput{{Value: 90000, Script: w.script()}}
+			raw, _ := tx.Serialize([]*secp256k1.PrivateKey{other})
+			return raw
+		}(),
+		"forged token": spend(func(tx *transaction) {
+			tx.Outputs[0].Token = &tokenInfo{CategoryID: bytes.Repeat([]byte{7}, 32), Capability: tokenCapabilityMutable}
+		}),
+	}
+	for name, raw := range cases {
+		if _, err := client.Broadcast(ctx, raw); !isElectrumRPCError(err) {
+			t.Errorf("%s: broadcast = %v, want a rejection", name, err)
+		}
+	}
+
+	// The genesis rule: a coin at index 0 may mint its own txid's category.
+	mint := spend(func(tx *transaction) {
+		tx.Outputs[0].Token = &tokenInfo{CategoryID: utxos[0].txid, Capability: tokenCapabilityMinting}
+	})
+	if _, err := client.Broadcast(ctx, mint); err != nil {
+		t.Fatalf("genesis: %v", err)
+	}
+	if _, err := client.Broadcast(ctx, spend(func(*transaction) {})); !isElectrumRPCError(err) {
+		t.Errorf("double spend: broadcast = %v, want a rejection", err)
+	}
+	chain.mine(1)
+	if _, nfts, err := w.Holdings(ctx); err != nil || nfts != 1 {
+		t.Errorf("holdings after genesis: %d NFTs, %v", nfts, err)
+	}
+	if _, err := client.GetRawTransaction(ctx, repeat("00", 32)); !isElectrumRPCError(err) {
+		t.Errorf("unknown tx: %v, want an rpc error", err)
+	}
+}
@@ -81,7 +81,7 @@ func TestTruncatedHistoryIsNotReportedAsUnclaimed(t *testing.T) {
 
 	client := NewElectrumClient(m.endpoint())
 	defer client.Close()
-	reg := NewBCHRegistry(client, 1)
+	reg := m.registry(client, 1)
 
 	_, err := reg.ResolveOwner("padded.fn")
 	if err == nil {
@@ -0,0 +1,554 @@
+package bch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+)
+
+// This file makes the registry's view of the chain independent of the Electrum
+// server it reads it from (SPV: simplified payment verification). The server
+// still chooses what to show, but no longer what is true: every header it
+// sends is checked for proof-of-work at the difficulty ASERT demands, the chain
+// must build on a checkpoint, and each transaction the registry acts on must
+// come with a Merkle proof into one of those headers. Faking a claim then
+// means mining a block at the real network's difficulty.
+//
+// What SPV cannot do is make a server show everything: it can still withhold a
+// transaction (a claim, a transfer) from a history. Failover to another server
+// is the answer to that, not this file.
+
+// errUnverifiedChain marks chain data from the server that failed
+// verification. Like errHistoryTruncated it is never a definitive not-found,
+// so a lying server cannot get a name negative-cached.
+var errUnverifiedChain = errors.New("chain data failed verification")
+
+const (
+	blockHeaderSize    = 80
+	targetSpacing      = 600      // ideal seconds between blocks
+	maxFutureBlockTime = 2 * 3600 // how far ahead of our clock a header may be
+	medianTimeSpan     = 11       // blocks in the median-time-past
+	maxHeadersPerCall  = 2016     // the most headers an Electrum server returns at once
+
+	// tofuDepth is how far below the tip a chain without a checkpoint starts:
+	// one week of blocks, so the starting header is as buried as any claim a
+	// lookup is likely to trust.
+	tofuDepth = 1008
+	// reorgWindow is how many headers below the tip a sync first re-reads to
+	// find where the server's chain and ours meet. It doubles until they do.
+	reorgWindow = 10
+)
+
+// chainParams are the consensus rules a header chain is checked against.
+type chainParams struct {
+	name     string
+	powLimit *big.Int // the easiest target a block may have
+
+	// The ASERT (aserti3-2d) anchor: every block above anchorHeight has the
+	// target computed from the anchor's bits and its parent's timestamp.
+	anchorHeight     int64
+	anchorBits       uint32
+	anchorParentTime int64
+	halfLife         int64 // seconds ahead of schedule that double the target
+
+	// minDifficultyBlocks is the testnet rule letting a block mined more than
+	// 20 minutes after its parent use powLimit.
+	minDifficultyBlocks bool
+
+	// checkpoint is where a chain starts when none is configured; nil leaves
+	// such a chain to trust on first use.
+	checkpoint *checkpoint
+}
+
+// bchPowLimit is 2^224 - 1, the easiest target on every public BCH network.
+var bchPowLimit = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 224), big.NewInt(1))
+
+// bchNetworks are the parameters of the networks config.BCHNetwork names.
+// Mainnet's built-in checkpoint is the ASERT anchor block itself; the test
+// networks have none.
+var bchNetworks = map[string]*chainParams{
+	"mainnet": {name: "mainnet", powLimit: bchPowLimit, anchorHeight: 661647, anchorBits: 0x1804dafe, anchorParentTime: 1605447844, halfLife: 2 * 24 * 3600,
+		checkpoint: mustCheckpoint("661647:00000000000000000083ed4b7a780d59e3983513215518ad75654bb02deee62f")},
+	"testnet3": {name: "testnet3", powLimit: bchPowLimit, anchorHeight: 1421481, anchorBits: 0x1d00ffff, anchorParentTime: 1605445400, halfLife: 3600,
+		minDifficultyBlocks: true},
+	"testnet4": {name: "testnet4", powLimit: bchPowLimit, anchorHeight: 16844, anchorBits: 0x1d00ffff, anchorParentTime: 1605451779, halfLife: 3600,
+		minDifficultyBlocks: true},
+	"chipnet": {name: "chipnet", powLimit: bchPowLimit, anchorHeight: 16844, anchorBits: 0x1d00ffff, anchorParentTime: 1605451779, halfLife: 3600,
+		minDifficultyBlocks: true},
+}
+
+// compactToTarget expands a header's compact "bits" into its target, and
+// reports whether the encoding is valid (not negative, not overflowing).
+func compactToTarget(bits uint32) (*big.Int, bool) {
+	size := bits >> 24
+	word := bits & 0x007fffff
+	target := new(big.Int)
+	if size <= 3 {
+		target.SetUint64(uint64(word >> (8 * (3 - size))))
+	} else {
+		target.SetUint64(uint64(word))
+		target.Lsh(target, uint(8*(size-3)))
+	}
+	negative := word != 0 && bits&0x00800000 != 0
+	overflow := word != 0 && (size > 34 || (word > 0xff && size > 33) || (word > 0xffff && size > 32))
+	return target, !negative && !overflow
+}
+
+// targetToCompact is the inverse of compactToTarget, rounding down as nodes do.
+func targetToCompact(target *big.Int) uint32 {
+	size := uint32((target.BitLen() + 7) / 8)
+	var compact uint32
+	if size <= 3 {
+		compact = uint32(target.Uint64() << (8 * (3 - size)))
+	} else {
+		compact = uint32(new(big.Int).Rsh(target, uint(8*(size-3))).Uint64())
+	}
+	if compact&0x00800000 != 0 {
+		compact >>= 8
+		size++
+	}
+	return compact | size<<24
+}
+
+// asertTarget computes the aserti3-2d target for the block after parent, in
+// the same fixed-point arithmetic as the reference implementation, so the
+// bits it yields match a node's bit for bit.
+func (p *chainParams) asertTarget(parentHeight, parentTime int64) *big.Int {
+	anchorTarget, _ := compactToTarget(p.anchorBits)
+	timeDiff := parentTime - p.anchorParentTime
+	heightDiff := parentHeight - p.anchorHeight
+	// Go's / truncates toward zero like C++'s; >> floors like the reference.
+	exponent := ((timeDiff - targetSpacing*(heightDiff+1)) * 65536) / p.halfLife
+	shifts := exponent >> 16
+	frac := uint64(uint16(exponent))
+	factor := 65536 + ((195766423245049*frac + 971821376*frac*frac + 5127*frac*frac*frac + 1<<47) >> 48)
+
+	next := new(big.Int).Mul(anchorTarget, new(big.Int).SetUint64(factor))
+	shifts -= 16
+	switch {
+	case shifts <= 0:
+		next.Rsh(next, uint(-shifts))
+	case shifts > 256:
+		return new(big.Int).Set(p.powLimit)
+	default:
+		next.Lsh(next, uint(shifts))
+	}
+	if next.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	if next.Cmp(p.powLimit) > 0 {
+		return new(big.Int).Set(p.powLimit)
+	}
+	return next
+}
+
+// nextBits returns the bits a block mined at time on top of parent must carry.
+func (p *chainParams) nextBits(parent *blockHeader, parentHeight, time int64) uint32 {
+	if p.minDifficultyBlocks && time > parent.time+2*targetSpacing {
+		return targetToCompact(p.powLimit)
+	}
+	return targetToCompact(p.asertTarget(parentHeight, parent.time))
+}
+
+// blockHeader is a parsed 80-byte block header. Hashes are in internal order.
+type blockHeader struct {
+	raw        []byte
+	hash       []byte
+	prevHash   []byte
+	merkleRoot []byte
+	time       int64
+	bits       uint32
+	work       *big.Int // chain work up to and including this block, counted from the HeaderChain's start
+}
+
+func parseHeader(raw []byte) (*blockHeader, error) {
+	if len(raw) != blockHeaderSize {
+		return nil, fmt.Errorf("block header is %d bytes, want %d", len(raw), blockHeaderSize)
+	}
+	return &blockHeader{
+		raw:        raw,
+		hash:       sha256d(raw),
+		prevHash:   raw[4:36],
+		merkleRoot: raw[36:68],
+		time:       int64(binary.LittleEndian.Uint32(raw[68:72])),
+		bits:       binary.LittleEndian.Uint32(raw[72:76]),
+	}, nil
+}
+
+// displayHash is the header's hash as block explorers show it.
+func (h *blockHeader) displayHash() string { return hex.EncodeToString(reverseBytes(h.hash)) }
+
+// blockWork is the expected number of hashes it took to mine h:
+// 2^256 / (target+1). A header with invalid bits counts for nothing.
+func blockWork(h *blockHeader) *big.Int {
+	target, ok := compactToTarget(h.bits)
+	if !ok || target.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), target.Add(target, big.NewInt(1)))
+}
+
+// checkHeader checks h, the header at height, against the verified headers
+// before it: prev ends with its parent and holds up to medianTimeSpan of them.
+func (p *chainParams) checkHeader(h *blockHeader, height int64, prev []*blockHeader, now time.Time) error {
+	parent := prev[len(prev)-1]
+	if !bytes.Equal(h.prevHash, parent.hash) {
+		return fmt.Errorf("block %d does not build on block %d", height, height-1)
+	}
+	if height <= p.anchorHeight {
+		return fmt.Errorf("block %d is below the ASERT anchor %d", height, p.anchorHeight)
+	}
+	if want := p.nextBits(parent, height-1, h.time); h.bits != want {
+		return fmt.Errorf("block %d has bits %08x, want %08x", height, h.bits, want)
+	}
+	target, ok := compactToTarget(h.bits)
+	if !ok || target.Sign() <= 0 || target.Cmp(p.powLimit) > 0 {
+		return fmt.Errorf("block %d has invalid bits %08x", height, h.bits)
+	}
+	if new(big.Int).SetBytes(reverseBytes(h.hash)).Cmp(target) > 0 {
+		return fmt.Errorf("block %d has insufficient proof of work", height)
+	}
+	if len(prev) >= medianTimeSpan {
+		times := make([]int64, 0, medianTimeSpan)
+		for _, b := range prev[len(prev)-medianTimeSpan:] {
+			times = append(times, b.time)
+		}
+		slices.Sort(times)
+		if median := times[medianTimeSpan/2]; h.time <= median {
+			return fmt.Errorf("block %d is timestamped %d, not after the median time past %d", height, h.time, median)
+		}
+	}
+	if h.time > now.Unix()+maxFutureBlockTime {
+		return fmt.Errorf("block %d is timestamped %d, too far in the future", height, h.time)
+	}
+	return nil
+}
+
+// checkpoint is a block trusted by configuration rather than by work.
+type checkpoint struct {
+	height int64
+	hash   []byte // internal order
+}
+
+// parseCheckpoint reads a checkpoint written "height:hash", with the hash in
+// display order as block explorers show it.
+func parseCheckpoint(s string) (*checkpoint, error) {
+	heightStr, hashHex, ok := strings.Cut(s, ":")
+	height, err := strconv.ParseInt(heightStr, 10, 64)
+	if !ok || err != nil || height < 0 {
+		return nil, fmt.Errorf("checkpoint %q: want height:hash", s)
+	}
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("checkpoint %q: hash must be 64 hex digits", s)
+	}
+	return &checkpoint{height: height, hash: reverseBytes(hash)}, nil
+}
+
+func mustCheckpoint(s string) *checkpoint {
+	cp, err := parseCheckpoint(s)
+	if err != nil {
+		panic(err)
+	}
+	return cp
+}
+
+// TrustOnFirstUse is the checkpoint setting that starts a header chain from
+// the server's block tofuDepth below its tip, even on a network with a
+// built-in checkpoint.
+const TrustOnFirstUse = "tofu"
+
+// HeaderChain is a verified, contiguous run of block headers, kept up to date
+// with an Electrum server's tip. Headers above the starting block are checked
+// for work and difficulty; headers below it, fetched when an older block is
+// asked for, are checked by hash links down from it.
+//
+// The starting block is the configured checkpoint, or else the network's
+// built-in one. Without either, it is the server's block tofuDepth below the
+// tip at the first sync: trust on first use, which still makes every later
+// block cost real work, but lets the first server pick which chain that is.
+// A chain from the built-in checkpoint checks every header since, which on
+// mainnet is a few hundred thousand of them on the first sync.
+type HeaderChain struct {
+	client     *ElectrumClient
+	params     *chainParams
+	checkpoint *checkpoint
+	now        func() time.Time
+
+	mu      sync.Mutex // guards base/headers; held across fetches so syncs do not race
+	base    int64      // height of headers[0]
+	headers []*blockHeader
+}
+
+// NewHeaderChain builds a header chain for network ("mainnet", "chipnet", …)
+// over client. checkpoint is "height:hash", TrustOnFirstUse, or empty for the
+// network's built-in checkpoint (trust on first use where it has none); a
+// checkpoint must be at or above the network's ASERT anchor, the first block
+// this package can check the difficulty of.
+func NewHeaderChain(client *ElectrumClient, network, checkpoint string) (*HeaderChain, error) {
+	params, ok := bchNetworks[network]
+	if !ok {
+		return nil, fmt.Errorf("unknown BCH network %q", network)
+	}
+	switch checkpoint {
+	case "":
+		return newHeaderChain(client, params, params.checkpoint), nil
+	case TrustOnFirstUse:
+		return newHeaderChain(client, params, nil), nil
+	}
+	cp, err := parseCheckpoint(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cp.height < params.anchorHeight {
+		return nil, fmt.Errorf("checkpoint height %d is below %s's ASERT anchor %d", cp.height, network, params.anchorHeight)
+	}
+	return newHeaderChain(client, params, cp), nil
+}
+
+func newHeaderChain(client *ElectrumClient, params *chainParams, cp *checkpoint) *HeaderChain {
+	return &HeaderChain{client: client, params: params, checkpoint: cp, now: time.Now}
+}
+
+// Tip syncs the chain with the server and returns the verified tip height.
+func (c *HeaderChain) Tip(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncLocked(ctx)
+}
+
+func (c *HeaderChain) tipLocked() int64 { return c.base + int64(len(c.headers)) - 1 }
+
+// syncLocked follows the server to its tip: it re-reads a window of headers
+// below the lower of the two tips, widening it until the server's headers
+// build on ours, and checks every header above that point. The server's
+// chain replaces ours only if it has at least as much work; one with less is
+// refused, so a server cannot roll confirmed blocks back by showing a shorter
+// branch. A server that is merely behind, on our chain, leaves it as it is.
+// Callers must hold c.mu.
+func (c *HeaderChain) syncLocked(ctx context.Context) (int64, error) {
+	height, raw, err := c.client.TipHeader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if c.headers == nil {
+		if err := c.startLocked(ctx, height); err != nil {
+			return 0, err
+		}
+	}
+	if height == c.tipLocked() && bytes.Equal(raw, c.headers[len(c.headers)-1].raw) {
+		return height, nil
+	}
+	if height < c.base {
+		return 0, fmt.Errorf("%w: server tip %d is below the chain's start %d", errUnverifiedChain, height, c.base)
+	}
+	if height < c.tipLocked() && bytes.Equal(raw, c.headers[height-c.base].raw) {
+		return c.tipLocked(), nil
+	}
+	for back := int64(reorgWindow); ; back *= 2 {
+		from := max(min(c.tipLocked(), height)-back, c.base) + 1
+		fetched, err := c.fetchLocked(ctx, from, height)
+		if err != nil {
+			return 0, err
+		}
+		chain := slices.Clip(c.headers[:from-c.base])
+		if len(fetched) > 0 && !bytes.Equal(fetched[0].prevHash, chain[len(chain)-1].hash) {
+			if from == c.base+1 {
+				return 0, fmt.Errorf("%w: the server's chain does not build on block %d %s", errUnverifiedChain, c.base, c.headers[0].displayHash())
+			}
+			continue
+		}
+		for i, h := range fetched {
+			if err := c.params.checkHeader(h, from+int64(i), chain[max(0, len(chain)-medianTimeSpan):], c.now()); err != nil {
+				return 0, fmt.Errorf("%w: %v", errUnverifiedChain, err)
+			}
+			h.work = new(big.Int).Add(chain[len(chain)-1].work, blockWork(h))
+			chain = append(chain, h)
+		}
+		ours, theirs := c.headers[len(c.headers)-1], chain[len(chain)-1]
+		if theirs.work.Cmp(ours.work) < 0 {
+			return 0, fmt.Errorf("%w: the server's chain to block %d %s has less work than ours to block %d %s", errUnverifiedChain,
+				height, theirs.displayHash(), c.tipLocked(), ours.displayHash())
+		}
+		c.headers = chain
+		return c.tipLocked(), nil
+	}
+}
+
+// startLocked fetches the block the chain starts from. Callers must hold c.mu.
+func (c *HeaderChain) startLocked(ctx context.Context, tip int64) error {
+	height := max(tip-tofuDepth, c.params.anchorHeight)
+	if c.checkpoint != nil {
+		height = c.checkpoint.height
+	}
+	if height > tip {
+		return fmt.Errorf("%w: server tip %d is below the checkpoint %d", errUnverifiedChain, tip, height)
+	}
+	fetched, err := c.fetchLocked(ctx, height, height)
+	if err != nil {
+		return err
+	}
+	start := fetched[0]
+	start.work = blockWork(start)
+	if c.checkpoint == nil {
+		logger.Warn("no BCH checkpoint configured: trusting the server's block as the start of the chain; pin one with FREEDOM_BCH_CHECKPOINT",
+			"network", c.params.name, "height", height, "hash", start.displayHash())
+	} else if !bytes.Equal(start.hash, c.checkpoint.hash) {
+		return fmt.Errorf("%w: the server's block %d is %s, not the checkpoint %s", errUnverifiedChain,
+			height, start.displayHash(), hex.EncodeToString(reverseBytes(c.checkpoint.hash)))
+	}
+	c.base, c.headers = height, []*blockHeader{start}
+	return nil
+}
+
+// headerLocked returns the verified header at height, syncing or extending
+// the chain down to it as needed. Callers must hold c.mu.
+func (c *HeaderChain) headerLocked(ctx context.Context, height int64) (*blockHeader, error) {
+	if c.headers == nil || height > c.tipLocked() {
+		if _, err := c.syncLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if height > c.tipLocked() {
+		return nil, fmt.Errorf("%w: block %d is above the verified tip %d", errUnverifiedChain, height, c.tipLocked())
+	}
+	if height < c.base {
+		if err := c.extendBackLocked(ctx, height); err != nil {
+			return nil, err
+		}
+	}
+	return c.headers[height-c.base], nil
+}
+
+// extendBackLocked fetches the headers from height up to the chain's start
+// and prepends them, each linked by hash to the one above. The start vouches
+// for everything below it, so no work is checked: this is also what lets the
+// chain reach blocks from before the ASERT anchor. The first lookup of an old
+// name can download a lot of headers; they are kept. Callers must hold c.mu.
+func (c *HeaderChain) extendBackLocked(ctx context.Context, height int64) error {
+	fetched, err := c.fetchLocked(ctx, height, c.base-1)
+	if err != nil {
+		return err
+	}
+	next := c.headers[0]
+	for i := len(fetched) - 1; i >= 0; i-- {
+		if !bytes.Equal(fetched[i].hash, next.prevHash) {
+			return fmt.Errorf("%w: block %d does not link to block %d", errUnverifiedChain, height+int64(i), height+int64(i)+1)
+		}
+		fetched[i].work = new(big.Int).Sub(next.work, blockWork(next))
+		next = fetched[i]
+	}
+	c.headers = append(fetched, c.headers...)
+	c.base = height
+	return nil
+}
+
+// fetchLocked reads the headers from..to (inclusive) from the server,
+// unverified. Callers must hold c.mu.
+func (c *HeaderChain) fetchLocked(ctx context.Context, from, to int64) ([]*blockHeader, error) {
+	var out []*blockHeader
+	for start := from; start <= to; {
+		count := min(to-start+1, maxHeadersPerCall)
+		raw, err := c.client.GetHeaders(ctx, start, count)
+		if err != nil {
+			return nil, fmt.Errorf("headers %d+%d: %w", start, count, err)
+		}
+		if int64(len(raw)) != count*blockHeaderSize {
+			return nil, fmt.Errorf("%w: asked for %d headers from %d, got %d bytes", errUnverifiedChain, count, start, len(raw))
+		}
+		for i := range count {
+			h, _ := parseHeader(raw[i*blockHeaderSize : (i+1)*blockHeaderSize])
+			out = append(out, h)
+		}
+		start += count
+	}
+	return out, nil
+}
+
+// header returns the verified header at height.
+func (c *HeaderChain) header(ctx context.Context, height int64) (*blockHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headerLocked(ctx, height)
+}
+
+// VerifyTx checks that raw is the transaction txid (display hex) and that the
+// verified block at height includes it, by its Merkle inclusion proof, and
+// returns that proof with the block's header.
+func (c *HeaderChain) VerifyTx(ctx context.Context, raw []byte, txid string, height int64) (*registry.Inclusion, error) {
+	id := txID(raw)
+	if hex.EncodeToString(reverseBytes(id)) != txid {
+		return nil, fmt.Errorf("%w: the server sent another transaction for %s", errUnverifiedChain, txid)
+	}
+	// A 64-byte transaction hashes like an inner Merkle node, so a proof for
+	// one could really be a proof for half a tree. Consensus forbids them.
+	if len(raw) == 64 {
+		return nil, fmt.Errorf("%w: %s is 64 bytes", errUnverifiedChain, txid)
+	}
+	if height <= 0 {
+		return nil, fmt.Errorf("%w: %s is not in a block", errUnverifiedChain, txid)
+	}
+	proof, err := c.client.GetMerkle(ctx, txid, height)
+	if err != nil {
+		return nil, fmt.Errorf("merkle proof for %s: %w", txid, err)
+	}
+	if proof.BlockHeight != height {
+		return nil, fmt.Errorf("%w: merkle proof for %s is for block %d, not %d", errUnverifiedChain, txid, proof.BlockHeight, height)
+	}
+	branch := make([][]byte, len(proof.Merkle))
+	for i, s := range proof.Merkle {
+		if branch[i] = reverseBytesHex(s); len(branch[i]) != 32 {
+			return nil, fmt.Errorf("%w: malformed merkle proof for %s", errUnverifiedChain, txid)
+		}
+	}
+	header, err := c.header(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	in := &registry.Inclusion{Height: height, Header: header.raw, Branch: branch, Pos: proof.Pos}
+	if !included(id, in, header) {
+		return nil, fmt.Errorf("%w: %s is not in block %d", errUnverifiedChain, txid, height)
+	}
+	return in, nil
+}
+
+// included reports whether in's branch joins the transaction id (internal
+// order) to header's Merkle root.
+func included(id []byte, in *registry.Inclusion, header *blockHeader) bool {
+	for _, b := range in.Branch {
+		if len(b) != 32 {
+			return false
+		}
+	}
+	root := merkleRootFromBranch(id, in.Branch, in.Pos)
+	return root != nil && bytes.Equal(root, header.merkleRoot)
+}
+
+// merkleRootFromBranch folds a Merkle branch into the root it proves leaf is
+// under, at position pos; nil if pos does not fit the branch.
+func merkleRootFromBranch(leaf []byte, branch [][]byte, pos uint64) []byte {
+	if len(branch) < 64 && pos>>len(branch) != 0 {
+		return nil
+	}
+	h := leaf
+	for _, sibling := range branch {
+		if pos&1 == 1 {
+			h = sha256d(append(append([]byte(nil), sibling...), h...))
+		} else {
+			h = sha256d(append(append([]byte(nil), h...), sibling...))
+		}
+		pos >>= 1
+	}
+	return h
+}
@@ -0,0 +1,421 @@
+package bch
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, bits := range []uint32{0x1d00ffff, 0x1804dafe, 0x207fffff, 0x1b0404cb, 0x03123456} {
+		target, ok := compactToTarget(bits)
+		if !ok {
+			t.Fatalf("%08x: reported invalid", bits)
+		}
+		if got := targetToCompact(target); got != bits {
+			t.Fatalf("%08x: round trip gave %08x", bits, got)
+		}
+	}
+	if _, ok := compactToTarget(0x04923456); ok {
+		t.Fatal("negative target accepted")
+	}
+	if _, ok := compactToTarget(0xff123456); ok {
+		t.Fatal("overflowing target accepted")
+	}
+}
+
+// TestASERT checks the mainnet schedule: a block on time keeps the anchor's
+// target, one a half-life late doubles it and one a half-life early halves it.
+func TestASERT(t *testing.T) {
+	p := bchNetworks["mainnet"]
+	const parentHeight = 661747
+	onTime := p.anchorParentTime + targetSpacing*(parentHeight-p.anchorHeight+1)
+	for _, tc := range []struct {
+		parentTime int64
+		want       uint32
+	}{
+		{onTime, 0x1804dafe},
+		{onTime + p.halfLife, 0x1809b5fc},
+		{onTime - p.halfLife, 0x18026d7f},
+	} {
+		if got := targetToCompact(p.asertTarget(parentHeight, tc.parentTime)); got != tc.want {
+			t.Fatalf("parent time %+d s: bits %08x, want %08x", tc.parentTime-onTime, got, tc.want)
+		}
+	}
+	// Far enough behind, the target stops at the limit.
+	if got := p.asertTarget(parentHeight, onTime+100*p.halfLife); got.Cmp(p.powLimit) != 0 {
+		t.Fatalf("target %x, want the limit", got)
+	}
+}
+
+func TestMinDifficultyRule(t *testing.T) {
+	p := bchNetworks["chipnet"]
+	parentHeight := p.anchorHeight + 10
+	parent := &blockHeader{time: p.anchorParentTime + targetSpacing*(parentHeight-p.anchorHeight+1)}
+	if got := p.nextBits(parent, parentHeight, parent.time+2*targetSpacing); got != p.anchorBits {
+		t.Fatalf("block 20 minutes on: bits %08x, want %08x", got, p.anchorBits)
+	}
+	if got, want := p.nextBits(parent, parentHeight, parent.time+2*targetSpacing+1), targetToCompact(p.powLimit); got != want {
+		t.Fatalf("block over 20 minutes on: bits %08x, want %08x", got, want)
+	}
+	if got := bchNetworks["mainnet"].nextBits(parent, 700000, parent.time+3600); got == targetToCompact(bchPowLimit) {
+		t.Fatal("mainnet applied the testnet rule")
+	}
+}
+
+// mineAt mines a regtest header on top of prev at the given time and bits.
+// With work false it instead finds a nonce whose hash misses the target.
+func mineAt(prev *blockHeader, when int64, bits uint32, work bool) *blockHeader {
+	raw := make([]byte, blockHeaderSize)
+	copy(raw[4:36], prev.hash)
+	binary.LittleEndian.PutUint32(raw[68:72], uint32(when))
+	binary.LittleEndian.PutUint32(raw[72:76], bits)
+	target, _ := compactToTarget(bits)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(raw[76:80], nonce)
+		if (new(big.Int).SetBytes(reverseBytes(sha256d(raw))).Cmp(target) <= 0) == work {
+			h, _ := parseHeader(raw)
+			return h
+		}
+	}
+}
+
+func TestCheckHeader(t *testing.T) {
+	p := regtestParams
+	chain := []*blockHeader{mineHeader(nil, 0, nil)}
+	for height := int64(1); height <= medianTimeSpan; height++ {
+		chain = append(chain, mineHeader(chain[height-1], height, nil))
+	}
+	height := int64(len(chain))
+	parent := chain[height-1]
+	prev := chain[height-medianTimeSpan:]
+	now := time.Unix(regtestGenesisTime+targetSpacing*height, 0)
+	when := parent.time + targetSpacing
+	bits := p.nextBits(parent, height-1, when)
+
+	if err := p.checkHeader(mineAt(parent, when, bits, true), height, prev, now); err != nil {
+		t.Fatalf("valid header: %v", err)
+	}
+	median := chain[height-1-medianTimeSpan/2].time
+	for name, tc := range map[string]struct {
+		h    *blockHeader
+		want string
+	}{
+		"orphan":      {mineAt(chain[height-2], when, bits, true), "does not build on"},
+		"no work":     {mineAt(parent, when, bits, false), "insufficient proof of work"},
+		"wrong bits":  {mineAt(parent, when, bits-1, true), "has bits"},
+		"old":         {mineAt(parent, median, p.nextBits(parent, height-1, median), true), "median time past"},
+		"from future": {mineAt(parent, now.Unix()+maxFutureBlockTime+1, bits, true), "future"},
+	} {
+		if err := p.checkHeader(tc.h, height, prev, now); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := "000000000000000001bd9d7a1a6ea2a0bcbf5e0e0c7e5b2e1a7a1b8d0d6f6c6e"
+	cp, err := parseCheckpoint("800000:" + hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.height != 800000 || hex.EncodeToString(reverseBytes(cp.hash)) != hash {
+		t.Fatalf("parsed %d %x", cp.height, cp.hash)
+	}
+	for _, bad := range []string{"", "800000", "-1:" + hash, "x:" + hash, "800000:abcd", "800000:" + hash[:63] + "g"} {
+		if _, err := parseCheckpoint(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	if _, err := NewHeaderChain(nil, "nonet", ""); err == nil {
+		t.Error("unknown network accepted")
+	}
+}
+
+// TestBuiltinCheckpoint checks an empty setting starts mainnet from its
+// built-in checkpoint, and a network without one (or TrustOnFirstUse) from
+// the server's word.
+func TestBuiltinCheckpoint(t *testing.T) {
+	for name, p := range bchNetworks {
+		if p.checkpoint != nil && p.checkpoint.height < p.anchorHeight {
+			t.Errorf("%s: built-in checkpoint %d is below the anchor %d", name, p.checkpoint.height, p.anchorHeight)
+		}
+	}
+	for _, tc := range []struct {
+		network, setting string
+		builtin          bool
+	}{
+		{"mainnet", "", true},
+		{"mainnet", TrustOnFirstUse, false},
+		{"chipnet", "", false},
+	} {
+		hc, err := NewHeaderChain(nil, tc.network, tc.setting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hc.checkpoint != nil; got != tc.builtin || got && hc.checkpoint != bchNetworks[tc.network].checkpoint {
+			t.Errorf("%s %q: checkpoint %+v", tc.network, tc.setting, hc.checkpoint)
+		}
+	}
+}
+
+func TestHeaderChainCheckpoint(t *testing.T) {
+	r := newRegtest(t)
+	r.mine(20)
+	c := r.client()
+
+	good := newHeaderChain(c, regtestParams, &checkpoint{height: 5, hash: r.headers[5].hash})
+	if tip, err := good.Tip(t.Context()); err != nil || tip != 20 {
+		t.Fatalf("Tip = %d, %v; want 20", tip, err)
+	}
+	bad := newHeaderChain(c, regtestParams, &checkpoint{height: 5, hash: r.headers[6].hash})
+	if _, err := bad.Tip(t.Context()); !errors.Is(err, errUnverifiedChain) {
+		t.Fatalf("mismatched checkpoint: %v", err)
+	}
+	ahead := newHeaderChain(c, regtestParams, &checkpoint{height: 30, hash: r.headers[5].hash})
+	if _, err := ahead.Tip(t.Context()); !errors.Is(err, errUnverifiedChain) {
+		t.Fatalf("checkpoint above the tip: %v", err)
+	}
+}
+
+// TestHeaderChainFollowsReorg syncs, swaps the server's top blocks for another
+// branch and checks the chain follows it.
+func TestHeaderChainFollowsReorg(t *testing.T) {
+	r := newRegtest(t)
+	r.mine(30)
+	hc := newHeaderChain(r.client(), regtestParams, nil)
+	if _, err := hc.Tip(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	r.reorg(15)
+	key, _ := secp256k1.GeneratePrivateKey()
+	r.fund(p2pkhScript(hash160(key.PubKey().SerializeCompressed())), 1000)
+	r.mine(16)
+	tip, err := hc.Tip(t.Context())
+	if err != nil || tip != 31 {
+		t.Fatalf("Tip = %d, %v; want 31", tip, err)
+	}
+	if got := hc.headers[tip-hc.base].hash; !bytesEqual(got, r.headers[31].hash) {
+		t.Fatal("chain did not follow the server's new branch")
+	}
+}
+
+// TestHeaderChainRefusesLessWork has the server swap its top blocks for a
+// shorter branch: the chain keeps its own. A server that is only behind, on
+// the same chain, leaves it as it is.
+func TestHeaderChainRefusesLessWork(t *testing.T) {
+	r := newRegtest(t)
+	r.mine(30)
+	hc := newHeaderChain(r.client(), regtestParams, nil)
+	if _, err := hc.Tip(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	ours := r.headers[30].hash
+
+	r.reorg(5)
+	if tip, err := hc.Tip(t.Context()); err != nil || tip != 30 {
+		t.Fatalf("server behind: Tip = %d, %v; want 30", tip, err)
+	}
+
+	r.reorg(10)
+	key, _ := secp256k1.GeneratePrivateKey()
+	r.fund(p2pkhScript(hash160(key.PubKey().SerializeCompressed())), 1000)
+	r.mine(12)
+	if _, err := hc.Tip(t.Context()); !errors.Is(err, errUnverifiedChain) {
+		t.Fatalf("shorter branch: %v", err)
+	}
+	if got := hc.headers[hc.tipLocked()-hc.base].hash; hc.tipLocked() != 30 || !bytesEqual(got, ours) {
+		t.Fatalf("chain moved to block %d", hc.tipLocked())
+	}
+
+	r.mine(4)
+	if tip, err := hc.Tip(t.Context()); err != nil || tip != 31 {
+		t.Fatalf("longer branch: Tip = %d, %v; want 31", tip, err)
+	}
+}
+
+// TestVerifyTx proves a transaction mined below the chain's start, which
+// takes the chain back down to it, and rejects proofs that do not hold.
+func TestVerifyTx(t *testing.T) {
+	r := newRegtest(t)
+	key, _ := secp256k1.GeneratePrivateKey()
+	script := p2pkhScript(hash160(key.PubKey().SerializeCompressed()))
+	r.fund(script, 1000)
+	r.fund(script, 2000)
+	id := r.fund(script, 3000)
+	r.mine(tofuDepth + 50)
+	other := r.fund(script, 4000)
+	r.mine(1)
+
+	hc := newHeaderChain(r.client(), regtestParams, nil)
+	in, err := hc.VerifyTx(t.Context(), r.txs[id], id, 1)
+	if err != nil {
+		t.Fatalf("VerifyTx: %v", err)
+	}
+	if in.Height != 1 || !bytesEqual(in.Header, r.headers[1].raw) {
+		t.Fatalf("inclusion for block %d, header %x", in.Height, in.Header)
+	}
+	if hc.base != 1 {
+		t.Fatalf("chain starts at %d, want 1", hc.base)
+	}
+	// The server now claims block 2 holds block 1's transactions too.
+	r.mu.Lock()
+	r.blocks[1] = r.blocks[0]
+	r.mu.Unlock()
+	verify := func(raw []byte, txid string, height int64) error {
+		_, err := hc.VerifyTx(t.Context(), raw, txid, height)
+		return err
+	}
+	for name, err := range map[string]error{
+		"wrong block":       verify(r.txs[id], id, 2),
+		"wrong transaction": verify(r.txs[other], id, 1),
+		"unmined":           verify(r.txs[id], id, 0),
+	} {
+		if !errors.Is(err, errUnverifiedChain) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestBCHRegistryRejectsUnprovenClaim has the server list a claim its block
+// does not hold: the lookup fails as unverified, never as not-found.
+func TestBCHRegistryRejectsUnprovenClaim(t *testing.T) {
+	m := newMockElectrum(t)
+	ownerPub := ownerPubBytes(t, testsupport.NewTestKey(t))
+	fundingKey, _ := secp256k1.GeneratePrivateKey()
+	holderScript := p2pkhScript(hash160(fundingKey.PubKey().SerializeCompressed()))
+	raw := makeClaimTx(t, "forged", ownerPub, holderScript, fundingKey, mustHex(t, repeat("ab", 32)))
+	m.addTx(raw, 100, markerScript("forged"), holderScript)
+	delete(m.blocks, 100)
+
+	client := NewElectrumClient(m.endpoint())
+	defer client.Close()
+	_, err := m.registry(client, 1).ResolveOwner("forged.fn")
+	if !errors.Is(err, errUnverifiedChain) || errors.Is(err, registry.ErrRegistryNotFound) {
+		t.Fatalf("ResolveOwner: %v, want an unverified chain", err)
+	}
+}
+
+// regtestGenesisTime is the simulated genesis block's timestamp; each block
+// after it is stamped exactly targetSpacing later.
+const regtestGenesisTime = 1700000000
+
+// regtestParams are the rules of simulated chains: ASERT from genesis at the
+// easiest target, which on-schedule timestamps keep, so a header takes a
+// couple of hashes to mine.
+var regtestParams = func() *chainParams {
+	limit, _ := compactToTarget(0x207fffff)
+	return &chainParams{name: "regtest", powLimit: limit, anchorHeight: 0, anchorBits: 0x207fffff,
+		anchorParentTime: regtestGenesisTime - targetSpacing, halfLife: 3600}
+}()
+
+// mineHeader mines the block at height on top of prev (nil for genesis) over
+// txids (internal order), stamped on the ideal schedule.
+func mineHeader(prev *blockHeader, height int64, txids [][]byte) *blockHeader {
+	raw := make([]byte, blockHeaderSize)
+	binary.LittleEndian.PutUint32(raw[0:4], 2)
+	if prev != nil {
+		copy(raw[4:36], prev.hash)
+	}
+	copy(raw[36:68], merkleRoot(txids))
+	binary.LittleEndian.PutUint32(raw[68:72], uint32(regtestGenesisTime+targetSpacing*height))
+	binary.LittleEndian.PutUint32(raw[72:76], regtestParams.anchorBits)
+	target, _ := compactToTarget(regtestParams.anchorBits)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(raw[76:80], nonce)
+		if new(big.Int).SetBytes(reverseBytes(sha256d(raw))).Cmp(target) <= 0 {
+			h, _ := parseHeader(raw)
+			return h
+		}
+	}
+}
+
+// merkleRoot is the Merkle root of txids (internal order); an empty block,
+// which only a simulation has, gets zeros.
+func merkleRoot(txids [][]byte) []byte {
+	if len(txids) == 0 {
+		return make([]byte, 32)
+	}
+	branch := merkleBranch(txids, 0)
+	return merkleRootFromBranch(txids[0], branch, 0)
+}
+
+// merkleBranch is the Merkle branch proving txids[pos], leaf upwards.
+func merkleBranch(txids [][]byte, pos int) [][]byte {
+	var branch [][]byte
+	level := txids
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(slices.Clip(level), level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			next[i] = sha256d(append(append([]byte(nil), level[2*i]...), level[2*i+1]...))
+		}
+		level, pos = next, pos/2
+	}
+	return branch
+}
+
+// blockTxIDs decodes display txids into internal order.
+func blockTxIDs(ids []string) [][]byte {
+	out := make([][]byte, len(ids))
+	for i, id := range ids {
+		out[i] = reverseBytesHex(id)
+	}
+	return out
+}
+
+// serveHeaders answers the header and Merkle proof calls for a chain of
+// headers (by height) whose block at height h holds txids(h). Shared by
+// regtest and mockElectrum.
+func serveHeaders(method string, params []json.RawMessage, headers []*blockHeader, txids func(height int64) []string) (any, *electrumRPCError, bool) {
+	num := func(i int) int64 {
+		var n int64
+		if i < len(params) {
+			json.Unmarshal(params[i], &n)
+		}
+		return n
+	}
+	tip := int64(len(headers)) - 1
+	switch method {
+	case "blockchain.headers.subscribe":
+		return map[string]any{"height": tip, "hex": hex.EncodeToString(headers[tip].raw)}, nil, true
+	case "blockchain.block.headers":
+		start, count := num(0), min(num(1), maxHeadersPerCall)
+		var raw []byte
+		for h := start; h >= 0 && h <= tip && h < start+count; h++ {
+			raw = append(raw, headers[h].raw...)
+		}
+		return map[string]any{"count": len(raw) / blockHeaderSize, "hex": hex.EncodeToString(raw), "max": maxHeadersPerCall}, nil, true
+	case "blockchain.transaction.get_merkle":
+		var txid string
+		json.Unmarshal(params[0], &txid)
+		height := num(1)
+		if height <= 0 || height > tip {
+			return nil, &electrumRPCError{Code: 1, Message: "bad height"}, true
+		}
+		ids := txids(height)
+		pos := slices.Index(ids, txid)
+		if pos < 0 {
+			return nil, &electrumRPCError{Code: 1, Message: "tx not in block"}, true
+		}
+		var merkle []string
+		for _, b := range merkleBranch(blockTxIDs(ids), pos) {
+			merkle = append(merkle, hex.EncodeToString(reverseBytes(b)))
+		}
+		return map[string]any{"block_height": height, "merkle": merkle, "pos": pos}, nil, true
+	}
+	return nil, nil, false
+}
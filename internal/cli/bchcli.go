@@ -38,6 +38,16 @@ func bchWalletFromEnv() (*bch.Wallet, *bch.ElectrumClient, error) {
 	return w, client, nil
 }
 
+// bchHeaders builds the header chain registry lookups verify against, for the
+// configured network and checkpoint.
+func bchHeaders(client *bch.ElectrumClient, cfg *config.Config) (*bch.HeaderChain, error) {
+	headers, err := bch.NewHeaderChain(client, cfg.BCHNetwork, cfg.BCHCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("BCH headers: %w", err)
+	}
+	return headers, nil
+}
+
 func cliWallet(args []string) error {
 	w, client, err := bchWalletFromEnv()
 	if err != nil {
@@ -96,7 +106,12 @@ func cliClaim(args []string) error {
 	defer cancel()
 
 	// Refuse to double-claim if the name already resolves to someone.
-	reg := bch.NewBCHRegistry(client, config.LoadConfig().BCHMinConf)
+	cfg := config.LoadConfig()
+	headers, err := bchHeaders(client, cfg)
+	if err != nil {
+		return err
+	}
+	reg := bch.NewBCHRegistry(client, headers, cfg.BCHMinConf)
 	if existing, err := reg.ResolveOwner(label + "." + record.TLD); err == nil {
 		if bytes.Equal(existing, ownerPub) {
 			return fmt.Errorf("%q is already claimed by this key", label)
@@ -146,7 +161,12 @@ func cliAdopt(args []string) error {
 	defer cancel()
 
 	// The category is the earliest confirmed claim's txid.
-	reg := bch.NewBCHRegistry(client, config.LoadConfig().BCHMinConf)
+	cfg := config.LoadConfig()
+	headers, err := bchHeaders(client, cfg)
+	if err != nil {
+		return err
+	}
+	reg := bch.NewBCHRegistry(client, headers, cfg.BCHMinConf)
 	category, err := reg.CategoryFor(ctx, label)
 	if err != nil {
 		return fmt.Errorf("find name NFT category: %w", err)
@@ -180,7 +200,11 @@ func cliWhois(args []string) error {
 	client := bch.NewElectrumClient(cfg.BCHElectrum...)
 	defer client.Close()
 
-	reg := bch.NewBCHRegistry(client, cfg.BCHMinConf)
+	headers, err := bchHeaders(client, cfg)
+	if err != nil {
+		return err
+	}
+	reg := bch.NewBCHRegistry(client, headers, cfg.BCHMinConf)
 	ownerPub, err := reg.ResolveOwner(label + "." + record.TLD)
 	if err != nil {
 		return fmt.Errorf("%q: %w", label, err)
@@ -2,15 +2,18 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
 )
 
 // testContentService returns a store-only content service for exercising the
@@ -31,7 +34,7 @@ func TestContentHandlerChunkedRoundTrip(t *testing.T) {
 
 	data := testsupport.TestBytes(content.ChunkSize + 4096)
 	// uploadContent is the CLI's streaming upload path (POSTs to /content).
-	hash, err := uploadContent(server.URL, bytes.NewReader(data))
+	hash, err := uploadContent(server.URL, bytes.NewReader(data), client.PutOptions{})
 	if err != nil {
 		t.Fatalf("uploadContent: %v", err)
 	}
@@ -80,7 +83,7 @@ func TestContentHandlerSniffsContentType(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			hash, err := uploadContent(server.URL, bytes.NewReader(tc.data))
+			hash, err := uploadContent(server.URL, bytes.NewReader(tc.data), client.PutOptions{})
 			if err != nil {
 				t.Fatalf("uploadContent: %v", err)
 			}
@@ -102,3 +105,72 @@ func TestContentHandlerSniffsContentType(t *testing.T) {
 		})
 	}
 }
+
+// TestContentHandlerChunkingParam checks a content-defined chunking upload
+// round-trips through the handler and that an unknown mode is refused.
+func TestContentHandlerChunkingParam(t *testing.T) {
+	cs := testContentService(t)
+	server := httptest.NewServer(httpapi.ContentHandler(cs))
+	defer server.Close()
+
+	data := testsupport.TestBytes(2*content.ChunkSize + 99)
+	hash, err := uploadContent(server.URL, bytes.NewReader(data), client.PutOptions{Chunking: "cdc"})
+	if err != nil {
+		t.Fatalf("uploadContent: %v", err)
+	}
+	blob, err := cs.Fetch(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("fetch back: %v", err)
+	}
+	if !bytes.Equal(blob, data) {
+		t.Fatal("CDC upload read back different bytes")
+	}
+
+	resp, err := http.Post(server.URL+"/content?chunking=rabin", "application/octet-stream", bytes.NewReader(data[:10]))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown chunking mode: status %d, want 400", resp.StatusCode)
+	}
+}
+
+// TestContentHandlerEncryptedUpload checks ?encrypt=1 returns a read
+// capability, that GET with the capability serves the plaintext, and that the
+// bare hash only yields ciphertext.
+func TestContentHandlerEncryptedUpload(t *testing.T) {
+	cs := testContentService(t)
+	server := httptest.NewServer(httpapi.ContentHandler(cs))
+	defer server.Close()
+
+	data := []byte("# Members only\n\nThe meeting is at noon.\n")
+	readCap, err := uploadContent(server.URL, bytes.NewReader(data), client.PutOptions{Encrypt: true})
+	if err != nil {
+		t.Fatalf("uploadContent: %v", err)
+	}
+	hash, key, err := content.ParseContentRef(readCap)
+	if err != nil || key == nil {
+		t.Fatalf("encrypted upload returned %q, not a read capability (%v)", readCap, err)
+	}
+
+	get := func(ref string) (int, []byte) {
+		resp, err := http.Get(server.URL + "/content?hash=" + url.QueryEscape(ref))
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+	if status, body := get(readCap); status != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("GET with capability: status %d, body %q", status, body)
+	}
+	if status, body := get(hash); status != http.StatusOK || bytes.Contains(body, []byte("meeting")) {
+		t.Fatalf("GET by bare hash: status %d, plaintext visible", status)
+	}
+	other, _ := content.NewContentKey()
+	if status, _ := get(content.FormatReadCap(hash, other)); status != http.StatusForbidden {
+		t.Fatalf("GET with the wrong key: status %d, want 403", status)
+	}
+}
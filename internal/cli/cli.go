@@ -1,12 +1,9 @@
 package cli
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,12 +11,23 @@ import (
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
 )
 
 // defaultAPI is the node HTTP API the CLI talks to by default. It matches the
 // node's default FREEDOM_HTTP_ADDR (":8420") so `publish`/`lookup` work out of
 // the box against a locally running node.
-const defaultAPI = "http://localhost:8420"
+const defaultAPI = client.DefaultURL
+
+// apiTokenEnv names the variable holding the API token the CLI presents, which
+// a node whose API is bound beyond loopback requires.
+const apiTokenEnv = "FREEDOM_API_TOKEN"
+
+// newClient returns a client for the node API at api, authenticating with
+// $FREEDOM_API_TOKEN when it is set.
+func newClient(api string) *client.Client {
+	return client.New(api).WithToken(os.Getenv(apiTokenEnv))
+}
 
 // cliUsage documents the freedom subcommands.
 const cliUsage = `freedom - manage Freedom Names
@@ -28,10 +36,31 @@ Usage:
   freedom keygen <label>                 Generate an owner keypair for a name
   freedom set <label> <TYPE> <VALUE> [ttl]   Stage a resource record (A|AAAA|TXT|CNAME|CONTENT)
   freedom clear <label>                  Remove all staged records for a name
-  freedom publish <label> [--api URL]    Sign staged records and publish to a running node
-  freedom put <label> <file> [--api URL] [--ttl S]   Upload a file's content and point <label> at it
+  freedom publish <label> [--api URL] [--wait [--timeout D]]
+                                         Sign staged records and publish to a running node;
+                                         --wait blocks until the network returns the update
+  freedom put <label> <file> [--api URL] [--ttl S] [--chunking fixed|cdc] [--encrypt]
+                                         Upload a file's content and point <label> at it
+  freedom content ls|gc [--api URL]      List content sets held by a node / collect garbage
+  freedom content pin|unpin|rm <hash> [--api URL]
+                                         Keep a set for good, release it to the hosting
+                                         budget, or remove it from the node now
+  freedom content export <hash> <file> [--api URL]
+  freedom content import <file> [--api URL]
+                                         Move a content set through an archive file
+  freedom content status <hash|name> [--wait N] [--timeout D] [--api URL]
+                                         Show where a set is replicated; --wait blocks
+                                         until N other peers hold it
   freedom name <label>                   Print the full "label.<pubKeyID>.fn" name
   freedom lookup <name> [--api URL] [--type TYPE]   Resolve a name via a running node
+  freedom warmup <file|-> [--api URL]    Resolve a list of names (one per line) through a
+                                         node, warming the cache its DNS server answers from
+
+API tokens, for a node whose HTTP API is bound beyond loopback:
+  freedom token create <name> --scopes LIST   Create a token; LIST is any of resolve,
+                                         content-read, content-write, publish, admin, or all
+  freedom token ls                       List tokens (the tokens themselves are not kept)
+  freedom token revoke <id>              Revoke a token
 
 Bare names on Bitcoin Cash (set FREEDOM_BCH_ELECTRUM):
   freedom wallet                         Show the BCH funding address + balance
@@ -40,7 +69,8 @@ Bare names on Bitcoin Cash (set FREEDOM_BCH_ELECTRUM):
   freedom whois <name>                   Show the on-chain owner of a bare name
 
 Keys and staged records live under ~/.freedom/keys/; the BCH wallet key in
-~/.freedom/bch.key. The default node API is http://localhost:8420 (--api).
+~/.freedom/bch.key. The default node API is http://localhost:8420 (--api); set
+FREEDOM_API_TOKEN to reach one that requires a token.
 `
 
 // RunCLI dispatches a "freedom" subcommand.
@@ -61,10 +91,14 @@ func RunCLI(args []string) {
 		err = cliPublish(args[1:])
 	case "put":
 		err = cliPut(args[1:])
+	case "content":
+		err = cliContent(args[1:])
 	case "name":
 		err = cliName(args[1:])
 	case "lookup":
 		err = cliLookup(args[1:])
+	case "warmup":
+		err = cliWarmup(args[1:])
 	case "wallet":
 		err = cliWallet(args[1:])
 	case "claim":
@@ -73,6 +107,8 @@ func RunCLI(args []string) {
 		err = cliAdopt(args[1:])
 	case "whois":
 		err = cliWhois(args[1:])
+	case "token":
+		err = cliToken(args[1:])
 	case "help", "-h", "--help":
 		fmt.Print(cliUsage)
 		return
@@ -238,9 +274,20 @@ func cliName(args []string) error {
 func cliPublish(args []string) error {
 	label, flags := popPositional(args)
 	if label == "" {
-		return fmt.Errorf("usage: freedom publish <label> [--api URL]")
+		return fmt.Errorf("usage: freedom publish <label> [--api URL] [--wait [--timeout D]]")
 	}
 	api := flagValue(flags, "--api", defaultAPI)
+	var wait time.Duration
+	if hasFlag(flags, "--wait") {
+		wait = defaultPublishWait
+		if v := flagValue(flags, "--timeout", ""); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 || d > 5*time.Minute {
+				return fmt.Errorf("invalid --timeout %q: want a duration up to 5m", v)
+			}
+			wait = d
+		}
+	}
 
 	records, err := loadStaged(label)
 	if err != nil {
@@ -249,21 +296,31 @@ func cliPublish(args []string) error {
 	if len(records) == 0 {
 		return fmt.Errorf("no staged records for %q (use: freedom set ...)", label)
 	}
-	return publishRecords(api, label, records)
+	return publishRecords(api, label, records, wait)
 }
 
+// defaultPublishWait is how long publish --wait waits without --timeout.
+const defaultPublishWait = 2 * time.Minute
+
 // publishRecords signs the given records for a label (with a sequence number
 // strictly above the name's current record) and POSTs them to a node. Shared by
-// `freedom publish` and `freedom put`.
-func publishRecords(api, label string, records []record.RR) error {
+// `freedom publish` and `freedom put`. With a non-zero wait it then blocks, up
+// to wait, until the node's DHT lookups return the new record.
+func publishRecords(api, label string, records []record.RR, wait time.Duration) error {
 	service, err := authoring.NewDefault(nil)
 	if err != nil {
 		return err
 	}
 
+	c := newClient(api)
+	ctx := context.Background()
+
+	// The current record only raises the sequence number. A name without one
+	// (first publish) or a node that cannot say right now falls back to the
+	// clock, so any failure here is not an error.
 	var current *record.FNRecord
 	if name, nameErr := service.Name(label); nameErr == nil {
-		if rec, ok := fetchCurrentRecord(api, name.Name); ok {
+		if rec, err := c.Record(ctx, name.Name); err == nil {
 			current = rec
 		}
 	}
@@ -271,24 +328,21 @@ func publishRecords(api, label string, records []record.RR) error {
 	if err != nil {
 		return err
 	}
-	payload, err := rec.Marshal()
-	if err != nil {
-		return err
-	}
-
-	resp, err := http.Post(api+"/publish", "application/json", bytes.NewReader(payload))
-	if err != nil {
+	if _, err := c.Publish(ctx, rec); err != nil {
 		return fmt.Errorf("publish to %s: %w", api, err)
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("node rejected publish (%d): %s", resp.StatusCode, string(body))
-	}
 	name, _ := rec.FullName()
 	fmt.Printf("Published %s (seq %d, %d record(s))\n", name, rec.Seq, len(records))
 	fmt.Printf("Record valid until %s. Re-run publish before then to renew.\n",
 		time.Unix(rec.EOL, 0).Format(time.RFC1123))
+	if wait == 0 {
+		return nil
+	}
+	fmt.Printf("Waiting up to %v for seq %d to be visible...\n", wait, rec.Seq)
+	if _, err := c.WaitResolve(ctx, name, rec.Seq, wait); err != nil {
+		return fmt.Errorf("seq %d not visible via %s: %w", rec.Seq, api, err)
+	}
+	fmt.Printf("Visible: %s resolves to seq %d\n", name, rec.Seq)
 	return nil
 }
 
@@ -300,46 +354,16 @@ func cliLookup(args []string) error {
 	api := flagValue(flags, "--api", defaultAPI)
 	rtype := flagValue(flags, "--type", "")
 
-	// Escape query values so metacharacters in a name can't corrupt the URL.
-	params := url.Values{"name": {name}}
-	if rtype != "" {
-		params.Set("type", rtype)
-	}
-	resp, err := http.Get(api + "/resolve?" + params.Encode())
+	records, err := newClient(api).Resolve(context.Background(), name, rtype)
 	if err != nil {
 		return fmt.Errorf("lookup via %s: %w", api, err)
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("lookup failed (%d): %s", resp.StatusCode, string(body))
-	}
-	fmt.Println(string(body))
-	return nil
-}
-
-// fetchCurrentRecord fetches the current signed record for a full name from a
-// running node, returning ok=false if the name has no record or the node is
-// unreachable (first publish, or transient failure; callers fall back).
-func fetchCurrentRecord(api, fullName string) (*record.FNRecord, bool) {
-	params := url.Values{"name": {fullName}}
-	resp, err := http.Get(api + "/record?" + params.Encode())
-	if err != nil {
-		return nil, false
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, false
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, false
-	}
-	rec, err := record.UnmarshalFNRecord(body)
+	out, err := json.Marshal(map[string]any{"name": name, "records": records})
 	if err != nil {
-		return nil, false
+		return err
 	}
-	return rec, true
+	fmt.Println(string(out))
+	return nil
 }
 
 // --- staged records helpers ---
@@ -390,6 +414,13 @@ func popPositional(args []string) (string, []string) {
 	return "", args
 }
 
+// boolFlags are the flags that take no value. Every other "--flag" consumes
+// the argument after it, so a switch must be listed here or it would swallow
+// the next positional.
+var boolFlags = map[string]bool{
+	"--encrypt": true,
+}
+
 // popPositionals splits args into up to n positionals and the remaining
 // (flag) args. A "--flag value" pair is treated as flags, not positionals.
 func popPositionals(args []string, n int) (positionals, flags []string) {
@@ -397,7 +428,7 @@ func popPositionals(args []string, n int) (positionals, flags []string) {
 		a := args[i]
 		if len(a) >= 2 && a[:2] == "--" {
 			flags = append(flags, a)
-			if i+1 < len(args) {
+			if !boolFlags[a] && i+1 < len(args) {
 				flags = append(flags, args[i+1])
 				i++
 			}
@@ -412,6 +443,16 @@ func popPositionals(args []string, n int) (positionals, flags []string) {
 	return positionals, flags
 }
 
+// hasFlag reports whether the switch --name (see boolFlags) was given.
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
 // flagValue returns the value following --name, or fallback.
 func flagValue(args []string, name, fallback string) string {
 	for i, a := range args {
@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 )
 
 // withTempHome points ~/.freedom at a temp dir for the duration of a test.
@@ -68,3 +75,45 @@ func TestStagedRoundTripPath(t *testing.T) {
 		t.Fatalf("unexpected staged path: %s", p)
 	}
 }
+
+// TestPublishWait publishes with --wait and checks the CLI then waits, through
+// /resolve?wait-seq, for the seq it just published.
+func TestPublishWait(t *testing.T) {
+	withTempHome(t)
+	if err := cliKeygen([]string{"mysite"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cliSet([]string{"mysite", "A", "10.0.0.1", "300"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var published uint64
+	var waited url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/record", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("/publish", func(w http.ResponseWriter, r *http.Request) {
+		var rec record.FNRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		published = rec.Seq
+		name, _ := rec.FullName()
+		json.NewEncoder(w).Encode(map[string]string{"published": name})
+	})
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		waited = r.URL.Query()
+		json.NewEncoder(w).Encode(map[string]any{"name": waited.Get("name"), "records": []record.RR{}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if err := cliPublish([]string{"mysite", "--api", server.URL, "--wait", "--timeout", "45s"}); err != nil {
+		t.Fatal(err)
+	}
+	if published == 0 || waited.Get("wait-seq") != strconv.FormatUint(published, 10) || waited.Get("timeout") != "45s" {
+		t.Errorf("published seq %d, then waited with %v", published, waited)
+	}
+	if err := cliPublish([]string{"mysite", "--api", server.URL, "--wait", "--timeout", "1h"}); err == nil {
+		t.Error("--timeout beyond the node's limit accepted")
+	}
+}
@@ -1,13 +1,17 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
 )
 
 // cliPut is the common author action LibreWeb's editor triggers: upload a file's
@@ -19,11 +23,18 @@ import (
 //
 //  3. signs and publishes the name.
 //
-//     freedom put <label> <file> [--api URL] [--ttl SECONDS]
+//     freedom put <label> <file> [--api URL] [--ttl SECONDS] [--chunking fixed|cdc] [--encrypt]
+//
+// --chunking cdc splits large files at content-defined boundaries, so a later
+// upload of an edited version shares most of its chunks with this one.
+//
+// --encrypt stores the file encrypted and publishes its read capability as the
+// CONTENT record: anyone who resolves the name can still read the page, but
+// the nodes hosting its bytes cannot.
 func cliPut(args []string) error {
 	positional, flags := popPositionals(args, 2)
 	if len(positional) != 2 {
-		return fmt.Errorf("usage: freedom put <label> <file> [--api URL] [--ttl SECONDS]")
+		return fmt.Errorf("usage: freedom put <label> <file> [--api URL] [--ttl SECONDS] [--chunking fixed|cdc] [--encrypt]")
 	}
 	label, file := positional[0], positional[1]
 	api := flagValue(flags, "--api", defaultAPI)
@@ -35,6 +46,13 @@ func cliPut(args []string) error {
 		}
 		ttl = uint32(parsed)
 	}
+	opts := client.PutOptions{Encrypt: hasFlag(flags, "--encrypt")}
+	if v := flagValue(flags, "--chunking", ""); v != "" {
+		if _, err := content.ParseChunking(v); err != nil {
+			return err
+		}
+		opts.Chunking = v
+	}
 
 	f, err := os.Open(file)
 	if err != nil {
@@ -46,38 +64,299 @@ func cliPut(args []string) error {
 		return fmt.Errorf("stat %s: %w", file, err)
 	}
 
-	hash, err := uploadContent(api, f)
+	ref, err := uploadContent(api, f, opts)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Uploaded %s (%d bytes) -> %s\n", file, info.Size(), hash)
+	fmt.Printf("Uploaded %s (%d bytes) -> %s\n", file, info.Size(), ref)
 
 	// A name published this way points solely at its content.
-	records := []record.RR{{Type: record.RecordTypeCONTENT, Value: hash, TTL: ttl}}
+	records := []record.RR{{Type: record.RecordTypeCONTENT, Value: ref, TTL: ttl}}
 	if err := saveStaged(label, records); err != nil {
 		return err
 	}
-	return publishRecords(api, label, records)
+	return publishRecords(api, label, records, 0)
 }
 
-// uploadContent POSTs raw bytes (streamed from r, so large files never sit
-// fully in memory) to a node's /content endpoint and returns the content hash
-// the node assigned.
-func uploadContent(api string, r io.Reader) (string, error) {
-	resp, err := http.Post(api+"/content", "application/octet-stream", r)
+// uploadContent streams r (so large files never sit fully in memory) to a
+// node's content store and returns the reference the node assigned: the
+// content hash, or for an encrypted upload the read capability (the only way
+// to read it back).
+func uploadContent(api string, r io.Reader, opts client.PutOptions) (string, error) {
+	res, err := newClient(api).PutContent(context.Background(), r, opts)
 	if err != nil {
 		return "", fmt.Errorf("upload to %s: %w", api, err)
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("node rejected content (%d): %s", resp.StatusCode, string(body))
+	if res.Hash == "" {
+		return "", fmt.Errorf("upload to %s: node assigned no content hash", api)
+	}
+	return res.Ref(), nil
+}
+
+// cliContent manages what a running node's content store keeps:
+//
+//	freedom content ls [--api URL]
+//	freedom content pin <hash> [--api URL]
+//	freedom content unpin <hash> [--api URL]
+//	freedom content rm <hash> [--api URL]
+//	freedom content gc [--api URL]
+//	freedom content export <hash> <file> [--api URL]
+//	freedom content import <file> [--api URL]
+//	freedom content status <hash|name> [--wait N] [--timeout D] [--api URL]
+//
+// Pinned sets (everything published through this node, plus what the operator
+// pins) are kept for good; unpinned ones are hosted under the node's hosting
+// budget and evicted when it needs space. Unpin an old site version and run gc
+// to reclaim its disk, or rm it to drop it at once. export and import move a
+// whole set through a single archive file instead of the network. status
+// shows where a set has been replicated to, and with --wait blocks until N
+// other peers are confirmed to hold it (a publish script's "is it safe to
+// switch this machine off yet?").
+func cliContent(args []string) error {
+	const usage = "usage: freedom content ls|pin|unpin|rm|gc|export|import|status [args] [--api URL]"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	sub, rest := args[0], args[1:]
+	switch sub {
+	case "ls", "gc":
+		positional, flags := popPositionals(rest, 1)
+		if len(positional) != 0 {
+			return fmt.Errorf(usage)
+		}
+		api := flagValue(flags, "--api", defaultAPI)
+		if sub == "ls" {
+			return contentList(api)
+		}
+		return contentGC(api)
+	case "pin", "unpin", "rm":
+		positional, flags := popPositionals(rest, 1)
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: freedom content %s <hash> [--api URL]", sub)
+		}
+		hash := positional[0]
+		c := newClient(flagValue(flags, "--api", defaultAPI))
+		ctx := context.Background()
+		var err error
+		done := "Pinned"
+		switch sub {
+		case "pin":
+			err = c.Pin(ctx, hash)
+		case "unpin":
+			err, done = c.Unpin(ctx, hash), "Unpinned"
+		case "rm":
+			err, done = c.RemoveContent(ctx, hash), "Removed"
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", done, hash)
+		return nil
+	case "export":
+		positional, flags := popPositionals(rest, 3)
+		if len(positional) != 2 {
+			return fmt.Errorf("usage: freedom content export <hash> <file> [--api URL]")
+		}
+		return contentExport(flagValue(flags, "--api", defaultAPI), positional[0], positional[1])
+	case "import":
+		positional, flags := popPositionals(rest, 2)
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: freedom content import <file> [--api URL]")
+		}
+		return contentImport(flagValue(flags, "--api", defaultAPI), positional[0])
+	case "status":
+		positional, flags := popPositionals(rest, 1)
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: freedom content status <hash|name> [--wait N] [--timeout D] [--api URL]")
+		}
+		wait := 0
+		if v := flagValue(flags, "--wait", ""); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid --wait %q: want a replica count", v)
+			}
+			wait = n
+		}
+		timeout := 10 * time.Minute
+		if v := flagValue(flags, "--timeout", ""); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid --timeout %q: want a duration like 5m", v)
+			}
+			timeout = d
+		}
+		return contentStatus(flagValue(flags, "--api", defaultAPI), positional[0], wait, timeout)
+	}
+	return fmt.Errorf("unknown content command %q\n%s", sub, usage)
+}
+
+// contentExport downloads the archive of a set into file. A partial file from
+// a failed download is removed rather than left to look like an archive.
+func contentExport(api, hash, file string) error {
+	archive, err := newClient(api).Export(context.Background(), hash)
+	if err != nil {
+		return fmt.Errorf("export via %s: %w", api, err)
+	}
+	defer archive.Close()
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, archive)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("export %s: %w", hash, err)
+	}
+	fmt.Printf("Exported %s to %s (%d bytes)\n", hash, file, n)
+	return nil
+}
+
+// contentImport uploads an archive file and pins the set it holds.
+func contentImport(api, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", file, err)
 	}
-	var out struct {
-		Hash string `json:"hash"`
+	defer f.Close()
+	hash, size, err := newClient(api).Import(context.Background(), f)
+	if err != nil {
+		return fmt.Errorf("import via %s: %w", api, err)
 	}
-	if err := json.Unmarshal(body, &out); err != nil || out.Hash == "" {
-		return "", fmt.Errorf("unexpected /content response: %s", string(body))
+	fmt.Printf("Imported %s (%d bytes)\n", hash, size)
+	return nil
+}
+
+// statusPollInterval is how often content status --wait asks the node again.
+var statusPollInterval = 2 * time.Second
+
+// contentStatus prints the replication status of a set, given by hash or by a
+// name whose CONTENT record points at it. With wait > 0 it first polls (without
+// the DHT provider lookup, which is slow and changes little between polls)
+// until wait other peers are confirmed holders or timeout passes.
+func contentStatus(api, ref string, wait int, timeout time.Duration) error {
+	hash, err := contentRoot(api, ref)
+	if err != nil {
+		return err
+	}
+	c := newClient(api)
+	ctx := context.Background()
+	if wait > 0 {
+		deadline := time.Now().Add(timeout)
+		for {
+			st, err := c.ContentStatus(ctx, hash, false)
+			if err != nil {
+				return err
+			}
+			if st.Confirmed >= wait {
+				break
+			}
+			if time.Now().After(deadline) {
+				printReplicationStatus(st)
+				return fmt.Errorf("%s: %d of %d replicas confirmed after %s", hash, st.Confirmed, wait, timeout)
+			}
+			time.Sleep(statusPollInterval)
+		}
+	}
+	st, err := c.ContentStatus(ctx, hash, true)
+	if err != nil {
+		return err
+	}
+	printReplicationStatus(st)
+	return nil
+}
+
+// contentRoot turns a content hash, read capability or name into the root
+// hash, resolving a name's CONTENT record through the node.
+func contentRoot(api, ref string) (string, error) {
+	if hash, _, err := content.ParseContentRef(ref); err == nil {
+		return hash, nil
+	}
+	records, err := newClient(api).Resolve(context.Background(), ref, record.RecordTypeCONTENT)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	for _, rr := range records {
+		if rr.Type != record.RecordTypeCONTENT {
+			continue
+		}
+		hash, _, err := content.ParseContentRef(rr.Value)
+		if err != nil {
+			return "", fmt.Errorf("%s: CONTENT record: %w", ref, err)
+		}
+		return hash, nil
+	}
+	return "", fmt.Errorf("%s is neither a content hash nor a name with a CONTENT record", ref)
+}
+
+func printReplicationStatus(st *client.ReplicationStatus) {
+	state := "not held"
+	switch {
+	case st.Pinned:
+		state = "pinned"
+	case st.Held && len(st.Groups) > 0:
+		state = "group"
+	case st.Held:
+		state = "hosted"
+	}
+	fmt.Printf("%s  %s", st.Hash, state)
+	if st.Held {
+		fmt.Printf("  %d bytes  %d chunks", st.Size, st.Chunks)
+	}
+	if st.Erasure != "" {
+		fmt.Printf("  erasure %s", st.Erasure)
+	}
+	fmt.Println()
+	fmt.Printf("replicas: %d confirmed", st.Confirmed)
+	if st.Providers != nil {
+		fmt.Printf(", %d DHT providers", *st.Providers)
+	}
+	fmt.Printf("; survives losing %d of %d holders\n", st.Durability.Tolerates, st.Durability.Holders)
+	for _, rp := range st.Replicas {
+		line := fmt.Sprintf("  %s  %-8s  %s", rp.Peer, rp.State, rp.At.Format(time.RFC3339))
+		if rp.Column != nil {
+			line += fmt.Sprintf("  column %d", *rp.Column)
+		}
+		fmt.Println(line)
+	}
+	if h := st.LastHeal; h != nil {
+		fmt.Printf("last heal %s: %d/%d holders, pushed %d", h.At.Format(time.RFC3339), h.Holders, h.Target, h.Pushed)
+		if h.Error != "" {
+			fmt.Printf(", error: %s", h.Error)
+		}
+		fmt.Println()
+	}
+}
+
+func contentList(api string) error {
+	sets, err := newClient(api).ContentSets(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, s := range sets {
+		state := "hosted"
+		if s.Pinned {
+			state = "pinned"
+		} else if len(s.Groups) > 0 {
+			state = "group"
+		}
+		line := fmt.Sprintf("%s  %-6s  %12d bytes  %4d chunks", s.Root, state, s.Size, s.Chunks)
+		if len(s.Groups) > 0 {
+			line += "  groups: " + strings.Join(s.Groups, ",")
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func contentGC(api string) error {
+	res, err := newClient(api).GC(context.Background())
+	if err != nil {
+		return err
 	}
-	return out.Hash, nil
+	fmt.Printf("Evicted %d sets, deleted %d unreferenced blobs, freed %d bytes\n",
+		res.EvictedSets, res.DeletedBlobs, res.FreedBytes)
+	return nil
 }
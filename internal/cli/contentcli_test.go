@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
+)
+
+// contentAdminServer serves the content and content-management routes over
+// an indexed store-only service, wired the way StartHTTPServer wires them.
+func contentAdminServer(t *testing.T) (*httptest.Server, *content.BlobStore) {
+	t.Helper()
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	cs, err := node.NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/content", httpapi.ContentHandler(cs))
+	mux.HandleFunc("/content/sets", httpapi.ContentSetsHandler(cs))
+	mux.HandleFunc("/content/pin", httpapi.ContentPinHandler(cs, true))
+	mux.HandleFunc("/content/unpin", httpapi.ContentPinHandler(cs, false))
+	mux.HandleFunc("/content/gc", httpapi.ContentGCHandler(cs))
+	mux.HandleFunc("/content/export", httpapi.ContentExportHandler(cs))
+	mux.HandleFunc("/content/import", httpapi.ContentImportHandler(cs))
+	mux.HandleFunc("/content/status", httpapi.ContentStatusHandler(cs))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func listSets(t *testing.T, api string) []content.SetInfo {
+	t.Helper()
+	sets, err := client.New(api).ContentSets(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	return sets
+}
+
+// TestContentCommandsLifecycle walks an upload through unpin, pin and rm
+// using the CLI's own commands, checking the node's view after each.
+func TestContentCommandsLifecycle(t *testing.T) {
+	server, store := contentAdminServer(t)
+	data := testsupport.TestBytes(content.ChunkSize + 1024)
+	hash, err := uploadContent(server.URL, bytes.NewReader(data), client.PutOptions{})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	sets := listSets(t, server.URL)
+	if len(sets) != 1 || sets[0].Root != hash || !sets[0].Pinned || sets[0].Chunks != 2 {
+		t.Fatalf("sets after upload: %+v", sets)
+	}
+
+	if err := cliContent([]string{"unpin", hash, "--api", server.URL}); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	if sets := listSets(t, server.URL); sets[0].Pinned {
+		t.Fatalf("set still pinned after unpin")
+	}
+	if err := cliContent([]string{"pin", "--api", server.URL, hash}); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if sets := listSets(t, server.URL); !sets[0].Pinned {
+		t.Fatalf("set not pinned after pin")
+	}
+
+	if err := cliContent([]string{"rm", hash, "--api", server.URL}); err != nil {
+		t.Fatalf("rm: %v", err)
+	}
+	if sets := listSets(t, server.URL); len(sets) != 0 {
+		t.Fatalf("sets after rm: %+v", sets)
+	}
+	if store.Has(hash) {
+		t.Fatalf("removed root still on disk")
+	}
+	resp, err := http.Get(server.URL + "/content?hash=" + hash)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET after rm: status %d, want 404", resp.StatusCode)
+	}
+
+	if err := cliContent([]string{"gc", "--api", server.URL}); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+}
+
+// TestContentCommandsUnknownRoot checks managing a root the node does not
+// hold is a 404, surfaced as a CLI error, and a malformed one a 400.
+func TestContentCommandsUnknownRoot(t *testing.T) {
+	server, _ := contentAdminServer(t)
+	missing, err := content.ContentHash([]byte("never stored"))
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	for _, sub := range []string{"pin", "unpin", "rm"} {
+		err := cliContent([]string{sub, missing, "--api", server.URL})
+		if err == nil || !strings.Contains(err.Error(), "(404)") {
+			t.Fatalf("%s of unknown root: %v, want a 404", sub, err)
+		}
+	}
+	if err := cliContent([]string{"pin", "not-a-hash", "--api", server.URL}); err == nil || !strings.Contains(err.Error(), "(400)") {
+		t.Fatalf("pin of malformed hash: %v, want a 400", err)
+	}
+}
+
+// TestContentExportImportCommands carries a set from one node to another
+// through an archive file, the way an operator seeds a new server offline.
+func TestContentExportImportCommands(t *testing.T) {
+	from, _ := contentAdminServer(t)
+	to, _ := contentAdminServer(t)
+	data := testsupport.TestBytes(content.ChunkSize + 1024)
+	hash, err := uploadContent(from.URL, bytes.NewReader(data), client.PutOptions{})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "site.fnar")
+	if err := cliContent([]string{"export", hash, file, "--api", from.URL}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := cliContent([]string{"import", file, "--api", to.URL}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	resp, err := http.Get(to.URL + "/content?hash=" + hash)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, data) {
+		t.Fatalf("content after import differs (%d bytes, want %d)", len(body), len(data))
+	}
+
+	// A missing root is an error and leaves no file behind.
+	missing := filepath.Join(t.TempDir(), "missing.fnar")
+	other, _ := content.ContentHash([]byte("never stored"))
+	if err := cliContent([]string{"export", other, missing, "--api", from.URL}); err == nil || !strings.Contains(err.Error(), "(404)") {
+		t.Fatalf("export of missing root: %v, want a 404", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("failed export left a file: %v", err)
+	}
+
+	// A damaged archive is refused.
+	raw, _ := os.ReadFile(file)
+	raw[len(raw)-1] ^= 0xff
+	os.WriteFile(file, raw, 0o600)
+	if err := cliContent([]string{"import", file, "--api", to.URL}); err == nil || !strings.Contains(err.Error(), "(400)") {
+		t.Fatalf("import of damaged archive: %v, want a 400", err)
+	}
+}
+
+// TestContentStatusCommand checks status by hash and by name, and that --wait
+// gives up after its timeout when no peer ever confirms a replica (a node
+// without a network has none).
+func TestContentStatusCommand(t *testing.T) {
+	server, _ := contentAdminServer(t)
+	hash, err := uploadContent(server.URL, bytes.NewReader([]byte("status page")), client.PutOptions{})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if err := cliContent([]string{"status", hash, "--api", server.URL}); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	// A name is resolved to the root of its CONTENT record.
+	resolve := http.NewServeMux()
+	resolve.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "CONTENT" {
+			http.Error(w, "want type=CONTENT", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":    r.URL.Query().Get("name"),
+			"records": []map[string]any{{"type": "CONTENT", "value": hash, "ttl": 300}},
+		})
+	})
+	names := httptest.NewServer(resolve)
+	defer names.Close()
+	if got, err := contentRoot(names.URL, "site.abc.fn"); err != nil || got != hash {
+		t.Fatalf("contentRoot by name = %q, %v; want %s", got, err, hash)
+	}
+
+	old := statusPollInterval
+	statusPollInterval = 10 * time.Millisecond
+	defer func() { statusPollInterval = old }()
+	err = cliContent([]string{"status", hash, "--wait", "1", "--timeout", "50ms", "--api", server.URL})
+	if err == nil || !strings.Contains(err.Error(), "0 of 1 replicas") {
+		t.Fatalf("status --wait without peers: %v, want a timeout", err)
+	}
+	if err := cliContent([]string{"status", hash, "--wait", "-1", "--api", server.URL}); err == nil {
+		t.Fatalf("negative --wait accepted")
+	}
+}
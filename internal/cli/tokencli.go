@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+)
+
+// cliToken manages the API tokens a node requires when its HTTP API is bound
+// beyond loopback. It edits the node's token file (http_tokens_file) directly,
+// so it runs on the node's machine; the node picks the change up on the next
+// request, without a restart.
+func cliToken(args []string) error {
+	const usage = "usage: freedom token create <name> --scopes LIST | ls | revoke <id>"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	tokens := apitoken.Open(config.LoadConfig().HTTPTokensFile)
+	sub, rest := args[0], args[1:]
+	switch sub {
+	case "create":
+		positional, flags := popPositionals(rest, 1)
+		if len(positional) != 1 || !hasFlag(flags, "--scopes") {
+			return fmt.Errorf("usage: freedom token create <name> --scopes LIST (any of resolve, content-read, content-write, publish, admin, or all)")
+		}
+		scopes, err := apitoken.ParseScopes(flagValue(flags, "--scopes", ""))
+		if err != nil {
+			return err
+		}
+		return tokenCreate(os.Stdout, tokens, positional[0], scopes)
+	case "ls":
+		return tokenList(os.Stdout, tokens)
+	case "revoke":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: freedom token revoke <id>")
+		}
+		if err := tokens.Revoke(rest[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %s\n", rest[0])
+		return nil
+	}
+	return fmt.Errorf("unknown token command %q\n%s", sub, usage)
+}
+
+func tokenCreate(w io.Writer, tokens *apitoken.Store, name string, scopes []apitoken.Scope) error {
+	token, t, err := tokens.Create(name, scopes)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Created token %s (%s) with scopes %s:\n\n  %s\n\n", t.ID, t.Name, scopeList(t.Scopes), token)
+	fmt.Fprintf(w, "It is shown only now. Clients send it as \"Authorization: Bearer <token>\";\nthe CLI reads it from %s.\n", apiTokenEnv)
+	return nil
+}
+
+func tokenList(w io.Writer, tokens *apitoken.Store) error {
+	list, err := tokens.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintf(w, "No API tokens (%s)\n", tokens.Path())
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED")
+	for _, t := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.ID, t.Name, scopeList(t.Scopes), t.Created.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+func scopeList(scopes []apitoken.Scope) string {
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+)
+
+// TestTokenCommands creates a token, uses it through FREEDOM_API_TOKEN against
+// a node that checks it, then revokes it.
+func TestTokenCommands(t *testing.T) {
+	withTempHome(t)
+	tokens := apitoken.Open(config.LoadConfig().HTTPTokensFile)
+
+	var out bytes.Buffer
+	if err := tokenCreate(&out, tokens, "laptop", []apitoken.Scope{apitoken.ContentRead}); err != nil {
+		t.Fatal(err)
+	}
+	token := regexp.MustCompile(`fnt_\S+`).FindString(out.String())
+	if token == "" {
+		t.Fatalf("no token in %q", out.String())
+	}
+	out.Reset()
+	if err := tokenList(&out, tokens); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "laptop") || !strings.Contains(out.String(), "content-read") || strings.Contains(out.String(), token) {
+		t.Fatalf("ls:\n%s", out.String())
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, err := tokens.Check(bearer); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid or revoked API token"}`))
+			return
+		}
+		w.Write([]byte(`{"sets":[]}`))
+	}))
+	defer server.Close()
+
+	if err := cliContent([]string{"ls", "--api", server.URL}); err == nil {
+		t.Error("ls without a token succeeded")
+	}
+	t.Setenv(apiTokenEnv, token)
+	if err := cliContent([]string{"ls", "--api", server.URL}); err != nil {
+		t.Errorf("ls with the token: %v", err)
+	}
+
+	list, err := tokens.List()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("tokens: %v %v", list, err)
+	}
+	if err := cliToken([]string{"revoke", list[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cliContent([]string{"ls", "--api", server.URL}); err == nil {
+		t.Error("ls with a revoked token succeeded")
+	}
+	if err := cliToken([]string{"create", "noscopes"}); err == nil {
+		t.Error("create without --scopes succeeded")
+	}
+	if err := cliToken([]string{"create", "x", "--scopes", "root"}); err == nil {
+		t.Error("create with an unknown scope succeeded")
+	}
+}
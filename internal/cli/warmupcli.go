@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
+)
+
+// warmupBatch is how many names go to the node per /resolve/batch request,
+// well under the node's limit, so a long list shows progress as it goes.
+const warmupBatch = 1000
+
+// cliWarmup resolves every name of a list through a node, filling the cache
+// its DNS server answers from before clients ask: after a restart, or ahead
+// of a planned switch of resolvers.
+func cliWarmup(args []string) error {
+	path, flags := popPositional(args)
+	if path == "" {
+		return fmt.Errorf("usage: freedom warmup <file|-> [--api URL]")
+	}
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	names, err := readNames(in)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	api := flagValue(flags, "--api", defaultAPI)
+	return warmup(context.Background(), os.Stdout, newClient(api), names)
+}
+
+// readNames reads one name per line, skipping blank lines and # comments.
+func readNames(r io.Reader) ([]string, error) {
+	var names []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, sc.Err()
+}
+
+// warmup resolves names through c, reporting each name that does not resolve
+// and a summary to w. It fails if any name did not resolve.
+func warmup(ctx context.Context, w io.Writer, c *client.Client, names []string) error {
+	var resolved, failed int
+	for start := 0; start < len(names); start += warmupBatch {
+		stream, err := c.ResolveBatch(ctx, names[start:min(start+warmupBatch, len(names))])
+		if err != nil {
+			return fmt.Errorf("warm up via %s: %w", c.URL(), err)
+		}
+		for {
+			result, err := stream.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				stream.Close()
+				return fmt.Errorf("warm up via %s: %w", c.URL(), err)
+			}
+			if result.Err != nil {
+				failed++
+				fmt.Fprintf(w, "%s: %v\n", result.Name, result.Err)
+				continue
+			}
+			resolved++
+		}
+		stream.Close()
+	}
+	fmt.Fprintf(w, "Warmed %d names", resolved)
+	if failed > 0 {
+		fmt.Fprintf(w, "; %d did not resolve", failed)
+	}
+	fmt.Fprintln(w)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d names did not resolve", failed, resolved+failed)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
+)
+
+func TestReadNames(t *testing.T) {
+	names, err := readNames(strings.NewReader("site.abc.fn\n\n# comment\n  blog.fn  # trailing\n"))
+	if err != nil || !slices.Equal(names, []string{"site.abc.fn", "blog.fn"}) {
+		t.Fatalf("readNames = %q, %v", names, err)
+	}
+}
+
+// TestWarmup warms a list longer than one batch through a node that knows
+// every name but one.
+func TestWarmup(t *testing.T) {
+	var batches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpapi.BatchResolveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Names) > warmupBatch {
+			http.Error(w, "bad batch", http.StatusBadRequest)
+			return
+		}
+		batches++
+		enc := json.NewEncoder(w)
+		for _, name := range req.Names {
+			line := httpapi.BatchResolveResult{Name: name, Status: http.StatusOK}
+			if name == "gone.fn" {
+				line.Status, line.Error = http.StatusNotFound, "not found"
+			}
+			enc.Encode(line)
+		}
+	}))
+	defer server.Close()
+
+	names := []string{"gone.fn"}
+	for i := range warmupBatch {
+		names = append(names, fmt.Sprintf("n%d.fn", i))
+	}
+	var out bytes.Buffer
+	err := warmup(t.Context(), &out, client.New(server.URL), names)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1001") {
+		t.Errorf("warmup: %v, want one failure", err)
+	}
+	if batches != 2 {
+		t.Errorf("%d batches, want 2", batches)
+	}
+	if got := out.String(); !strings.Contains(got, "gone.fn: ") || !strings.Contains(got, "Warmed 1000 names; 1 did not resolve") {
+		t.Errorf("output %q", got)
+	}
+}
@@ -2,18 +2,23 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 )
 
-// Config holds runtime configuration. Values come from environment variables so
-// nothing operational is hardcoded; sensible defaults keep
-// `go run ./cmd/freedom-names` working.
+var logger = logging.For(logging.Config)
+
+// Config holds runtime configuration. Values come from environment variables
+// and an optional config file (see file.go) so nothing operational is
+// hardcoded; sensible defaults keep `go run ./cmd/freedom-names` working.
 type Config struct {
 	HTTPAddr      string   // address for the HTTP API (default "127.0.0.1:8420")
 	AuthoringAddr string   // loopback-only owner-key API (default "127.0.0.1:8421")
@@ -22,8 +27,11 @@ type Config struct {
 	Bootstrap     []string // bootstrap peer multiaddrs
 	ContentDir    string   // content-addressed blobstore directory
 
+	// File is the config file the values were read from, or "" if none.
+	File string
+
 	// BootstrapFromEnv reports whether Bootstrap came from FREEDOM_BOOTSTRAP
-	// rather than the built-in list. A hand-supplied list is worth echoing at
+	// (or the config file's bootstrap setting) rather than the built-in list. A hand-supplied list is worth echoing at
 	// startup, since a typo in it silently yields no peers; the built-in list
 	// only needs a one-line summary.
 	BootstrapFromEnv bool
@@ -38,6 +46,21 @@ type Config struct {
 	// the API is reached through a hostname (see hostAllowed).
 	HTTPAllowedHosts []string
 
+	// HTTPTokensFile holds the bearer tokens remote clients must present when
+	// the HTTP API is bound beyond loopback (see internal/apitoken). Managed
+	// with `freedom token`.
+	HTTPTokensFile string
+
+	// Private network mode. SwarmKeyFile names a libp2p pre-shared key
+	// (swarm.key): only peers holding the same key can connect at all, so
+	// nodes sharing one form a DHT and content network of their own.
+	// ProtocolPrefix namespaces every DHT and content protocol, and
+	// MDNSService is the name LAN discovery advertises under; both keep
+	// networks apart even without a key. See Private.
+	SwarmKeyFile   string
+	ProtocolPrefix string
+	MDNSService    string
+
 	// BootstrapMode reports whether this process runs as a bootstrap node
 	// (`freedom-names bootstrap`): fixed p2p ports, DHT server mode, an HTTP
 	// API on 8430 and no DNS server. Resolved once in main() and read
@@ -50,17 +73,72 @@ type Config struct {
 	BCHElectrum []string // electrum servers, tried in order with failover (empty disables bare names)
 	BCHNetwork  string   // "mainnet" | "chipnet" | "testnet4" | "testnet3"
 	BCHMinConf  int64    // confirmations required for a claim to count
+	// BCHCheckpoint ("height:hash") is the block header verification starts
+	// from. Empty uses the network's built-in checkpoint, or trusts the first
+	// server's block a week below its tip on a network without one; "tofu"
+	// does that on every network.
+	BCHCheckpoint string
 
 	// Content replication and hosting policy. Content is distributed by
 	// design: a publish pushes copies to other nodes, and every holder tops
 	// the replica count back up — availability never rests on one node.
-	ContentReplicas     int           // pushed copies per publish (target holders = replicas+1)
-	ContentHostBudget   int64         // max bytes of hosted (other people's) content
-	ContentHostTTL      time.Duration // hosted content expires this long after last access/re-push
-	ContentHealInterval time.Duration // how often to check + top up replica counts
-	ContentUpRate       int64         // bytes/s serving + pushing content (0 = unlimited)
-	ContentDownRate     int64         // bytes/s fetching + receiving pushes (0 = unlimited)
-	ContentMaxPushSize  int64         // largest pushed content set this node accepts
+	ContentReplicas     int             // pushed copies per publish (target holders = replicas+1)
+	ContentHostBudget   int64           // max bytes of hosted (other people's) content
+	ContentHostTTL      time.Duration   // hosted content expires this long after last access/re-push
+	ContentHealInterval time.Duration   // how often to check + top up replica counts
+	ContentUpRate       int64           // bytes/s serving + pushing content (0 = unlimited)
+	ContentDownRate     int64           // bytes/s fetching + receiving pushes (0 = unlimited)
+	ContentMaxPushSize  int64           // largest pushed content set this node accepts
+	ContentErasure      content.Erasure // k+m shard layout for chunked uploads (zero = full copies)
+	ContentReprovide    string          // ReprovideRoots | ReprovideAll: which blobs get provider records
+
+	// Who may push content to this node, and how much any one pusher may
+	// host here. Entries are peer IDs; see node.pushPolicy.
+	ContentPeerQuota  content.PeerQuota // per-pusher caps within the hosting budget (zero = none)
+	ContentAllowPeers []string          // if set, only these may push
+	ContentDenyPeers  []string          // never accept pushes from these
+
+	// Replication groups: named sets of peers (typically one team's nodes)
+	// that keep each other's content outside the hosting budget.
+	ContentGroups []ContentGroup
+
+	// Logging (see internal/logging). LogLevels and LogFiles are keyed by
+	// subsystem; a subsystem with a file is written there instead of to
+	// standard error.
+	LogLevel  slog.Level
+	LogLevels map[string]slog.Level
+	LogJSON   bool
+	LogFiles  map[string]string
+}
+
+// Private reports whether the node runs a network of its own rather than
+// joining the public one.
+func (c *Config) Private() bool {
+	return c.SwarmKeyFile != "" || c.ProtocolPrefix != DefaultProtocolPrefix
+}
+
+// LogOptions returns the logging configuration for logging.Setup.
+func (c *Config) LogOptions() logging.Options {
+	return logging.Options{Level: c.LogLevel, Levels: c.LogLevels, JSON: c.LogJSON, Files: c.LogFiles}
+}
+
+// Defaults for the public network. A private network changes at least one of
+// FREEDOM_SWARM_KEY and FREEDOM_PROTOCOL_PREFIX.
+const (
+	DefaultProtocolPrefix = "/freedomnames"
+	DefaultMDNSService    = "localfreedomnames"
+)
+
+// Reprovide strategies for FREEDOM_CONTENT_REPROVIDE.
+const (
+	ReprovideRoots = "roots" // set roots (and held shard columns) only; chunks are found through the root's holders
+	ReprovideAll   = "all"   // every stored blob, chunks included
+)
+
+// ContentGroup is one named replication group.
+type ContentGroup struct {
+	Name    string
+	Members []string // peer IDs
 }
 
 // Default bootstrap peers: public server-mode nodes a fresh install dials to
@@ -105,77 +183,256 @@ func LoadConfig() *Config {
 	return LoadConfigForRole(false)
 }
 
-// LoadConfigForRole reads configuration from the environment with defaults,
-// choosing role-dependent defaults for a bootstrap node.
+// LoadConfigForRole reads configuration from the config file and the
+// environment with defaults, choosing role-dependent defaults for a bootstrap
+// node. Invalid values are logged and fall back to their defaults; an
+// unreadable config file is logged and ignored. See Load.
 //
 // The role must be passed in rather than patched onto the returned Config:
-// envOr cannot distinguish "unset" from "set to the default value", so
+// the loader cannot distinguish "unset" from "set to the default value", so
 // overwriting HTTPAddr afterwards would silently clobber an explicit
-// FREEDOM_HTTP_ADDR. Passing the fallback in leaves the env -> flag precedence
-// chain (see applyNodeFlags) intact.
+// FREEDOM_HTTP_ADDR. Passing the fallback in leaves the file -> env -> flag
+// precedence chain (see applyNodeFlags) intact.
 func LoadConfigForRole(bootstrapMode bool) *Config {
+	cfg, problems, err := Load(bootstrapMode)
+	if err != nil {
+		logger.Warn("config file ignored", "err", err)
+	}
+	for _, p := range problems {
+		logger.Warn("invalid setting: "+p.Reason, "var", p.Key, "value", p.Value, "from", p.From)
+	}
+	return cfg
+}
+
+// Load is LoadConfigForRole for callers that report problems themselves
+// (`freedom-names config check`, a reload): it returns every rejected value
+// instead of logging it, and the error reading or parsing the config file, if
+// any. The Config is usable either way — a bad file is skipped as a whole.
+func Load(bootstrapMode bool) (*Config, []Problem, error) {
+	src, err := newSource()
+	cfg := load(src, bootstrapMode)
+	return cfg, src.problems, err
+}
+
+func load(src *source, bootstrapMode bool) *Config {
 	cfg := &Config{
 		BootstrapMode: bootstrapMode,
+		File:          src.path,
 		// Bind the HTTP API to loopback by default: it is an unauthenticated
 		// local control surface (a browser spawns the node), so it must not be
 		// exposed on all interfaces. Override with FREEDOM_HTTP_ADDR=:8420 to
 		// share it on a LAN deliberately.
-		HTTPAddr: envOr("FREEDOM_HTTP_ADDR", defaultHTTPAddr(bootstrapMode)),
+		HTTPAddr: src.or("FREEDOM_HTTP_ADDR", defaultHTTPAddr(bootstrapMode)),
 		// Owner-key operations use a different origin from /content, which can
 		// serve user-controlled bytes. The HTTP server rejects any non-loopback
 		// value even when the ordinary API is deliberately exposed.
-		AuthoringAddr: envOr("FREEDOM_AUTHORING_ADDR", "127.0.0.1:8421"),
+		AuthoringAddr: src.or("FREEDOM_AUTHORING_ADDR", "127.0.0.1:8421"),
 		// Default to the high port :8053 so nodes run without root. (We avoid
 		// :5353, which collides with mDNS/avahi on most desktops.) Set
 		// FREEDOM_DNS_ADDR=:53 (with setcap or a :53->:8053 forwarder) for
 		// system-wide resolution. See the README.
-		DNSAddr:     envOr("FREEDOM_DNS_ADDR", ":8053"),
-		UpstreamDNS: envOr("FREEDOM_UPSTREAM_DNS", "1.1.1.1:53"),
+		DNSAddr:     src.or("FREEDOM_DNS_ADDR", ":8053"),
+		UpstreamDNS: src.or("FREEDOM_UPSTREAM_DNS", "1.1.1.1:53"),
 		Bootstrap:   defaultBootstrapPeers,
-		ContentDir:  envOr("FREEDOM_CONTENT_DIR", defaultContentDirOr()),
+		ContentDir:  src.or("FREEDOM_CONTENT_DIR", defaultContentDirOr()),
 
 		// Default to mainnet: bare names are a real, globally-unique namespace.
 		// Point FREEDOM_BCH_NETWORK at chipnet/testnet4 to experiment with free
 		// faucet coins (see the README).
-		BCHNetwork: envOr("FREEDOM_BCH_NETWORK", "mainnet"),
-		BCHMinConf: 1,
+		BCHNetwork:    src.or("FREEDOM_BCH_NETWORK", "mainnet"),
+		BCHMinConf:    1,
+		BCHCheckpoint: src.get("FREEDOM_BCH_CHECKPOINT"),
 	}
 	// Electrum servers: an explicit FREEDOM_BCH_ELECTRUM (comma-separated) wins;
 	// otherwise use the built-in bootstrap list for the selected network.
-	if v := os.Getenv("FREEDOM_BCH_ELECTRUM"); v != "" {
+	if v := src.get("FREEDOM_BCH_ELECTRUM"); v != "" {
 		cfg.BCHElectrum = splitAndTrim(v)
 	} else {
 		cfg.BCHElectrum = defaultBCHElectrumServers(cfg.BCHNetwork)
 	}
-	if v := os.Getenv("FREEDOM_BOOTSTRAP"); v != "" {
+	if v := src.get("FREEDOM_BOOTSTRAP"); v != "" {
 		cfg.Bootstrap = splitAndTrim(v)
 		cfg.BootstrapFromEnv = true
 	}
+	loadNetworkConfig(src, cfg)
 	// Recursion for remote clients is opt-in and spelled out explicitly, so it
 	// can never be enabled by a typo in an unrelated variable.
-	cfg.DNSRecursionAny = strings.EqualFold(os.Getenv("FREEDOM_DNS_RECURSION"), "any")
-	if v := os.Getenv("FREEDOM_HTTP_ALLOWED_HOSTS"); v != "" {
+	cfg.DNSRecursionAny = strings.EqualFold(src.get("FREEDOM_DNS_RECURSION"), "any")
+	if v := src.get("FREEDOM_HTTP_ALLOWED_HOSTS"); v != "" {
 		cfg.HTTPAllowedHosts = splitAndTrim(strings.ToLower(v))
 	}
-	if v := os.Getenv("FREEDOM_BCH_MINCONF"); v != "" {
+	cfg.HTTPTokensFile = src.or("FREEDOM_HTTP_TOKENS_FILE", defaultTokensFileOr())
+	if v := src.get("FREEDOM_BCH_MINCONF"); v != "" {
 		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 1 {
 			cfg.BCHMinConf = n
+		} else {
+			src.reject("FREEDOM_BCH_MINCONF", "want a whole number of at least 1; using 1")
 		}
 	}
 
 	// Content replication knobs. Defaults favor a robust network: 3 pushed
 	// replicas per publish and a 20 GiB hosting budget per node; bandwidth is
 	// unlimited unless the operator opts into a cap.
-	cfg.ContentReplicas = envInt("FREEDOM_CONTENT_REPLICAS", 3)
-	cfg.ContentHostBudget = envSize("FREEDOM_CONTENT_HOST_BUDGET", 20<<30)
-	cfg.ContentHostTTL = envDuration("FREEDOM_CONTENT_HOST_TTL", 30*24*time.Hour)
-	cfg.ContentHealInterval = envDuration("FREEDOM_CONTENT_HEAL_INTERVAL", time.Hour)
-	cfg.ContentUpRate = envSize("FREEDOM_CONTENT_UP_RATE", 0)
-	cfg.ContentDownRate = envSize("FREEDOM_CONTENT_DOWN_RATE", 0)
-	cfg.ContentMaxPushSize = envSize("FREEDOM_CONTENT_MAX_PUSH_SIZE", content.MaxContentSize)
+	cfg.ContentReplicas = src.int("FREEDOM_CONTENT_REPLICAS", 3)
+	cfg.ContentHostBudget = src.size("FREEDOM_CONTENT_HOST_BUDGET", 20<<30)
+	cfg.ContentHostTTL = src.duration("FREEDOM_CONTENT_HOST_TTL", 30*24*time.Hour)
+	cfg.ContentHealInterval = src.duration("FREEDOM_CONTENT_HEAL_INTERVAL", time.Hour)
+	cfg.ContentUpRate = src.size("FREEDOM_CONTENT_UP_RATE", 0)
+	cfg.ContentDownRate = src.size("FREEDOM_CONTENT_DOWN_RATE", 0)
+	cfg.ContentMaxPushSize = src.size("FREEDOM_CONTENT_MAX_PUSH_SIZE", content.MaxContentSize)
+	// Erasure coding is opt-in: it changes the manifest (and so the address)
+	// of every chunked upload, and needs K+M willing peers to pay off.
+	if v := src.get("FREEDOM_CONTENT_ERASURE"); v != "" {
+		e, err := content.ParseErasure(v)
+		if err != nil {
+			src.reject("FREEDOM_CONTENT_ERASURE", fmt.Sprintf("%v; using full copies", err))
+		} else {
+			cfg.ContentErasure = e
+		}
+	}
+	// Providing every chunk costs a DHT walk per chunk; roots alone are
+	// enough to find a set, since whoever holds the root serves its chunks.
+	switch v := src.or("FREEDOM_CONTENT_REPROVIDE", ReprovideRoots); v {
+	case ReprovideRoots, ReprovideAll:
+		cfg.ContentReprovide = v
+	default:
+		src.reject("FREEDOM_CONTENT_REPROVIDE", "want "+ReprovideRoots+" or "+ReprovideAll+"; using "+ReprovideRoots)
+		cfg.ContentReprovide = ReprovideRoots
+	}
+	// No per-peer caps by default: the hosting budget alone bounds the disk
+	// donated, and a small network may legitimately have one big publisher.
+	cfg.ContentPeerQuota = content.PeerQuota{
+		Bytes: src.size("FREEDOM_CONTENT_PEER_BUDGET", 0),
+		Sets:  src.int("FREEDOM_CONTENT_PEER_MAX_SETS", 0),
+	}
+	if v := src.get("FREEDOM_CONTENT_ALLOW"); v != "" {
+		cfg.ContentAllowPeers = splitAndTrim(v)
+	}
+	if v := src.get("FREEDOM_CONTENT_DENY"); v != "" {
+		cfg.ContentDenyPeers = splitAndTrim(v)
+	}
+	if v := src.get("FREEDOM_CONTENT_GROUPS"); v != "" {
+		groups, err := ParseContentGroups(v)
+		if err != nil {
+			src.reject("FREEDOM_CONTENT_GROUPS", fmt.Sprintf("%v; no replication groups", err))
+		} else {
+			cfg.ContentGroups = groups
+		}
+	}
+	loadLogConfig(src, cfg)
 	return cfg
 }
 
+// loadNetworkConfig reads the private network settings. Unlike everything
+// else, an invalid swarm key or protocol prefix is kept rather than replaced
+// by the default — the node then refuses to start (see node.NewNode), since
+// falling back would put a private network's records on the public DHT.
+func loadNetworkConfig(src *source, cfg *Config) {
+	cfg.SwarmKeyFile = src.get("FREEDOM_SWARM_KEY")
+	if cfg.SwarmKeyFile != "" {
+		if _, err := LoadSwarmKey(cfg.SwarmKeyFile); err != nil {
+			src.reject("FREEDOM_SWARM_KEY", fmt.Sprintf("%v; the node will not start", err))
+		}
+	}
+	cfg.ProtocolPrefix = src.or("FREEDOM_PROTOCOL_PREFIX", DefaultProtocolPrefix)
+	if err := CheckProtocolPrefix(cfg.ProtocolPrefix); err != nil {
+		src.reject("FREEDOM_PROTOCOL_PREFIX", fmt.Sprintf("%v; the node will not start", err))
+	}
+	cfg.MDNSService = src.or("FREEDOM_MDNS_SERVICE", DefaultMDNSService)
+	// The public bootstrap nodes cannot be reached with a swarm key, and
+	// speak different protocols from a network with its own prefix: a
+	// private network brings its own.
+	if cfg.Private() && !cfg.BootstrapFromEnv {
+		cfg.Bootstrap = nil
+	}
+}
+
+// LoadSwarmKey reads a libp2p pre-shared key file, in the format
+// go-ipfs-swarm-key-gen writes:
+//
+//	/key/swarm/psk/1.0.0/
+//	/base16/
+//	<64 hex digits>
+func LoadSwarmKey(path string) (pnet.PSK, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, fmt.Errorf("swarm key %s: %w", path, err)
+	}
+	return psk, nil
+}
+
+// CheckProtocolPrefix reports whether p can prefix libp2p protocol ids: a
+// path such as "/acme-names", without a trailing slash or whitespace.
+func CheckProtocolPrefix(p string) error {
+	if !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") || len(p) < 2 || strings.ContainsAny(p, " \t\n") {
+		return fmt.Errorf("protocol prefix %q: want a path like /acme-names", p)
+	}
+	return nil
+}
+
+// loadLogConfig reads the FREEDOM_LOG_* variables. Like the rest, a bad value
+// is reported and falls back to the default rather than stopping the node.
+func loadLogConfig(src *source, cfg *Config) {
+	cfg.LogLevel = slog.LevelInfo
+	if v := src.get("FREEDOM_LOG_LEVEL"); v != "" {
+		level, levels, err := logging.ParseLevel(v)
+		if err != nil {
+			src.reject("FREEDOM_LOG_LEVEL", fmt.Sprintf("%v; using info", err))
+		} else {
+			cfg.LogLevel, cfg.LogLevels = level, levels
+		}
+	}
+	switch v := src.or("FREEDOM_LOG_FORMAT", "text"); strings.ToLower(v) {
+	case "text":
+	case "json":
+		cfg.LogJSON = true
+	default:
+		src.reject("FREEDOM_LOG_FORMAT", "want text or json; using text")
+	}
+	if v := src.get("FREEDOM_LOG_FILES"); v != "" {
+		files, err := logging.ParseFiles(v)
+		if err != nil {
+			src.reject("FREEDOM_LOG_FILES", fmt.Sprintf("%v; logging to standard error only", err))
+		} else {
+			cfg.LogFiles = files
+		}
+	}
+}
+
+// ParseContentGroups parses replication groups written
+// "name=peer1,peer2;other=peer3": groups separated by semicolons, each a name
+// and its comma-separated member peer IDs. Whether the IDs are valid is
+// checked where they are used.
+func ParseContentGroups(s string) ([]ContentGroup, error) {
+	var groups []ContentGroup
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, members, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("group %q: want name=peer,peer", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("group %q defined twice", name)
+		}
+		seen[name] = true
+		g := ContentGroup{Name: name, Members: splitAndTrim(members)}
+		if len(g.Members) == 0 {
+			return nil, fmt.Errorf("group %q has no members", name)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
 // parseSize parses a byte quantity: a plain integer, or an integer/decimal with
 // a K/M/G/T suffix (optionally followed by "B" or "iB"), 1024-based. Examples:
 // "20GB", "512MiB", "1024", "1.5G".
@@ -202,25 +459,25 @@ func parseSize(s string) (int64, error) {
 	return int64(f * float64(mult)), nil
 }
 
-// envSize reads a byte-quantity env var, logging and falling back on a bad
+// size reads a byte-quantity setting, reporting and falling back on a bad
 // value (matching the forgiving style of the other FREEDOM_* vars).
-func envSize(key string, fallback int64) int64 {
-	v := os.Getenv(key)
+func (src *source) size(key string, fallback int64) int64 {
+	v := src.get(key)
 	if v == "" {
 		return fallback
 	}
 	n, err := parseSize(v)
 	if err != nil {
-		log.Printf("WARNING: %s=%q is not a valid size, using default", key, v)
+		src.reject(key, "not a valid size, using default")
 		return fallback
 	}
 	return n
 }
 
-// envDuration reads a duration env var (time.ParseDuration syntax, plus a "d"
+// duration reads a duration setting (time.ParseDuration syntax, plus a "d"
 // days suffix, e.g. "30d").
-func envDuration(key string, fallback time.Duration) time.Duration {
-	v := os.Getenv(key)
+func (src *source) duration(key string, fallback time.Duration) time.Duration {
+	v := src.get(key)
 	if v == "" {
 		return fallback
 	}
@@ -229,21 +486,21 @@ func envDuration(key string, fallback time.Duration) time.Duration {
 	}
 	d, err := time.ParseDuration(v)
 	if err != nil || d < 0 {
-		log.Printf("WARNING: %s=%q is not a valid duration, using default", key, v)
+		src.reject(key, "not a valid duration, using default")
 		return fallback
 	}
 	return d
 }
 
-// envInt reads a non-negative integer env var.
-func envInt(key string, fallback int) int {
-	v := os.Getenv(key)
+// int reads a non-negative integer setting.
+func (src *source) int(key string, fallback int) int {
+	v := src.get(key)
 	if v == "" {
 		return fallback
 	}
 	n, err := strconv.Atoi(v)
 	if err != nil || n < 0 {
-		log.Printf("WARNING: %s=%q is not a valid integer, using default", key, v)
+		src.reject(key, "not a valid integer, using default")
 		return fallback
 	}
 	return n
@@ -305,6 +562,16 @@ func defaultBCHElectrumServers(network string) []string {
 	}
 }
 
+// defaultTokensFileOr returns ~/.freedom/api-tokens.json, or "" if the home
+// dir can't be determined.
+func defaultTokensFileOr() string {
+	path, err := apitoken.DefaultFile()
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
 // defaultContentDirOr returns ~/.freedom/content, or "" if the home dir can't
 // be determined (the caller then reports the store as disabled).
 func defaultContentDirOr() string {
@@ -315,8 +582,8 @@ func defaultContentDirOr() string {
 	return dir
 }
 
-func envOr(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
+func (src *source) or(key, fallback string) string {
+	if v := src.get(key); v != "" {
 		return v
 	}
 	return fallback
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 )
 
 func TestParseSize(t *testing.T) {
@@ -37,37 +42,46 @@ func TestParseSize(t *testing.T) {
 }
 
 func TestEnvHelpers(t *testing.T) {
+	src := &source{}
 	t.Setenv("FN_TEST_SIZE", "1GB")
-	if got := envSize("FN_TEST_SIZE", 5); got != 1<<30 {
-		t.Errorf("envSize set = %d", got)
+	if got := src.size("FN_TEST_SIZE", 5); got != 1<<30 {
+		t.Errorf("size set = %d", got)
 	}
-	if got := envSize("FN_TEST_SIZE_UNSET", 5); got != 5 {
-		t.Errorf("envSize fallback = %d", got)
+	if got := src.size("FN_TEST_SIZE_UNSET", 5); got != 5 {
+		t.Errorf("size fallback = %d", got)
 	}
 	t.Setenv("FN_TEST_SIZE_BAD", "banana")
-	if got := envSize("FN_TEST_SIZE_BAD", 5); got != 5 {
-		t.Errorf("envSize bad value = %d, want fallback", got)
+	if got := src.size("FN_TEST_SIZE_BAD", 5); got != 5 {
+		t.Errorf("size bad value = %d, want fallback", got)
 	}
 
 	t.Setenv("FN_TEST_DUR", "90m")
-	if got := envDuration("FN_TEST_DUR", time.Hour); got != 90*time.Minute {
-		t.Errorf("envDuration = %v", got)
+	if got := src.duration("FN_TEST_DUR", time.Hour); got != 90*time.Minute {
+		t.Errorf("duration = %v", got)
 	}
 	t.Setenv("FN_TEST_DUR_DAYS", "30d")
-	if got := envDuration("FN_TEST_DUR_DAYS", time.Hour); got != 30*24*time.Hour {
-		t.Errorf("envDuration days = %v", got)
+	if got := src.duration("FN_TEST_DUR_DAYS", time.Hour); got != 30*24*time.Hour {
+		t.Errorf("duration days = %v", got)
 	}
-	if got := envDuration("FN_TEST_DUR_UNSET", time.Hour); got != time.Hour {
-		t.Errorf("envDuration fallback = %v", got)
+	if got := src.duration("FN_TEST_DUR_UNSET", time.Hour); got != time.Hour {
+		t.Errorf("duration fallback = %v", got)
 	}
 
 	t.Setenv("FN_TEST_INT", "7")
-	if got := envInt("FN_TEST_INT", 3); got != 7 {
-		t.Errorf("envInt = %d", got)
+	if got := src.int("FN_TEST_INT", 3); got != 7 {
+		t.Errorf("int = %d", got)
 	}
 	t.Setenv("FN_TEST_INT_BAD", "-2")
-	if got := envInt("FN_TEST_INT_BAD", 3); got != 3 {
-		t.Errorf("envInt negative = %d, want fallback", got)
+	if got := src.int("FN_TEST_INT_BAD", 3); got != 3 {
+		t.Errorf("int negative = %d, want fallback", got)
+	}
+
+	// Each fallback is reported, with where the bad value came from.
+	if len(src.problems) != 2 {
+		t.Fatalf("problems = %v, want the bad size and the bad int", src.problems)
+	}
+	if p := src.problems[0]; p.Key != "FN_TEST_SIZE_BAD" || p.Value != "banana" || p.From != fromEnv {
+		t.Errorf("problem = %+v", p)
 	}
 }
 
@@ -122,3 +136,118 @@ func TestHTTPAddrDefaultByRole(t *testing.T) {
 			cfg.HTTPAddr, cfg.BootstrapMode)
 	}
 }
+
+func TestParseContentGroups(t *testing.T) {
+	groups, err := ParseContentGroups(" team = 12D3KooA, 12D3KooB ;family=12D3KooC;")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "team" || len(groups[0].Members) != 2 ||
+		groups[0].Members[1] != "12D3KooB" || groups[1].Name != "family" || groups[1].Members[0] != "12D3KooC" {
+		t.Fatalf("groups: %+v", groups)
+	}
+	for _, bad := range []string{"team", "=12D3KooA", "team=", "team=A;team=B"} {
+		if _, err := ParseContentGroups(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestContentReprovide(t *testing.T) {
+	for v, want := range map[string]string{"": ReprovideRoots, "all": ReprovideAll, "roots": ReprovideRoots, "some": ReprovideRoots} {
+		t.Setenv("FREEDOM_CONTENT_REPROVIDE", v)
+		if got := LoadConfig().ContentReprovide; got != want {
+			t.Errorf("FREEDOM_CONTENT_REPROVIDE=%q: %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestLogConfig(t *testing.T) {
+	t.Setenv("FREEDOM_LOG_LEVEL", "warn,p2p=debug")
+	t.Setenv("FREEDOM_LOG_FORMAT", "JSON")
+	t.Setenv("FREEDOM_LOG_FILES", "p2p=/tmp/fn-p2p.log")
+	cfg := LoadConfig()
+	if cfg.LogLevel != slog.LevelWarn || cfg.LogLevels[logging.P2P] != slog.LevelDebug {
+		t.Errorf("levels: %v %v", cfg.LogLevel, cfg.LogLevels)
+	}
+	if !cfg.LogJSON || cfg.LogFiles[logging.P2P] != "/tmp/fn-p2p.log" {
+		t.Errorf("format/files: %v %v", cfg.LogJSON, cfg.LogFiles)
+	}
+
+	// Bad values fall back to the defaults instead of stopping the node.
+	t.Setenv("FREEDOM_LOG_LEVEL", "loud")
+	t.Setenv("FREEDOM_LOG_FORMAT", "xml")
+	t.Setenv("FREEDOM_LOG_FILES", "nosuch=/tmp/x.log")
+	cfg = LoadConfig()
+	if cfg.LogLevel != slog.LevelInfo || cfg.LogLevels != nil || cfg.LogJSON || cfg.LogFiles != nil {
+		t.Errorf("fallback: %+v", cfg.LogOptions())
+	}
+}
+
+// testSwarmKey is a swarm.key in the go-ipfs-swarm-key-gen format.
+const testSwarmKey = "/key/swarm/psk/1.0.0/\n/base16/\n" +
+	"8a3c1a2b5e7d9f0c4b6a8e1d3f5a7c9b2d4e6f8a0c1b3d5e7f9a2c4b6d8e0f1a\n"
+
+func TestPrivateNetworkConfig(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "swarm.key")
+	if err := os.WriteFile(key, []byte(testSwarmKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, "")
+	t.Setenv("FREEDOM_BOOTSTRAP", "")
+	t.Setenv("FREEDOM_PROTOCOL_PREFIX", "")
+	t.Setenv("FREEDOM_MDNS_SERVICE", "")
+
+	// The public network by default.
+	t.Setenv("FREEDOM_SWARM_KEY", "")
+	cfg, _, _ := Load(false)
+	if cfg.Private() || cfg.ProtocolPrefix != DefaultProtocolPrefix || cfg.MDNSService != DefaultMDNSService || len(cfg.Bootstrap) == 0 {
+		t.Fatalf("defaults: private=%v prefix=%q mdns=%q bootstrap=%d", cfg.Private(), cfg.ProtocolPrefix, cfg.MDNSService, len(cfg.Bootstrap))
+	}
+
+	// A swarm key drops the public bootstrap list...
+	t.Setenv("FREEDOM_SWARM_KEY", key)
+	cfg, problems, _ := Load(false)
+	if !cfg.Private() || len(cfg.Bootstrap) != 0 || len(problems) != 0 {
+		t.Errorf("swarm key: private=%v bootstrap=%v problems=%v", cfg.Private(), cfg.Bootstrap, problems)
+	}
+	// ...but keeps the network's own.
+	t.Setenv("FREEDOM_BOOTSTRAP", "/ip4/10.0.0.1/tcp/4020/p2p/12D3KooWFRgUQUMvP4rimeZ1vS2DzmP48vvxcfEk5XqWmURMKU13")
+	if cfg, _, _ := Load(false); len(cfg.Bootstrap) != 1 {
+		t.Errorf("own bootstrap list dropped: %v", cfg.Bootstrap)
+	}
+
+	// A prefix of its own is private too, key or not.
+	t.Setenv("FREEDOM_SWARM_KEY", "")
+	t.Setenv("FREEDOM_PROTOCOL_PREFIX", "/acme-names")
+	if cfg, _, _ := Load(false); !cfg.Private() {
+		t.Error("custom prefix not private")
+	}
+
+	// Invalid values are reported but kept, so the node refuses to start
+	// rather than joining the public network.
+	bad := filepath.Join(dir, "bad.key")
+	if err := os.WriteFile(bad, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FREEDOM_SWARM_KEY", bad)
+	t.Setenv("FREEDOM_PROTOCOL_PREFIX", "acme/")
+	cfg, problems, _ = Load(false)
+	if cfg.SwarmKeyFile != bad || cfg.ProtocolPrefix != "acme/" || len(problems) != 2 {
+		t.Errorf("invalid network settings: key %q prefix %q problems %v", cfg.SwarmKeyFile, cfg.ProtocolPrefix, problems)
+	}
+}
+
+func TestCheckProtocolPrefix(t *testing.T) {
+	for _, ok := range []string{"/freedomnames", "/acme-names", "/acme/names"} {
+		if err := CheckProtocolPrefix(ok); err != nil {
+			t.Errorf("%q: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "/", "acme", "/acme/", "/acme names"} {
+		if CheckProtocolPrefix(bad) == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// The config file is an optional YAML document holding the same settings as
+// the FREEDOM_* environment variables, keyed by the variable's name without
+// the prefix, in lower case:
+//
+//	http_addr: 127.0.0.1:8420
+//	content_host_budget: 50G
+//	http_allowed_hosts: [node.internal]
+//	content_groups:
+//	  team: [12D3KooW..., 12D3KooW...]
+//
+// Settings may also be nested by their leading words ("content:" then
+// "host_budget: 50G"). Lists are what the variables write comma-separated,
+// and mappings what they write name=value. Precedence, highest first: flags,
+// environment, file, built-in defaults — so a file suits a systemd unit, and
+// a one-off variable still overrides it.
+
+// FileEnv names the config file. Unset, DefaultFile is used if it exists;
+// set, the file must exist.
+const FileEnv = "FREEDOM_CONFIG"
+
+// knownVars is every setting the loader reads. A file key that is not one of
+// these is reported rather than silently ignored: a typo in a file is far
+// more likely than in a variable someone just exported.
+var knownVars = []string{
+	"FREEDOM_HTTP_ADDR",
+	"FREEDOM_AUTHORING_ADDR",
+	"FREEDOM_DNS_ADDR",
+	"FREEDOM_UPSTREAM_DNS",
+	"FREEDOM_DNS_RECURSION",
+	"FREEDOM_HTTP_ALLOWED_HOSTS",
+	"FREEDOM_HTTP_TOKENS_FILE",
+	"FREEDOM_BOOTSTRAP",
+	"FREEDOM_SWARM_KEY",
+	"FREEDOM_PROTOCOL_PREFIX",
+	"FREEDOM_MDNS_SERVICE",
+	"FREEDOM_CONTENT_DIR",
+	"FREEDOM_BCH_NETWORK",
+	"FREEDOM_BCH_ELECTRUM",
+	"FREEDOM_BCH_MINCONF",
+	"FREEDOM_BCH_CHECKPOINT",
+	"FREEDOM_CONTENT_REPLICAS",
+	"FREEDOM_CONTENT_HOST_BUDGET",
+	"FREEDOM_CONTENT_HOST_TTL",
+	"FREEDOM_CONTENT_HEAL_INTERVAL",
+	"FREEDOM_CONTENT_UP_RATE",
+	"FREEDOM_CONTENT_DOWN_RATE",
+	"FREEDOM_CONTENT_MAX_PUSH_SIZE",
+	"FREEDOM_CONTENT_ERASURE",
+	"FREEDOM_CONTENT_REPROVIDE",
+	"FREEDOM_CONTENT_PEER_BUDGET",
+	"FREEDOM_CONTENT_PEER_MAX_SETS",
+	"FREEDOM_CONTENT_ALLOW",
+	"FREEDOM_CONTENT_DENY",
+	"FREEDOM_CONTENT_GROUPS",
+	"FREEDOM_LOG_LEVEL",
+	"FREEDOM_LOG_FORMAT",
+	"FREEDOM_LOG_FILES",
+}
+
+// fileKey is the config file spelling of a FREEDOM_* variable.
+func fileKey(env string) string {
+	return strings.ToLower(strings.TrimPrefix(env, "FREEDOM_"))
+}
+
+// DefaultFile returns ~/.freedom/config.yaml, or "" if the home directory
+// can't be determined.
+func DefaultFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".freedom", "config.yaml")
+}
+
+// Problem is one rejected setting. The setting falls back to its default;
+// the node still starts.
+type Problem struct {
+	Key    string // the FREEDOM_* variable, or the file key if it is unknown
+	Value  string
+	From   string // "environment" or the config file's path
+	Reason string // what is wrong, and what is used instead
+}
+
+func (p Problem) String() string {
+	if p.Value == "" {
+		return fmt.Sprintf("%s (%s): %s", p.Key, p.From, p.Reason)
+	}
+	return fmt.Sprintf("%s=%q (%s): %s", p.Key, p.Value, p.From, p.Reason)
+}
+
+// fromEnv is Problem.From for a value set in the environment.
+const fromEnv = "environment"
+
+// source is where settings are looked up: the environment first, then the
+// config file. It collects the problems found along the way.
+type source struct {
+	path     string            // config file read, "" if none
+	file     map[string]string // FREEDOM_* name -> value, in variable syntax
+	problems []Problem
+}
+
+// newSource reads the config file, if any. On error the returned source has
+// no file values, so loading carries on from the environment alone.
+func newSource() (*source, error) {
+	src := &source{}
+	path, explicit := os.LookupEnv(FileEnv)
+	if !explicit || path == "" {
+		path = DefaultFile()
+	}
+	if path == "" {
+		return src, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return src, nil
+	}
+	if err != nil {
+		return src, fmt.Errorf("config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return src, fmt.Errorf("config file %s: %w", path, err)
+	}
+	src.path = path
+	src.file = map[string]string{}
+	src.flatten("", doc)
+	return src, nil
+}
+
+// flatten walks the document, joining nested keys with "_" until they name a
+// setting.
+func (src *source) flatten(prefix string, doc map[string]any) {
+	for _, k := range sortedKeys(doc) {
+		v := doc[k]
+		key := strings.ToLower(prefix + k)
+		env := "FREEDOM_" + strings.ToUpper(key)
+		if slices.Contains(knownVars, env) {
+			s, err := fileValue(v, env == "FREEDOM_CONTENT_GROUPS")
+			if err != nil {
+				src.problems = append(src.problems, Problem{Key: env, From: src.path, Reason: err.Error() + "; ignored"})
+				continue
+			}
+			src.file[env] = s
+			continue
+		}
+		if nested, ok := v.(map[string]any); ok {
+			src.flatten(key+"_", nested)
+			continue
+		}
+		src.problems = append(src.problems, Problem{Key: key, From: src.path, Reason: "unknown setting; ignored"})
+	}
+}
+
+// fileValue renders a YAML value in the syntax of the matching variable.
+// Groups are the one mapping whose entries are themselves lists, so they
+// take the variable's ";" separator.
+func fileValue(v any, groups bool) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		return joinList(v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sep := ","
+		if groups {
+			sep = ";"
+		}
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			var s string
+			var err error
+			if list, ok := v[k].([]any); ok {
+				s, err = joinList(list)
+			} else {
+				s, err = scalar(v[k])
+			}
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, k+"="+s)
+		}
+		return strings.Join(parts, sep), nil
+	default:
+		return scalar(v)
+	}
+}
+
+func joinList(list []any) (string, error) {
+	parts := make([]string, 0, len(list))
+	for _, e := range list {
+		s, err := scalar(e)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func scalar(v any) (string, error) {
+	switch v.(type) {
+	case string, int, int64, uint64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("want a value, got %T", v)
+	}
+}
+
+// lookup returns a setting's value and where it came from.
+func (src *source) lookup(key string) (value, from string) {
+	if v := os.Getenv(key); v != "" {
+		return v, fromEnv
+	}
+	if v := src.file[key]; v != "" {
+		return v, src.path
+	}
+	return "", ""
+}
+
+func (src *source) get(key string) string {
+	v, _ := src.lookup(key)
+	return v
+}
+
+// reject records that key's value is unusable.
+func (src *source) reject(key, reason string) {
+	v, from := src.lookup(key)
+	src.problems = append(src.problems, Problem{Key: key, Value: v, From: from, Reason: reason})
+}
+
+// Setting is one effective setting, keyed like the config file.
+type Setting struct {
+	Key   string
+	Value any // string, int64, []string, or a map of strings or lists
+}
+
+// Settings returns the effective configuration in config file form, in a
+// fixed order. Written out with WriteYAML it is a valid config file.
+func (c *Config) Settings() []Setting {
+	recursion := "local"
+	if c.DNSRecursionAny {
+		recursion = "any"
+	}
+	erasure := ""
+	if c.ContentErasure.Enabled() {
+		erasure = c.ContentErasure.String()
+	}
+	groups := map[string][]string{}
+	for _, g := range c.ContentGroups {
+		groups[g.Name] = g.Members
+	}
+	levels := []string{c.LogLevel.String()}
+	for _, sub := range sortedKeys(c.LogLevels) {
+		levels = append(levels, sub+"="+c.LogLevels[sub].String())
+	}
+	format := "text"
+	if c.LogJSON {
+		format = "json"
+	}
+	s := func(env string, v any) Setting { return Setting{Key: fileKey(env), Value: v} }
+	return []Setting{
+		s("FREEDOM_HTTP_ADDR", c.HTTPAddr),
+		s("FREEDOM_AUTHORING_ADDR", c.AuthoringAddr),
+		s("FREEDOM_DNS_ADDR", c.DNSAddr),
+		s("FREEDOM_UPSTREAM_DNS", c.UpstreamDNS),
+		s("FREEDOM_DNS_RECURSION", recursion),
+		s("FREEDOM_HTTP_ALLOWED_HOSTS", list(c.HTTPAllowedHosts)),
+		s("FREEDOM_HTTP_TOKENS_FILE", c.HTTPTokensFile),
+		s("FREEDOM_BOOTSTRAP", list(c.Bootstrap)),
+		s("FREEDOM_SWARM_KEY", c.SwarmKeyFile),
+		s("FREEDOM_PROTOCOL_PREFIX", c.ProtocolPrefix),
+		s("FREEDOM_MDNS_SERVICE", c.MDNSService),
+		s("FREEDOM_CONTENT_DIR", c.ContentDir),
+		s("FREEDOM_BCH_NETWORK", c.BCHNetwork),
+		s("FREEDOM_BCH_ELECTRUM", list(c.BCHElectrum)),
+		s("FREEDOM_BCH_MINCONF", c.BCHMinConf),
+		s("FREEDOM_BCH_CHECKPOINT", c.BCHCheckpoint),
+		s("FREEDOM_CONTENT_REPLICAS", int64(c.ContentReplicas)),
+		s("FREEDOM_CONTENT_HOST_BUDGET", c.ContentHostBudget),
+		s("FREEDOM_CONTENT_HOST_TTL", c.ContentHostTTL.String()),
+		s("FREEDOM_CONTENT_HEAL_INTERVAL", c.ContentHealInterval.String()),
+		s("FREEDOM_CONTENT_UP_RATE", c.ContentUpRate),
+		s("FREEDOM_CONTENT_DOWN_RATE", c.ContentDownRate),
+		s("FREEDOM_CONTENT_MAX_PUSH_SIZE", c.ContentMaxPushSize),
+		s("FREEDOM_CONTENT_ERASURE", erasure),
+		s("FREEDOM_CONTENT_REPROVIDE", c.ContentReprovide),
+		s("FREEDOM_CONTENT_PEER_BUDGET", c.ContentPeerQuota.Bytes),
+		s("FREEDOM_CONTENT_PEER_MAX_SETS", int64(c.ContentPeerQuota.Sets)),
+		s("FREEDOM_CONTENT_ALLOW", list(c.ContentAllowPeers)),
+		s("FREEDOM_CONTENT_DENY", list(c.ContentDenyPeers)),
+		s("FREEDOM_CONTENT_GROUPS", groups),
+		s("FREEDOM_LOG_LEVEL", strings.ToLower(strings.Join(levels, ","))),
+		s("FREEDOM_LOG_FORMAT", format),
+		s("FREEDOM_LOG_FILES", mapOrEmpty(c.LogFiles)),
+	}
+}
+
+// list keeps a nil list from being written as YAML null.
+func list(l []string) []string {
+	if l == nil {
+		return []string{}
+	}
+	return l
+}
+
+func mapOrEmpty(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteYAML writes the effective configuration as a config file.
+func (c *Config) WriteYAML(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.Settings() {
+		var v yaml.Node
+		if err := v.Encode(s.Value); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.Key}, &v)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Changed returns the keys of the settings whose effective value differs
+// between two configurations, in Settings order.
+func Changed(old, cur *Config) []string {
+	was := old.Settings()
+	var keys []string
+	for i, s := range cur.Settings() {
+		if !reflect.DeepEqual(was[i].Value, s.Value) {
+			keys = append(keys, s.Key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeConfigFile points FREEDOM_CONFIG at a file holding body.
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileEnv, path)
+	return path
+}
+
+func TestConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+upstream_dns: 9.9.9.9:53
+http_allowed_hosts: [Node.Internal, fn.lan]
+content:
+  host_budget: 1G
+  host_ttl: 7d
+  up_rate: 512K
+  groups:
+    team: [12D3KooA, 12D3KooB]
+    family: [12D3KooC]
+dns_addr: :5300
+content_replicas: lots
+colour: blue
+`)
+	// The environment wins over the file.
+	t.Setenv("FREEDOM_DNS_ADDR", ":5400")
+	t.Setenv("FREEDOM_UPSTREAM_DNS", "")
+	t.Setenv("FREEDOM_HTTP_ALLOWED_HOSTS", "")
+	t.Setenv("FREEDOM_CONTENT_HOST_BUDGET", "")
+	t.Setenv("FREEDOM_CONTENT_REPLICAS", "")
+
+	cfg, problems, err := Load(false)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.File != path {
+		t.Errorf("File = %q, want %q", cfg.File, path)
+	}
+	if cfg.UpstreamDNS != "9.9.9.9:53" || cfg.DNSAddr != ":5400" {
+		t.Errorf("upstream %q, dns addr %q", cfg.UpstreamDNS, cfg.DNSAddr)
+	}
+	if !slices.Equal(cfg.HTTPAllowedHosts, []string{"node.internal", "fn.lan"}) {
+		t.Errorf("allowed hosts %v", cfg.HTTPAllowedHosts)
+	}
+	if cfg.ContentHostBudget != 1<<30 || cfg.ContentHostTTL != 7*24*time.Hour || cfg.ContentUpRate != 512<<10 {
+		t.Errorf("nested content settings: budget %d ttl %v up %d", cfg.ContentHostBudget, cfg.ContentHostTTL, cfg.ContentUpRate)
+	}
+	if len(cfg.ContentGroups) != 2 || cfg.ContentGroups[0].Name != "family" ||
+		!slices.Equal(cfg.ContentGroups[1].Members, []string{"12D3KooA", "12D3KooB"}) {
+		t.Errorf("groups %+v", cfg.ContentGroups)
+	}
+
+	// An unknown key and a bad value are reported, not fatal.
+	if cfg.ContentReplicas != 3 {
+		t.Errorf("bad replicas = %d, want the default", cfg.ContentReplicas)
+	}
+	var keys []string
+	for _, p := range problems {
+		keys = append(keys, p.Key)
+		if p.From != path {
+			t.Errorf("%s: from %q, want the file", p.Key, p.From)
+		}
+	}
+	if !slices.Equal(keys, []string{"colour", "FREEDOM_CONTENT_REPLICAS"}) {
+		t.Errorf("problems %v", problems)
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	// A file named explicitly must exist.
+	t.Setenv(FileEnv, filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, _, err := Load(false); err == nil {
+		t.Error("missing explicit file accepted")
+	}
+
+	// A file that does not parse is skipped whole; the environment still applies.
+	writeConfigFile(t, "dns_addr: [unclosed\n")
+	t.Setenv("FREEDOM_DNS_ADDR", ":5400")
+	cfg, _, err := Load(false)
+	if err == nil {
+		t.Error("malformed file accepted")
+	}
+	if cfg.File != "" || cfg.DNSAddr != ":5400" {
+		t.Errorf("after a bad file: File %q, DNSAddr %q", cfg.File, cfg.DNSAddr)
+	}
+}
+
+// TestWriteYAMLRoundTrip checks that `config check` output is itself a valid
+// config file describing the same configuration.
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	writeConfigFile(t, `
+content_host_budget: 2G
+content_erasure: 4+2
+content_groups: {team: [12D3KooA, 12D3KooB]}
+log_level: warn,dns=debug
+log_files: {p2p: /tmp/fn-p2p.log}
+bch_minconf: 3
+`)
+	want, problems, err := Load(false)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("load: %v %v", err, problems)
+	}
+	var buf bytes.Buffer
+	if err := want.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, buf.String())
+	got, problems, err := Load(false)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("reload: %v %v\n%s", err, problems, buf.String())
+	}
+	if changed := Changed(want, got); len(changed) != 0 {
+		t.Errorf("round trip changed %v\n%s", changed, buf.String())
+	}
+}
+
+func TestChanged(t *testing.T) {
+	writeConfigFile(t, "")
+	a := LoadConfig()
+	b := LoadConfig()
+	b.UpstreamDNS = "9.9.9.9:53"
+	b.ContentUpRate = 1 << 20
+	if got := Changed(a, b); !slices.Equal(got, []string{"upstream_dns", "content_up_rate"}) {
+		t.Errorf("Changed = %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package content
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// This file implements content archives: one content set — its root blob and,
+// for chunked content, every chunk — in a single file, for moving content
+// between nodes without the network (seeding a new server from a USB drive,
+// keeping an offline copy of a site). It plays the role a CAR file plays for
+// IPFS.
+//
+// The format is the magic line followed by one record per blob, the root
+// first:
+//
+//	uvarint(len(hash)) hash uvarint(len(data)) data
+//
+// Every record names its own hash, so an archive is self-verifying: a reader
+// recomputes each blob's hash and rejects the archive at the first mismatch,
+// and whether the blobs form a complete set is decided by the root's manifest,
+// not by anything else the archive claims. Chunks appear once each, in
+// manifest order.
+
+// archiveMagic starts every content archive.
+const archiveMagic = "freedom-names/archive@1\n"
+
+// ErrBadArchive means an archive is malformed, truncated or fails hash
+// verification.
+var ErrBadArchive = errors.New("invalid content archive")
+
+// ArchiveWriter writes a content archive.
+type ArchiveWriter struct {
+	w   io.Writer
+	hdr []byte
+}
+
+// NewArchiveWriter writes the archive header to w and returns a writer for
+// its records. The caller writes the root first.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	if _, err := io.WriteString(w, archiveMagic); err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{w: w, hdr: make([]byte, 0, 2*binary.MaxVarintLen64+64)}, nil
+}
+
+// WriteBlob appends one blob record.
+func (aw *ArchiveWriter) WriteBlob(hash string, data []byte) error {
+	hdr := binary.AppendUvarint(aw.hdr[:0], uint64(len(hash)))
+	hdr = append(hdr, hash...)
+	hdr = binary.AppendUvarint(hdr, uint64(len(data)))
+	if _, err := aw.w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := aw.w.Write(data)
+	return err
+}
+
+// ArchiveReader reads a content archive record by record, verifying each.
+type ArchiveReader struct {
+	r *bufio.Reader
+}
+
+// NewArchiveReader checks the archive header and returns a reader for its
+// records.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != archiveMagic {
+		return nil, fmt.Errorf("%w: not a content archive", ErrBadArchive)
+	}
+	return &ArchiveReader{r: br}, nil
+}
+
+// Next returns the next blob and its hash, which it has verified the blob
+// against. It returns io.EOF after the last record; anything malformed,
+// oversized or truncated is ErrBadArchive.
+func (ar *ArchiveReader) Next() (string, []byte, error) {
+	hashLen, err := binary.ReadUvarint(ar.r)
+	if err == io.EOF {
+		return "", nil, io.EOF
+	}
+	if err != nil || hashLen == 0 || hashLen > 128 {
+		return "", nil, fmt.Errorf("%w: bad record header", ErrBadArchive)
+	}
+	hashBuf := make([]byte, hashLen)
+	if _, err := io.ReadFull(ar.r, hashBuf); err != nil {
+		return "", nil, fmt.Errorf("%w: truncated record", ErrBadArchive)
+	}
+	hash := string(hashBuf)
+	if !IsContentHash(hash) {
+		return "", nil, fmt.Errorf("%w: bad hash %q", ErrBadArchive, hash)
+	}
+	size, err := binary.ReadUvarint(ar.r)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: truncated record", ErrBadArchive)
+	}
+	if size > MaxBlobSize {
+		return "", nil, fmt.Errorf("%w: blob %s exceeds %d bytes", ErrBadArchive, hash, MaxBlobSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(ar.r, data); err != nil {
+		return "", nil, fmt.Errorf("%w: truncated blob %s", ErrBadArchive, hash)
+	}
+	got, err := ContentHash(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if got != hash {
+		return "", nil, fmt.Errorf("%w: blob %s does not match its hash", ErrBadArchive, hash)
+	}
+	return hash, data, nil
+}
@@ -0,0 +1,93 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, blobs ...[]byte) ([]byte, []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	var hashes []string
+	for _, b := range blobs {
+		h, err := ContentHash(b)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		if err := aw.WriteBlob(h, b); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		hashes = append(hashes, h)
+	}
+	return buf.Bytes(), hashes
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	blobs := [][]byte{[]byte("root"), testBytes(100000), {}}
+	archive, hashes := writeTestArchive(t, blobs...)
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	for i := range blobs {
+		h, data, err := ar.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if h != hashes[i] || !bytes.Equal(data, blobs[i]) {
+			t.Fatalf("record %d mismatch", i)
+		}
+	}
+	if _, _, err := ar.Next(); err != io.EOF {
+		t.Fatalf("after last record: %v, want io.EOF", err)
+	}
+}
+
+// TestArchiveRejectsDamage checks that a flipped byte anywhere in a blob, a
+// cut-off archive or a foreign file is ErrBadArchive, never silently accepted.
+func TestArchiveRejectsDamage(t *testing.T) {
+	archive, _ := writeTestArchive(t, []byte("root"), testBytes(5000))
+
+	readAll := func(data []byte) error {
+		ar, err := NewArchiveReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, _, err := ar.Next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	// A valid hash announcing a blob far beyond MaxBlobSize must be refused
+	// before anything is allocated for it.
+	h, _ := ContentHash([]byte("x"))
+	huge := binary.AppendUvarint([]byte(archiveMagic), uint64(len(h)))
+	huge = binary.AppendUvarint(append(huge, h...), 1<<40)
+
+	tampered := bytes.Clone(archive)
+	tampered[len(tampered)-10] ^= 0xff
+	cases := map[string][]byte{
+		"tampered":  tampered,
+		"truncated": archive[:len(archive)-1],
+		"no magic":  archive[1:],
+		"huge size": huge,
+	}
+	for name, data := range cases {
+		if err := readAll(data); !errors.Is(err, ErrBadArchive) {
+			t.Errorf("%s: %v, want ErrBadArchive", name, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package content
+
+import "fmt"
+
+// This file implements content-defined chunking (FastCDC). Fixed-size chunking
+// cuts at multiples of ChunkSize, so inserting or deleting a single byte near
+// the start of a file shifts every later boundary and changes every chunk
+// hash: republishing a lightly edited video stores and replicates all of it
+// again. Content-defined chunking instead places a boundary wherever a rolling
+// hash of the last few dozen bytes hits a pattern, so boundaries move with the
+// data around an edit and the chunks away from it keep their hashes — the
+// blobstore and every replica already hold them.
+
+// Chunking selects how content larger than one chunk is split. It is chosen
+// per upload; the manifest records the outcome (explicit per-chunk sizes for
+// content-defined chunks), so readers never need to know which was used.
+type Chunking string
+
+const (
+	// ChunkingFixed cuts every ChunkSize bytes and records a version 1
+	// manifest. It is the default, so existing content keeps its addresses.
+	ChunkingFixed Chunking = "fixed"
+	// ChunkingCDC cuts at content-defined boundaries (FastCDC) and records a
+	// version 2 manifest listing each chunk's size.
+	ChunkingCDC Chunking = "cdc"
+)
+
+// ParseChunking validates a chunking mode name. The empty string selects the
+// default, ChunkingFixed.
+func ParseChunking(s string) (Chunking, error) {
+	switch Chunking(s) {
+	case "", ChunkingFixed:
+		return ChunkingFixed, nil
+	case ChunkingCDC:
+		return ChunkingCDC, nil
+	}
+	return "", fmt.Errorf("unknown chunking mode %q (want %q or %q)", s, ChunkingFixed, ChunkingCDC)
+}
+
+// Content-defined chunk bounds. The average is half of ChunkSize so an edit
+// costs a few MiB of new chunks rather than 8; the maximum is ChunkSize, so a
+// chunk still fits the one-chunk buffer PutStream works with; the minimum
+// keeps the chunk count, and so the manifest, bounded (see MaxManifestChunks).
+const (
+	CDCMinChunk = 1 << 20
+	CDCAvgChunk = 4 << 20
+	CDCMaxChunk = ChunkSize
+)
+
+// Normalized chunking (FastCDC §3.3): below the average size a boundary needs
+// two more zero bits than the average implies, above it two fewer, which pulls
+// chunk sizes toward CDCAvgChunk. The masks select the *top* bits of the gear
+// hash, which depend on the last 64 bytes; the low bits would only see the
+// last few.
+const (
+	cdcMaskSmall = uint64(1<<24-1) << (64 - 24) // log2(CDCAvgChunk) + 2 bits
+	cdcMaskLarge = uint64(1<<20-1) << (64 - 20) // log2(CDCAvgChunk) - 2 bits
+)
+
+// gearTable maps each byte value to a pseudo-random 64-bit word. It is part
+// of the chunk format: changing it moves every boundary, which costs nothing
+// in correctness (manifests list the chunks they use) but forfeits dedup
+// against everything stored before. It is generated from a fixed seed with
+// splitmix64 rather than spelled out as 256 literals.
+var gearTable = func() (t [256]uint64) {
+	x := uint64(0x46524545444f4d21) // "FREEDOM!"
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// Cut returns the length of the next chunk at the start of data. data must
+// hold at least ChunkSize bytes unless the stream has ended, in which case it
+// is the whole remainder; the result is then never zero for non-empty data
+// and never above ChunkSize.
+func (c Chunking) Cut(data []byte) int {
+	if c == ChunkingCDC {
+		return cdcCut(data)
+	}
+	return min(len(data), ChunkSize)
+}
+
+// cdcCut finds a FastCDC boundary in data. Nothing shorter than CDCMinChunk
+// is ever cut (the hash is not even computed there), and a chunk that reaches
+// CDCMaxChunk without a boundary is cut there.
+func cdcCut(data []byte) int {
+	n := len(data)
+	if n <= CDCMinChunk {
+		return n
+	}
+	if n > CDCMaxChunk {
+		n = CDCMaxChunk
+	}
+	normal := min(n, CDCAvgChunk)
+	var h uint64
+	i := CDCMinChunk
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&cdcMaskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&cdcMaskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
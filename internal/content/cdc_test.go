@@ -0,0 +1,90 @@
+package content
+
+import (
+	"bytes"
+	"testing"
+)
+
+// cdcChunks splits data the way PutStreamWith does, returning each chunk.
+func cdcChunks(data []byte) [][]byte {
+	var out [][]byte
+	for len(data) > 0 {
+		window := data[:min(len(data), ChunkSize+1)]
+		n := ChunkingCDC.Cut(window)
+		out = append(out, data[:n])
+		data = data[n:]
+	}
+	return out
+}
+
+func TestCDCCutBounds(t *testing.T) {
+	data := testBytes(3 * ChunkSize)
+	chunks := cdcChunks(data)
+	if len(chunks) < 3 {
+		t.Fatalf("24 MiB split into only %d chunk(s)", len(chunks))
+	}
+	var total int
+	for i, c := range chunks {
+		total += len(c)
+		if len(c) > CDCMaxChunk {
+			t.Fatalf("chunk %d is %d bytes, above the %d max", i, len(c), CDCMaxChunk)
+		}
+		if i < len(chunks)-1 && len(c) < CDCMinChunk {
+			t.Fatalf("chunk %d is %d bytes, below the %d min", i, len(c), CDCMinChunk)
+		}
+	}
+	if total != len(data) {
+		t.Fatalf("chunks cover %d bytes, want %d", total, len(data))
+	}
+}
+
+func TestCDCCutShortInput(t *testing.T) {
+	for _, n := range []int{1, 100, CDCMinChunk} {
+		if got := ChunkingCDC.Cut(make([]byte, n)); got != n {
+			t.Fatalf("Cut of %d remaining bytes = %d, want all of them", n, got)
+		}
+	}
+	// No boundary in a run of zeros: cut at the maximum.
+	if got := ChunkingCDC.Cut(make([]byte, ChunkSize+1)); got != CDCMaxChunk {
+		t.Fatalf("Cut of boundary-free data = %d, want %d", got, CDCMaxChunk)
+	}
+}
+
+// TestCDCSurvivesInsertion is the point of content-defined chunking: an edit
+// near the start must leave the later chunks, and so their hashes, unchanged.
+func TestCDCSurvivesInsertion(t *testing.T) {
+	orig := testBytes(4 * ChunkSize)
+	edited := append([]byte("one inserted line\n"), orig...)
+
+	seen := map[string]bool{}
+	for _, c := range cdcChunks(orig) {
+		seen[string(c)] = true
+	}
+	after := cdcChunks(edited)
+	shared := 0
+	for _, c := range after {
+		if seen[string(c)] {
+			shared++
+		}
+	}
+	if shared < len(after)-2 {
+		t.Fatalf("only %d of %d chunks survived a prefix insertion", shared, len(after))
+	}
+
+	// Fixed-size chunking, by contrast, shares nothing.
+	if bytes.Equal(orig[ChunkSize:2*ChunkSize], edited[ChunkSize:2*ChunkSize]) {
+		t.Fatal("fixed-size chunks unexpectedly survived the insertion")
+	}
+}
+
+func TestParseChunking(t *testing.T) {
+	for in, want := range map[string]Chunking{"": ChunkingFixed, "fixed": ChunkingFixed, "cdc": ChunkingCDC} {
+		got, err := ParseChunking(in)
+		if err != nil || got != want {
+			t.Errorf("ParseChunking(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseChunking("rabin"); err == nil {
+		t.Error("ParseChunking accepted an unknown mode")
+	}
+}
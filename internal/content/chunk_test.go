@@ -1,6 +1,7 @@
 package content
 
 import (
+	"bytes"
 	"math/rand"
 	"testing"
 )
@@ -89,6 +90,70 @@ func TestDecodeManifestRejects(t *testing.T) {
 	}
 }
 
+func TestManifestV2RoundTrip(t *testing.T) {
+	h1, _ := ContentHash([]byte("chunk one"))
+	h2, _ := ContentHash([]byte("chunk two"))
+	h3, _ := ContentHash([]byte("chunk three"))
+	m := &ChunkManifest{TotalSize: 3<<20 + 5, Chunks: []string{h1, h2, h3}, Sizes: []int64{2 << 20, 5, 1 << 20}}
+
+	data, err := EncodeManifest(m)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte(manifestMagicV2)) {
+		t.Fatalf("manifest with sizes not encoded as version 2: %q", data[:30])
+	}
+	got, ok := DecodeManifest(data)
+	if !ok {
+		t.Fatalf("decode rejected a valid v2 manifest")
+	}
+	for i, want := range m.Sizes {
+		if got.ChunkLen(i) != want {
+			t.Fatalf("ChunkLen(%d) = %d, want %d", i, got.ChunkLen(i), want)
+		}
+	}
+}
+
+// TestManifestV1EncodingUnchanged pins the version 1 encoding: fixed-size
+// manifests are published addresses, so the new optional fields must not
+// change their bytes.
+func TestManifestV1EncodingUnchanged(t *testing.T) {
+	h1, _ := ContentHash([]byte("a"))
+	h2, _ := ContentHash([]byte("b"))
+	data, err := EncodeManifest(&ChunkManifest{TotalSize: ChunkSize + 1, ChunkSize: ChunkSize, Chunks: []string{h1, h2}})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	want := manifestMagic + `{"totalSize":8388609,"chunkSize":8388608,"chunks":["` + h1 + `","` + h2 + `"]}`
+	if string(data) != want {
+		t.Fatalf("v1 encoding changed:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestDecodeManifestV2Rejects(t *testing.T) {
+	h1, _ := ContentHash([]byte("a"))
+	h2, _ := ContentHash([]byte("b"))
+	encode := func(body string) []byte { return []byte(manifestMagicV2 + body) }
+	chunks := `"chunks":["` + h1 + `","` + h2 + `"]`
+
+	cases := map[string][]byte{
+		"sizes missing":        encode(`{"totalSize":10,` + chunks + `}`),
+		"size count mismatch":  encode(`{"totalSize":10,` + chunks + `,"sizes":[10]}`),
+		"sizes do not sum":     encode(`{"totalSize":11,` + chunks + `,"sizes":[5,5]}`),
+		"zero size":            encode(`{"totalSize":10,` + chunks + `,"sizes":[10,0]}`),
+		"negative size":        encode(`{"totalSize":10,` + chunks + `,"sizes":[11,-1]}`),
+		"chunk over blob max":  encode(`{"totalSize":33554434,` + chunks + `,"sizes":[33554433,1]}`),
+		"mixed with chunkSize": encode(`{"totalSize":10,"chunkSize":5,` + chunks + `,"sizes":[5,5]}`),
+		"single chunk":         encode(`{"totalSize":10,"chunks":["` + h1 + `"],"sizes":[10]}`),
+		"v1 magic with sizes":  []byte(manifestMagic + `{"totalSize":10,"chunkSize":5,` + chunks + `,"sizes":[5,5]}`),
+	}
+	for name, data := range cases {
+		if _, ok := DecodeManifest(data); ok {
+			t.Errorf("%s: DecodeManifest accepted invalid input", name)
+		}
+	}
+}
+
 // TestPutStreamSingleBlob checks content up to one chunk keeps the plain
 // content-hash address (no manifest), including exactly at the boundary.
 
@@ -100,3 +165,73 @@ func testBytes(n int) []byte {
 	rand.New(rand.NewSource(42)).Read(data)
 	return data
 }
+
+func testErasureManifest(t *testing.T, e Erasure, chunks int) *ChunkManifest {
+	t.Helper()
+	m := &ChunkManifest{Erasure: &e}
+	for i := 0; i < chunks; i++ {
+		h, _ := ContentHash([]byte{byte(i), byte(i >> 8)})
+		m.Chunks = append(m.Chunks, h)
+		m.Sizes = append(m.Sizes, CDCMinChunk)
+		m.TotalSize += CDCMinChunk
+		row := make([]string, e.Shards())
+		for j := range row {
+			row[j], _ = ContentHash([]byte{byte(i), byte(i >> 8), byte(j)})
+		}
+		m.Shards = append(m.Shards, row)
+	}
+	return m
+}
+
+func TestManifestErasureRoundTrip(t *testing.T) {
+	m := testErasureManifest(t, Erasure{K: 4, M: 2}, 3)
+	data, err := EncodeManifest(m)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, ok := DecodeManifest(data)
+	if !ok || got.Erasure == nil || *got.Erasure != *m.Erasure || len(got.Shards) != 3 {
+		t.Fatalf("decode: ok=%v %+v", ok, got)
+	}
+	if col := got.Column(5); len(col) != 3 || col[2] != m.Shards[2][5] {
+		t.Fatalf("Column(5) = %v", col)
+	}
+}
+
+func TestManifestErasureRejects(t *testing.T) {
+	cases := map[string]func(m *ChunkManifest){
+		"short row":       func(m *ChunkManifest) { m.Shards[1] = m.Shards[1][:5] },
+		"missing row":     func(m *ChunkManifest) { m.Shards = m.Shards[:2] },
+		"bad shard hash":  func(m *ChunkManifest) { m.Shards[0][0] = "nope" },
+		"invalid layout":  func(m *ChunkManifest) { m.Erasure.M = 0 },
+		"shards, no code": func(m *ChunkManifest) { m.Erasure = nil },
+	}
+	for name, mutate := range cases {
+		m := testErasureManifest(t, Erasure{K: 4, M: 2}, 3)
+		mutate(m)
+		data, _ := EncodeManifest(m)
+		if _, ok := DecodeManifest(data); ok {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	// An erasure layout is version 2 only.
+	m := testErasureManifest(t, Erasure{K: 4, M: 2}, 3)
+	m.Sizes, m.ChunkSize = nil, CDCMinChunk
+	data, _ := EncodeManifest(m)
+	if _, ok := DecodeManifest(data); ok {
+		t.Errorf("version 1 manifest with an erasure layout accepted")
+	}
+}
+
+// TestManifestErasureFitsProbeLimit checks the largest erasure-coded manifest
+// is still small enough for LoadContentIndex to recognize it as one.
+func TestManifestErasureFitsProbeLimit(t *testing.T) {
+	m := testErasureManifest(t, Erasure{K: MaxErasureShards - 1, M: 1}, MaxManifestChunks)
+	data, err := EncodeManifest(m)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(data) > manifestProbeLimit {
+		t.Fatalf("largest manifest is %d bytes, over the %d probe limit", len(data), manifestProbeLimit)
+	}
+}
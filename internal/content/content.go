@@ -30,14 +30,18 @@ const MaxBlobSize = 32 << 20
 // ChunkSize is the fixed size of each chunk of large content (8 MiB). Content
 // up to ChunkSize is stored as a single blob whose hash is the content hash
 // (unchanged from the pre-chunking format); anything larger becomes
-// ceil(size/ChunkSize) chunk blobs plus a manifest.
+// ceil(size/ChunkSize) chunk blobs plus a manifest — or, with ChunkingCDC,
+// content-defined chunks of at most ChunkSize (see cdc.go).
 const ChunkSize = 8 << 20
 
 // MaxContentSize caps total content addressed by one manifest (1 GiB).
 const MaxContentSize = 1 << 30
 
-// MaxManifestChunks bounds a manifest's chunk list (MaxContentSize/ChunkSize).
-const MaxManifestChunks = MaxContentSize / ChunkSize
+// MaxManifestChunks bounds a manifest's chunk list. Content-defined chunks are
+// never shorter than CDCMinChunk (bar the last), so MaxContentSize/CDCMinChunk
+// covers both manifest versions; a fixed-size manifest is held to its own
+// tighter count by the TotalSize check in DecodeManifest.
+const MaxManifestChunks = MaxContentSize / CDCMinChunk
 
 // ErrBlobTooLarge is returned when data exceeds MaxBlobSize.
 var ErrBlobTooLarge = fmt.Errorf("blob exceeds max size of %d bytes", MaxBlobSize)
@@ -206,56 +210,113 @@ func (s *BlobStore) Open(hash string) (io.ReadCloser, int64, error) {
 // as a manifest only if it starts with this prefix AND the remainder parses as
 // a strictly valid manifest (DecodeManifest), so ordinary content is not
 // misread as one.
-const manifestMagic = "freedom-names/manifest@1\n"
+//
+// Version 1 describes fixed-size chunks (ChunkSize each, bar the last).
+// Version 2 lists every chunk's size explicitly, which content-defined
+// chunking needs (see cdc.go). Both stay readable forever: a manifest's hash is
+// a published address.
+const (
+	manifestMagic   = "freedom-names/manifest@1\n"
+	manifestMagicV2 = "freedom-names/manifest@2\n"
+)
 
-// ChunkManifest describes content split into fixed-size chunks. Every chunk is
-// exactly ChunkSize bytes except the last, which holds the remainder.
+// ChunkManifest describes content split into chunks. A version 1 manifest has
+// ChunkSize set and every chunk is exactly ChunkSize bytes except the last,
+// which holds the remainder. A version 2 manifest has Sizes instead, one entry
+// per chunk.
+//
+// A version 2 manifest may also carry an erasure layout (see erasure.go):
+// Erasure names K and M, and Shards lists, per chunk, the hashes of its K+M
+// shards. The shards are ordinary blobs; replicas hold a column of them
+// instead of the chunks themselves.
 type ChunkManifest struct {
-	TotalSize int64    `json:"totalSize"`
-	ChunkSize int64    `json:"chunkSize"`
-	Chunks    []string `json:"chunks"`
+	TotalSize int64      `json:"totalSize"`
+	ChunkSize int64      `json:"chunkSize,omitempty"`
+	Chunks    []string   `json:"chunks"`
+	Sizes     []int64    `json:"sizes,omitempty"`
+	Erasure   *Erasure   `json:"erasure,omitempty"`
+	Shards    [][]string `json:"shards,omitempty"`
+}
+
+// Column returns the hashes of shard j of every chunk, in chunk order: what a
+// replica holding column j stores.
+func (m *ChunkManifest) Column(j int) []string {
+	col := make([]string, len(m.Shards))
+	for i, row := range m.Shards {
+		col[i] = row[j]
+	}
+	return col
 }
 
 // ChunkLen returns the expected byte length of chunk i.
 func (m *ChunkManifest) ChunkLen(i int) int64 {
+	if m.Sizes != nil {
+		return m.Sizes[i]
+	}
 	if i == len(m.Chunks)-1 {
 		return m.TotalSize - int64(len(m.Chunks)-1)*m.ChunkSize
 	}
 	return m.ChunkSize
 }
 
-// EncodeManifest serializes a manifest to its blob bytes.
+// EncodeManifest serializes a manifest to its blob bytes, as version 2 when it
+// carries explicit chunk sizes and version 1 otherwise. A version 1 manifest
+// encodes byte-for-byte as it always has (the new fields are omitted when
+// empty), so fixed-size content keeps its address.
 func EncodeManifest(m *ChunkManifest) ([]byte, error) {
 	body, err := json.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
-	return append([]byte(manifestMagic), body...), nil
+	magic := manifestMagic
+	if m.Sizes != nil {
+		magic = manifestMagicV2
+	}
+	return append([]byte(magic), body...), nil
 }
 
-// DecodeManifest reports whether data is a valid manifest blob. Validation is
-// strict — magic prefix, well-formed hashes, and a chunk count that exactly
-// matches TotalSize — so a random blob cannot pass by accident.
+// DecodeManifest reports whether data is a valid manifest blob of either
+// version. Validation is strict — magic prefix, well-formed hashes, and chunk
+// sizes that exactly account for TotalSize — so a random blob cannot pass by
+// accident.
 func DecodeManifest(data []byte) (*ChunkManifest, bool) {
-	if !bytes.HasPrefix(data, []byte(manifestMagic)) {
+	var (
+		body []byte
+		v2   bool
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte(manifestMagic)):
+		body = data[len(manifestMagic):]
+	case bytes.HasPrefix(data, []byte(manifestMagicV2)):
+		body, v2 = data[len(manifestMagicV2):], true
+	default:
 		return nil, false
 	}
 	var m ChunkManifest
-	if err := json.Unmarshal(data[len(manifestMagic):], &m); err != nil {
+	if err := json.Unmarshal(body, &m); err != nil {
 		return nil, false
 	}
 	n := int64(len(m.Chunks))
-	if m.ChunkSize < 1 || m.ChunkSize > MaxBlobSize {
-		return nil, false
-	}
 	// Single-chunk content is stored as a plain blob, so a real manifest has
 	// at least two chunks.
 	if n < 2 || n > MaxManifestChunks {
 		return nil, false
 	}
-	if m.TotalSize > MaxContentSize || m.TotalSize <= (n-1)*m.ChunkSize || m.TotalSize > n*m.ChunkSize {
+	if m.TotalSize > MaxContentSize {
 		return nil, false
 	}
+	if v2 {
+		if !validChunkSizes(&m) || !validShards(&m) {
+			return nil, false
+		}
+	} else {
+		if m.Sizes != nil || m.Erasure != nil || m.Shards != nil || m.ChunkSize < 1 || m.ChunkSize > MaxBlobSize {
+			return nil, false
+		}
+		if m.TotalSize <= (n-1)*m.ChunkSize || m.TotalSize > n*m.ChunkSize {
+			return nil, false
+		}
+	}
 	for _, h := range m.Chunks {
 		if !IsContentHash(h) {
 			return nil, false
@@ -264,6 +325,45 @@ func DecodeManifest(data []byte) (*ChunkManifest, bool) {
 	return &m, true
 }
 
+// validChunkSizes checks a version 2 manifest's size list: one positive size
+// per chunk, none beyond what a blob may hold, summing exactly to TotalSize.
+// ChunkSize must be absent so the two layouts can never be mixed.
+func validChunkSizes(m *ChunkManifest) bool {
+	if m.ChunkSize != 0 || len(m.Sizes) != len(m.Chunks) {
+		return false
+	}
+	var total int64
+	for _, size := range m.Sizes {
+		if size < 1 || size > MaxBlobSize {
+			return false
+		}
+		total += size
+	}
+	return total == m.TotalSize
+}
+
+// validShards checks a version 2 manifest's erasure layout, if any: a valid
+// K+M and one row of K+M well-formed shard hashes per chunk.
+func validShards(m *ChunkManifest) bool {
+	if m.Erasure == nil {
+		return m.Shards == nil
+	}
+	if !m.Erasure.Valid() || len(m.Shards) != len(m.Chunks) {
+		return false
+	}
+	for _, row := range m.Shards {
+		if len(row) != m.Erasure.Shards() {
+			return false
+		}
+		for _, h := range row {
+			if !IsContentHash(h) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // List returns the hashes currently stored (used by the keep-providing loop).
 func (s *BlobStore) List() ([]string, error) {
 	entries, err := os.ReadDir(s.dir)
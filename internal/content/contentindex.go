@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,6 +15,8 @@ import (
 // root hash. Sets are either owned (published via this node — never evicted)
 // or hosted (pushed to us or cached from a fetch — counted against the
 // operator's hosting budget, expired by TTL, evicted LRU under pressure).
+// A hosted set pushed by a member of one of the node's replication groups is
+// kept for that group instead, outside the budget like an owned set.
 // The index is a sidecar JSON file next to the blobs, written atomically.
 
 // indexFileName is the sidecar file inside the content directory.
@@ -26,6 +30,32 @@ const evictionProtection = time.Hour
 // manifest during reconciliation (real manifests are a few KB).
 const manifestProbeLimit = 1 << 20
 
+// presentColumn finds a shard column of an erasure-coded manifest whose every
+// shard is present, returning its hashes and total size.
+func presentColumn(m *ChunkManifest, present map[string]bool) ([]string, int64, bool) {
+	if m.Erasure == nil {
+		return nil, 0, false
+	}
+	for j := 0; j < m.Erasure.Shards(); j++ {
+		col := m.Column(j)
+		complete := true
+		for _, h := range col {
+			if !present[h] {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			var size int64
+			for i := range m.Chunks {
+				size += m.Erasure.ShardLen(m.ChunkLen(i))
+			}
+			return col, size, true
+		}
+	}
+	return nil, 0, false
+}
+
 // contentMeta describes one content set.
 type contentMeta struct {
 	Owned      bool     `json:"owned"`
@@ -33,9 +63,18 @@ type contentMeta struct {
 	Chunks     []string `json:"chunks,omitempty"`
 	StoredAt   int64    `json:"storedAt"`       // unix seconds
 	LastAccess int64    `json:"lastAccess"`     // unix seconds, TTL + LRU driver
-	From       string   `json:"from,omitempty"` // pusher peer ID (future per-peer caps)
+	From       string   `json:"from,omitempty"` // peer it came from (pusher or fetch source); see PeerQuota
+
+	// Groups names the replication groups the set is kept for (see
+	// AddGroupSet). Like an owned set, a group set is never evicted and does
+	// not count against the hosting budget.
+	Groups []string `json:"groups,omitempty"`
 }
 
+// budgeted reports whether a set counts against the hosting budget, and so
+// may be evicted to make room: hosted sets, but not owned or group sets.
+func (m *contentMeta) budgeted() bool { return !m.Owned && len(m.Groups) == 0 }
+
 // ContentIndex is the in-memory index with its on-disk sidecar.
 type ContentIndex struct {
 	path  string
@@ -58,6 +97,25 @@ type ContentIndex struct {
 	// promise, N concurrent pushes each measure the same pre-transfer usage and
 	// all pass — overshooting the operator's budget by a factor of N.
 	reserved int64
+
+	// inflight is the part of reserved promised to each pusher, so a per-peer
+	// quota counts a pusher's transfers in progress as well as its stored sets
+	// (the same gap reserved closes for the global budget).
+	inflight map[string]*peerInflight
+}
+
+// peerInflight is one pusher's admitted-but-not-yet-stored transfers.
+type peerInflight struct {
+	bytes int64
+	sets  int
+}
+
+// PeerQuota caps how much hosted content may come from any one peer, so a
+// single publisher cannot occupy the whole hosting budget. A zero field is no
+// cap. Owned (pinned) sets never count.
+type PeerQuota struct {
+	Bytes int64 `json:"bytes,omitempty"` // hosted bytes per peer
+	Sets  int   `json:"sets,omitempty"`  // hosted sets per peer
 }
 
 // indexFile is the on-disk shape.
@@ -139,6 +197,10 @@ func LoadContentIndex(dir string, store *BlobStore) (*ContentIndex, error) {
 			}
 			if complete {
 				adopt(h, size+m.TotalSize, m.Chunks)
+			} else if col, colSize, ok := presentColumn(m, present); ok {
+				// A replica of an erasure-coded set holds one shard
+				// column, not the chunks.
+				adopt(h, size+colSize, col)
 			}
 		}
 	}
@@ -230,6 +292,73 @@ func (ix *ContentIndex) addHostedLocked(root string, size int64, chunks []string
 	ix.save()
 }
 
+// AddGroupSet records a set pushed by a member of one of this node's
+// replication groups, kept for those groups outside the hosting budget: it is
+// never evicted, whatever the budget, until the operator removes it. No
+// reservation is needed, as nothing is admitted against the budget. A set
+// already indexed just joins the groups. claims may be nil.
+func (ix *ContentIndex) AddGroupSet(root string, size int64, chunks []string, from string, groups []string, claims *BlobClaims) {
+	if ix == nil {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.joinGroupsLocked(root, groups) {
+		ix.touchLocked(root)
+	} else {
+		now := time.Now().Unix()
+		m := &contentMeta{Size: size, Chunks: chunks, StoredAt: now, LastAccess: now, From: from, Groups: groups}
+		ix.sets[root] = m
+		ix.reference(root, m)
+	}
+	ix.releaseClaimsLocked(claims, false)
+	ix.save()
+}
+
+// JoinGroups adds groups to the set rooted at root, taking it out of the
+// hosting budget (see AddGroupSet). It reports false if no such set is
+// indexed.
+func (ix *ContentIndex) JoinGroups(root string, groups []string) bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.joinGroupsLocked(root, groups) {
+		return false
+	}
+	ix.save()
+	return true
+}
+
+func (ix *ContentIndex) joinGroupsLocked(root string, groups []string) bool {
+	m := ix.sets[root]
+	if m == nil {
+		return false
+	}
+	for _, g := range groups {
+		if !slices.Contains(m.Groups, g) {
+			m.Groups = append(m.Groups, g)
+		}
+	}
+	return true
+}
+
+// Membership reports whether root is indexed, whether it is owned, and which
+// replication groups it is kept for.
+func (ix *ContentIndex) Membership(root string) (owned bool, groups []string, ok bool) {
+	if ix == nil {
+		return false, nil, false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	m := ix.sets[root]
+	if m == nil {
+		return false, nil, false
+	}
+	return m.Owned, append([]string(nil), m.Groups...), true
+}
+
 // Has reports whether the index tracks a set rooted at root.
 func (ix *ContentIndex) Has(root string) bool {
 	if ix == nil {
@@ -387,7 +516,7 @@ func (ix *ContentIndex) HostedBytes() int64 {
 func (ix *ContentIndex) hostedBytesLocked() int64 {
 	total := ix.reserved
 	for _, m := range ix.sets {
-		if !m.Owned {
+		if m.budgeted() {
 			total += m.Size
 		}
 	}
@@ -410,27 +539,89 @@ func (ix *ContentIndex) hostedBytesLocked() int64 {
 // two steps would leave exactly the gap this exists to close: both callers test
 // against the same usage, then both reserve.
 func (ix *ContentIndex) Reserve(size, budget, maxSize int64, ttl time.Duration, now time.Time) bool {
+	return ix.ReserveFrom("", PeerQuota{}, size, budget, maxSize, ttl, now)
+}
+
+// ReserveFrom is Reserve for a transfer from the peer from, which must also
+// stay within quota counting what that peer already has stored here and in
+// flight. Pair it with ReleaseFrom or CommitHosted for the same peer. The
+// quota is checked before the budget: a peer over its share is refused even
+// when the budget has room, and causes no eviction.
+func (ix *ContentIndex) ReserveFrom(from string, quota PeerQuota, size, budget, maxSize int64, ttl time.Duration, now time.Time) bool {
 	if ix == nil {
 		return true // store-only service (tests): no policy
 	}
 	ix.mu.Lock()
 	defer ix.mu.Unlock()
+	if from != "" && !ix.withinQuotaLocked(from, quota, size) {
+		return false
+	}
 	if !ix.fitLocked(size, budget, maxSize, ttl, now, false) {
 		return false
 	}
 	ix.reserved += size
+	if from != "" {
+		if ix.inflight == nil {
+			ix.inflight = map[string]*peerInflight{}
+		}
+		f := ix.inflight[from]
+		if f == nil {
+			f = &peerInflight{}
+			ix.inflight[from] = f
+		}
+		f.bytes += size
+		f.sets++
+	}
 	return true
 }
 
+// withinQuotaLocked reports whether one more set of size bytes from the peer
+// from fits its quota. Caller holds mu.
+func (ix *ContentIndex) withinQuotaLocked(from string, quota PeerQuota, size int64) bool {
+	if quota.Bytes <= 0 && quota.Sets <= 0 {
+		return true
+	}
+	bytes, sets := size, 1
+	if f := ix.inflight[from]; f != nil {
+		bytes += f.bytes
+		sets += f.sets
+	}
+	for _, m := range ix.sets {
+		if m.budgeted() && m.From == from {
+			bytes += m.Size
+			sets++
+		}
+	}
+	return (quota.Bytes <= 0 || bytes <= quota.Bytes) && (quota.Sets <= 0 || sets <= quota.Sets)
+}
+
 // Release drops a reservation taken by Reserve whose transfer never completed.
 // A completed one is consumed by CommitHosted instead.
 func (ix *ContentIndex) Release(size int64) {
+	ix.ReleaseFrom("", size)
+}
+
+// ReleaseFrom drops a reservation taken by ReserveFrom.
+func (ix *ContentIndex) ReleaseFrom(from string, size int64) {
 	if ix == nil {
 		return
 	}
 	ix.mu.Lock()
 	defer ix.mu.Unlock()
 	ix.releaseLocked(size)
+	ix.releaseFromLocked(from, size)
+}
+
+func (ix *ContentIndex) releaseFromLocked(from string, size int64) {
+	f := ix.inflight[from]
+	if f == nil {
+		return
+	}
+	f.bytes -= size
+	f.sets--
+	if f.sets <= 0 {
+		delete(ix.inflight, from)
+	}
 }
 
 func (ix *ContentIndex) releaseLocked(size int64) {
@@ -463,6 +654,7 @@ func (ix *ContentIndex) CommitHosted(root string, size int64, chunks []string, f
 	// Drop the promise before measuring, or these bytes are counted twice and
 	// the eviction pass frees twice what it needs to.
 	ix.releaseLocked(size)
+	ix.releaseFromLocked(from, size)
 	if !ix.fitLocked(size, budget, maxSize, ttl, now, true) {
 		return false
 	}
@@ -515,7 +707,7 @@ func (ix *ContentIndex) fitLocked(size, budget, maxSize int64, ttl time.Duration
 		victimExpired := false
 		var oldest int64
 		for root, m := range ix.sets {
-			if m.Owned || spared[root] {
+			if !m.budgeted() || spared[root] {
 				continue
 			}
 			expired := ttl > 0 && now.Unix()-m.LastAccess > int64(ttl.Seconds())
@@ -577,6 +769,228 @@ func (ix *ContentIndex) evictLocked(root string) {
 	}
 }
 
+// SetInfo is the public description of one indexed content set, as listed by
+// Sets.
+type SetInfo struct {
+	Root       string   `json:"root"`
+	Pinned     bool     `json:"pinned"` // owned: never evicted, not budgeted
+	Size       int64    `json:"size"`
+	Chunks     int      `json:"chunks"`
+	StoredAt   int64    `json:"storedAt"`
+	LastAccess int64    `json:"lastAccess"`
+	From       string   `json:"from,omitempty"`
+	Groups     []string `json:"groups,omitempty"` // kept for these replication groups
+}
+
+// Sets returns a snapshot of every indexed set, largest first.
+func (ix *ContentIndex) Sets() []SetInfo {
+	if ix == nil {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	out := make([]SetInfo, 0, len(ix.sets))
+	for root, m := range ix.sets {
+		out = append(out, setInfo(root, m))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size {
+			return out[i].Size > out[j].Size
+		}
+		return out[i].Root < out[j].Root
+	})
+	return out
+}
+
+// Set returns the SetInfo of the set rooted at root, if the index tracks it.
+func (ix *ContentIndex) Set(root string) (SetInfo, bool) {
+	if ix == nil {
+		return SetInfo{}, false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	m := ix.sets[root]
+	if m == nil {
+		return SetInfo{}, false
+	}
+	return setInfo(root, m), true
+}
+
+func setInfo(root string, m *contentMeta) SetInfo {
+	return SetInfo{
+		Root: root, Pinned: m.Owned, Size: m.Size, Chunks: len(m.Chunks),
+		StoredAt: m.StoredAt, LastAccess: m.LastAccess, From: m.From,
+		Groups: append([]string(nil), m.Groups...),
+	}
+}
+
+// PeerUsage is how much hosted content came from one peer, as listed by
+// HostedByPeer. From is empty for sets of unknown origin (adopted from disk).
+type PeerUsage struct {
+	From          string `json:"from"`
+	Sets          int    `json:"sets"`
+	Bytes         int64  `json:"bytes"`
+	InFlightSets  int    `json:"inFlightSets,omitempty"`
+	InFlightBytes int64  `json:"inFlightBytes,omitempty"`
+}
+
+// HostedByPeer groups budgeted hosted sets (neither owned nor group sets), and transfers in flight, by the
+// peer they came from, largest first.
+func (ix *ContentIndex) HostedByPeer() []PeerUsage {
+	if ix == nil {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	by := map[string]*PeerUsage{}
+	get := func(from string) *PeerUsage {
+		u := by[from]
+		if u == nil {
+			u = &PeerUsage{From: from}
+			by[from] = u
+		}
+		return u
+	}
+	for _, m := range ix.sets {
+		if m.budgeted() {
+			u := get(m.From)
+			u.Sets++
+			u.Bytes += m.Size
+		}
+	}
+	for from, f := range ix.inflight {
+		u := get(from)
+		u.InFlightSets += f.sets
+		u.InFlightBytes += f.bytes
+	}
+	out := make([]PeerUsage, 0, len(by))
+	for _, u := range by {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := out[i].Bytes+out[i].InFlightBytes, out[j].Bytes+out[j].InFlightBytes; a != b {
+			return a > b
+		}
+		return out[i].From < out[j].From
+	})
+	return out
+}
+
+// Pin marks a set this node already holds as owned, whatever brought it here:
+// it stops counting against the hosting budget and is never evicted. It
+// reports false if no such set is indexed.
+func (ix *ContentIndex) Pin(root string) bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	m := ix.sets[root]
+	if m == nil {
+		return false
+	}
+	if !m.Owned {
+		m.Owned = true
+		ix.save()
+	}
+	return true
+}
+
+// Unpin demotes an owned set to an ordinary hosted one. Nothing is deleted:
+// the set stays a replica the network can fetch, but from now on it counts
+// against the hosting budget and is an eviction candidate like any other
+// (its StoredAt is kept, so it does not get a fresh churn protection). Use
+// Remove to drop it at once, or GC to apply the budget. It reports false if no
+// such set is indexed.
+func (ix *ContentIndex) Unpin(root string) bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	m := ix.sets[root]
+	if m == nil {
+		return false
+	}
+	if m.Owned {
+		m.Owned = false
+		ix.save()
+	}
+	return true
+}
+
+// Remove drops a set, owned or hosted, and deletes its blobs unless another
+// set references them or a writer holds a claim on them (see evictLocked). It
+// reports false if no such set is indexed.
+func (ix *ContentIndex) Remove(root string) bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.sets[root] == nil {
+		return false
+	}
+	ix.evictLocked(root)
+	ix.save()
+	return true
+}
+
+// GCResult reports what a GC pass removed. FreedBytes counts evicted sets at
+// their indexed size plus swept blobs; a blob an evicted set shared with a
+// set that stays is counted but not deleted.
+type GCResult struct {
+	EvictedSets  int   `json:"evictedSets"`
+	DeletedBlobs int   `json:"deletedBlobs"`
+	FreedBytes   int64 `json:"freedBytes"`
+}
+
+// GC brings the store back in line with the index. First it applies the
+// hosting budget, evicting hosted sets in the usual order until usage fits
+// (unpinning can leave it over budget, and nothing else evicts until the next
+// set arrives). Then it sweeps blobs that no set references.
+//
+// The sweep is safe alongside transfers because of BlobClaims: every writer
+// claims a blob before it writes it, under the same lock this holds, so a blob
+// that is on disk, referenced by no set and claimed by no writer is one that
+// nothing will ever point at — the leftovers of a crash, or of a removal a
+// claim held back. Temporary files are not content hashes and are never
+// listed.
+func (ix *ContentIndex) GC(budget int64, ttl time.Duration, now time.Time) (GCResult, error) {
+	var res GCResult
+	if ix == nil {
+		return res, nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	sets, hosted := len(ix.sets), ix.hostedBytesLocked()
+	ix.fitLocked(0, budget, 0, ttl, now, true)
+	res.EvictedSets = sets - len(ix.sets)
+	res.FreedBytes = hosted - ix.hostedBytesLocked()
+
+	hashes, err := ix.store.List()
+	if err != nil {
+		return res, err
+	}
+	for _, h := range hashes {
+		if len(ix.blobs[h]) > 0 || ix.pending[h] > 0 {
+			continue
+		}
+		rc, size, err := ix.store.Open(h)
+		if err != nil {
+			continue
+		}
+		rc.Close()
+		if err := ix.store.Delete(h); err != nil {
+			return res, err
+		}
+		res.DeletedBlobs++
+		res.FreedBytes += size
+	}
+	return res, nil
+}
+
 // Flush persists pending lastAccess updates (called opportunistically from the
 // heal loop; structural changes save immediately).
 func (ix *ContentIndex) Flush() {
@@ -235,3 +235,248 @@ func TestIndexTouchBlobRefreshesSet(t *testing.T) {
 		t.Fatalf("TouchBlob did not refresh the owning set")
 	}
 }
+
+// TestIndexPinUnpin checks pinning takes a hosted set out of the budget and
+// unpinning puts an owned one back, keeping its StoredAt so it gets no fresh
+// protection window.
+func TestIndexPinUnpin(t *testing.T) {
+	ix, store, dir := newTestIndex(t)
+	hosted, _ := store.Put([]byte("hosted"))
+	owned, _ := store.Put([]byte("owned"))
+	ix.AddHosted(hosted, 100, nil, "", nil)
+	ix.MarkOwned(owned, 200, nil, nil)
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	ix.mu.Lock()
+	ix.sets[owned].StoredAt = old
+	ix.mu.Unlock()
+
+	if !ix.Pin(hosted) || !ix.Unpin(owned) {
+		t.Fatalf("pin/unpin of indexed sets reported missing")
+	}
+	if ix.Pin("not-indexed") || ix.Unpin("not-indexed") {
+		t.Fatalf("pin/unpin of an unknown root reported success")
+	}
+	if got := ix.HostedBytes(); got != 200 {
+		t.Fatalf("hosted bytes %d, want 200 (only the unpinned set)", got)
+	}
+
+	reloaded, err := LoadContentIndex(dir, store)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	sets := reloaded.Sets()
+	if len(sets) != 2 || sets[0].Root != owned || sets[0].Pinned || sets[0].StoredAt != old {
+		t.Fatalf("unpinned set after reload: %+v", sets)
+	}
+	if sets[1].Root != hosted || !sets[1].Pinned {
+		t.Fatalf("pinned set after reload: %+v", sets)
+	}
+}
+
+// TestIndexRemoveKeepsSharedAndClaimed removes a set whose chunk is shared
+// with another set and whose other chunk a writer has claimed: only the
+// unshared, unclaimed blobs may go.
+func TestIndexRemoveKeepsSharedAndClaimed(t *testing.T) {
+	ix, store, _ := newTestIndex(t)
+	shared, _ := store.Put([]byte("shared chunk"))
+	claimed, _ := store.Put([]byte("claimed chunk"))
+	root, _ := store.Put([]byte("root"))
+	other, _ := store.Put([]byte("other root"))
+	ix.MarkOwned(root, 300, []string{shared, claimed}, nil)
+	ix.MarkOwned(other, 200, []string{shared}, nil)
+	claims := ix.BeginWrite()
+	claims.Claim(claimed)
+	defer claims.Discard()
+
+	if !ix.Remove(root) {
+		t.Fatalf("Remove reported the root missing")
+	}
+	if ix.Remove(root) {
+		t.Fatalf("second Remove reported success")
+	}
+	if ix.Has(root) || store.Has(root) {
+		t.Fatalf("removed root still indexed or on disk")
+	}
+	if !store.Has(shared) {
+		t.Fatalf("blob shared with a remaining set was deleted")
+	}
+	if !store.Has(claimed) {
+		t.Fatalf("claimed blob was deleted")
+	}
+}
+
+// TestIndexGCSweepsOrphansButNotClaims checks the sweep deletes a blob no set
+// references and no writer claims, and leaves one a writer is still assembling
+// into a set.
+func TestIndexGCSweepsOrphansButNotClaims(t *testing.T) {
+	ix, store, _ := newTestIndex(t)
+	kept, _ := store.Put([]byte("kept root"))
+	ix.MarkOwned(kept, 9, nil, nil)
+	orphan, _ := store.Put([]byte("orphan"))
+	inFlight, _ := store.Put([]byte("in flight"))
+	claims := ix.BeginWrite()
+	claims.Claim(inFlight)
+
+	res, err := ix.GC(1000, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if res.DeletedBlobs != 1 || res.FreedBytes != int64(len("orphan")) || res.EvictedSets != 0 {
+		t.Fatalf("GC result %+v, want the one orphan swept", res)
+	}
+	if store.Has(orphan) || !store.Has(kept) || !store.Has(inFlight) {
+		t.Fatalf("GC swept the wrong blobs: orphan=%v kept=%v inFlight=%v",
+			store.Has(orphan), store.Has(kept), store.Has(inFlight))
+	}
+	claims.Discard()
+}
+
+// TestIndexGCAppliesBudget unpins a set so hosted usage exceeds the budget and
+// checks GC evicts it without touching pinned content.
+func TestIndexGCAppliesBudget(t *testing.T) {
+	ix, store, _ := newTestIndex(t)
+	pinned, _ := store.Put([]byte("pinned"))
+	old, _ := store.Put([]byte("old version"))
+	ix.MarkOwned(pinned, 500, nil, nil)
+	ix.MarkOwned(old, 500, nil, nil)
+	past := time.Now().Add(-2 * time.Hour).Unix()
+	ix.mu.Lock()
+	ix.sets[old].StoredAt, ix.sets[old].LastAccess = past, past
+	ix.mu.Unlock()
+	ix.Unpin(old)
+
+	res, err := ix.GC(100, 24*time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if res.EvictedSets != 1 || res.FreedBytes != 500 {
+		t.Fatalf("GC result %+v, want the unpinned set evicted", res)
+	}
+	if ix.Has(old) || store.Has(old) {
+		t.Fatalf("unpinned set over budget survived GC")
+	}
+	if !ix.Has(pinned) || !store.Has(pinned) {
+		t.Fatalf("GC touched pinned content")
+	}
+}
+
+// TestIndexReconcileAdoptsShardColumn lays down what a replica of an
+// erasure-coded set holds — the manifest and one shard column, no chunks —
+// and checks reconciliation adopts it as one hosted set.
+func TestIndexReconcileAdoptsShardColumn(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewBlobStore(dir)
+	e := Erasure{K: 2, M: 1}
+	data := testBytes(CDCMinChunk + 500)
+	chunks := [][]byte{data[:CDCMinChunk], data[CDCMinChunk:]}
+	m := &ChunkManifest{TotalSize: int64(len(data)), Erasure: &e}
+	var column []string
+	var columnSize int64
+	for _, c := range chunks {
+		h, _ := ContentHash(c)
+		m.Chunks = append(m.Chunks, h)
+		m.Sizes = append(m.Sizes, int64(len(c)))
+		var row []string
+		for j, shard := range e.Encode(c) {
+			sh, _ := ContentHash(shard)
+			row = append(row, sh)
+			if j == 2 {
+				store.Put(shard)
+				column = append(column, sh)
+				columnSize += int64(len(shard))
+			}
+		}
+		m.Shards = append(m.Shards, row)
+	}
+	mdata, _ := EncodeManifest(m)
+	root, _ := store.Put(mdata)
+
+	ix, err := LoadContentIndex(dir, store)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	sets := ix.Sets()
+	if len(sets) != 1 || sets[0].Root != root || sets[0].Chunks != 2 || sets[0].Size != int64(len(mdata))+columnSize {
+		t.Fatalf("sets after reconcile: %+v", sets)
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, h := range column {
+		if !ix.blobs[h][root] {
+			t.Fatalf("shard %s not referenced by the adopted set", h)
+		}
+	}
+}
+
+func TestIndexPeerQuota(t *testing.T) {
+	ix, _, _ := newTestIndex(t)
+	now := time.Now()
+	const budget = 10000
+	quota := PeerQuota{Bytes: 500, Sets: 2}
+	ix.AddHosted("a1", 300, nil, "peer-a", nil)
+
+	// peer-a holds 300 of its 500: another 300 would exceed it, 200 fits.
+	if ix.ReserveFrom("peer-a", quota, 300, budget, budget, time.Hour, now) {
+		t.Fatalf("reservation over the byte quota admitted")
+	}
+	if !ix.ReserveFrom("peer-a", quota, 200, budget, budget, time.Hour, now) {
+		t.Fatalf("reservation within quota refused")
+	}
+	// In flight counts: a third set is over the set quota even at 0 bytes left.
+	if ix.ReserveFrom("peer-a", PeerQuota{Sets: 2}, 1, budget, budget, time.Hour, now) {
+		t.Fatalf("in-flight transfer not counted against the set quota")
+	}
+	// Other peers are unaffected.
+	if !ix.ReserveFrom("peer-b", quota, 400, budget, budget, time.Hour, now) {
+		t.Fatalf("quota of one peer applied to another")
+	}
+	usage := ix.HostedByPeer()
+	if len(usage) != 2 || usage[0].From != "peer-a" || usage[0].Bytes != 300 || usage[0].InFlightBytes != 200 || usage[1].InFlightSets != 1 {
+		t.Fatalf("usage: %+v", usage)
+	}
+
+	// A release frees the in-flight share; a commit turns it into a stored set.
+	ix.ReleaseFrom("peer-b", 400)
+	if !ix.CommitHosted("a2", 200, nil, "peer-a", budget, budget, time.Hour, now, nil) {
+		t.Fatalf("commit refused")
+	}
+	usage = ix.HostedByPeer()
+	if len(usage) != 1 || usage[0].Sets != 2 || usage[0].Bytes != 500 || usage[0].InFlightSets != 0 {
+		t.Fatalf("usage after commit: %+v", usage)
+	}
+	if ix.ReserveFrom("peer-a", quota, 1, budget, budget, time.Hour, now) {
+		t.Fatalf("peer at its quota admitted")
+	}
+	// Pinned sets do not count against their source's quota.
+	ix.Pin("a1")
+	if !ix.ReserveFrom("peer-a", quota, 300, budget, budget, time.Hour, now) {
+		t.Fatalf("pinned set still counted against the quota")
+	}
+}
+
+func TestIndexGroupSetOutsideBudget(t *testing.T) {
+	ix, _, _ := newTestIndex(t)
+	ix.AddGroupSet("team-site", 500, nil, "peer-a", []string{"team"}, nil)
+	ix.AddHosted("stranger", 300, nil, "peer-b", nil)
+	if got := ix.HostedBytes(); got != 300 {
+		t.Fatalf("hosted bytes %d, want only the stranger's 300", got)
+	}
+	// A budget too small for either set evicts only the budgeted one.
+	if _, err := ix.GC(100, time.Nanosecond, time.Now().Add(48*time.Hour)); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	if !ix.Has("team-site") || ix.Has("stranger") {
+		t.Fatalf("gc kept the wrong sets: team=%v stranger=%v", ix.Has("team-site"), ix.Has("stranger"))
+	}
+	// Joining another group merges; membership reflects both.
+	if !ix.JoinGroups("team-site", []string{"team", "family"}) {
+		t.Fatalf("join failed")
+	}
+	owned, groups, ok := ix.Membership("team-site")
+	if !ok || owned || len(groups) != 2 {
+		t.Fatalf("membership: owned=%v groups=%v ok=%v", owned, groups, ok)
+	}
+	if ix.JoinGroups("missing", []string{"team"}) {
+		t.Fatalf("joined a set that is not indexed")
+	}
+}
@@ -0,0 +1,230 @@
+package content
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/multiformats/go-base36"
+)
+
+// This file implements encrypted content. An encrypted upload is sealed on
+// the uploading node under a fresh random key before it is chunked, so every
+// blob that is stored, provided, pushed to replicas or cached by a fetcher is
+// ciphertext, and the content hash addresses the ciphertext. Reading needs a
+// *read capability*: the hash plus the key, in one string (the idea of a
+// Tahoe-LAFS read cap). Whoever holds the capability can fetch and decrypt;
+// whoever holds only the hash — a replica, a peer watching provider records —
+// sees noise.
+//
+// The ciphertext is a short header followed by the plaintext in 64 KiB
+// segments, each sealed with AES-256-GCM (the STREAM construction): the nonce
+// is the segment counter plus a flag marking the final segment, so segments
+// cannot be reordered, dropped, or the stream truncated or extended without
+// the next Open failing. Segmenting keeps both directions streaming with
+// bounded memory, like the rest of the content layer.
+
+// encMagic starts every encrypted content stream. It lets a reader given a key
+// tell "this is not encrypted content" apart from "wrong key".
+const encMagic = "freedom-names/enc@1\n"
+
+// ContentKeySize is the length of a content key (AES-256).
+const ContentKeySize = 32
+
+// encSegment is the plaintext length of every sealed segment but the last.
+const encSegment = 64 << 10
+
+// encOverhead is the GCM tag appended to each segment.
+const encOverhead = 16
+
+// ErrBadContentKey means decryption failed: the key is wrong, or the content
+// is not encrypted content, or it was tampered with. The cases are not told
+// apart on purpose; the answer to all of them is "not readable".
+var ErrBadContentKey = errors.New("content cannot be decrypted with this key")
+
+// NewContentKey returns a fresh random content key.
+func NewContentKey() ([]byte, error) {
+	key := make([]byte, ContentKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// FormatReadCap joins a content hash and its key into a read capability,
+// "<hash>:<key>" with the key base36-encoded like the hash. The capability is
+// the shareable link to encrypted content; anyone holding it can read it.
+func FormatReadCap(hash string, key []byte) string {
+	return hash + ":" + base36.EncodeToStringLc(key)
+}
+
+// ParseContentRef accepts either a plain content hash or a read capability and
+// returns the hash and, for a capability, the key (nil otherwise). It is what
+// every place that takes "content to fetch" (a CONTENT record value, the
+// ?hash= parameter) uses, so encrypted content can go wherever plain content
+// can.
+func ParseContentRef(ref string) (hash string, key []byte, err error) {
+	hash, encKey, isCap := strings.Cut(ref, ":")
+	if !IsContentHash(hash) {
+		return "", nil, fmt.Errorf("invalid content hash %q", hash)
+	}
+	if !isCap {
+		return hash, nil, nil
+	}
+	key, err = base36.DecodeString(encKey)
+	if err != nil || len(key) != ContentKeySize || base36.EncodeToStringLc(key) != encKey {
+		return "", nil, errors.New("invalid read capability key")
+	}
+	return hash, key, nil
+}
+
+// IsContentRef reports whether s is a plain content hash or a well-formed
+// read capability.
+func IsContentRef(s string) bool {
+	_, _, err := ParseContentRef(s)
+	return err == nil
+}
+
+// EncryptedSize returns the ciphertext length for plain bytes of plaintext.
+// Every segment is full but the last; only empty content has an empty one.
+func EncryptedSize(plain int64) int64 {
+	segments := max(1, (plain+encSegment-1)/encSegment)
+	return int64(len(encMagic)) + plain + segments*encOverhead
+}
+
+// DecryptedSize returns the plaintext length behind ciphertext of the given
+// length, or false if no plaintext encrypts to that length.
+func DecryptedSize(cipherLen int64) (int64, bool) {
+	body := cipherLen - int64(len(encMagic))
+	if body < encOverhead {
+		return 0, false
+	}
+	full, rest := body/(encSegment+encOverhead), body%(encSegment+encOverhead)
+	switch {
+	case rest == 0: // the last segment was full
+		return full * encSegment, true
+	case rest > encOverhead, rest == encOverhead && full == 0:
+		return full*encSegment + rest - encOverhead, true
+	}
+	return 0, false
+}
+
+func newSegmentAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != ContentKeySize {
+		return nil, fmt.Errorf("content key must be %d bytes", ContentKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce is the STREAM nonce: the segment counter, then a final flag.
+func segmentNonce(nonce []byte, counter uint64, final bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// segmentStream is the shared read loop of both directions: it reads input
+// one segment plus one byte at a time (the extra byte is how it knows whether
+// a segment is the last), transforms it, and serves the output.
+type segmentStream struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	inLen   int // input bytes per non-final segment
+	seal    bool
+	counter uint64
+	in      []byte // inLen+1 bytes of buffer; in[:have] is unconsumed input
+	have    int
+	nonce   []byte
+	out     []byte // transformed bytes not yet returned
+	done    bool
+	err     error
+}
+
+// NewEncryptReader returns a reader over the encrypted form of r under key.
+// The output is exactly EncryptedSize(bytes read from r) long.
+func NewEncryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newSegmentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &segmentStream{r: r, aead: aead, inLen: encSegment, seal: true}
+	s.in = make([]byte, s.inLen+1)
+	s.nonce = make([]byte, aead.NonceSize())
+	s.out = []byte(encMagic)
+	return s, nil
+}
+
+// NewDecryptReader returns a reader over the plaintext of encrypted content r.
+// Any failure — wrong key, unencrypted input, tampering, truncation — surfaces
+// as ErrBadContentKey from Read, and no byte of a segment is returned before
+// that segment has authenticated.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newSegmentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &segmentStream{r: r, aead: aead, inLen: encSegment + encOverhead}
+	s.in = make([]byte, s.inLen+1)
+	s.nonce = make([]byte, aead.NonceSize())
+	magic := make([]byte, len(encMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, []byte(encMagic)) {
+		s.err = ErrBadContentKey
+	}
+	return s, nil
+}
+
+func (s *segmentStream) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// next transforms one segment into s.out.
+func (s *segmentStream) next() error {
+	n, err := io.ReadFull(s.r, s.in[s.have:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	s.have += n
+	final := s.have <= s.inLen
+	seg := s.in[:min(s.have, s.inLen)]
+	nonce := segmentNonce(s.nonce, s.counter, final)
+	if s.seal {
+		s.out = s.aead.Seal(s.out[:0], nonce, seg, nil)
+	} else {
+		out, err := s.aead.Open(s.out[:0], nonce, seg, nil)
+		if err != nil {
+			return ErrBadContentKey
+		}
+		s.out = out
+	}
+	s.counter++
+	if final {
+		s.done = true
+		return nil
+	}
+	s.have = copy(s.in, s.in[s.inLen:s.have]) // the look-ahead byte
+	return nil
+}
@@ -0,0 +1,108 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encryptAll(t *testing.T, plain, key []byte) []byte {
+	t.Helper()
+	r, err := NewEncryptReader(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatalf("NewEncryptReader: %v", err)
+	}
+	ct, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	return ct
+}
+
+func decryptAll(ct, key []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ct), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key, err := NewContentKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	for _, n := range []int{0, 1, encSegment - 1, encSegment, encSegment + 1, 3*encSegment + 5} {
+		plain := testBytes(n)
+		ct := encryptAll(t, plain, key)
+		if int64(len(ct)) != EncryptedSize(int64(n)) {
+			t.Fatalf("size %d: ciphertext is %d bytes, EncryptedSize says %d", n, len(ct), EncryptedSize(int64(n)))
+		}
+		if got, ok := DecryptedSize(int64(len(ct))); !ok || got != int64(n) {
+			t.Fatalf("size %d: DecryptedSize = %d, %v", n, got, ok)
+		}
+		if n > 64 && bytes.Contains(ct, plain[:64]) {
+			t.Fatalf("size %d: ciphertext contains plaintext", n)
+		}
+		got, err := decryptAll(ct, key)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: decrypt err=%v equal=%v", n, err, bytes.Equal(got, plain))
+		}
+	}
+}
+
+// TestDecryptRejectsTampering covers the ways a holder could alter ciphertext
+// it hosts; every one must fail authentication rather than yield bytes.
+func TestDecryptRejectsTampering(t *testing.T) {
+	key, _ := NewContentKey()
+	other, _ := NewContentKey()
+	plain := testBytes(2*encSegment + 100)
+	ct := encryptAll(t, plain, key)
+	seg := encSegment + encOverhead
+	hdr := len(encMagic)
+
+	cases := map[string]struct {
+		data []byte
+		key  []byte
+	}{
+		"wrong key":         {ct, other},
+		"flipped bit":       {func() []byte { c := bytes.Clone(ct); c[hdr+10] ^= 1; return c }(), key},
+		"truncated at edge": {ct[:hdr+2*seg], key},
+		"truncated mid":     {ct[:len(ct)-5], key},
+		"extended":          {append(bytes.Clone(ct), encryptAll(t, nil, key)[hdr:]...), key},
+		"segments swapped": {func() []byte {
+			c := bytes.Clone(ct)
+			copy(c[hdr:hdr+seg], ct[hdr+seg:hdr+2*seg])
+			copy(c[hdr+seg:hdr+2*seg], ct[hdr:hdr+seg])
+			return c
+		}(), key},
+		"not encrypted": {plain, key},
+	}
+	for name, tc := range cases {
+		if _, err := decryptAll(tc.data, tc.key); !errors.Is(err, ErrBadContentKey) {
+			t.Errorf("%s: got %v, want ErrBadContentKey", name, err)
+		}
+	}
+}
+
+func TestParseContentRef(t *testing.T) {
+	hash, _ := ContentHash([]byte("page"))
+	key, _ := NewContentKey()
+	readCap := FormatReadCap(hash, key)
+
+	if h, k, err := ParseContentRef(hash); err != nil || h != hash || k != nil {
+		t.Fatalf("plain hash: %s, %x, %v", h, k, err)
+	}
+	h, k, err := ParseContentRef(readCap)
+	if err != nil || h != hash || !bytes.Equal(k, key) {
+		t.Fatalf("read cap: %s, %x, %v", h, k, err)
+	}
+	_, encKey, _ := strings.Cut(readCap, ":")
+	for _, bad := range []string{"", "nope", hash + ":", hash + ":short", "nope:" + encKey, hash + ":" + strings.ToUpper(encKey), readCap + ":x"} {
+		if IsContentRef(bad) {
+			t.Errorf("IsContentRef accepted %q", bad)
+		}
+	}
+}
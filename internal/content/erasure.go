@@ -0,0 +1,272 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements erasure coding for replication. Pushing R full copies
+// of a set costs R times its size on other people's disks and survives the
+// loss of R holders. Reed–Solomon coding splits every chunk into K data shards
+// and adds M parity shards; any K of the K+M rebuild the chunk. Spreading the
+// K+M shard *columns* (shard j of every chunk) over distinct peers costs
+// (K+M)/K times the size — 1.5x for 4+2 — and survives the loss of any M of
+// them.
+//
+// The code is systematic (the data shards are the chunk's bytes, cut into K
+// equal pieces and zero-padded) and uses a Cauchy matrix for parity, every
+// square submatrix of which is invertible: that is what makes *any* K shards
+// enough. Arithmetic is in GF(2^8), so K+M is at most 256; the manifest caps
+// it much lower (MaxErasureShards).
+
+// MaxErasureShards caps K+M. Every chunk lists K+M shard hashes in the
+// manifest, and a manifest must stay small enough to be recognized as one
+// (see LoadContentIndex) even at MaxManifestChunks chunks.
+const MaxErasureShards = 12
+
+// Erasure is a Reed–Solomon layout: K data shards plus M parity shards per
+// chunk. The zero value means no erasure coding (full copies).
+type Erasure struct {
+	K int `json:"k"`
+	M int `json:"m"`
+}
+
+// ParseErasure parses an erasure layout written "k+m", e.g. "4+2". The empty
+// string is the zero Erasure (off).
+func ParseErasure(s string) (Erasure, error) {
+	if s == "" {
+		return Erasure{}, nil
+	}
+	ks, ms, ok := strings.Cut(s, "+")
+	k, kerr := strconv.Atoi(strings.TrimSpace(ks))
+	m, merr := strconv.Atoi(strings.TrimSpace(ms))
+	e := Erasure{K: k, M: m}
+	if !ok || kerr != nil || merr != nil || !e.Valid() {
+		return Erasure{}, fmt.Errorf("invalid erasure layout %q (want k+m with k,m >= 1 and k+m <= %d)", s, MaxErasureShards)
+	}
+	return e, nil
+}
+
+// Enabled reports whether e selects erasure coding at all.
+func (e Erasure) Enabled() bool { return e.K > 0 }
+
+// Valid reports whether e is a usable layout.
+func (e Erasure) Valid() bool {
+	return e.K >= 1 && e.M >= 1 && e.K+e.M <= MaxErasureShards
+}
+
+// Shards is K+M.
+func (e Erasure) Shards() int { return e.K + e.M }
+
+func (e Erasure) String() string { return fmt.Sprintf("%d+%d", e.K, e.M) }
+
+// ShardLen returns the length of every shard of a chunk of chunkLen bytes.
+func (e Erasure) ShardLen(chunkLen int64) int64 {
+	return (chunkLen + int64(e.K) - 1) / int64(e.K)
+}
+
+// ErrTooFewShards means fewer than K shards of a chunk are available.
+var ErrTooFewShards = errors.New("too few shards to rebuild chunk")
+
+// Encode splits chunk into K data shards and computes M parity shards,
+// returning all K+M (data first).
+func (e Erasure) Encode(chunk []byte) [][]byte {
+	n := int(e.ShardLen(int64(len(chunk))))
+	shards := make([][]byte, e.Shards())
+	for c := 0; c < e.K; c++ {
+		shards[c] = make([]byte, n)
+		if lo := c * n; lo < len(chunk) {
+			copy(shards[c], chunk[lo:min(lo+n, len(chunk))])
+		}
+	}
+	for r := 0; r < e.M; r++ {
+		p := make([]byte, n)
+		for c := 0; c < e.K; c++ {
+			gfMulAdd(p, shards[c], e.coeff(r, c))
+		}
+		shards[e.K+r] = p
+	}
+	return shards
+}
+
+// Shard returns shard j of chunk alone, without computing the others.
+func (e Erasure) Shard(chunk []byte, j int) []byte {
+	n := int(e.ShardLen(int64(len(chunk))))
+	shard := make([]byte, n)
+	if j < e.K {
+		if lo := j * n; lo < len(chunk) {
+			copy(shard, chunk[lo:min(lo+n, len(chunk))])
+		}
+		return shard
+	}
+	for c := 0; c < e.K; c++ {
+		if lo := c * n; lo < len(chunk) {
+			gfMulAdd(shard, chunk[lo:min(lo+n, len(chunk))], e.coeff(j-e.K, c))
+		}
+	}
+	return shard
+}
+
+// Reconstruct rebuilds a chunk of chunkLen bytes from its shards, indexed by
+// shard number with nil for those missing. Any K present shards of the right
+// length are enough. The result is not verified against the chunk hash; the
+// caller does that.
+func (e Erasure) Reconstruct(shards [][]byte, chunkLen int64) ([]byte, error) {
+	n := int(e.ShardLen(chunkLen))
+	if len(shards) != e.Shards() {
+		return nil, fmt.Errorf("have %d shard slots, want %d", len(shards), e.Shards())
+	}
+	// Pick K shards, data shards first: a data shard needs no arithmetic.
+	var rows []int
+	for j := 0; j < e.Shards() && len(rows) < e.K; j++ {
+		if shards[j] != nil && len(shards[j]) == n {
+			rows = append(rows, j)
+		}
+	}
+	if len(rows) < e.K {
+		return nil, ErrTooFewShards
+	}
+
+	data := make([][]byte, e.K)
+	systematic := true
+	for i, j := range rows {
+		if j != i {
+			systematic = false
+		}
+	}
+	if systematic {
+		copy(data, shards[:e.K])
+	} else {
+		// Row i of the encoding matrix for shard j: a unit row for a data
+		// shard, the Cauchy row for a parity shard. Inverting the K chosen
+		// rows maps the chosen shards back to the data shards.
+		mat := make([][]byte, e.K)
+		for i, j := range rows {
+			mat[i] = make([]byte, e.K)
+			if j < e.K {
+				mat[i][j] = 1
+			} else {
+				for c := 0; c < e.K; c++ {
+					mat[i][c] = e.coeff(j-e.K, c)
+				}
+			}
+		}
+		inv, err := gfInvert(mat)
+		if err != nil {
+			return nil, err
+		}
+		for c := 0; c < e.K; c++ {
+			out := make([]byte, n)
+			for i, j := range rows {
+				gfMulAdd(out, shards[j], inv[c][i])
+			}
+			data[c] = out
+		}
+	}
+
+	chunk := make([]byte, 0, int64(n)*int64(e.K))
+	for _, d := range data {
+		chunk = append(chunk, d...)
+	}
+	return chunk[:chunkLen], nil
+}
+
+// coeff is the Cauchy matrix entry for parity row r, data column c:
+// 1 / (x_r + y_c) with x_r = K+r and y_c = c, which are all distinct, so the
+// sum (XOR) is never zero.
+func (e Erasure) coeff(r, c int) byte {
+	return gfInv(byte(e.K+r) ^ byte(c))
+}
+
+// --- GF(2^8) arithmetic, polynomial x^8+x^4+x^3+x^2+1 (0x11d) ---
+
+var gfExp, gfLog = func() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds c·src into dst, element-wise.
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	if c == 1 {
+		for i, b := range src {
+			dst[i] ^= b
+		}
+		return
+	}
+	var table [256]byte
+	for i := range table {
+		table[i] = gfMul(byte(i), c)
+	}
+	for i, b := range src {
+		dst[i] ^= table[b]
+	}
+}
+
+// gfInvert inverts a square matrix by Gauss–Jordan elimination.
+func gfInvert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	a := make([][]byte, n)
+	inv := make([][]byte, n)
+	for i := range m {
+		a[i] = append([]byte(nil), m[i]...)
+		inv[i] = make([]byte, n)
+		inv[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if a[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("singular erasure matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+		scale := gfInv(a[col][col])
+		for c := 0; c < n; c++ {
+			a[col][c] = gfMul(a[col][c], scale)
+			inv[col][c] = gfMul(inv[col][c], scale)
+		}
+		for r := 0; r < n; r++ {
+			if r == col || a[r][col] == 0 {
+				continue
+			}
+			f := a[r][col]
+			for c := 0; c < n; c++ {
+				a[r][c] ^= gfMul(f, a[col][c])
+				inv[r][c] ^= gfMul(f, inv[col][c])
+			}
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,68 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseErasure(t *testing.T) {
+	good := map[string]Erasure{"": {}, "4+2": {K: 4, M: 2}, " 10 + 2 ": {K: 10, M: 2}, "1+1": {K: 1, M: 1}}
+	for in, want := range good {
+		got, err := ParseErasure(in)
+		if err != nil || got != want {
+			t.Errorf("ParseErasure(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"4", "4+0", "0+2", "10+3", "a+b", "4+2+1", "-1+2"} {
+		if _, err := ParseErasure(in); err == nil {
+			t.Errorf("ParseErasure(%q) accepted", in)
+		}
+	}
+}
+
+// TestErasureAnyKShardsRebuild encodes chunks of awkward lengths and checks
+// every choice of K surviving shards gives the chunk back.
+func TestErasureAnyKShardsRebuild(t *testing.T) {
+	e := Erasure{K: 3, M: 3}
+	for _, size := range []int{1, 2, 1000, 4097} {
+		chunk := testBytes(size)
+		shards := e.Encode(chunk)
+		for j := range shards {
+			if !bytes.Equal(e.Shard(chunk, j), shards[j]) {
+				t.Fatalf("size %d: Shard(%d) differs from Encode", size, j)
+			}
+		}
+		for mask := 0; mask < 1<<e.Shards(); mask++ {
+			have := make([][]byte, e.Shards())
+			n := 0
+			for j := range have {
+				if mask&(1<<j) != 0 {
+					have[j] = shards[j]
+					n++
+				}
+			}
+			got, err := e.Reconstruct(have, int64(size))
+			if n < e.K {
+				if !errors.Is(err, ErrTooFewShards) {
+					t.Fatalf("size %d mask %b: %v, want ErrTooFewShards", size, mask, err)
+				}
+				continue
+			}
+			if err != nil || !bytes.Equal(got, chunk) {
+				t.Fatalf("size %d mask %b: err=%v equal=%v", size, mask, err, bytes.Equal(got, chunk))
+			}
+		}
+	}
+}
+
+func TestErasureIgnoresWrongLengthShards(t *testing.T) {
+	e := Erasure{K: 2, M: 1}
+	chunk := testBytes(100)
+	shards := e.Encode(chunk)
+	shards[0] = shards[0][:10] // a truncated shard is as good as missing
+	shards[1] = nil
+	if _, err := e.Reconstruct(shards, 100); !errors.Is(err, ErrTooFewShards) {
+		t.Fatalf("Reconstruct with one usable shard: %v", err)
+	}
+}
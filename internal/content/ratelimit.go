@@ -22,11 +22,32 @@ func NewRateLimiter(bytesPerSec int64) *rate.Limiter {
 	if bytesPerSec <= 0 {
 		return nil
 	}
-	burst := int(bytesPerSec / 10)
-	if burst < 64<<10 {
-		burst = 64 << 10
+	return rate.NewLimiter(rate.Limit(bytesPerSec), rateBurst(bytesPerSec))
+}
+
+// rateBurst is a tenth of a second's worth of bytes, at least 64 KiB.
+func rateBurst(bytesPerSec int64) int {
+	return int(max(bytesPerSec/10, 64<<10))
+}
+
+// NewAdjustableRateLimiter is NewRateLimiter for a cap that may change while
+// the node runs (see SetRate): it always returns a limiter, one that never
+// waits for zero/negative rates.
+func NewAdjustableRateLimiter(bytesPerSec int64) *rate.Limiter {
+	l := rate.NewLimiter(rate.Inf, rateBurst(0))
+	SetRate(l, bytesPerSec)
+	return l
+}
+
+// SetRate changes the cap of a limiter from NewAdjustableRateLimiter.
+// Transfers already running slow down or speed up from their next chunk.
+func SetRate(l *rate.Limiter, bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		l.SetLimit(rate.Inf)
+		return
 	}
-	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+	l.SetBurst(rateBurst(bytesPerSec))
+	l.SetLimit(rate.Limit(bytesPerSec))
 }
 
 // LimitReader wraps r so reads consume tokens from l. Nil l returns r as-is.
@@ -5,6 +5,8 @@ import (
 	"io"
 	"testing"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
 func TestRateLimiterNilPassthrough(t *testing.T) {
@@ -52,3 +54,31 @@ func TestRateLimitedCopySlowsDown(t *testing.T) {
 		t.Fatalf("limited read corrupted data")
 	}
 }
+
+func TestAdjustableRateLimiter(t *testing.T) {
+	data := testBytes(256 << 10)
+	timeCopy := func(l *rate.Limiter) time.Duration {
+		start := time.Now()
+		if _, err := io.Copy(io.Discard, LimitReader(bytes.NewReader(data), l)); err != nil {
+			t.Fatalf("copy: %v", err)
+		}
+		return time.Since(start)
+	}
+
+	l := NewAdjustableRateLimiter(0)
+	if l == nil {
+		t.Fatal("adjustable limiter is nil when unlimited")
+	}
+	if elapsed := timeCopy(l); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited copy took %v", elapsed)
+	}
+	// Capping it later takes effect on the same limiter.
+	SetRate(l, 512<<10)
+	if elapsed := timeCopy(l); elapsed < 200*time.Millisecond {
+		t.Errorf("capped copy finished too fast: %v", elapsed)
+	}
+	SetRate(l, 0)
+	if elapsed := timeCopy(l); elapsed > 100*time.Millisecond {
+		t.Errorf("uncapped copy took %v", elapsed)
+	}
+}
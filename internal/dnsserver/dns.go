@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/netip"
 	"sync/atomic"
@@ -14,10 +13,14 @@ import (
 	"codeberg.org/miekg/dns"
 	"codeberg.org/miekg/dns/dnsutil"
 	"codeberg.org/miekg/dns/rdata"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
 )
 
+var logger = logging.For(logging.DNS)
+
 // dnsResolveTimeout bounds a .fn lookup on the DNS path. Stub resolvers
 // typically give up after ~5s, so answering later than that is wasted work.
 const dnsResolveTimeout = 4 * time.Second
@@ -27,7 +30,9 @@ const dnsResolveTimeout = 4 * time.Second
 // resolver.
 type DNSServer struct {
 	resolver *resolver.Resolver
-	upstream string // host:port of the upstream resolver for non-.fn queries
+	// upstream is the host:port of the upstream resolver for non-.fn
+	// queries. It can change on a config reload; see SetUpstream.
+	upstream atomic.Pointer[string]
 	// recurseAny lifts the local-client restriction on forwarding. Off by
 	// default: see forwardingAllowed.
 	recurseAny bool
@@ -56,10 +61,10 @@ const maxInflightFN = 64
 func NewDNSServer(addr, upstream string, resolver *resolver.Resolver, recurseAny bool) *DNSServer {
 	s := &DNSServer{
 		resolver:   resolver,
-		upstream:   upstream,
 		recurseAny: recurseAny,
 		inflight:   make(chan struct{}, maxInflightFN),
 	}
+	s.upstream.Store(&upstream)
 
 	mux := dns.NewServeMux()
 	mux.HandleFunc("fn.", s.handleFN)
@@ -94,12 +99,12 @@ func (s *DNSServer) Start() error {
 
 	go func() {
 		if err := s.udp.ListenAndServe(); err != nil {
-			log.Printf("DNS UDP server error: %v", err)
+			logger.Error("UDP server stopped", "err", err)
 		}
 	}()
 	go func() {
 		if err := s.tcp.ListenAndServe(); err != nil {
-			log.Printf("DNS TCP server error: %v", err)
+			logger.Error("TCP server stopped", "err", err)
 		}
 	}()
 
@@ -107,10 +112,16 @@ func (s *DNSServer) Start() error {
 	<-udpReady
 	<-tcpReady
 
-	log.Printf("DNS server listening on %s (udp+tcp), forwarding to %s", s.udp.Addr, s.upstream)
+	logger.Info("DNS server listening (udp+tcp)", "addr", s.udp.Addr, "upstream", *s.upstream.Load())
 	return nil
 }
 
+// SetUpstream switches the resolver non-.fn queries are forwarded to.
+// Queries already being forwarded finish against the old one.
+func (s *DNSServer) SetUpstream(upstream string) {
+	s.upstream.Store(&upstream)
+}
+
 // Shutdown stops both listeners.
 func (s *DNSServer) Shutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -121,8 +132,9 @@ func (s *DNSServer) Shutdown() {
 
 // handleFN answers queries for the ".fn" zone from the DHT.
 func (s *DNSServer) handleFN(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) {
+	start := time.Now()
 	if err := r.Unpack(); err != nil {
-		log.Printf("DNS: unpack: %v", err)
+		logger.Debug("unpack failed", "err", err)
 		return
 	}
 	if len(r.Question) == 0 {
@@ -146,7 +158,7 @@ func (s *DNSServer) handleFN(ctx context.Context, w dns.ResponseWriter, r *dns.M
 		r.Response = true
 		r.RecursionAvailable = true
 		r.Rcode = dns.RcodeServerFailure
-		respond(w, r)
+		respond(w, r, metrics.ZoneFN, start)
 		return
 	}
 
@@ -163,18 +175,19 @@ func (s *DNSServer) handleFN(ctx context.Context, w dns.ResponseWriter, r *dns.M
 	r.RecursionAvailable = true
 
 	if err != nil {
-		// %q, not %s: a query name is raw bytes off the wire. The DNS library
-		// escapes embedded dots and nothing else, so a label may carry newlines
-		// or terminal escapes, and answering .fn for anyone who asks is the
-		// design — an unauthenticated packet must not be able to write forged
-		// lines into this node's log.
-		log.Printf("DNS: resolve %q: %v", name, err)
+		// An attribute, never part of the message: a query name is raw bytes
+		// off the wire. The DNS library escapes embedded dots and nothing
+		// else, so a label may carry newlines or terminal escapes, and
+		// answering .fn for anyone who asks is the design — an unauthenticated
+		// packet must not be able to write forged lines into this node's log.
+		// The log handler quotes attribute values; it does not quote messages.
+		logger.Info("resolve failed", "name", name, "err", err)
 		if errors.Is(err, context.DeadlineExceeded) {
 			r.Rcode = dns.RcodeServerFailure // transient: lookup timed out
 		} else {
 			r.Rcode = dns.RcodeNameError // NXDOMAIN
 		}
-		respond(w, r)
+		respond(w, r, metrics.ZoneFN, start)
 		return
 	}
 
@@ -183,33 +196,35 @@ func (s *DNSServer) handleFN(ctx context.Context, w dns.ResponseWriter, r *dns.M
 			r.Answer = append(r.Answer, answer)
 		}
 	}
-	respond(w, r)
+	respond(w, r, metrics.ZoneFN, start)
 }
 
 // handleForward proxies non-.fn queries to the configured upstream resolver,
 // but only for clients allowed to use this node recursively.
 func (s *DNSServer) handleForward(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) {
+	start := time.Now()
 	if err := r.Unpack(); err != nil {
-		log.Printf("DNS: unpack: %v", err)
+		logger.Debug("unpack failed", "err", err)
 		return
 	}
 	if !s.recurseAny && !forwardingAllowed(w.RemoteAddr()) {
 		r.Reset()
 		r.Response = true
 		r.Rcode = dns.RcodeRefused
-		respond(w, r)
+		respond(w, r, metrics.ZoneForward, start)
 		return
 	}
-	resp, err := dns.Exchange(ctx, r, "udp", s.upstream)
+	upstream := *s.upstream.Load()
+	resp, err := dns.Exchange(ctx, r, "udp", upstream)
 	if err != nil || resp == nil {
-		log.Printf("DNS: forward to %s failed: %v", s.upstream, err)
+		logger.Warn("forward failed", "upstream", upstream, "err", err)
 		r.Reset()
 		r.Response = true
 		r.Rcode = dns.RcodeServerFailure
-		respond(w, r)
+		respond(w, r, metrics.ZoneForward, start)
 		return
 	}
-	respond(w, resp)
+	respond(w, resp, metrics.ZoneForward, start)
 }
 
 // overloadLogInterval is the minimum gap between "lookups in flight" warnings.
@@ -220,13 +235,13 @@ const overloadLogInterval = 10 * time.Second
 // the scale.
 func (s *DNSServer) logOverloaded(name string) {
 	dropped := s.dropped.Add(1)
+	metrics.DNSShed.Inc()
 	last := s.lastDropLog.Load()
 	now := time.Now().UnixNano()
 	if now-last < int64(overloadLogInterval) || !s.lastDropLog.CompareAndSwap(last, now) {
 		return
 	}
-	log.Printf("DNS: shedding lookups (%d refused so far, %d already in flight), most recently %q",
-		dropped, maxInflightFN, name)
+	logger.Warn("shedding lookups", "refused", dropped, "inflight", maxInflightFN, "lastName", name)
 }
 
 // forwardingAllowed reports whether a client may use this node as a recursive
@@ -260,10 +275,11 @@ func forwardingAllowed(addr net.Addr) bool {
 // respond packs a message and writes it. Pack leaves a partially-filled buffer
 // behind on failure (e.g. a record too large to represent on the wire) and the
 // writer would happily put those bytes on the wire, so a failure is turned into
-// an empty SERVFAIL instead of a malformed answer.
-func respond(w dns.ResponseWriter, m *dns.Msg) {
+// an empty SERVFAIL instead of a malformed answer. The answer is counted under
+// zone with the response code it finally went out with, timed from start.
+func respond(w dns.ResponseWriter, m *dns.Msg, zone string, start time.Time) {
 	if err := m.Pack(); err != nil {
-		log.Printf("DNS: pack response: %v", err)
+		logger.Error("pack response failed", "err", err)
 		m.Reset()
 		m.Response = true
 		m.Rcode = dns.RcodeServerFailure
@@ -271,9 +287,21 @@ func respond(w dns.ResponseWriter, m *dns.Msg) {
 			return
 		}
 	}
+	metrics.DNSQueries.WithLabelValues(zone, rcodeLabel(m.Rcode)).Inc()
+	metrics.DNSQueryDuration.WithLabelValues(zone).Observe(metrics.Since(start))
 	if _, err := io.Copy(w, m); err != nil {
-		log.Printf("DNS: write response: %v", err)
+		logger.Debug("write response failed", "err", err)
+	}
+}
+
+// rcodeLabel names a response code for the queries metric. Forwarded answers
+// carry whatever code the upstream chose, so an unknown one is bucketed rather
+// than given a series of its own.
+func rcodeLabel(rcode uint16) string {
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return name
 	}
+	return "OTHER"
 }
 
 // toDNSRR converts a Freedom Names record.RR into a wire DNS record.RR for the given query
@@ -8,6 +8,8 @@ import (
 
 	"codeberg.org/miekg/dns"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
@@ -95,3 +97,95 @@ func TestDNSServerAnswersFN(t *testing.T) {
 		t.Fatalf("expected 10.0.0.5, got %s", a.Addr.String())
 	}
 }
+
+// TestDNSQueriesCounted checks that an answered query lands in the queries
+// metric under its zone and response code.
+func TestDNSQueriesCounted(t *testing.T) {
+	resolver, _, name := mustResolver(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	srv := NewDNSServer(addr, "127.0.0.1:53", resolver, false)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("start dns server: %v", err)
+	}
+	defer srv.Shutdown()
+
+	ok := metrics.DNSQueries.WithLabelValues(metrics.ZoneFN, "NOERROR")
+	before := testutil.ToFloat64(ok)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := dns.Exchange(ctx, dns.NewMsg(name, dns.TypeA), "udp", addr); err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if got := testutil.ToFloat64(ok) - before; got != 1 {
+		t.Fatalf("fn NOERROR counted %v times, want 1", got)
+	}
+
+}
+
+// fakeUpstream answers every query NXDOMAIN, so a forwarded query is easy to
+// tell from one the server failed itself.
+func fakeUpstream(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			m := &dns.Msg{Data: append([]byte(nil), buf[:n]...)}
+			if m.Unpack() != nil {
+				continue
+			}
+			m.Response = true
+			m.Rcode = dns.RcodeNameError
+			m.Data = nil
+			if m.Pack() == nil {
+				pc.WriteTo(m.Data, from)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// TestSetUpstream checks that a reload's new upstream is used by the running
+// server.
+func TestSetUpstream(t *testing.T) {
+	resolver, _, _ := mustResolver(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	// Start against an upstream nothing listens on.
+	srv := NewDNSServer(addr, "127.0.0.1:1", resolver, false)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("start dns server: %v", err)
+	}
+	defer srv.Shutdown()
+	srv.SetUpstream(fakeUpstream(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := dns.Exchange(ctx, dns.NewMsg("example.com.", dns.TypeA), "udp", addr)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("rcode %s, want the new upstream's NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+}
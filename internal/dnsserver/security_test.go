@@ -2,11 +2,11 @@ package dnsserver
 
 import (
 	"bytes"
-	"log"
 	"net"
-	"os"
 	"strings"
 	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 )
 
 // --- DNS server: open-resolver gate and log-injection hardening ---
@@ -43,8 +43,10 @@ func TestForwardingAllowedOnlyForLocalClients(t *testing.T) {
 // the operator's log, including terminal escapes.
 func TestDNSLogsEscapeHostileQueryNames(t *testing.T) {
 	var buf bytes.Buffer
-	log.SetOutput(&buf)
-	defer log.SetOutput(os.Stderr)
+	if err := logging.Setup(logging.Options{Output: &buf}); err != nil {
+		t.Fatalf("setup logging: %v", err)
+	}
+	defer logging.Close()
 
 	hostile := "evil\n2026/01/01 00:00:00 DNS server listening on 0.0.0.0:53\x1b[2Kgotcha.fn."
 	s := &DNSServer{inflight: make(chan struct{}, 1)}
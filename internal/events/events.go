@@ -0,0 +1,151 @@
+// Package events is the node's activity feed: connectivity changes, record
+// publishes, resolver cache invalidations, content transfers and heal results,
+// as they happen. The HTTP API streams it to clients on /events.
+//
+// Like metrics, the feed is package-level, so every subsystem publishes into
+// it without any wiring. Publishing never blocks: a subscriber that does not
+// keep up loses events, and is told how many, rather than slowing the node.
+// With no subscribers a publish costs a lock and a counter.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topic groups related event types; subscribers choose topics.
+type Topic string
+
+// The topics, with the event types published under each.
+const (
+	// Connectivity: peer.connectedness, reachability, addresses.
+	Connectivity Topic = "connectivity"
+	// Records: record.published, record.republished, record.expired.
+	Records Topic = "records"
+	// Cache: cache.invalidated, cache.cleared.
+	Cache Topic = "cache"
+	// Content: content.fetch.started, content.fetch.progress,
+	// content.fetch.done, content.fetch.failed, content.push.
+	Content Topic = "content"
+	// Heal: heal.
+	Heal Topic = "heal"
+)
+
+// Topics lists every topic.
+var Topics = []Topic{Connectivity, Records, Cache, Content, Heal}
+
+// ParseTopics parses a comma-separated topic list. An empty list means every
+// topic.
+func ParseTopics(list string) ([]Topic, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var topics []Topic
+	for _, name := range strings.Split(list, ",") {
+		t := Topic(strings.TrimSpace(name))
+		if !t.valid() {
+			return nil, fmt.Errorf("unknown event topic %q", name)
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+func (t Topic) valid() bool {
+	for _, known := range Topics {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is one thing that happened. Data is specific to the type and is
+// encoded as JSON; Seq increases by one per event published, so a gap seen by
+// a subscriber is only ever its own dropped events or another topic's.
+type Event struct {
+	Seq   uint64    `json:"seq"`
+	Topic Topic     `json:"topic"`
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Data  any       `json:"data,omitempty"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it starts losing them.
+const subscriberBuffer = 256
+
+// Subscription receives the events of the topics it was made for.
+type Subscription struct {
+	ch      chan Event
+	topics  map[Topic]bool // nil for every topic
+	dropped atomic.Uint64
+}
+
+// Events returns the channel events arrive on. It is closed by Close.
+func (s *Subscription) Events() <-chan Event { return s.ch }
+
+// TakeDropped returns how many events were dropped because the subscriber
+// fell behind since the last call, and resets the count.
+func (s *Subscription) TakeDropped() uint64 { return s.dropped.Swap(0) }
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	if _, ok := feed.subs[s]; ok {
+		delete(feed.subs, s)
+		close(s.ch)
+	}
+}
+
+func (s *Subscription) wants(t Topic) bool {
+	return s.topics == nil || s.topics[t]
+}
+
+var feed = struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*Subscription]struct{}
+}{subs: map[*Subscription]struct{}{}}
+
+// Subscribe starts receiving events of topics, or of every topic if none are
+// given. The caller must Close the subscription.
+func Subscribe(topics ...Topic) *Subscription {
+	s := &Subscription{ch: make(chan Event, subscriberBuffer)}
+	if len(topics) > 0 {
+		s.topics = make(map[Topic]bool, len(topics))
+		for _, t := range topics {
+			s.topics[t] = true
+		}
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.subs[s] = struct{}{}
+	return s
+}
+
+// Publish sends an event to every subscriber of topic. data must not be
+// modified afterwards: subscribers encode it later, on their own goroutines.
+func Publish(topic Topic, typ string, data any) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.seq++
+	if len(feed.subs) == 0 {
+		return
+	}
+	e := Event{Seq: feed.seq, Topic: topic, Type: typ, At: time.Now().UTC(), Data: data}
+	for s := range feed.subs {
+		if !s.wants(topic) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
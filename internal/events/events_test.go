@@ -0,0 +1,65 @@
+package events
+
+import "testing"
+
+func TestSubscribeFiltersTopics(t *testing.T) {
+	records := Subscribe(Records)
+	defer records.Close()
+	all := Subscribe()
+	defer all.Close()
+
+	Publish(Content, "content.fetch.done", map[string]any{"hash": "h"})
+	Publish(Records, "record.published", map[string]any{"seq": 1})
+
+	got := <-records.Events()
+	if got.Type != "record.published" || got.Topic != Records {
+		t.Fatalf("records subscriber got %+v", got)
+	}
+	if len(records.Events()) != 0 {
+		t.Errorf("records subscriber got another topic's event")
+	}
+	first, second := <-all.Events(), <-all.Events()
+	if first.Type != "content.fetch.done" || second.Seq != first.Seq+1 {
+		t.Errorf("all-topics subscriber got %+v then %+v", first, second)
+	}
+}
+
+func TestSlowSubscriberDrops(t *testing.T) {
+	s := Subscribe(Heal)
+	defer s.Close()
+	for range subscriberBuffer + 5 {
+		Publish(Heal, "heal", nil)
+	}
+	if n := s.TakeDropped(); n != 5 {
+		t.Errorf("dropped %d, want 5", n)
+	}
+	if n := s.TakeDropped(); n != 0 {
+		t.Errorf("dropped count not reset: %d", n)
+	}
+	if len(s.Events()) != subscriberBuffer {
+		t.Errorf("buffered %d events", len(s.Events()))
+	}
+}
+
+func TestCloseEndsSubscription(t *testing.T) {
+	s := Subscribe()
+	s.Close()
+	s.Close() // idempotent
+	Publish(Cache, "cache.cleared", nil)
+	if _, ok := <-s.Events(); ok {
+		t.Error("closed subscription received an event")
+	}
+}
+
+func TestParseTopics(t *testing.T) {
+	if topics, err := ParseTopics(""); err != nil || topics != nil {
+		t.Errorf("empty list: %v %v", topics, err)
+	}
+	topics, err := ParseTopics("records, heal")
+	if err != nil || len(topics) != 2 || topics[0] != Records || topics[1] != Heal {
+		t.Errorf("records, heal: %v %v", topics, err)
+	}
+	if _, err := ParseTopics("records,gossip"); err == nil {
+		t.Error("unknown topic accepted")
+	}
+}
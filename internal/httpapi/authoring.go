@@ -48,6 +48,29 @@ func localAuthoringOnly(next http.Handler) http.Handler {
 	})
 }
 
+// NamesResponse answers GET /authoring/names.
+type NamesResponse struct {
+	Names []authoring.Name `json:"names"`
+}
+
+// CreateNameRequest is the body of POST /authoring/names.
+type CreateNameRequest struct {
+	Label string `json:"label"`
+}
+
+// PublishNameRequest is the body of POST /authoring/names/<label>/publish:
+// the complete record set to sign.
+type PublishNameRequest struct {
+	Records []record.RR `json:"records"`
+}
+
+// NamePublished answers an authoring publish.
+type NamePublished struct {
+	Published string `json:"published"`
+	Seq       uint64 `json:"seq"`
+	Expires   int64  `json:"expires"` // unix seconds
+}
+
 // NamesHandler lists locally owned names or creates a new owner key.
 //
 //	GET  /authoring/names
@@ -65,11 +88,9 @@ func NamesHandler(service *authoring.Service) http.HandlerFunc {
 				writeJSONError(w, http.StatusInternalServerError, "list names: %v", err)
 				return
 			}
-			writeJSON(w, http.StatusOK, map[string]any{"names": names})
+			writeJSON(w, http.StatusOK, NamesResponse{Names: names})
 		case http.MethodPost:
-			var input struct {
-				Label string `json:"label"`
-			}
+			var input CreateNameRequest
 			if err := decodeAuthoringJSON(r, &input); err != nil {
 				writeJSONError(w, http.StatusBadRequest, "invalid request: %v", err)
 				return
@@ -111,9 +132,7 @@ func NamePublishHandler(service *authoring.Service) http.HandlerFunc {
 			writeJSONError(w, http.StatusBadRequest, "invalid name label")
 			return
 		}
-		var input struct {
-			Records []record.RR `json:"records"`
-		}
+		var input PublishNameRequest
 		if err := decodeAuthoringJSON(r, &input); err != nil {
 			writeJSONError(w, http.StatusBadRequest, "invalid request: %v", err)
 			return
@@ -128,11 +147,7 @@ func NamePublishHandler(service *authoring.Service) http.HandlerFunc {
 			writeJSONError(w, http.StatusInternalServerError, "derive published name: %v", err)
 			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{
-			"published": name,
-			"seq":       rec.Seq,
-			"expires":   rec.EOL,
-		})
+		writeJSON(w, http.StatusOK, NamePublished{Published: name, Seq: rec.Seq, Expires: rec.EOL})
 	}
 }
 
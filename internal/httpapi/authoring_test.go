@@ -253,7 +253,7 @@ func TestAuthoringAPIIsLoopbackOnly(t *testing.T) {
 
 func TestAuthoringOriginDiffersFromContentAPI(t *testing.T) {
 	_, _, namesHandler, _ := newAuthoringHandlers(t, true)
-	handler := localAPIGuard(namesHandler, nil)
+	handler := localAPIGuard(namesHandler, nil, nil)
 	req := httptest.NewRequest(http.MethodPost, "http://localhost:8421/authoring/names", strings.NewReader(`{"label":"driveby"}`))
 	req.RemoteAddr = "127.0.0.1:1234"
 	req.Host = "localhost:8421"
@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+)
+
+const (
+	// maxBatchNames caps the names of one /resolve/batch request.
+	maxBatchNames = 10000
+	// maxBatchBody caps its body: maxBatchNames names of the longest
+	// plausible spelling, with room to spare.
+	maxBatchBody = 4 << 20
+	// batchWorkers is how many names of a batch are resolved at once. Each
+	// may be a full DHT walk, so this bounds what one client can put on the
+	// node's DHT at a time.
+	batchWorkers = 16
+)
+
+// BatchResolveRequest is the body of POST /resolve/batch.
+type BatchResolveRequest struct {
+	Names []string `json:"names"`
+	// Types keeps only the records of these types; all records if empty.
+	Types []string `json:"types,omitempty"`
+}
+
+// BatchResolveResult is one line of a /resolve/batch answer: the records of
+// one name, or why it did not resolve. Status is what /resolve would have
+// answered for the name alone.
+type BatchResolveResult struct {
+	Name    string      `json:"name"`
+	Status  int         `json:"status"`
+	Records []record.RR `json:"records"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// BatchResolveHandler resolves many names at once, concurrently, streaming
+// one BatchResolveResult per distinct name as NDJSON in the order they
+// complete. Names resolved here are cached like any other resolution, so a
+// batch also warms the cache the DNS server answers from.
+func BatchResolveHandler(freedomDht FreedomDHT, res *resolver.Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !freedomDht.IsInitialized() {
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Only POST allowed")
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBatchBody+1))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to read body: %v", err)
+			return
+		}
+		if len(data) > maxBatchBody {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "request exceeds %d bytes", maxBatchBody)
+			return
+		}
+		var req BatchResolveRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: %v", err)
+			return
+		}
+		switch {
+		case len(req.Names) == 0:
+			writeJSONError(w, http.StatusBadRequest, "names is empty")
+			return
+		case len(req.Names) > maxBatchNames:
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "%d names; at most %d per batch", len(req.Names), maxBatchNames)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		enc := json.NewEncoder(w)
+		// Returning cancels the request context, which stops the workers.
+		for result := range res.ResolveBatch(r.Context(), req.Names, batchWorkers) {
+			line := BatchResolveResult{Name: result.Name, Status: http.StatusOK, Records: []record.RR{}}
+			if result.Err != nil {
+				line.Status, line.Error = resolveErrStatus(result.Err), result.Err.Error()
+			} else {
+				for _, rr := range result.Records {
+					if len(req.Types) == 0 || slices.Contains(req.Types, rr.Type) {
+						line.Records = append(line.Records, rr)
+					}
+				}
+			}
+			if enc.Encode(line) != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
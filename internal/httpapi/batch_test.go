@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func postBatch(h http.Handler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/resolve/batch", strings.NewReader(body)))
+	return rec
+}
+
+func TestBatchResolve(t *testing.T) {
+	res, name, _ := proofFixture(t)
+	unpublished, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "gone",
+		[]record.RR{{Type: record.RecordTypeA, Value: "10.0.0.8", TTL: 60}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, _ := unpublished.FullName()
+	h := BatchResolveHandler(stubDHT{initialized: true}, res)
+
+	body, _ := json.Marshal(BatchResolveRequest{
+		Names: []string{name, strings.ToUpper(name), missing, "not-a-name"},
+		Types: []string{record.RecordTypeA},
+	})
+	rec := postBatch(h, string(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	got := map[string]BatchResolveResult{}
+	dec := json.NewDecoder(rec.Body)
+	for {
+		var line BatchResolveResult
+		if err := dec.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, dup := got[line.Name]; dup {
+			t.Errorf("%s answered twice", line.Name)
+		}
+		got[line.Name] = line
+	}
+	if len(got) != 3 {
+		t.Errorf("%d results, want one per distinct name: %v", len(got), got)
+	}
+	if r := got[name]; r.Status != http.StatusOK || len(r.Records) != 1 || r.Records[0].Value != "10.0.0.7" {
+		t.Errorf("%s: %+v, want only its A record", name, r)
+	}
+	// The fake DHT fails a miss outright; the status a real miss gets is
+	// resolveErrStatus's business.
+	if r := got[missing]; r.Status < 400 || r.Error == "" || r.Records == nil || len(r.Records) != 0 {
+		t.Errorf("%s: %+v, want an error with no records", missing, r)
+	}
+	if r := got["not-a-name"]; r.Status != http.StatusBadRequest {
+		t.Errorf("not-a-name: %+v, want 400", r)
+	}
+}
+
+func TestBatchResolveRejects(t *testing.T) {
+	res, name, _ := proofFixture(t)
+	h := BatchResolveHandler(stubDHT{initialized: true}, res)
+	tooMany := `{"names":[` + strings.Repeat(fmt.Sprintf("%q,", name), maxBatchNames) + `"x.fn"]}`
+	for body, want := range map[string]int{
+		`{"names":[]}`:     http.StatusBadRequest,
+		`{}`:               http.StatusBadRequest,
+		`names: [site.fn]`: http.StatusBadRequest,
+		tooMany:            http.StatusRequestEntityTooLarge,
+		`{"names":["a.fn"]` + strings.Repeat(" ", maxBatchBody) + `}`: http.StatusRequestEntityTooLarge,
+	} {
+		if rec := postBatch(h, body); rec.Code != want {
+			t.Errorf("%.40s: status %d, want %d", body, rec.Code, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resolve/batch", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,264 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+)
+
+// This file holds the content store's management endpoints: GET
+// /content/sets lists what is held, GET /content/hosted who it is held for,
+// GET /content/status where one root is replicated, POST /content/pin and
+// /content/unpin change whether a root is kept for good, DELETE /content?hash= (routed from
+// ContentHandler) drops one now, and POST /content/gc applies the hosting
+// budget and sweeps unreferenced blobs. GET /content/export and POST
+// /content/import move a whole set in and out as one archive file.
+
+// ContentSetsResponse answers /content/sets.
+type ContentSetsResponse struct {
+	Sets []content.SetInfo `json:"sets"`
+}
+
+// PinResponse answers /content/pin and /content/unpin.
+type PinResponse struct {
+	Hash   string `json:"hash"`
+	Pinned bool   `json:"pinned"`
+}
+
+// ImportResponse answers /content/import with the root and size of the set
+// the archive held.
+type ImportResponse struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// RemoveResponse answers DELETE /content.
+type RemoveResponse struct {
+	Hash string `json:"hash"`
+}
+
+// ContentSetsHandler lists every content set the node holds.
+func ContentSetsHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		sets, err := svc.ListSets()
+		if err != nil {
+			writeContentAdminError(w, "", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ContentSetsResponse{Sets: sets})
+	}
+}
+
+// ContentHostedHandler reports hosted content grouped by the peer it came
+// from, against the hosting budget and per-peer quota.
+func ContentHostedHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		usage, err := svc.Hosted()
+		if err != nil {
+			writeContentAdminError(w, "", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, usage)
+	}
+}
+
+// ContentStatusHandler reports where the set rooted at ?hash= is replicated:
+// the local holder state, the peers replication has confirmed, the last heal
+// and a durability estimate. It also counts the DHT's provider records, unless
+// ?providers=0 skips that lookup (as the CLI does when polling).
+func ContentStatusHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		hash, ok := rootParam(w, r)
+		if !ok {
+			return
+		}
+		lookup := r.URL.Query().Get("providers") != "0"
+		writeJSON(w, http.StatusOK, svc.ReplicationStatus(r.Context(), hash, lookup))
+	}
+}
+
+// ContentPinHandler pins (pin true) or unpins a root given as ?hash=.
+func ContentPinHandler(svc *node.ContentService, pin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		hash, ok := rootParam(w, r)
+		if !ok {
+			return
+		}
+		op := svc.Unpin
+		if pin {
+			op = svc.Pin
+		}
+		if err := op(hash); err != nil {
+			writeContentAdminError(w, hash, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, PinResponse{Hash: hash, Pinned: pin})
+	}
+}
+
+// ContentGCHandler runs one garbage-collection pass.
+func ContentGCHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		res, err := svc.GC()
+		if err != nil {
+			writeContentAdminError(w, "", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// ContentExportHandler streams the set rooted at ?hash= as a content archive.
+func ContentExportHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		hash, ok := rootParam(w, r)
+		if !ok {
+			return
+		}
+		// Export writes nothing until the root is found, so the headers are
+		// only committed once there is an archive to send; a failure after
+		// that can only truncate it, which an import detects.
+		aw := &archiveResponse{w: w, hash: hash}
+		if err := svc.Export(r.Context(), hash, aw); err != nil {
+			if !aw.started {
+				writeContentFetchError(w, hash, err)
+				return
+			}
+			contentLog.Warn("export interrupted", "hash", hash, "err", err)
+		}
+	}
+}
+
+// archiveResponse sets the archive response headers on the first write.
+type archiveResponse struct {
+	w       http.ResponseWriter
+	hash    string
+	started bool
+}
+
+func (a *archiveResponse) Write(p []byte) (int, error) {
+	if !a.started {
+		a.started = true
+		a.w.Header().Set("Content-Type", "application/octet-stream")
+		a.w.Header().Set("Content-Disposition", `attachment; filename="`+a.hash+`.fnar"`)
+		a.w.WriteHeader(http.StatusOK)
+	}
+	return a.w.Write(p)
+}
+
+// ContentImportHandler stores the set in a content archive sent as the
+// request body, as owned content.
+func ContentImportHandler(svc *node.ContentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		// The archive bounds itself (only blobs its root names are accepted,
+		// each once), so the body needs no separate cap.
+		hash, size, err := svc.Import(r.Context(), r.Body)
+		if errors.Is(err, content.ErrBadArchive) {
+			writeJSONError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "import content: %v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ImportResponse{Hash: hash, Size: size})
+	}
+}
+
+// deleteContent removes the set rooted at ?hash= from this node.
+func deleteContent(w http.ResponseWriter, r *http.Request, svc *node.ContentService) {
+	hash, ok := rootParam(w, r)
+	if !ok {
+		return
+	}
+	if err := svc.Remove(hash); err != nil {
+		writeContentAdminError(w, hash, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RemoveResponse{Hash: hash})
+}
+
+// rootParam reads and validates ?hash= as a set root, writing the 400 itself.
+func rootParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing hash parameter")
+		return "", false
+	}
+	if !content.IsContentHash(hash) {
+		writeJSONError(w, http.StatusBadRequest, "invalid content hash")
+		return "", false
+	}
+	return hash, true
+}
+
+// writeContentAdminError maps a store-management error: 404 for a root this
+// node does not hold, 503 when there is no index to manage, 500 otherwise.
+func writeContentAdminError(w http.ResponseWriter, hash string, err error) {
+	switch {
+	case errors.Is(err, content.ErrBlobNotFound):
+		writeJSONError(w, http.StatusNotFound, "content %s is not held by this node", hash)
+	case errors.Is(err, node.ErrIndexUnavailable):
+		writeJSONError(w, http.StatusServiceUnavailable, "%v", err)
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "%v", err)
+	}
+}
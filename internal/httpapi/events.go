@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
+)
+
+// eventsKeepalive is how often an idle event stream gets a comment line, so
+// proxies and clients do not take a quiet node for a dead connection.
+var eventsKeepalive = 15 * time.Second
+
+// LaggedEvent is the data of the "lagged" event: the stream fell behind and
+// Dropped events were lost since the last one it was sent.
+type LaggedEvent struct {
+	Dropped uint64 `json:"dropped"`
+}
+
+// EventsHandler streams the node's activity as server-sent events, one per
+// events.Event: the event's type as the SSE event name, its Seq as the id and
+// the event as JSON data. ?topics= takes a comma-separated topic list, all
+// topics if absent. Streams end when stop is closed, so that shutting the
+// server down does not wait for the clients to hang up.
+func EventsHandler(stop <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		topics, err := events.ParseTopics(r.URL.Query().Get("topics"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		sub := events.Subscribe(topics...)
+		defer sub.Close()
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if rc.Flush() != nil {
+			return
+		}
+
+		keepalive := time.NewTicker(eventsKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-stop:
+				return
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					if writeSSE(w, 0, "lagged", LaggedEvent{Dropped: dropped}) != nil {
+						return
+					}
+				}
+				if writeSSE(w, e.Seq, e.Type, e) != nil {
+					return
+				}
+			}
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one server-sent event; an id of 0 is left out.
+func writeSSE(w http.ResponseWriter, id uint64, name string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+	return err
+}
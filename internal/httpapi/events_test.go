@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
+)
+
+// sseFrame is one parsed server-sent event.
+type sseFrame struct {
+	id, event, data string
+}
+
+// readFrame reads the next event from an SSE stream, skipping comments.
+func readFrame(t *testing.T, r *bufio.Reader) sseFrame {
+	t.Helper()
+	var f sseFrame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if f.event != "" {
+				return f
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			f.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			f.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			f.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEvents(t *testing.T, url string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestEventsStreamsTopics(t *testing.T) {
+	srv := httptest.NewServer(EventsHandler(nil))
+	t.Cleanup(srv.Close) // after the stream's body is closed
+	stream := openEvents(t, srv.URL+"?topics=records")
+
+	events.Publish(events.Cache, "cache.cleared", map[string]any{"entries": 3})
+	events.Publish(events.Records, "record.published", map[string]any{"label": "site", "seq": 2})
+
+	f := readFrame(t, stream)
+	if f.event != "record.published" || f.id == "" {
+		t.Fatalf("got %+v, want the record.published event", f)
+	}
+	var e struct {
+		Seq   uint64         `json:"seq"`
+		Topic string         `json:"topic"`
+		Type  string         `json:"type"`
+		Data  map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(f.data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Topic != "records" || e.Type != "record.published" || e.Data["label"] != "site" {
+		t.Errorf("event data %s", f.data)
+	}
+}
+
+// gatedWriter is a ResponseWriter whose writes wait for gate, so the handler
+// falls behind the feed on demand. ready is closed when the headers are
+// flushed, by which time the handler has subscribed.
+type gatedWriter struct {
+	*httptest.ResponseRecorder
+	gate, ready chan struct{}
+	once        sync.Once
+	mu          sync.Mutex
+}
+
+func (w *gatedWriter) Write(b []byte) (int, error) {
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *gatedWriter) Flush() {
+	w.once.Do(func() { close(w.ready) })
+}
+
+func (w *gatedWriter) body() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Body.String()
+}
+
+func TestEventsReportsLag(t *testing.T) {
+	w := &gatedWriter{ResponseRecorder: httptest.NewRecorder(), gate: make(chan struct{}), ready: make(chan struct{})}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		EventsHandler(nil).ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodGet, "/events?topics=heal", nil))
+	}()
+	<-w.ready
+
+	// The handler takes the first event and blocks writing it; the rest fill
+	// its subscription until they are dropped.
+	for range 1000 {
+		events.Publish(events.Heal, "heal", nil)
+	}
+	close(w.gate)
+	events.Publish(events.Heal, "heal", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(w.body(), "event: lagged") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	stream := bufio.NewReader(strings.NewReader(w.body()))
+	for {
+		f := readFrame(t, stream)
+		if f.event == "lagged" {
+			var lag LaggedEvent
+			if err := json.Unmarshal([]byte(f.data), &lag); err != nil || lag.Dropped == 0 {
+				t.Fatalf("lagged event %q: %v", f.data, err)
+			}
+			return
+		}
+	}
+}
+
+func TestEventsEndOnStop(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(EventsHandler(stop))
+	t.Cleanup(srv.Close)
+	stream := openEvents(t, srv.URL)
+
+	close(stop)
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.ReadString('\n')
+		for err == nil {
+			_, err = stream.ReadString('\n')
+		}
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after stop")
+	}
+}
+
+func TestEventsRejectsUnknownTopic(t *testing.T) {
+	rec := httptest.NewRecorder()
+	EventsHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events?topics=gossip", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "gossip") {
+		t.Errorf("status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -6,19 +6,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/routing"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/bind"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
@@ -26,7 +29,42 @@ import (
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/version"
 )
 
-type Response struct {
+// Loggers for the subsystems this package serves.
+var (
+	httpLog      = logging.For(logging.HTTP)
+	authoringLog = logging.For(logging.Authoring)
+	contentLog   = logging.For(logging.Content)
+)
+
+// The JSON bodies the API answers with. The handlers encode these types and
+// the OpenAPI document (openapi.go) describes them, so the two cannot drift.
+
+// ErrorResponse is the body of every error the API answers with.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// PublishResponse answers /publish with the full name the record went under.
+type PublishResponse struct {
+	Published string `json:"published"`
+}
+
+// ResolveResponse answers /resolve. Proof is set only for ?proof=1.
+type ResolveResponse struct {
+	Name    string          `json:"name"`
+	Records []record.RR     `json:"records"`
+	Seq     uint64          `json:"seq,omitempty"` // of the record waited for (wait-seq)
+	Proof   *resolver.Proof `json:"proof,omitempty"`
+}
+
+// PeersResponse answers /peers: the routing table and the connected hosts.
+type PeersResponse struct {
+	Peers []string `json:"peers"`
+	Hosts []string `json:"hosts"`
+}
+
+// InfoResponse answers /info.
+type InfoResponse struct {
 	Version         string   `json:"version"`
 	Role            string   `json:"role"`
 	Mode            string   `json:"mode"`
@@ -36,6 +74,10 @@ type Response struct {
 	HostsConnected  int      `json:"hostsConnected"`
 	NetworkSize     int32    `json:"networkSize"`
 	Protocols       []string `json:"protocols"`
+
+	// Reprovide is the progress of keeping this node's content provider
+	// records fresh; absent when content is not enabled.
+	Reprovide *node.ReprovideStats `json:"reprovide,omitempty"`
 }
 
 // Node roles reported by /health and /info. This is a fixed vocabulary, not
@@ -54,23 +96,31 @@ func roleFor(bootstrapMode bool) string {
 	return RoleNode
 }
 
-func StartHTTPServer(freedomDht FreedomDHT, res *resolver.Resolver, cache resolver.Cache, svc *node.ContentService, addr, authoringAddr string, bootstrapMode bool, allowedHosts []string) {
+func StartHTTPServer(freedomDht FreedomDHT, res *resolver.Resolver, cache resolver.Cache, svc *node.ContentService, addr, authoringAddr string, bootstrapMode bool, allowedHosts *HostList, tokensFile string) {
 	role := roleFor(bootstrapMode)
+	// Bound beyond loopback, the API is reachable by more than this machine,
+	// so every route with a scope needs a token (see tokens.go).
+	var tokens *apitoken.Store
+	if !loopbackAddr(addr) {
+		tokens = apitoken.Open(tokensFile)
+		if list, err := tokens.List(); err != nil {
+			httpLog.Error("API tokens unreadable; remote requests will fail", "file", tokensFile, "err", err)
+		} else if len(list) == 0 {
+			httpLog.Warn("HTTP API bound beyond loopback but no API tokens exist; create one with: freedom token create <name> --scopes ...", "addr", addr)
+		}
+	}
 	var authoringServer *http.Server
 	var authoringListener net.Listener
 	var authoringURL string
 	if !bootstrapMode {
 		authoringService, err := authoring.NewDefault(freedomDht)
 		if err != nil {
-			log.Printf("WARNING: authoring API disabled: %v", err)
+			authoringLog.Warn("authoring API disabled", "err", err)
 		} else if authoringListener, err = listenAuthoring(authoringAddr); err != nil {
-			log.Printf("WARNING: authoring API disabled: %v", err)
+			authoringLog.Warn("authoring API disabled", "err", err)
 		} else {
-			authoringMux := http.NewServeMux()
-			authoringMux.Handle("/authoring/names", localAuthoringOnly(NamesHandler(authoringService)))
-			authoringMux.Handle("/authoring/names/", localAuthoringOnly(NamePublishHandler(authoringService)))
 			authoringServer = &http.Server{
-				Handler:           localAPIGuard(authoringMux, nil),
+				Handler:           localAPIGuard(newMux(authoringRoutes(), apiDeps{names: authoringService}), nil, nil),
 				ReadHeaderTimeout: 15 * time.Second,
 				IdleTimeout:       120 * time.Second,
 			}
@@ -78,21 +128,21 @@ func StartHTTPServer(freedomDht FreedomDHT, res *resolver.Resolver, cache resolv
 		}
 	}
 
-	// Set up HTTP API endpoints
-	mux := http.NewServeMux()
-	mux.HandleFunc("/publish", PublishHandler(freedomDht))
-	mux.HandleFunc("/resolve", ResolveHandler(freedomDht, res))
-	mux.HandleFunc("/record", RecordHandler(freedomDht))
-	mux.HandleFunc("/peers", AllPeersHandler(freedomDht))
-	mux.HandleFunc("/info", InfoHandler(freedomDht, role))
-	mux.HandleFunc("/clear_cache", ClearCacheHandler(cache))
-	mux.HandleFunc("/health", HealthHandler(freedomDht, role, authoringURL))
-	// Content endpoints (LibreWeb's page-bytes layer).
-	mux.HandleFunc("/content", ContentHandler(svc))
-	mux.HandleFunc("/resolve-content", ResolveContentHandler(res, svc))
+	// Set up HTTP API endpoints (see routes.go)
+	stopStreams := make(chan struct{})
+	mux := newMux(apiRoutes(), apiDeps{
+		dht:          freedomDht,
+		res:          res,
+		cache:        cache,
+		svc:          svc,
+		role:         role,
+		authoringURL: authoringURL,
+		stop:         stopStreams,
+		tokens:       tokens,
+	})
 	server := &http.Server{
 		Addr:    addr,
-		Handler: localAPIGuard(mux, allowedHosts),
+		Handler: localAPIGuard(mux, allowedHosts, tokens),
 		// The API is unauthenticated and bound to loopback, but a listening
 		// socket is still a listening socket: without a header deadline a
 		// single peer that opens connections and never finishes a request
@@ -102,14 +152,17 @@ func StartHTTPServer(freedomDht FreedomDHT, res *resolver.Resolver, cache resolv
 		ReadHeaderTimeout: 15 * time.Second,
 		IdleTimeout:       120 * time.Second,
 	}
+	// Shutdown waits for active requests, and an event stream never ends on
+	// its own.
+	server.RegisterOnShutdown(func() { close(stopStreams) })
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	if authoringServer != nil {
 		go func() {
-			log.Printf("Authoring API server listening on %s", authoringListener.Addr())
+			authoringLog.Info("authoring API server listening", "addr", authoringListener.Addr())
 			if err := authoringServer.Serve(authoringListener); err != nil && err != http.ErrServerClosed {
-				log.Printf("WARNING: authoring API stopped: %v", err)
+				authoringLog.Error("authoring API stopped", "err", err)
 			}
 		}()
 	}
@@ -123,39 +176,38 @@ func StartHTTPServer(freedomDht FreedomDHT, res *resolver.Resolver, cache resolv
 		<-stop
 		err := server.Shutdown(context.Background())
 		if err != nil {
-			log.Printf("Error during shutdown: %v\n", err)
+			httpLog.Error("shutdown failed", "err", err)
 		}
 		if authoringServer != nil {
 			if err := authoringServer.Shutdown(context.Background()); err != nil {
-				log.Printf("Error shutting down authoring API: %v\n", err)
+				authoringLog.Error("shutdown failed", "err", err)
 			}
 		}
 		// Notifying the main goroutine that we are done
 		wg.Done()
 	}()
 
-	log.Printf("HTTP API server listening on %s", addr)
+	httpLog.Info("HTTP API server listening", "addr", addr)
 	// Blocking until the server is done
 	err := server.ListenAndServe()
 	if err == http.ErrServerClosed {
 		// Graceful shutdown the HTTP server
 		wg.Wait()
-		//log.Println("Server was gracefully shut down.")
 	} else if err != nil {
 		if bind.IsPrivilegedPort(err) || bind.IsAddrInUse(err) {
-			log.Fatalf("HTTP API could not bind %s: %v\n  Set FREEDOM_HTTP_ADDR to a free port, e.g. FREEDOM_HTTP_ADDR=:8422", addr, err)
+			httpLog.Error("HTTP API could not bind; set FREEDOM_HTTP_ADDR to a free port, e.g. FREEDOM_HTTP_ADDR=:8422", "addr", addr, "err", err)
+		} else {
+			httpLog.Error("HTTP server stopped", "err", err)
 		}
-		log.Fatalf("HTTP server error: %v", err)
+		os.Exit(1)
 	}
 }
 
 func listenAuthoring(addr string) (net.Listener, error) {
-	host, _, err := net.SplitHostPort(addr)
-	if err != nil {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
 		return nil, fmt.Errorf("invalid FREEDOM_AUTHORING_ADDR %q: %w", addr, err)
 	}
-	ip := net.ParseIP(host)
-	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+	if !loopbackAddr(addr) {
 		return nil, fmt.Errorf("FREEDOM_AUTHORING_ADDR %q is not loopback; owner-key operations cannot be exposed remotely", addr)
 	}
 	listener, err := net.Listen("tcp", addr)
@@ -187,18 +239,31 @@ const maxPublishBody = 1 << 20
 //     fetch, announcing this node to the DHT as a provider of it. An Origin
 //     check cannot see that request at all (see crossSite), so cross-site
 //     requests are refused outright on every route and method.
-func localAPIGuard(next http.Handler, allowedHosts []string) http.Handler {
+//
+// When tokens is set — the API is bound beyond loopback, so it is no longer
+// only local — the guard also authenticates: a request carrying a bearer
+// token must carry a valid one, and the token rides on the request context
+// for the route's scope check (see requireScope). A request with a valid
+// token may name any Host, since a rebinding page has no token to send.
+func localAPIGuard(next http.Handler, allowedHosts *HostList, tokens *apitoken.Store) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !hostAllowed(r.Host, allowedHosts) {
-			http.Error(w, "Host not allowed for the local API (set FREEDOM_HTTP_ALLOWED_HOSTS to permit it)", http.StatusForbidden)
+		token, ok := authenticate(w, r, tokens)
+		if !ok {
+			return
+		}
+		if token != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, token))
+		}
+		if token == nil && !hostAllowed(r.Host, allowedHosts.Get()) {
+			writeJSONError(w, http.StatusForbidden, "Host not allowed for the local API (set FREEDOM_HTTP_ALLOWED_HOSTS to permit it)")
 			return
 		}
 		if crossSite(r) {
-			http.Error(w, "Cross-site request rejected (Sec-Fetch-Site: cross-site): this API is local-only", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, "Cross-site request rejected (Sec-Fetch-Site: cross-site): this API is local-only")
 			return
 		}
 		if !originAllowed(r) {
-			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, "Cross-origin request rejected")
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -224,6 +289,33 @@ func crossSite(r *http.Request) bool {
 	return r.Header.Get("Sec-Fetch-Site") == "cross-site"
 }
 
+// HostList is the operator's Host header allow-list (FREEDOM_HTTP_ALLOWED_HOSTS),
+// replaceable while the server runs so a config reload takes effect without
+// a restart. A nil *HostList is the empty list.
+type HostList struct {
+	hosts atomic.Pointer[[]string]
+}
+
+// NewHostList returns a list holding hosts.
+func NewHostList(hosts []string) *HostList {
+	l := &HostList{}
+	l.Set(hosts)
+	return l
+}
+
+// Set replaces the list.
+func (l *HostList) Set(hosts []string) {
+	l.hosts.Store(&hosts)
+}
+
+// Get returns the current list.
+func (l *HostList) Get() []string {
+	if l == nil {
+		return nil
+	}
+	return *l.hosts.Load()
+}
+
 // hostAllowed reports whether a request's Host header may address this API.
 // "localhost", any IP literal, and the operator's explicit allow-list pass.
 func hostAllowed(rawHost string, allowed []string) bool {
@@ -280,94 +372,172 @@ func originAllowed(r *http.Request) bool {
 func PublishHandler(freedomDht FreedomDHT) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !freedomDht.IsInitialized() {
-			http.Error(w, "DHT not initialized", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
 			return
 		}
 		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Only POST allowed")
 			return
 		}
 
 		body, err := io.ReadAll(io.LimitReader(r.Body, maxPublishBody+1))
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Failed to read request body")
 			return
 		}
 		if len(body) > maxPublishBody {
-			http.Error(w, "Record too large", http.StatusRequestEntityTooLarge)
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "Record too large")
 			return
 		}
 		rec, err := record.UnmarshalFNRecord(body)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid FNRecord: %v", err), http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid FNRecord: %v", err)
 			return
 		}
 		// Verify before publishing so we never store an unowned/forged record.
 		if err := rec.Verify(); err != nil {
-			http.Error(w, fmt.Sprintf("Record failed verification: %v", err), http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Record failed verification: %v", err)
 			return
 		}
 		if err := freedomDht.PublishRecord(rec); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to publish record: %v", err), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to publish record: %v", err)
 			return
 		}
 
 		name, _ := rec.FullName()
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		jsonResponse, _ := json.Marshal(map[string]string{"published": name})
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, PublishResponse{Published: name})
 	}
 }
 
 // ResolveHandler resolves a "label.<pubKeyID>.fn" name to its resource records,
-// optionally filtered by ?type=A.
+// optionally filtered by ?type=A. With ?proof=1 the response also carries the
+// signed record and owner evidence behind them (see resolver.Proof). With
+// ?wait-seq=N it long-polls the DHT until the name's record reaches seq N.
 func ResolveHandler(freedomDht FreedomDHT, res *resolver.Resolver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !freedomDht.IsInitialized() {
-			http.Error(w, "DHT not initialized", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
 			return
 		}
 
 		name := r.URL.Query().Get("name")
 		if name == "" {
-			http.Error(w, "Missing name parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing name parameter")
 			return
 		}
 		recordType := r.URL.Query().Get("type")
+		withProof, err := queryBool(r, "proof")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
 
-		log.Println("Resolve name:", name)
+		httpLog.Debug("resolve", "name", name, "proof", withProof)
+		if r.URL.Query().Has("wait-seq") {
+			if withProof {
+				writeJSONError(w, http.StatusBadRequest, "proof cannot be combined with wait-seq")
+				return
+			}
+			writeResolveWait(w, r, res, name, recordType)
+			return
+		}
+		if withProof {
+			writeResolveProof(w, r, res, name, recordType)
+			return
+		}
 
-		var (
-			records []record.RR
-			err     error
-		)
+		var records []record.RR
 		if recordType != "" {
 			records, err = res.ResolveType(r.Context(), name, recordType)
 		} else {
 			records, err = res.Resolve(r.Context(), name)
 		}
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to resolve name: %v", err), resolveErrStatus(err))
+			writeJSONError(w, resolveErrStatus(err), "Failed to resolve name: %v", err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		jsonResponse, _ := json.Marshal(map[string]any{"name": name, "records": records})
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, ResolveResponse{Name: name, Records: records})
+	}
+}
+
+// writeResolveProof answers /resolve?proof=1. The records are taken from the
+// proof's record, so they are exactly what a client verifying it will get.
+func writeResolveProof(w http.ResponseWriter, r *http.Request, res *resolver.Resolver, name, recordType string) {
+	proof, err := res.ResolveProof(r.Context(), name)
+	if err != nil {
+		writeJSONError(w, resolveErrStatus(err), "Failed to resolve name: %v", err)
+		return
+	}
+	records := make([]record.RR, 0, len(proof.Record.Records))
+	for _, rr := range proof.Record.Records {
+		if recordType == "" || rr.Type == recordType {
+			records = append(records, rr)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, ResolveResponse{Name: name, Records: records, Proof: proof})
+}
+
+const (
+	// defaultWaitTimeout is how long /resolve?wait-seq waits without a
+	// timeout parameter; maxWaitTimeout is the longest it may be asked to.
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// waitSeqPoll is how long /resolve?wait-seq pauses between DHT lookups.
+var waitSeqPoll = time.Second
+
+// writeResolveWait answers /resolve?wait-seq=N: the records of the first
+// record with Seq >= N the DHT returns within the timeout, bypassing the
+// cache. Deploy scripts use it to block until an update is visible.
+func writeResolveWait(w http.ResponseWriter, r *http.Request, res *resolver.Resolver, name, recordType string) {
+	seq, err := strconv.ParseUint(r.URL.Query().Get("wait-seq"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid wait-seq parameter %q", r.URL.Query().Get("wait-seq"))
+		return
+	}
+	timeout := defaultWaitTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			writeJSONError(w, http.StatusBadRequest, "invalid timeout parameter %q: want a duration up to %v", v, maxWaitTimeout)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	rec, err := res.WaitSeq(ctx, name, seq, waitSeqPoll)
+	if err != nil {
+		writeJSONError(w, resolveErrStatus(err), "Failed to resolve name: %v", err)
+		return
+	}
+	records := make([]record.RR, 0, len(rec.Records))
+	for _, rr := range rec.Records {
+		if recordType == "" || rr.Type == recordType {
+			records = append(records, rr)
+		}
 	}
+
+	writeJSON(w, http.StatusOK, ResolveResponse{Name: name, Records: records, Seq: rec.Seq})
 }
 
 // resolveErrStatus maps a resolution error to an HTTP status so clients can
 // tell "this name does not exist" (404) apart from "bad request" (400) and
-// "the lookup infrastructure failed, retry later" (502).
+// "the lookup infrastructure failed, retry later" (502), and a wait-seq that
+// ran out of time (504).
 func resolveErrStatus(err error) int {
 	switch {
+	case errors.Is(err, resolver.ErrSeqNotVisible):
+		return http.StatusGatewayTimeout
 	case errors.Is(err, routing.ErrNotFound), errors.Is(err, registry.ErrRegistryNotFound):
 		return http.StatusNotFound
 	case errors.Is(err, record.ErrNotFNName):
 		return http.StatusBadRequest
+	case errors.Is(err, resolver.ErrNoProof):
+		return http.StatusNotImplemented
 	default:
 		// Transient/unknown failure (DHT timeout, no peers).
 		return http.StatusBadGateway
@@ -380,23 +550,23 @@ func resolveErrStatus(err error) int {
 func RecordHandler(freedomDht FreedomDHT) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !freedomDht.IsInitialized() {
-			http.Error(w, "DHT not initialized", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
 			return
 		}
 
 		name := r.URL.Query().Get("name")
 		if name == "" {
-			http.Error(w, "Missing name parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing name parameter")
 			return
 		}
 		key, err := record.DHTKeyForName(name)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid name: %v", err), http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid name: %v", err)
 			return
 		}
 		rec, err := freedomDht.ResolveRecord(r.Context(), key)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch record: %v", err), resolveErrStatus(err))
+			writeJSONError(w, resolveErrStatus(err), "Failed to fetch record: %v", err)
 			return
 		}
 
@@ -411,7 +581,7 @@ func RecordHandler(freedomDht FreedomDHT) http.HandlerFunc {
 func AllPeersHandler(freedomDht FreedomDHT) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !freedomDht.IsInitialized() {
-			http.Error(w, "DHT not initialized", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
 			return
 		}
 
@@ -430,22 +600,16 @@ func AllPeersHandler(freedomDht FreedomDHT) http.HandlerFunc {
 			hostList[i] = host.String()
 		}
 
-		jsonResponse, err := json.Marshal(map[string][]string{"peers": peerList, "hosts": hostList})
-		if err != nil {
-			http.Error(w, "Failed to encode peer list", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, PeersResponse{Peers: peerList, Hosts: hostList})
 	}
 }
 
-// InfoHandler returns general information about the DHT
-func InfoHandler(freedomDht FreedomDHT, role string) http.HandlerFunc {
+// InfoHandler returns general information about the DHT, and the content
+// reprovide progress when svc is set.
+func InfoHandler(freedomDht FreedomDHT, svc *node.ContentService, role string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !freedomDht.IsInitialized() {
-			http.Error(w, "DHT not initialized", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "DHT not initialized")
 			return
 		}
 
@@ -483,7 +647,7 @@ func InfoHandler(freedomDht FreedomDHT, role string) http.HandlerFunc {
 			protocolList[i] = string(protocol)
 		}
 
-		response := Response{
+		response := InfoResponse{
 			Version:         version.String(),
 			Role:            role,
 			Mode:            mode,
@@ -494,9 +658,14 @@ func InfoHandler(freedomDht FreedomDHT, role string) http.HandlerFunc {
 			NetworkSize:     networkSize,
 			Protocols:       protocolList,
 		}
+		if svc != nil {
+			if st, ok := svc.ReprovideStats(); ok {
+				response.Reprovide = &st
+			}
+		}
 		jsonResponse, err := json.Marshal(response)
 		if err != nil {
-			http.Error(w, "Failed to encode peer list", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to encode peer list")
 			return
 		}
 
@@ -510,7 +679,7 @@ func ClearCacheHandler(cache resolver.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check if the request method is DELETE
 		if r.Method != http.MethodDelete {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 		// Clear the full cache
@@ -2,14 +2,13 @@ package httpapi
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/multiformats/go-base36"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
@@ -26,15 +25,41 @@ const sniffLen = 512
 // Plus /health for the spawned-node handshake.
 
 // writeJSONError writes a typed JSON error so the browser can show a friendly
-// message and branch on the status code.
+// message and branch on the status code. Every route answers errors through
+// it, so a client parses one ErrorResponse shape whatever it called.
 func writeJSONError(w http.ResponseWriter, status int, format string, args ...any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf(format, args...)})
+	writeJSON(w, status, ErrorResponse{Error: fmt.Sprintf(format, args...)})
 }
 
-// ContentHandler stores a blob (POST) or serves one by hash (GET). It replaces
-// `ipfs add` / `ipfs cat` for LibreWeb.
+// ContentStored answers POST /content. Key and Cap are set for ?encrypt=1
+// only: the base36 content key, and the read capability combining it with
+// the hash.
+type ContentStored struct {
+	Hash string `json:"hash"`
+	Key  string `json:"key,omitempty"`
+	Cap  string `json:"cap,omitempty"`
+}
+
+// ContentProofResponse answers /resolve-content?proof=1.
+type ContentProofResponse struct {
+	Name  string          `json:"name"`
+	Hash  string          `json:"hash"`
+	Proof *resolver.Proof `json:"proof"`
+}
+
+// HealthResponse answers /health. Role and Capabilities are always present,
+// ready or not; AuthoringAPI only with the "authoring" capability.
+type HealthResponse struct {
+	Status       string   `json:"status"`
+	Version      string   `json:"version"`
+	Ready        bool     `json:"ready"`
+	Role         string   `json:"role"`
+	Capabilities []string `json:"capabilities"`
+	AuthoringAPI string   `json:"authoringAPI,omitempty"`
+}
+
+// ContentHandler stores a blob (POST), serves one by hash (GET) or drops a set
+// from this node (DELETE). It replaces `ipfs add` / `ipfs cat` for LibreWeb.
 func ContentHandler(svc *node.ContentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if svc == nil {
@@ -46,20 +71,45 @@ func ContentHandler(svc *node.ContentService) http.HandlerFunc {
 			postContent(w, r, svc)
 		case http.MethodGet:
 			getContent(w, r, svc)
+		case http.MethodDelete:
+			deleteContent(w, r, svc)
 		default:
-			writeJSONError(w, http.StatusMethodNotAllowed, "use POST to store or GET to fetch")
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST to store, GET to fetch or DELETE to remove")
 		}
 	}
 }
 
 // postContent stores the request body (chunked past content.ChunkSize) and returns its
 // content hash. The body is consumed as a stream, so upload size is bounded by
-// content.MaxContentSize, not by memory.
+// content.MaxContentSize, not by memory. ?chunking=cdc selects content-defined
+// chunk boundaries for this upload (see content.ChunkingCDC).
+//
+// ?encrypt=1 stores the body encrypted under a fresh key (see
+// content/crypt.go). The response then also carries the key and the read
+// capability combining both, which is the only way to read the content back:
+// the node keeps no copy of the key once the response is written.
 func postContent(w http.ResponseWriter, r *http.Request, svc *node.ContentService) {
+	chunking, err := content.ParseChunking(r.URL.Query().Get("chunking"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	opts := node.PutOptions{Chunking: chunking}
+	encrypt, err := queryBool(r, "encrypt")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if encrypt {
+		if opts.Key, err = content.NewContentKey(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "generate content key: %v", err)
+			return
+		}
+	}
 	// Cap the read one byte past the limit so an oversized upload is detected
 	// (PutStream errors when the total crosses content.MaxContentSize) without
 	// reading an unbounded body.
-	hash, _, err := svc.PutStream(r.Context(), io.LimitReader(r.Body, content.MaxContentSize+1))
+	hash, _, err := svc.PutStreamWith(r.Context(), io.LimitReader(r.Body, content.MaxContentSize+1), opts)
 	if errors.Is(err, content.ErrContentTooLarge) {
 		writeJSONError(w, http.StatusRequestEntityTooLarge, "content exceeds max size of %d bytes", content.MaxContentSize)
 		return
@@ -68,24 +118,51 @@ func postContent(w http.ResponseWriter, r *http.Request, svc *node.ContentServic
 		writeJSONError(w, http.StatusInternalServerError, "store content: %v", err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"hash": hash})
+	resp := ContentStored{Hash: hash}
+	if opts.Key != nil {
+		resp.Key = base36.EncodeToStringLc(opts.Key)
+		resp.Cap = content.FormatReadCap(hash, opts.Key)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// queryBool reads an optional boolean query flag ("1"/"true"/"0"/"false").
+func queryBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter %q", name, v)
+	}
+	return b, nil
+}
+
+// fetchContentRef fetches a plain content hash, or decrypts the content behind
+// a read capability.
+func fetchContentRef(r *http.Request, svc *node.ContentService, hash string, key []byte) (io.ReadCloser, int64, error) {
+	if key != nil {
+		return svc.FetchStreamKey(r.Context(), hash, key)
+	}
+	return svc.FetchStream(r.Context(), hash)
 }
 
 // getContent serves the bytes for ?hash=, fetching from providers on a miss.
 // Chunked content is streamed chunk by chunk rather than assembled in memory.
+// ?hash= may also be a read capability, in which case the plaintext is served.
 func getContent(w http.ResponseWriter, r *http.Request, svc *node.ContentService) {
-	hash := r.URL.Query().Get("hash")
-	if hash == "" {
+	ref := r.URL.Query().Get("hash")
+	if ref == "" {
 		writeJSONError(w, http.StatusBadRequest, "missing hash parameter")
 		return
 	}
-	if !content.IsContentHash(hash) {
+	hash, key, err := content.ParseContentRef(ref)
+	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, "invalid content hash")
 		return
 	}
-	rc, size, err := svc.FetchStream(r.Context(), hash)
+	rc, size, err := fetchContentRef(r, svc, hash, key)
 	if err != nil {
 		writeContentFetchError(w, hash, err)
 		return
@@ -96,17 +173,29 @@ func getContent(w http.ResponseWriter, r *http.Request, svc *node.ContentService
 
 // ResolveContentHandler resolves a name to its CONTENT record and streams the
 // bytes in a single call — the request LibreWeb makes for every page load.
+// With ?proof=1 it streams nothing and answers with the content reference and
+// the proof behind it instead; the bytes are then fetched by hash.
 func ResolveContentHandler(res *resolver.Resolver, svc *node.ContentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if svc == nil {
+		name := r.URL.Query().Get("name")
+		withProof, err := queryBool(r, "proof")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		// A proof fetches no bytes, so it needs no content service.
+		if svc == nil && !withProof {
 			writeJSONError(w, http.StatusServiceUnavailable, "content service not enabled")
 			return
 		}
-		name := r.URL.Query().Get("name")
 		if name == "" {
 			writeJSONError(w, http.StatusBadRequest, "missing name parameter")
 			return
 		}
+		if withProof {
+			writeContentProof(w, r, res, name)
+			return
+		}
 
 		records, err := res.ResolveType(r.Context(), name, record.RecordTypeCONTENT)
 		if err != nil {
@@ -118,8 +207,15 @@ func ResolveContentHandler(res *resolver.Resolver, svc *node.ContentService) htt
 			return
 		}
 
-		hash := records[0].Value
-		rc, size, err := svc.FetchStream(r.Context(), hash)
+		// A CONTENT record may carry a read capability; the record was
+		// validated when it was accepted, so a parse failure here is only a
+		// defensive check.
+		hash, key, err := content.ParseContentRef(records[0].Value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadGateway, "%s has an invalid CONTENT record", name)
+			return
+		}
+		rc, size, err := fetchContentRef(r, svc, hash, key)
 		if err != nil {
 			writeContentFetchError(w, hash, err)
 			return
@@ -130,6 +226,33 @@ func ResolveContentHandler(res *resolver.Resolver, svc *node.ContentService) htt
 	}
 }
 
+// writeContentProof answers /resolve-content?proof=1 with the name's content
+// reference and the proof it was read from.
+func writeContentProof(w http.ResponseWriter, r *http.Request, res *resolver.Resolver, name string) {
+	proof, err := res.ResolveProof(r.Context(), name)
+	if err != nil {
+		writeJSONError(w, resolveErrStatus(err), "resolve %s: %v", name, err)
+		return
+	}
+	ref := ""
+	for _, rr := range proof.Record.Records {
+		if rr.Type == record.RecordTypeCONTENT {
+			ref = rr.Value
+			break
+		}
+	}
+	if ref == "" {
+		writeJSONError(w, http.StatusNotFound, "%s has no CONTENT record", name)
+		return
+	}
+	hash, _, err := content.ParseContentRef(ref)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "%s has an invalid CONTENT record", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, ContentProofResponse{Name: name, Hash: hash, Proof: proof})
+}
+
 // writeContentStream streams content bytes with an exact Content-Length. A
 // chunk fetch failing mid-stream can only truncate the response (headers are
 // already sent); the length mismatch lets the client detect it.
@@ -149,17 +272,22 @@ func writeContentStream(w http.ResponseWriter, hash string, rc io.Reader, size i
 	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.Copy(w, io.MultiReader(bytes.NewReader(head), rc)); err != nil {
-		log.Printf("content: stream %s: %v", hash, err)
+		contentLog.Debug("stream interrupted", "hash", hash, "err", err)
 	}
 }
 
 // writeContentFetchError maps a Fetch error to a status: 404 if genuinely not
-// available anywhere, 502 for transient discovery/transfer failures.
+// available anywhere, 403 if it is there but the key given cannot decrypt it,
+// 502 for transient discovery/transfer failures.
 func writeContentFetchError(w http.ResponseWriter, hash string, err error) {
 	if errors.Is(err, content.ErrBlobNotFound) {
 		writeJSONError(w, http.StatusNotFound, "content %s not found on the network", hash)
 		return
 	}
+	if errors.Is(err, content.ErrBadContentKey) {
+		writeJSONError(w, http.StatusForbidden, "content %s: %v", hash, err)
+		return
+	}
 	writeJSONError(w, http.StatusBadGateway, "fetch content %s: %v", hash, err)
 }
 
@@ -172,18 +300,17 @@ func writeContentFetchError(w http.ResponseWriter, hash string, err error) {
 // bootstrap node as "nothing here" and double-spawn. /health always answers.
 func HealthHandler(freedomDht FreedomDHT, role, authoringURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := map[string]any{
-			"status":       "ok",
-			"version":      version.String(),
-			"ready":        freedomDht.IsInitialized(),
-			"role":         role,
-			"capabilities": []string{},
+		response := HealthResponse{
+			Status:       "ok",
+			Version:      version.String(),
+			Ready:        freedomDht.IsInitialized(),
+			Role:         role,
+			Capabilities: []string{},
 		}
 		if authoringURL != "" {
-			response["capabilities"] = []string{"authoring"}
-			response["authoringAPI"] = authoringURL
+			response.Capabilities = []string{"authoring"}
+			response.AuthoringAPI = authoringURL
 		}
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusOK, response)
 	}
 }
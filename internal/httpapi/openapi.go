@@ -0,0 +1,281 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/version"
+)
+
+// This file builds the OpenAPI 3.0 description served at /openapi.json. It is
+// generated from the route tables in routes.go, and the body schemas from the
+// Go types the handlers encode, so the document describes what is actually
+// served. openapi_test.go checks every operation against it.
+
+// OpenAPIHandler serves the OpenAPI document for this node: the API at the
+// address it was reached through and, when authoringURL is set, the authoring
+// API at that address.
+func OpenAPIHandler(authoringURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		writeJSON(w, http.StatusOK, openAPIDocument("http://"+r.Host, authoringURL))
+	}
+}
+
+// openAPIDocument describes the API at apiURL and, unless authoringURL is
+// empty, the authoring API at authoringURL.
+func openAPIDocument(apiURL, authoringURL string) map[string]any {
+	schemas := newSchemaSet()
+	paths := map[string]any{}
+	for _, e := range apiRoutes() {
+		paths[e.path()] = e.pathItem(schemas)
+	}
+	if authoringURL != "" {
+		for _, e := range authoringRoutes() {
+			item := e.pathItem(schemas)
+			item["servers"] = []map[string]string{{"url": authoringURL, "description": "authoring API, loopback only"}}
+			paths[e.path()] = item
+		}
+	}
+	schemas.ref(reflect.TypeFor[ErrorResponse]())
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "Freedom Names node API",
+			"version":     version.String(),
+			"description": "The local HTTP API of a Freedom Names node. Every error is answered with an ErrorResponse body.",
+		},
+		"servers": []map[string]string{{"url": apiURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]any{
+				"token": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An API token (freedom token create). Needed only when the API is bound beyond loopback; each operation names the scope it needs.",
+				},
+			},
+		},
+	}
+}
+
+func (e endpoint) path() string {
+	if e.specPath != "" {
+		return e.specPath
+	}
+	return e.pattern
+}
+
+func (e endpoint) pathItem(schemas *schemaSet) map[string]any {
+	item := map[string]any{}
+	for _, op := range e.ops {
+		item[strings.ToLower(op.method)] = op.describe(schemas)
+	}
+	return item
+}
+
+func (op operation) describe(schemas *schemaSet) map[string]any {
+	out := map[string]any{"summary": op.summary}
+	if op.scope != "" {
+		out["description"] = fmt.Sprintf("Needs a token with the %s scope when the API is bound beyond loopback.", op.scope)
+		out["security"] = []map[string][]string{{"token": {}}, {}} // {}: no token on loopback
+	}
+	if len(op.params) > 0 {
+		params := make([]map[string]any, 0, len(op.params))
+		for _, p := range op.params {
+			params = append(params, p.describe())
+		}
+		out["parameters"] = params
+	}
+	switch {
+	case op.request != nil:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(schemas.ref(reflect.TypeOf(op.request))),
+		}
+	case op.upload:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/octet-stream": map[string]any{"schema": binarySchema()}},
+		}
+	}
+
+	success := map[string]any{"description": http.StatusText(op.successStatus())}
+	media := map[string]any{}
+	if op.response != nil {
+		media["application/json"] = map[string]any{"schema": schemas.ref(reflect.TypeOf(op.response))}
+	}
+	switch {
+	case op.item != nil:
+		// Each line of the stream is one value of this schema.
+		media[op.stream] = map[string]any{"schema": schemas.ref(reflect.TypeOf(op.item))}
+	case op.stream != "":
+		media[op.stream] = map[string]any{"schema": binarySchema()}
+	}
+	if len(media) > 0 {
+		success["content"] = media
+	}
+	responses := map[string]any{strconv.Itoa(op.successStatus()): success}
+	errorBody := jsonContent(schemas.ref(reflect.TypeFor[ErrorResponse]()))
+	statuses := []int{http.StatusForbidden}
+	if op.scope != "" {
+		statuses = append(statuses, http.StatusUnauthorized)
+	}
+	for _, status := range append(statuses, op.errors...) {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content":     errorBody,
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+func (op operation) successStatus() int {
+	if op.status != 0 {
+		return op.status
+	}
+	return http.StatusOK
+}
+
+func (p param) describe() map[string]any {
+	kind := p.kind
+	if kind == "" {
+		kind = "string"
+	}
+	in := "query"
+	if p.path {
+		in = "path"
+	}
+	return map[string]any{
+		"name":        p.name,
+		"in":          in,
+		"description": p.desc,
+		"required":    p.required,
+		"schema":      map[string]string{"type": kind},
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func binarySchema() map[string]any {
+	return map[string]any{"type": "string", "format": "binary"}
+}
+
+// schemaSet collects the named schemas of components/schemas, keyed by Go
+// type name.
+type schemaSet struct {
+	schemas map[string]any
+	types   map[string]reflect.Type
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{schemas: map[string]any{}, types: map[string]reflect.Type{}}
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// ref returns the schema for t, registering named struct types as components
+// and referring to them.
+func (s *schemaSet) ref(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return s.ref(t.Elem())
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]any{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := t.Name()
+		if seen, ok := s.types[name]; !ok {
+			s.types[name] = t // claimed before the fields, for recursive types
+			s.schemas[name] = s.object(t)
+		} else if seen != t {
+			panic(fmt.Sprintf("openapi: schema name %s is both %s and %s", name, seen, t))
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Struct:
+		return s.object(t)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer", "format": intFormat(t)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": intFormat(t), "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Interface:
+		return map[string]any{}
+	}
+	panic(fmt.Sprintf("openapi: no schema for %s", t))
+}
+
+func intFormat(t reflect.Type) string {
+	if t.Bits() <= 32 {
+		return "int32"
+	}
+	return "int64"
+}
+
+// object describes a struct the way encoding/json encodes it. A field without
+// omitempty is always present, so it is required; a nil slice, map or pointer
+// in one is encoded as null, so it is also nullable.
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for f := range t.Fields() {
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := s.ref(f.Type)
+		omitEmpty := strings.Contains(opts, "omitempty")
+		if !omitEmpty {
+			required = append(required, name)
+			switch f.Type.Kind() {
+			case reflect.Slice, reflect.Map, reflect.Pointer:
+				schema = nullable(schema)
+			}
+		}
+		props[name] = schema
+	}
+	out := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// nullable marks a schema as accepting null. A $ref takes no siblings in
+// OpenAPI 3.0, so a referenced schema is wrapped.
+func nullable(schema map[string]any) map[string]any {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]any{"allOf": []any{schema}, "nullable": true}
+	}
+	schema["nullable"] = true
+	return schema
+}
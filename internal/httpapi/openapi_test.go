@@ -0,0 +1,519 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/routing"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// specDHT is an initialized DHT over an in-memory record store.
+type specDHT struct {
+	stubDHT
+	store *testsupport.FakeDHT
+}
+
+func (d specDHT) PublishRecord(rec *record.FNRecord) error { return d.store.PublishRecord(rec) }
+
+func (d specDHT) ResolveRecord(ctx context.Context, key string) (*record.FNRecord, error) {
+	rec, err := d.store.ResolveRecord(ctx, key)
+	if err != nil {
+		return nil, routing.ErrNotFound
+	}
+	return rec, nil
+}
+
+// conformanceFixture is a node with one published name pointing at one held
+// content set, served through the muxes StartHTTPServer builds.
+type conformanceFixture struct {
+	deps              apiDeps
+	api, authoringAPI http.Handler
+	name              string // published, with an A and a CONTENT record
+	hash              string // held and pointed at by name
+	spare             string // held, free to remove
+	absent            string // a valid hash nothing holds
+	archive           []byte // export of hash
+	record            []byte // a signed record not yet published
+}
+
+func newConformanceFixture(t *testing.T) *conformanceFixture {
+	t.Helper()
+	ctx := t.Context()
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := node.NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fx := &conformanceFixture{}
+	if fx.hash, _, err = svc.PutStream(ctx, strings.NewReader("<html>hello</html>")); err != nil {
+		t.Fatal(err)
+	}
+	if fx.spare, _, err = svc.PutStream(ctx, strings.NewReader("spare")); err != nil {
+		t.Fatal(err)
+	}
+	fx.absent = mustContentHash(t, "absent")
+	var archive bytes.Buffer
+	if err := svc.Export(ctx, fx.hash, &archive); err != nil {
+		t.Fatal(err)
+	}
+	fx.archive = archive.Bytes()
+
+	dht := specDHT{stubDHT: stubDHT{initialized: true}, store: testsupport.NewFakeDHT()}
+	rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "site", []record.RR{
+		{Type: record.RecordTypeA, Value: "10.0.0.7", TTL: 300},
+		{Type: record.RecordTypeCONTENT, Value: fx.hash, TTL: 300},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dht.PublishRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	fx.name, _ = rec.FullName()
+	other, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "other",
+		[]record.RR{{Type: record.RecordTypeTXT, Value: "hi", TTL: 60}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fx.record, err = other.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, _ := resolver.NewMemoryCache()
+	names, err := authoring.New(t.TempDir(), dht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	close(stopped) // event streams end as soon as they have started
+	deps := apiDeps{
+		dht:          dht,
+		res:          resolver.NewResolver(dht.store, cache),
+		cache:        cache,
+		svc:          svc,
+		role:         RoleNode,
+		authoringURL: "http://127.0.0.1:8421",
+		names:        names,
+		stop:         stopped,
+	}
+	fx.deps = deps
+	fx.api = localAPIGuard(newMux(apiRoutes(), deps), nil, nil)
+	fx.authoringAPI = localAPIGuard(newMux(authoringRoutes(), deps), nil, nil)
+	return fx
+}
+
+// serve sends one request the way a local client would.
+func (fx *conformanceFixture) serve(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	h, host := fx.api, "localhost:8420"
+	if strings.HasPrefix(target, "/authoring/") {
+		h, host = fx.authoringAPI, "127.0.0.1:8421"
+	}
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Host = host
+	req.RemoteAddr = "127.0.0.1:45678"
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestOpenAPIConformance exercises every operation /openapi.json documents and
+// checks each answer, successful or not, against the document: the status
+// must be one it lists and the body must match the schema it gives.
+func TestOpenAPIConformance(t *testing.T) {
+	fx := newConformanceFixture(t)
+	spec := loadSpec(t, fx)
+	publish := `{"records":[{"type":"A","value":"10.0.0.9","ttl":60}]}`
+
+	for _, tc := range []struct {
+		method, path, target, body string
+		header                     http.Header
+		status                     int
+	}{
+		{"POST", "/publish", "/publish", string(fx.record), nil, 200},
+		{"POST", "/publish", "/publish", "not a record", nil, 400},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", nil, 200},
+		{"GET", "/resolve", "/resolve?type=A&proof=1&name=" + fx.name, "", nil, 200},
+		{"GET", "/resolve", "/resolve", "", nil, 400},
+		{"GET", "/resolve", "/resolve?name=site.fn", "", nil, 404},
+		{"GET", "/resolve", "/resolve?proof=maybe&name=" + fx.name, "", nil, 400},
+		{"GET", "/resolve", "/resolve?wait-seq=1&type=A&name=" + fx.name, "", nil, 200},
+		{"GET", "/resolve", "/resolve?wait-seq=2&timeout=10ms&name=" + fx.name, "", nil, 504},
+		{"GET", "/resolve", "/resolve?wait-seq=2&timeout=1h&name=" + fx.name, "", nil, 400},
+		{"POST", "/resolve/batch", "/resolve/batch", `{"names":["` + fx.name + `","site.fn","not-a-name"],"types":["A"]}`, nil, 200},
+		{"POST", "/resolve/batch", "/resolve/batch", `{"names":[]}`, nil, 400},
+		{"GET", "/record", "/record?name=" + fx.name, "", nil, 200},
+		{"GET", "/record", "/record?name=not-a-name", "", nil, 400},
+		{"GET", "/peers", "/peers", "", nil, 200},
+		{"GET", "/info", "/info", "", nil, 200},
+		{"DELETE", "/clear_cache", "/clear_cache", "", nil, 200},
+		{"GET", "/health", "/health", "", nil, 200},
+		{"GET", "/health", "/health", "", http.Header{"Sec-Fetch-Site": {"cross-site"}}, 403},
+		{"GET", "/metrics", "/metrics", "", nil, 200},
+		{"GET", "/openapi.json", "/openapi.json", "", nil, 200},
+		{"GET", "/events", "/events?topics=records,heal", "", nil, 200},
+		{"GET", "/events", "/events?topics=bogus", "", nil, 400},
+		{"POST", "/content", "/content", "page bytes", nil, 200},
+		{"POST", "/content", "/content?encrypt=1", "secret bytes", nil, 200},
+		{"POST", "/content", "/content?chunking=bogus", "x", nil, 400},
+		{"GET", "/content", "/content?hash=" + fx.hash, "", nil, 200},
+		{"GET", "/content", "/content?hash=bogus", "", nil, 400},
+		{"GET", "/content", "/content?hash=" + fx.absent, "", nil, 404},
+		{"DELETE", "/content", "/content?hash=" + fx.spare, "", nil, 200},
+		{"DELETE", "/content", "/content?hash=" + fx.absent, "", nil, 404},
+		{"GET", "/resolve-content", "/resolve-content?name=" + fx.name, "", nil, 200},
+		{"GET", "/resolve-content", "/resolve-content?proof=1&name=" + fx.name, "", nil, 200},
+		{"GET", "/resolve-content", "/resolve-content?name=site.fn", "", nil, 404},
+		{"GET", "/content/sets", "/content/sets", "", nil, 200},
+		{"GET", "/content/hosted", "/content/hosted", "", nil, 200},
+		{"GET", "/content/status", "/content/status?providers=0&hash=" + fx.hash, "", nil, 200},
+		{"GET", "/content/status", "/content/status", "", nil, 400},
+		{"POST", "/content/pin", "/content/pin?hash=" + fx.hash, "", nil, 200},
+		{"POST", "/content/pin", "/content/pin?hash=" + fx.absent, "", nil, 404},
+		{"POST", "/content/unpin", "/content/unpin?hash=" + fx.hash, "", nil, 200},
+		{"POST", "/content/gc", "/content/gc", "", nil, 200},
+		{"GET", "/content/export", "/content/export?hash=" + fx.hash, "", nil, 200},
+		{"GET", "/content/export", "/content/export?hash=" + fx.absent, "", nil, 404},
+		{"POST", "/content/import", "/content/import", string(fx.archive), nil, 200},
+		{"POST", "/content/import", "/content/import", "not an archive", nil, 400},
+		{"GET", "/authoring/names", "/authoring/names", "", nil, 200},
+		{"POST", "/authoring/names", "/authoring/names", `{"label":"blog"}`, nil, 201},
+		{"POST", "/authoring/names", "/authoring/names", `{"label":"blog"}`, nil, 409},
+		{"POST", "/authoring/names", "/authoring/names", `{"name":"blog"}`, nil, 400},
+		{"POST", "/authoring/names/{label}/publish", "/authoring/names/blog/publish", publish, nil, 200},
+		{"POST", "/authoring/names/{label}/publish", "/authoring/names/nosuch/publish", publish, nil, 404},
+	} {
+		rec := fx.serve(tc.method, tc.target, tc.body, tc.header)
+		what := tc.method + " " + tc.target
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", what, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if err := spec.checkResponse(tc.path, tc.method, rec); err != nil {
+			t.Errorf("%s: %v", what, err)
+		}
+		if rec.Code < 300 {
+			spec.exercised[tc.method+" "+tc.path] = true
+		}
+	}
+
+	for _, op := range spec.operations() {
+		if !spec.exercised[op] {
+			t.Errorf("%s is documented but never exercised", op)
+		}
+	}
+}
+
+// TestUnknownPathIsJSON checks the muxes' fallback answers in the error shape
+// every route uses.
+func TestUnknownPathIsJSON(t *testing.T) {
+	fx := newConformanceFixture(t)
+	spec := loadSpec(t, fx)
+	for _, target := range []string{"/nope", "/authoring/other"} {
+		rec := fx.serve(http.MethodGet, target, "", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: status %d", target, rec.Code)
+		}
+		if err := spec.checkBody(map[string]any{"$ref": "#/components/schemas/ErrorResponse"}, rec); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+}
+
+// TestOpenAPIWithoutAuthoring checks a node without an authoring API does not
+// document one.
+func TestOpenAPIWithoutAuthoring(t *testing.T) {
+	doc := openAPIDocument("http://localhost:8420", "")
+	for path := range doc["paths"].(map[string]any) {
+		if strings.HasPrefix(path, "/authoring/") {
+			t.Errorf("documents %s", path)
+		}
+	}
+}
+
+// openAPISpec is a parsed /openapi.json with enough of a schema validator for
+// the subset of OpenAPI the generator emits.
+type openAPISpec struct {
+	doc       map[string]any
+	exercised map[string]bool
+}
+
+func loadSpec(t *testing.T, fx *conformanceFixture) *openAPISpec {
+	t.Helper()
+	rec := fx.serve(http.MethodGet, "/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/openapi.json: status %d", rec.Code)
+	}
+	s := &openAPISpec{exercised: map[string]bool{}}
+	if err := json.Unmarshal(rec.Body.Bytes(), &s.doc); err != nil {
+		t.Fatalf("/openapi.json: %v", err)
+	}
+	if s.doc["openapi"] != "3.0.3" {
+		t.Fatalf("openapi version %v", s.doc["openapi"])
+	}
+	if err := s.checkRefs(s.doc); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// operations lists "METHOD path" for every documented operation.
+func (s *openAPISpec) operations() []string {
+	var ops []string
+	for path, item := range s.doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if method != "servers" {
+				ops = append(ops, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// checkRefs reports a $ref anywhere in v that names no component.
+func (s *openAPISpec) checkRefs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if s.component(ref) == nil {
+				return fmt.Errorf("dangling $ref %s", ref)
+			}
+		}
+		for _, sub := range v {
+			if err := s.checkRefs(sub); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, sub := range v {
+			if err := s.checkRefs(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *openAPISpec) component(ref string) map[string]any {
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+	if !ok {
+		return nil
+	}
+	schema, _ := s.doc["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+	return schema
+}
+
+// checkResponse checks rec is an answer the document allows for the
+// operation.
+func (s *openAPISpec) checkResponse(path, method string, rec *httptest.ResponseRecorder) error {
+	item, ok := s.doc["paths"].(map[string]any)[path].(map[string]any)
+	if !ok {
+		return fmt.Errorf("path %s is not documented", path)
+	}
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+	resp, ok := op["responses"].(map[string]any)[strconv.Itoa(rec.Code)].(map[string]any)
+	if !ok {
+		return fmt.Errorf("status %d is not documented", rec.Code)
+	}
+	media, _ := resp["content"].(map[string]any)
+	if len(media) == 0 {
+		if rec.Body.Len() != 0 {
+			return fmt.Errorf("undocumented body %q", rec.Body)
+		}
+		return nil
+	}
+	got, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	entry, ok := media[got].(map[string]any)
+	if !ok {
+		entry, ok = media["*/*"].(map[string]any)
+	}
+	if !ok {
+		return fmt.Errorf("content type %q is not documented", got)
+	}
+	schema := entry["schema"].(map[string]any)
+	switch {
+	case schema["format"] == "binary":
+		return nil
+	case got == "application/x-ndjson":
+		return s.checkLines(schema, rec)
+	}
+	return s.checkBody(schema, rec)
+}
+
+func (s *openAPISpec) checkBody(schema map[string]any, rec *httptest.ResponseRecorder) error {
+	dec := json.NewDecoder(rec.Body)
+	dec.UseNumber()
+	var body any
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("body is not JSON: %v", err)
+	}
+	return s.validate(schema, body, "body")
+}
+
+// checkLines checks each line of an NDJSON body against schema.
+func (s *openAPISpec) checkLines(schema map[string]any, rec *httptest.ResponseRecorder) error {
+	dec := json.NewDecoder(rec.Body)
+	dec.UseNumber()
+	for i := 0; ; i++ {
+		var line any
+		if err := dec.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("line %d is not JSON: %v", i, err)
+		}
+		if err := s.validate(schema, line, fmt.Sprintf("line[%d]", i)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *openAPISpec) validate(schema map[string]any, v any, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.validate(s.component(ref), v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if err := s.validate(sub.(map[string]any), v, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %T is not an object", at, v)
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing %s", at, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for name, value := range obj {
+			sub, ok := props[name].(map[string]any)
+			if !ok {
+				sub, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: undocumented property %s", at, name)
+				}
+				continue
+			}
+			if err := s.validate(sub, value, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %T is not an array", at, v)
+		}
+		for i, item := range arr {
+			if err := s.validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: %T is not a string", at, v)
+		}
+		switch schema["format"] {
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+				return fmt.Errorf("%s: not base64: %v", at, err)
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: not a date-time: %v", at, err)
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: %T is not a number", at, v)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: %s is not an integer", at, n)
+		}
+		if min, ok := schema["minimum"].(float64); ok && float64(i) < min {
+			return fmt.Errorf("%s: %d is below %v", at, i, min)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("%s: %T is not a number", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: %T is not a boolean", at, v)
+		}
+	}
+	return nil
+}
+
+// TestOpenAPIDescribesQueryParameters checks each documented query parameter
+// is one its handler reads: a request naming it with a bad value must not be
+// answered as if it were absent. It covers the boolean flags, whose parse
+// errors are the handlers' own.
+func TestOpenAPIDescribesQueryParameters(t *testing.T) {
+	fx := newConformanceFixture(t)
+	doc := openAPIDocument("http://localhost:8420", "http://127.0.0.1:8421")
+	for path, item := range doc["paths"].(map[string]any) {
+		for method, op := range item.(map[string]any) {
+			op, ok := op.(map[string]any)
+			if !ok {
+				continue
+			}
+			params, _ := op["parameters"].([]map[string]any)
+			for _, p := range params {
+				if p["schema"].(map[string]string)["type"] != "boolean" {
+					continue
+				}
+				target := path + "?" + url.Values{p["name"].(string): {"maybe"}, "name": {fx.name}}.Encode()
+				rec := fx.serve(strings.ToUpper(method), target, "", nil)
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("%s %s: status %d for an invalid %s", method, path, rec.Code, p["name"])
+				}
+			}
+		}
+	}
+}
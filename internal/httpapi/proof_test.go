@@ -0,0 +1,139 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/verify"
+)
+
+// ownerOnlyRegistry resolves every bare name to one owner but, unlike the BCH
+// registry, cannot prove it.
+type ownerOnlyRegistry struct{ pub []byte }
+
+func (o ownerOnlyRegistry) ResolveOwner(string) ([]byte, error) { return o.pub, nil }
+
+// proofFixture publishes one record with an A and a CONTENT record and returns
+// a resolver over it, the name, and the owner's marshaled pubkey.
+func proofFixture(t *testing.T) (*resolver.Resolver, string, []byte) {
+	t.Helper()
+	store := testsupport.NewFakeDHT()
+	priv := testsupport.NewTestKey(t)
+	rec, err := record.BuildAndSignRecord(priv, "site", []record.RR{
+		{Type: record.RecordTypeA, Value: "10.0.0.7", TTL: 300},
+		{Type: record.RecordTypeCONTENT, Value: mustContentHash(t, "page"), TTL: 300},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PublishRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	cache, _ := resolver.NewMemoryCache()
+	name, _ := rec.FullName()
+	pub, _ := crypto.MarshalPublicKey(priv.GetPublic())
+	return resolver.NewResolver(store, cache), name, pub
+}
+
+// mustContentHash returns the content hash of data.
+func mustContentHash(t *testing.T, data string) string {
+	t.Helper()
+	hash, err := content.ContentHash([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// getQuery serves GET path?params through h.
+func getQuery(t *testing.T, h http.Handler, path string, params url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil))
+	return rec
+}
+
+// TestResolveProof checks /resolve?proof=1 returns a proof the verify package
+// accepts, with records matching the proof's record.
+func TestResolveProof(t *testing.T) {
+	res, name, _ := proofFixture(t)
+	h := ResolveHandler(stubDHT{initialized: true}, res)
+
+	rec := getQuery(t, h, "/resolve", url.Values{"name": {name}, "type": {"A"}, "proof": {"1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Records []record.RR   `json:"records"`
+		Proof   *verify.Proof `json:"proof"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Records) != 1 || body.Records[0].Value != "10.0.0.7" {
+		t.Errorf("records %+v", body.Records)
+	}
+	records, err := verify.Check(name, body.Proof)
+	if err != nil {
+		t.Fatalf("proof does not verify: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("proof carries %d records, want the full set", len(records))
+	}
+
+	if rec := getQuery(t, h, "/resolve", url.Values{"name": {name}, "proof": {"maybe"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad proof flag: status %d", rec.Code)
+	}
+}
+
+// TestResolveProofUnprovableRegistry checks a bare name behind a registry that
+// cannot prove owners is refused in proof mode rather than answered unproven.
+func TestResolveProofUnprovableRegistry(t *testing.T) {
+	res, _, pub := proofFixture(t)
+	res.WithRegistry(ownerOnlyRegistry{pub: pub})
+	h := ResolveHandler(stubDHT{initialized: true}, res)
+
+	if rec := getQuery(t, h, "/resolve", url.Values{"name": {"site.fn"}}); rec.Code != http.StatusOK {
+		t.Fatalf("plain resolve: status %d", rec.Code)
+	}
+	if rec := getQuery(t, h, "/resolve", url.Values{"name": {"site.fn"}, "proof": {"1"}}); rec.Code != http.StatusNotImplemented {
+		t.Errorf("proof resolve: status %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+// TestResolveContentProof checks /resolve-content?proof=1 answers with the
+// content hash and a verifiable proof, even with no content service.
+func TestResolveContentProof(t *testing.T) {
+	res, name, _ := proofFixture(t)
+	h := ResolveContentHandler(res, nil)
+
+	rec := getQuery(t, h, "/resolve-content", url.Values{"name": {name}, "proof": {"true"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Hash  string        `json:"hash"`
+		Proof *verify.Proof `json:"proof"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Hash != mustContentHash(t, "page") {
+		t.Errorf("hash %q", body.Hash)
+	}
+	if _, err := verify.Check(name, body.Proof); err != nil {
+		t.Errorf("proof does not verify: %v", err)
+	}
+
+	if rec := getQuery(t, h, "/resolve-content", url.Values{"name": {name}}); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("streaming without a content service: status %d", rec.Code)
+	}
+}
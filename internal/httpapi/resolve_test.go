@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// lockedDHT is a FakeDHT safe to publish to while a request resolves from it.
+type lockedDHT struct {
+	mu    sync.Mutex
+	store *testsupport.FakeDHT
+}
+
+func (d *lockedDHT) PublishRecord(rec *record.FNRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.PublishRecord(rec)
+}
+
+func (d *lockedDHT) ResolveRecord(ctx context.Context, key string) (*record.FNRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.ResolveRecord(ctx, key)
+}
+
+// TestResolveWaitSeq publishes an update while /resolve?wait-seq waits for it,
+// and checks the cached answer moves on with it.
+func TestResolveWaitSeq(t *testing.T) {
+	old := waitSeqPoll
+	waitSeqPoll = 5 * time.Millisecond
+	defer func() { waitSeqPoll = old }()
+
+	priv := testsupport.NewTestKey(t)
+	build := func(seq uint64, ip string) *record.FNRecord {
+		rec, err := record.BuildAndSignRecord(priv, "site", []record.RR{{Type: record.RecordTypeA, Value: ip, TTL: 300}}, seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	dht := &lockedDHT{store: testsupport.NewFakeDHT()}
+	first := build(1, "10.0.0.1")
+	if err := dht.PublishRecord(first); err != nil {
+		t.Fatal(err)
+	}
+	name, _ := first.FullName()
+	cache, _ := resolver.NewMemoryCache()
+	h := ResolveHandler(stubDHT{initialized: true}, resolver.NewResolver(dht, cache))
+	resolveA := func(params url.Values) (int, ResolveResponse) {
+		params.Set("name", name)
+		rec := getQuery(t, h, "/resolve", params)
+		var out ResolveResponse
+		json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+	if _, out := resolveA(url.Values{}); len(out.Records) != 1 || out.Records[0].Value != "10.0.0.1" {
+		t.Fatalf("before the update: %+v", out)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		dht.PublishRecord(build(2, "10.0.0.2"))
+	}()
+	status, out := resolveA(url.Values{"wait-seq": {"2"}, "timeout": {"5s"}})
+	if status != http.StatusOK || out.Seq != 2 || len(out.Records) != 1 || out.Records[0].Value != "10.0.0.2" {
+		t.Fatalf("wait-seq=2: %d %+v", status, out)
+	}
+	if _, out := resolveA(url.Values{}); len(out.Records) != 1 || out.Records[0].Value != "10.0.0.2" {
+		t.Errorf("cached answer after the wait: %+v, want the update", out)
+	}
+
+	for params, want := range map[string]int{
+		"wait-seq=3&timeout=20ms": http.StatusGatewayTimeout,
+		"wait-seq=x":              http.StatusBadRequest,
+		"wait-seq=3&timeout=0s":   http.StatusBadRequest,
+		"wait-seq=3&proof=1":      http.StatusBadRequest,
+	} {
+		values, _ := url.ParseQuery(params)
+		if status, _ := resolveA(values); status != want {
+			t.Errorf("%s: status %d, want %d", params, status, want)
+		}
+	}
+}
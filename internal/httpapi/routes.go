@@ -0,0 +1,264 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+)
+
+// apiDeps is what the handlers are built from.
+type apiDeps struct {
+	dht          FreedomDHT
+	res          *resolver.Resolver
+	cache        resolver.Cache
+	svc          *node.ContentService
+	role         string
+	authoringURL string
+	names        *authoring.Service
+	stop         <-chan struct{} // closed when the server shuts down
+	tokens       *apitoken.Store // nil unless the API is bound beyond loopback
+}
+
+// An endpoint is one route: the handler serving it and the operations the
+// OpenAPI document describes for it. Both the muxes and the document are built
+// from the tables below, so a route cannot be served without being described.
+type endpoint struct {
+	pattern  string // ServeMux pattern
+	specPath string // OpenAPI path, when it differs from pattern
+	handler  func(apiDeps) http.Handler
+	ops      []operation
+}
+
+// operation is one method of an endpoint as the OpenAPI document shows it.
+type operation struct {
+	method   string
+	summary  string
+	params   []param
+	request  any    // JSON request body, by its Go type; nil for none
+	upload   bool   // the request body is a raw byte stream
+	status   int    // success status; 0 for 200
+	response any    // JSON success body, by its Go type; nil for none
+	stream   string // media type of a streamed success body
+	item     any    // JSON type of each line of a streamed application/x-ndjson body
+	errors   []int  // error statuses, besides the guard's 403
+	// scope is what a token needs for this operation when the API requires
+	// tokens; "" for an operation anyone reaching the API may use.
+	scope apitoken.Scope
+}
+
+// param is a query parameter, or a path parameter when path is set.
+type param struct {
+	name     string
+	desc     string
+	kind     string // schema type; "" for string
+	required bool
+	path     bool
+}
+
+var (
+	nameParam = param{name: "name", desc: "the full name, e.g. mysite.<pubKeyID>.fn or a bare mysite.fn", required: true}
+	hashParam = param{name: "hash", desc: "content root hash", required: true}
+)
+
+// apiRoutes is the API StartHTTPServer serves. The tables are functions, not
+// variables, because /openapi.json is described by the table it is built from.
+func apiRoutes() []endpoint {
+	return []endpoint{
+		{pattern: "/publish", handler: func(d apiDeps) http.Handler { return PublishHandler(d.dht) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.Publish, summary: "Publish a signed record",
+			request: record.FNRecord{}, response: PublishResponse{},
+			errors: []int{400, 413, 500},
+		}}},
+		{pattern: "/resolve", handler: func(d apiDeps) http.Handler { return ResolveHandler(d.dht, d.res) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Resolve, summary: "Resolve a name to its records",
+			params: []param{nameParam,
+				{name: "type", desc: "only records of this type, e.g. A"},
+				{name: "proof", desc: "also return the signed record and owner evidence", kind: "boolean"},
+				{name: "wait-seq", desc: "bypass the cache and wait until the record's seq is at least this", kind: "integer"},
+				{name: "timeout", desc: "how long wait-seq waits, e.g. 2m; 30s if absent, at most 5m"}},
+			response: ResolveResponse{},
+			errors:   []int{400, 404, 500, 501, 502, 504},
+		}}},
+		{pattern: "/resolve/batch", handler: func(d apiDeps) http.Handler { return BatchResolveHandler(d.dht, d.res) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.Resolve, summary: "Resolve many names concurrently, streaming one result per name as it completes",
+			request: BatchResolveRequest{},
+			stream:  "application/x-ndjson", item: BatchResolveResult{},
+			errors: []int{400, 413, 500},
+		}}},
+		{pattern: "/record", handler: func(d apiDeps) http.Handler { return RecordHandler(d.dht) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Resolve, summary: "Fetch the signed record of a self-certifying name, uncached",
+			params: []param{nameParam}, response: record.FNRecord{},
+			errors: []int{400, 404, 500, 502},
+		}}},
+		{pattern: "/peers", handler: func(d apiDeps) http.Handler { return AllPeersHandler(d.dht) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Admin, summary: "List routing-table peers and connected hosts",
+			response: PeersResponse{}, errors: []int{500},
+		}}},
+		{pattern: "/info", handler: func(d apiDeps) http.Handler { return InfoHandler(d.dht, d.svc, d.role) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Admin, summary: "Describe the node and its view of the network",
+			response: InfoResponse{}, errors: []int{500},
+		}}},
+		{pattern: "/clear_cache", handler: func(d apiDeps) http.Handler { return ClearCacheHandler(d.cache) }, ops: []operation{{
+			method: http.MethodDelete, scope: apitoken.Admin, summary: "Empty the resolution cache",
+		}}},
+		{pattern: "/health", handler: func(d apiDeps) http.Handler { return HealthHandler(d.dht, d.role, d.authoringURL) }, ops: []operation{{
+			method: http.MethodGet, summary: "Liveness, version, role and capabilities; answers before the node is ready",
+			response: HealthResponse{},
+		}}},
+		{pattern: "/metrics", handler: func(apiDeps) http.Handler { return metrics.Handler() }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Admin, summary: "Prometheus metrics",
+			stream: "text/plain",
+		}}},
+		{pattern: "/openapi.json", handler: func(d apiDeps) http.Handler { return OpenAPIHandler(d.authoringURL) }, ops: []operation{{
+			method: http.MethodGet, summary: "This document",
+			stream: "application/json",
+		}}},
+		{pattern: "/events", handler: func(d apiDeps) http.Handler { return EventsHandler(d.stop) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.Admin, summary: "Stream node activity as server-sent events",
+			params: []param{{name: "topics", desc: "comma-separated topics: connectivity, records, cache, content, heal; all if absent"}},
+			stream: "text/event-stream",
+			errors: []int{400},
+		}}},
+		{pattern: "/content", handler: func(d apiDeps) http.Handler { return ContentHandler(d.svc) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.ContentWrite, summary: "Store the request body as one content set",
+			params: []param{
+				{name: "chunking", desc: "fixed or cdc; the node's default if absent"},
+				{name: "encrypt", desc: "store encrypted and return the read capability", kind: "boolean"}},
+			upload: true, response: ContentStored{},
+			errors: []int{400, 413, 500, 503},
+		}, {
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "Fetch content by hash or read capability, from the network on a miss",
+			params: []param{{name: "hash", desc: "content hash, or read capability for encrypted content", required: true}},
+			stream: "*/*",
+			errors: []int{400, 403, 404, 502, 503},
+		}, {
+			method: http.MethodDelete, scope: apitoken.ContentWrite, summary: "Drop a content set from this node",
+			params: []param{hashParam}, response: RemoveResponse{},
+			errors: []int{400, 404, 500, 503},
+		}}},
+		{pattern: "/resolve-content", handler: func(d apiDeps) http.Handler { return ResolveContentHandler(d.res, d.svc) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "Fetch the content a name's CONTENT record points at",
+			params: []param{nameParam,
+				{name: "proof", desc: "answer with the content hash and its proof instead of the bytes", kind: "boolean"}},
+			stream: "*/*", response: ContentProofResponse{},
+			errors: []int{400, 403, 404, 501, 502, 503},
+		}}},
+		{pattern: "/content/sets", handler: func(d apiDeps) http.Handler { return ContentSetsHandler(d.svc) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "List the content sets this node holds",
+			response: ContentSetsResponse{}, errors: []int{500, 503},
+		}}},
+		{pattern: "/content/hosted", handler: func(d apiDeps) http.Handler { return ContentHostedHandler(d.svc) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "Hosted content per peer, against the hosting budget",
+			response: node.HostedUsage{}, errors: []int{500, 503},
+		}}},
+		{pattern: "/content/status", handler: func(d apiDeps) http.Handler { return ContentStatusHandler(d.svc) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "Where a content set is replicated",
+			params: []param{hashParam,
+				{name: "providers", desc: "0 skips the DHT provider lookup"}},
+			response: node.ReplicationStatus{}, errors: []int{400, 503},
+		}}},
+		{pattern: "/content/pin", handler: func(d apiDeps) http.Handler { return ContentPinHandler(d.svc, true) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.ContentWrite, summary: "Keep a content set for good",
+			params: []param{hashParam}, response: PinResponse{},
+			errors: []int{400, 404, 500, 503},
+		}}},
+		{pattern: "/content/unpin", handler: func(d apiDeps) http.Handler { return ContentPinHandler(d.svc, false) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.ContentWrite, summary: "Release a content set to the hosting budget",
+			params: []param{hashParam}, response: PinResponse{},
+			errors: []int{400, 404, 500, 503},
+		}}},
+		{pattern: "/content/gc", handler: func(d apiDeps) http.Handler { return ContentGCHandler(d.svc) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.ContentWrite, summary: "Apply the hosting budget and sweep unreferenced blobs",
+			response: content.GCResult{}, errors: []int{500, 503},
+		}}},
+		{pattern: "/content/export", handler: func(d apiDeps) http.Handler { return ContentExportHandler(d.svc) }, ops: []operation{{
+			method: http.MethodGet, scope: apitoken.ContentRead, summary: "Stream a content set as one archive",
+			params: []param{hashParam}, stream: "application/octet-stream",
+			errors: []int{400, 404, 502, 503},
+		}}},
+		{pattern: "/content/import", handler: func(d apiDeps) http.Handler { return ContentImportHandler(d.svc) }, ops: []operation{{
+			method: http.MethodPost, scope: apitoken.ContentWrite, summary: "Store the set in an archive, pinned",
+			upload: true, response: ImportResponse{},
+			errors: []int{400, 500, 503},
+		}}},
+	}
+}
+
+// authoringRoutes is the loopback-only authoring API.
+func authoringRoutes() []endpoint {
+	return []endpoint{
+		{pattern: "/authoring/names", handler: func(d apiDeps) http.Handler { return localAuthoringOnly(NamesHandler(d.names)) }, ops: []operation{{
+			method: http.MethodGet, summary: "List the names whose owner keys this node holds",
+			response: NamesResponse{}, errors: []int{500, 503},
+		}, {
+			method: http.MethodPost, summary: "Create an owner key for a new name",
+			request: CreateNameRequest{}, status: http.StatusCreated, response: authoring.Name{},
+			errors: []int{400, 409, 500, 503},
+		}}},
+		{pattern: "/authoring/names/", specPath: "/authoring/names/{label}/publish", handler: func(d apiDeps) http.Handler { return localAuthoringOnly(NamePublishHandler(d.names)) }, ops: []operation{{
+			method: http.MethodPost, summary: "Sign and publish the complete record set of a name",
+			params:  []param{{name: "label", desc: "the name's label", required: true, path: true}},
+			request: PublishNameRequest{}, response: NamePublished{},
+			errors: []int{400, 404, 409, 500, 502, 503},
+		}}},
+	}
+}
+
+// newMux serves routes, and answers any other path with a JSON 404 so that
+// no error the API gives is in another shape. Each route answers only the
+// methods its operations list; with d.tokens set, it also checks the scope of
+// the request's token.
+func newMux(routes []endpoint, d apiDeps) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, e := range routes {
+		h := e.handler(d)
+		if d.tokens != nil {
+			h = requireScope(h, e.ops)
+		}
+		mux.Handle(e.pattern, allowMethods(h, e.ops))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "no such endpoint: %s", r.URL.Path)
+	})
+	return mux
+}
+
+// allowMethods answers a method none of ops lists with a JSON 405, so no
+// request reaches a handler (or slips past requireScope) under a method the
+// route was never described with. HEAD is served as GET.
+func allowMethods(next http.Handler, ops []operation) http.Handler {
+	allowed := make([]string, 0, len(ops)+1)
+	for _, op := range ops {
+		allowed = append(allowed, op.method)
+		if op.method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	allow := strings.Join(allowed, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, op := range ops {
+			if op.method == opMethod(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		writeJSONError(w, http.StatusMethodNotAllowed, "use %s", allow)
+	})
+}
+
+// opMethod is the method of the operation a request is for: a HEAD request
+// is the GET without its body.
+func opMethod(r *http.Request) string {
+	if r.Method == http.MethodHead {
+		return http.MethodGet
+	}
+	return r.Method
+}
@@ -37,12 +37,39 @@ func TestHostAllowed(t *testing.T) {
 	}
 }
 
+// TestLocalAPIGuardFollowsHostList checks that replacing the allow-list (a
+// config reload) applies to the running guard.
+func TestLocalAPIGuardFollowsHostList(t *testing.T) {
+	hosts := NewHostList(nil)
+	guarded := localAPIGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), hosts, nil)
+	status := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Host = "node.internal:8420"
+		rec := httptest.NewRecorder()
+		guarded.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if got := status(); got != http.StatusForbidden {
+		t.Fatalf("unlisted host: %d", got)
+	}
+	hosts.Set([]string{"node.internal"})
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("after adding the host: %d", got)
+	}
+	hosts.Set(nil)
+	if got := status(); got != http.StatusForbidden {
+		t.Fatalf("after removing the host: %d", got)
+	}
+}
+
 func TestLocalAPIGuardRejectsRebindingAndCrossOrigin(t *testing.T) {
 	var reached bool
 	guarded := localAPIGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reached = true
 		w.WriteHeader(http.StatusOK)
-	}), nil)
+	}), nil, nil)
 
 	cases := []struct {
 		name       string
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
+)
+
+// tokenKey is the request context key of the token a request authenticated
+// with.
+type tokenKey struct{}
+
+// loopbackAddr reports whether a listen address accepts loopback connections
+// only. An empty host (":8420") listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// authenticate checks the request's bearer token against tokens. It returns
+// the token, nil if the request carried none (or tokens is nil), and false
+// after answering a request whose token is not valid.
+func authenticate(w http.ResponseWriter, r *http.Request, tokens *apitoken.Store) (*apitoken.Token, bool) {
+	if tokens == nil {
+		return nil, true
+	}
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, true
+	}
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		unauthorized(w, "use Authorization: Bearer <token>")
+		return nil, false
+	}
+	t, err := tokens.Check(strings.TrimSpace(token))
+	switch {
+	case errors.Is(err, apitoken.ErrInvalid):
+		unauthorized(w, "invalid or revoked API token")
+		return nil, false
+	case err != nil:
+		httpLog.Error("API tokens unreadable", "file", tokens.Path(), "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "API tokens unreadable")
+		return nil, false
+	}
+	return t, true
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="freedom-names"`)
+	writeJSONError(w, http.StatusUnauthorized, "%s", msg)
+}
+
+// requireScope admits a request to a route only with a token (authenticated
+// by localAPIGuard) that grants the scope the route's operation for the
+// request method needs. Operations without a scope are passed through; a
+// method the route does not serve is refused by allowMethods before this.
+func requireScope(next http.Handler, ops []operation) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, op := range ops {
+			if op.method != opMethod(r) || op.scope == "" {
+				continue
+			}
+			t, _ := r.Context().Value(tokenKey{}).(*apitoken.Token)
+			if t == nil {
+				unauthorized(w, "this API needs a token: Authorization: Bearer <token> (see freedom token)")
+				return
+			}
+			if !t.Allows(op.scope) {
+				writeJSONError(w, http.StatusForbidden, "token %s lacks the %s scope", t.ID, op.scope)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
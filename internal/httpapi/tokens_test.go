@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/apitoken"
+)
+
+// TestTokenScopes serves the API the way a node bound beyond loopback does
+// and checks each route admits only tokens with its scope, answering as the
+// OpenAPI document says.
+func TestTokenScopes(t *testing.T) {
+	fx := newConformanceFixture(t)
+	spec := loadSpec(t, fx)
+	tokens := apitoken.Open(filepath.Join(t.TempDir(), "api-tokens.json"))
+	reader, _, err := tokens.Create("reader", []apitoken.Scope{apitoken.Resolve, apitoken.ContentRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := tokens.Create("old", []apitoken.Scope{apitoken.Resolve})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Revoke(revokedToken.ID); err != nil {
+		t.Fatal(err)
+	}
+	deps := fx.deps
+	deps.tokens = tokens
+	api := localAPIGuard(newMux(apiRoutes(), deps), nil, tokens)
+
+	for _, tc := range []struct {
+		method, path, target, host, auth string
+		status                           int
+	}{
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "", 401},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "Bearer " + reader, 200},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "bearer " + reader, 200},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "Bearer " + revoked, 401},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "Bearer fnt_nope", 401},
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "", "Basic dXNlcjpwYXNz", 401},
+		{"GET", "/content", "/content?hash=" + fx.hash, "", "Bearer " + reader, 200},
+		{"POST", "/content/pin", "/content/pin?hash=" + fx.hash, "", "Bearer " + reader, 403},
+		{"POST", "/publish", "/publish", "", "Bearer " + reader, 403},
+		{"GET", "/info", "/info", "", "Bearer " + reader, 403},
+		// A method a route does not list is refused, never let past the
+		// scope check; HEAD needs what GET needs. None is in the document.
+		{"POST", "", "/info", "", "", 405},
+		{"HEAD", "", "/info", "", "", 401},
+		{"POST", "", "/resolve?name=" + fx.name, "", "", 405},
+		{"PUT", "", "/record?name=" + fx.name, "", "", 405},
+		{"POST", "", "/peers", "", "", 405},
+		{"POST", "", "/metrics", "", "", 405},
+		{"POST", "", "/resolve-content?name=" + fx.name, "", "", 405},
+		// Open operations need no token.
+		{"GET", "/health", "/health", "", "", 200},
+		{"GET", "/openapi.json", "/openapi.json", "", "", 200},
+		// A token stands in for the Host check; without one it still applies.
+		{"GET", "/resolve", "/resolve?name=" + fx.name, "node.example:8420", "Bearer " + reader, 200},
+		{"GET", "/health", "/health", "node.example:8420", "", 403},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.Host = "192.168.1.20:8420"
+		if tc.host != "" {
+			req.Host = tc.host
+		}
+		req.RemoteAddr = "192.168.1.30:45678"
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		what := tc.method + " " + tc.target + " " + tc.auth
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", what, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Errorf("%s: 401 without a Bearer challenge", what)
+		}
+		if tc.path == "" {
+			continue
+		}
+		if err := spec.checkResponse(tc.path, tc.method, rec); err != nil {
+			t.Errorf("%s: %v", what, err)
+		}
+	}
+}
+
+// TestEveryOperationHasAScope keeps a new route from being reachable with any
+// token, or none, by accident: only the ones listed here are open.
+func TestEveryOperationHasAScope(t *testing.T) {
+	open := map[string]bool{"GET /health": true, "GET /openapi.json": true}
+	for _, e := range apiRoutes() {
+		for _, op := range e.ops {
+			what := op.method + " " + e.pattern
+			if (op.scope == "") != open[what] {
+				t.Errorf("%s: scope %q", what, op.scope)
+			}
+		}
+	}
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8420":   true,
+		"[::1]:8420":       true,
+		"localhost:8420":   true,
+		":8420":            false,
+		"0.0.0.0:8420":     false,
+		"192.168.1.2:8420": false,
+		"nonsense":         false,
+	} {
+		if got := loopbackAddr(addr); got != want {
+			t.Errorf("loopbackAddr(%q) = %v", addr, got)
+		}
+	}
+}
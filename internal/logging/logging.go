@@ -0,0 +1,260 @@
+// Package logging is the node's structured, leveled logger, built on log/slog.
+//
+// Every record carries a subsystem tag (dns, dht, content, ...), so one
+// stream can be filtered after the fact, and any subsystem can be given a
+// level of its own or be written to a file of its own instead of the shared
+// output — the peer event stream, for one, is far too chatty to interleave
+// with everything else on a busy node.
+//
+// Loggers are meant to be package-level variables (For at init time), long
+// before main has read the configuration. They therefore resolve their
+// destination on every record rather than when they are created: Setup can
+// run, or run again, at any point and every existing logger follows it.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Subsystems. A logger is tagged with exactly one; Options.Levels and
+// Options.Files are keyed by them. Add values here, never inline.
+const (
+	Node      = "node"      // process lifecycle, stats
+	P2P       = "p2p"       // libp2p host events: peers, addresses, reachability
+	DHT       = "dht"       // record publish, republish, bootstrap
+	DNS       = "dns"       // DNS server
+	HTTP      = "http"      // HTTP API server
+	Content   = "content"   // content store, transfer, replication, healing
+	BCH       = "bch"       // BCH name registry and Electrum
+	Authoring = "authoring" // owner-key authoring API
+	Config    = "config"    // configuration loading
+)
+
+// Subsystems lists every subsystem, for validating configuration.
+var Subsystems = []string{Node, P2P, DHT, DNS, HTTP, Content, BCH, Authoring, Config}
+
+// SubsystemKey is the attribute carrying a record's subsystem.
+const SubsystemKey = "subsystem"
+
+// Options configures where and how records are written.
+type Options struct {
+	// Level is the minimum level written, for subsystems not in Levels.
+	Level slog.Level
+	// Levels overrides Level per subsystem.
+	Levels map[string]slog.Level
+	// JSON writes one JSON object per record instead of key=value text.
+	JSON bool
+	// Files sends a subsystem's records to a file (appended to, created if
+	// missing) instead of the shared output.
+	Files map[string]string
+	// Output is the shared output; nil means standard error.
+	Output io.Writer
+}
+
+// sinks is one applied configuration.
+type sinks struct {
+	level   slog.Level
+	levels  map[string]slog.Level
+	shared  slog.Handler
+	files   map[string]slog.Handler
+	closers []io.Closer
+}
+
+var (
+	current atomic.Pointer[sinks]
+	// setupMu serializes Setup and Close, so files are closed exactly once.
+	setupMu sync.Mutex
+	// writeMu is held for reading while a record is written and for writing
+	// while the configuration is swapped, so once a swap returns no record is
+	// still being written to the files it replaced.
+	writeMu sync.RWMutex
+)
+
+func init() {
+	current.Store(&sinks{shared: slog.NewTextHandler(os.Stderr, nil)})
+}
+
+// Setup applies opts to every logger, replacing (and closing the files of)
+// any earlier configuration. It also routes the standard library's log
+// package through the node subsystem, so nothing bypasses the configuration.
+// On error the previous configuration stays in effect.
+func Setup(opts Options) error {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	s := &sinks{
+		level:  opts.Level,
+		levels: opts.Levels,
+		shared: newHandler(out, opts.JSON),
+		files:  map[string]slog.Handler{},
+	}
+	for sub, path := range opts.Files {
+		if !slices.Contains(Subsystems, sub) {
+			s.close()
+			return fmt.Errorf("log file for unknown subsystem %q", sub)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			s.close()
+			return fmt.Errorf("open %s log: %w", sub, err)
+		}
+		s.closers = append(s.closers, f)
+		s.files[sub] = newHandler(f, opts.JSON)
+	}
+
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	old := swap(s)
+	slog.SetDefault(For(Node))
+	return old.close()
+}
+
+// Close closes any log files and falls back to standard error.
+func Close() error {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	return swap(&sinks{shared: slog.NewTextHandler(os.Stderr, nil)}).close()
+}
+
+// swap installs s and returns the configuration it replaced, which no record
+// is being written to any more and can be closed.
+func swap(s *sinks) *sinks {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	return current.Swap(s)
+}
+
+func newHandler(w io.Writer, json bool) slog.Handler {
+	if json {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+func (s *sinks) close() error {
+	var errs []error
+	for _, c := range s.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *sinks) enabled(sub string, level slog.Level) bool {
+	min, ok := s.levels[sub]
+	if !ok {
+		min = s.level
+	}
+	return level >= min
+}
+
+func (s *sinks) handler(sub string) slog.Handler {
+	if h, ok := s.files[sub]; ok {
+		return h
+	}
+	return s.shared
+}
+
+// For returns the logger for a subsystem.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem})
+}
+
+// handler tags records with its subsystem and hands them to whatever the
+// current configuration says that subsystem writes to. Attributes and groups
+// added with With are replayed onto that destination per record, since it
+// may change between records.
+type handler struct {
+	subsystem string
+	with      []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return current.Load().enabled(h.subsystem, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	writeMu.RLock()
+	defer writeMu.RUnlock()
+	dst := current.Load().handler(h.subsystem).WithAttrs([]slog.Attr{slog.String(SubsystemKey, h.subsystem)})
+	for _, w := range h.with {
+		dst = w(dst)
+	}
+	return dst.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(dst slog.Handler) slog.Handler { return dst.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.chain(func(dst slog.Handler) slog.Handler { return dst.WithGroup(name) })
+}
+
+func (h *handler) chain(w func(slog.Handler) slog.Handler) slog.Handler {
+	return &handler{subsystem: h.subsystem, with: append(slices.Clip(h.with), w)}
+}
+
+// ParseLevel parses a level spec: a default level optionally followed by
+// per-subsystem overrides, comma-separated, e.g. "info" or
+// "info,p2p=debug,dht=warn". Levels are debug, info, warn and error.
+func ParseLevel(spec string) (slog.Level, map[string]slog.Level, error) {
+	level := slog.LevelInfo
+	var levels map[string]slog.Level
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		sub, name, scoped := strings.Cut(part, "=")
+		if !scoped {
+			name = sub
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return 0, nil, fmt.Errorf("level %q: want debug, info, warn or error", name)
+		}
+		if !scoped {
+			level = l
+			continue
+		}
+		sub = strings.TrimSpace(sub)
+		if !slices.Contains(Subsystems, sub) {
+			return 0, nil, fmt.Errorf("unknown subsystem %q", sub)
+		}
+		if levels == nil {
+			levels = map[string]slog.Level{}
+		}
+		levels[sub] = l
+	}
+	return level, levels, nil
+}
+
+// ParseFiles parses per-subsystem log files written
+// "p2p=/var/log/fn-p2p.log,dns=/var/log/fn-dns.log".
+func ParseFiles(spec string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		sub, path, ok := strings.Cut(part, "=")
+		sub, path = strings.TrimSpace(sub), strings.TrimSpace(path)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("%q: want subsystem=path", part)
+		}
+		if !slices.Contains(Subsystems, sub) {
+			return nil, fmt.Errorf("unknown subsystem %q", sub)
+		}
+		files[sub] = path
+	}
+	return files, nil
+}
@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLoggerFollowsSetup checks that a logger created before Setup — the
+// package-level case — writes wherever the configuration applied later says.
+func TestLoggerFollowsSetup(t *testing.T) {
+	logger := For(DNS).With("zone", "fn")
+
+	var buf bytes.Buffer
+	if err := Setup(Options{Output: &buf}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer Close()
+	logger.Info("answered")
+
+	out := buf.String()
+	for _, want := range []string{"msg=answered", "subsystem=dns", "zone=fn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q lacks %q", out, want)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	err := Setup(Options{Output: &buf, Level: slog.LevelWarn, Levels: map[string]slog.Level{P2P: slog.LevelDebug}})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer Close()
+	For(DHT).Info("dropped")
+	For(DHT).Warn("kept-warn")
+	For(P2P).Debug("kept-debug")
+
+	out := buf.String()
+	if strings.Contains(out, "dropped") || !strings.Contains(out, "kept-warn") || !strings.Contains(out, "kept-debug") {
+		t.Fatalf("level filtering wrong:\n%s", out)
+	}
+}
+
+// TestSubsystemFile checks that a subsystem with a file is written there, as
+// JSON when asked, and not to the shared output.
+func TestSubsystemFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "p2p.log")
+	var buf bytes.Buffer
+	if err := Setup(Options{Output: &buf, JSON: true, Files: map[string]string{P2P: path}}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	For(P2P).Info("peer connected", "peer", "12D3Koo")
+	For(Content).Info("replicated")
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("log file is not one JSON record: %v\n%s", err, data)
+	}
+	if rec[SubsystemKey] != P2P || rec["msg"] != "peer connected" || rec["peer"] != "12D3Koo" {
+		t.Errorf("file record: %v", rec)
+	}
+	if out := buf.String(); strings.Contains(out, "peer connected") || !strings.Contains(out, `"subsystem":"content"`) {
+		t.Errorf("shared output:\n%s", out)
+	}
+}
+
+// TestStdlibLogRouted checks that the standard library's log package, which
+// dependencies may still use, goes through the configuration too.
+func TestStdlibLogRouted(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(Options{Output: &buf}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer Close()
+	log.Print("from stdlib")
+	if out := buf.String(); !strings.Contains(out, "from stdlib") || !strings.Contains(out, "subsystem=node") {
+		t.Fatalf("stdlib log not routed: %q", out)
+	}
+}
+
+func TestSetupRejectsUnknownSubsystem(t *testing.T) {
+	if err := Setup(Options{Files: map[string]string{"nosuch": filepath.Join(t.TempDir(), "x.log")}}); err == nil {
+		Close()
+		t.Fatal("expected an error for an unknown subsystem")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, levels, err := ParseLevel("warn, p2p=debug ,dht=error")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if level != slog.LevelWarn || levels[P2P] != slog.LevelDebug || levels[DHT] != slog.LevelError {
+		t.Fatalf("got %v %v", level, levels)
+	}
+	for _, bad := range []string{"loud", "p2p=loud", "nosuch=info"} {
+		if _, _, err := ParseLevel(bad); err == nil {
+			t.Errorf("ParseLevel(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	files, err := ParseFiles("p2p=/var/log/p2p.log, dns=/var/log/dns.log")
+	if err != nil || files[P2P] != "/var/log/p2p.log" || files[DNS] != "/var/log/dns.log" {
+		t.Fatalf("got %v, %v", files, err)
+	}
+	for _, bad := range []string{"p2p", "p2p=", "nosuch=/x.log"} {
+		if _, err := ParseFiles(bad); err == nil {
+			t.Errorf("ParseFiles(%q): expected an error", bad)
+		}
+	}
+}
+
+// TestReloadDuringWrites swaps log files while records are being written to
+// them: no write may land on a file the swap already closed.
+func TestReloadDuringWrites(t *testing.T) {
+	dir := t.TempDir()
+	h := For(P2P).Handler()
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "tick", 0)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		})
+	}
+	for i := range 200 {
+		path := filepath.Join(dir, fmt.Sprintf("p2p-%d.log", i))
+		if err := Setup(Options{Output: io.Discard, Files: map[string]string{P2P: path}}); err != nil {
+			t.Fatalf("setup %d: %v", i, err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		t.Fatalf("write during reload: %v", err)
+	}
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package metrics holds the Prometheus instruments the node exports on the
+// HTTP API's /metrics endpoint.
+//
+// Instruments are package-level and registered with the default registry, so
+// every subsystem records into them without any wiring, and the endpoint also
+// carries what libp2p itself registers there (resource manager, transports,
+// identify). State that lives on a particular node — bandwidth per protocol,
+// hosted bytes — is read at scrape time by a collector the node provides
+// instead (see node.FreedomNameNode.Collector), registered once via Register.
+//
+// Label values are always drawn from fixed vocabularies (a zone, an rcode, a
+// method name): never a query name, peer or hash, which would let whoever can
+// reach the node grow the series set without bound.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric this package defines.
+const namespace = "freedomnames"
+
+// Result label values shared by the instruments below.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// DNS zone label values: queries answered from the DHT, and queries forwarded
+// upstream.
+const (
+	ZoneFN      = "fn"
+	ZoneForward = "forward"
+)
+
+var (
+	// DNSQueries counts answered DNS queries by zone and response code.
+	DNSQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dns",
+		Name:      "queries_total",
+		Help:      "DNS queries answered, by zone (fn or forward) and response code.",
+	}, []string{"zone", "rcode"})
+
+	// DNSQueryDuration is the time from receiving a DNS query to answering it.
+	DNSQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "dns",
+		Name:      "query_duration_seconds",
+		Help:      "Time to answer a DNS query, by zone (fn or forward).",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2, 4},
+	}, []string{"zone"})
+
+	// DNSShed counts .fn lookups refused because too many were in flight.
+	DNSShed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dns",
+		Name:      "shed_total",
+		Help:      ".fn lookups refused with SERVFAIL because the in-flight limit was reached.",
+	})
+
+	// ResolverCache counts resolver cache lookups by outcome (hit or miss).
+	ResolverCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "resolver",
+		Name:      "cache_lookups_total",
+		Help:      "Resolver cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	// DHTOpDuration is the latency of DHT record puts and gets.
+	DHTOpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "dht",
+		Name:      "op_duration_seconds",
+		Help:      "Latency of DHT record operations, by op (put or get) and result.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"op", "result"})
+
+	// HealResults counts content heal passes by outcome.
+	HealResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "content",
+		Name:      "heal_results_total",
+		Help:      "Content heal passes, by result (healthy, repaired, short or error).",
+	}, []string{"result"})
+
+	// ElectrumCallDuration is the latency of Electrum JSON-RPC calls,
+	// including any (re)connect they had to do first.
+	ElectrumCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "electrum",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of Electrum calls, by method and result.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 15},
+	}, []string{"method", "result"})
+
+	// ElectrumFailovers counts connections that landed on a different
+	// Electrum endpoint than the last one that worked.
+	ElectrumFailovers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "electrum",
+		Name:      "failovers_total",
+		Help:      "Electrum connections established on a different endpoint than the last good one.",
+	})
+)
+
+// Since returns the seconds elapsed since start, for observing a histogram.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Result maps an error to ResultOK or ResultError.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
+
+// Register adds a collector to the default registry, alongside the
+// package-level instruments. It is for per-node state read at scrape time.
+func Register(c prometheus.Collector) error {
+	return prometheus.Register(c)
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,323 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// This file implements proof-of-storage challenges. A provider record only
+// says a peer *once* announced a hash, and a pushHave answer costs nothing to
+// give, so neither shows the bytes are still on disk. Before healing counts a
+// peer as a live holder (see replicator.heal), it asks the peer for the hash
+// of a random byte range of a random blob of the set, salted with a fresh
+// nonce: the answer cannot be precomputed or replayed, and the only way to
+// give it is to hold the blob. The challenger checks the answer against its
+// own copy; when it has no copy of any blob the holder should have, it fetches
+// one whole from the holder instead and checks its hash.
+
+// challengeProtocol is the libp2p stream protocol id for storage challenges.
+const challengeProtocol = protocol.ID("/content/challenge/1.0.0")
+
+// Challenge replies: the holder's first byte, followed by the proof digest
+// when it is challengeProof.
+const (
+	challengeMissing byte = 0 // blob not held, or the range does not fit it
+	challengeProof   byte = 1 // sha256(nonce || range) follows
+)
+
+const (
+	// challengeNonceLen is the size of the random salt in every challenge.
+	challengeNonceLen = 16
+
+	// maxChallengeRange caps the bytes one challenge makes a holder hash, so
+	// answering is cheap whatever the blob size.
+	maxChallengeRange = 64 << 10
+
+	// proofValidity is how long a passed challenge keeps a holder counted
+	// before it is challenged again. It spans several heal passes, so a
+	// healthy swarm is not re-challenged on every one.
+	proofValidity = 6 * time.Hour
+)
+
+// errProofFailed means a peer did not prove it holds a blob: it answered
+// challengeMissing or a wrong digest.
+var errProofFailed = errors.New("storage proof failed")
+
+// proofDigest is the answer to a challenge for data, the challenged range.
+func proofDigest(nonce, data []byte) []byte {
+	h := sha256.New()
+	h.Write(nonce)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// writeChallenge sends a challenge: the blob hash, the nonce, then the range
+// as uvarint offset and length.
+func writeChallenge(w io.Writer, hash string, nonce []byte, off, n uint64) error {
+	if err := writeRequest(w, hash); err != nil {
+		return err
+	}
+	buf := append([]byte(nil), nonce...)
+	buf = binary.AppendUvarint(buf, off)
+	buf = binary.AppendUvarint(buf, n)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readChallenge(r io.Reader) (hash string, nonce []byte, off, n uint64, err error) {
+	if hash, err = readRequest(r); err != nil {
+		return "", nil, 0, 0, err
+	}
+	nonce = make([]byte, challengeNonceLen)
+	if _, err = io.ReadFull(r, nonce); err != nil {
+		return "", nil, 0, 0, err
+	}
+	br := newByteReaderFrom(r)
+	if off, err = binary.ReadUvarint(br); err != nil {
+		return "", nil, 0, 0, err
+	}
+	if n, err = binary.ReadUvarint(br); err != nil {
+		return "", nil, 0, 0, err
+	}
+	if n == 0 || n > maxChallengeRange {
+		return "", nil, 0, 0, errors.New("bad challenge range")
+	}
+	return hash, nonce, off, n, nil
+}
+
+// handleChallengeStream answers one challenge from the local store.
+func (cs *ContentService) handleChallengeStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(20 * time.Second))
+
+	hash, nonce, off, n, err := readChallenge(stream)
+	if err != nil {
+		return
+	}
+	data, err := cs.readRange(hash, off, n)
+	if err != nil {
+		stream.Write([]byte{challengeMissing})
+		return
+	}
+	stream.Write(append([]byte{challengeProof}, proofDigest(nonce, data)...))
+}
+
+// readRange reads n bytes at off from a stored blob.
+func (cs *ContentService) readRange(hash string, off, n uint64) ([]byte, error) {
+	rc, size, err := cs.store.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if off+n > uint64(size) || off+n < off {
+		return nil, fmt.Errorf("range %d+%d outside blob of %d bytes", off, n, size)
+	}
+	data := make([]byte, n)
+	if ra, ok := rc.(io.ReaderAt); ok {
+		_, err = ra.ReadAt(data, int64(off))
+	} else if _, err = io.CopyN(io.Discard, rc, int64(off)); err == nil {
+		_, err = io.ReadFull(rc, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// proveBlob challenges p to prove it holds the blob hash, whose bytes the
+// caller has in data.
+func (cs *ContentService) proveBlob(ctx context.Context, p peer.ID, hash string, data []byte) error {
+	streamCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	stream, err := cs.node.kadDHT.Host().NewStream(streamCtx, p, cs.protocol(challengeProtocol))
+	if err != nil {
+		return fmt.Errorf("open challenge stream to %s: %w", p, err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(20 * time.Second))
+	return proveOnStream(stream, hash, data)
+}
+
+// proveOnStream runs the challenger's side on an already-open stream: a fresh
+// nonce and a random range within the blob, then the holder's digest checked
+// against data.
+func proveOnStream(stream io.ReadWriter, hash string, data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("cannot challenge empty blob %s", hash)
+	}
+	nonce := make([]byte, challengeNonceLen)
+	if _, err := crand.Read(nonce); err != nil {
+		return err
+	}
+	n := min(len(data), maxChallengeRange)
+	off := rand.Intn(len(data) - n + 1)
+	if err := writeChallenge(stream, hash, nonce, uint64(off), uint64(n)); err != nil {
+		return err
+	}
+	status, err := readStatusByte(stream)
+	if err != nil {
+		return err
+	}
+	if status != challengeProof {
+		return fmt.Errorf("%w: blob %s not held", errProofFailed, hash)
+	}
+	got := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(stream, got); err != nil {
+		return err
+	}
+	if !bytes.Equal(got, proofDigest(nonce, data[off:off+n])) {
+		return fmt.Errorf("%w: wrong digest for %s", errProofFailed, hash)
+	}
+	return nil
+}
+
+// prove challenges p on one random blob of the set rooted at root: any blob of
+// the full set for column -1, or a shard of column j of an erasure-coded set.
+func (cs *ContentService) prove(ctx context.Context, p peer.ID, root string, column int) error {
+	hash, data, err := cs.challengeTarget(root, column)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return cs.proveByFetch(ctx, cs.node.kadDHT.Host(), p, hash)
+	}
+	return cs.proveBlob(ctx, p, hash, data)
+}
+
+// proveByFetch has p prove it holds hash by serving the whole blob, checked
+// against its hash; for a challenger with no copy of its own to check a
+// digest against.
+func (cs *ContentService) proveByFetch(ctx context.Context, h host.Host, p peer.ID, hash string) error {
+	if _, err := cs.fetchVia(ctx, h, p, hash); err != nil {
+		return fmt.Errorf("%w: %s not served: %v", errProofFailed, hash, err)
+	}
+	return nil
+}
+
+// challengeTarget picks the blob to challenge a holder of root (or of its
+// shard column) on: a data chunk, or a shard of the column, never the
+// manifest, which a peer can keep without the data. It prefers one this node
+// can produce without the network, a blob in its store or a shard derived
+// from a chunk in its store, and returns its bytes. If none qualifies — a
+// column holder healing another column — it returns a random one with nil
+// bytes, for prove to fetch from the holder. Only a set without chunks is
+// challenged on its manifest.
+func (cs *ContentService) challengeTarget(root string, column int) (string, []byte, error) {
+	top, err := cs.store.Get(root)
+	if err != nil {
+		return "", nil, err
+	}
+	m, ok := content.DecodeManifest(top)
+	if !ok {
+		return root, top, nil
+	}
+	if column >= 0 && (m.Erasure == nil || column >= m.Erasure.Shards()) {
+		return "", nil, fmt.Errorf("%s has no shard column %d", root, column)
+	}
+	for _, i := range rand.Perm(len(m.Chunks)) {
+		if column < 0 {
+			if data, err := cs.store.Get(m.Chunks[i]); err == nil {
+				return m.Chunks[i], data, nil
+			}
+			continue
+		}
+		hash := m.Shards[i][column]
+		if data, err := cs.store.Get(hash); err == nil {
+			return hash, data, nil
+		}
+		if chunk, err := cs.store.Get(m.Chunks[i]); err == nil {
+			return hash, m.Erasure.Shard(chunk, column), nil
+		}
+	}
+	if len(m.Chunks) == 0 {
+		return root, top, nil
+	}
+	i := rand.Intn(len(m.Chunks))
+	if column < 0 {
+		return m.Chunks[i], nil, nil
+	}
+	return m.Shards[i][column], nil, nil
+}
+
+// --- replicator side: which holders count ---
+
+// proofKey identifies one holder's proof for one set (column -1) or column.
+type proofKey struct {
+	p      peer.ID
+	root   string
+	column int
+}
+
+// live reports whether p counts as a holder of root (or of its column): it
+// passed a challenge within proofValidity, or passes one now. With no prove
+// seam every claimed holder counts, as before challenges existed.
+func (r *replicator) live(ctx context.Context, p peer.ID, root string, column int) bool {
+	if r.prove == nil {
+		return true
+	}
+	key := proofKey{p, root, column}
+	r.proofMu.Lock()
+	at, ok := r.proven[key]
+	r.proofMu.Unlock()
+	if ok && r.now().Sub(at) < proofValidity {
+		return true
+	}
+	if err := r.prove(ctx, p, root, column); err != nil {
+		contentLog.Info("peer not counted as a holder", "peer", p, "root", root, "err", err)
+		r.proofMu.Lock()
+		delete(r.proven, key)
+		r.proofMu.Unlock()
+		r.notePeer(root, p, column, replicaFailed)
+		return false
+	}
+	r.recordProof(p, root, column)
+	r.notePeer(root, p, column, replicaProven)
+	return true
+}
+
+// recordProof notes that p has just shown it holds root (or its column): it
+// passed a challenge, or accepted a push whose every blob it verified.
+func (r *replicator) recordProof(p peer.ID, root string, column int) {
+	if r.prove == nil {
+		return
+	}
+	r.proofMu.Lock()
+	defer r.proofMu.Unlock()
+	if r.proven == nil {
+		r.proven = map[proofKey]time.Time{}
+	}
+	r.proven[proofKey{p, root, column}] = r.now()
+}
+
+// pruneProofs drops expired proofs, so the table tracks only current holders.
+func (r *replicator) pruneProofs() {
+	r.proofMu.Lock()
+	defer r.proofMu.Unlock()
+	now := r.now()
+	for k, at := range r.proven {
+		if now.Sub(at) >= proofValidity {
+			delete(r.proven, k)
+		}
+	}
+}
+
+func (r *replicator) now() time.Time {
+	if r.clock != nil {
+		return r.clock()
+	}
+	return time.Now()
+}
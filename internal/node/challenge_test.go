@@ -0,0 +1,256 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func TestChallengeFraming(t *testing.T) {
+	hash, _ := content.ContentHash([]byte("blob"))
+	nonce := bytes.Repeat([]byte{7}, challengeNonceLen)
+	var buf bytes.Buffer
+	if err := writeChallenge(&buf, hash, nonce, 300, 42); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	gotHash, gotNonce, off, n, err := readChallenge(&buf)
+	if err != nil || gotHash != hash || !bytes.Equal(gotNonce, nonce) || off != 300 || n != 42 {
+		t.Fatalf("round trip: %s %x %d %d %v", gotHash, gotNonce, off, n, err)
+	}
+	for _, n := range []uint64{0, maxChallengeRange + 1} {
+		buf.Reset()
+		writeChallenge(&buf, hash, nonce, 0, n)
+		if _, _, _, _, err := readChallenge(&buf); err == nil {
+			t.Errorf("range length %d accepted", n)
+		}
+	}
+}
+
+// challengeBetween opens a challenge stream from challenger to holder and
+// runs proveOnStream for hash with the challenger's copy data.
+func challengeBetween(t *testing.T, challenger, holder *pushTestPeer, hash string, data []byte) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := challenger.host.Connect(ctx, peer.AddrInfo{ID: holder.host.ID(), Addrs: holder.host.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	stream, err := challenger.host.NewStream(ctx, holder.host.ID(), defaultPrefix.id(challengeProtocol))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(15 * time.Second))
+	return proveOnStream(stream, hash, data)
+}
+
+func TestChallengeHolderProvesChunks(t *testing.T) {
+	sender := newPushTestPeer(t, 1<<30)
+	receiver := newPushTestPeer(t, 1<<30)
+
+	data := testsupport.TestBytes(content.ChunkSize + 999) // manifest + 2 chunks
+	root, _, err := sender.cs.PutStream(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if status, err := pushBetween(t, sender, receiver, root); err != nil || status != pushAccept {
+		t.Fatalf("push: status=%d err=%v", status, err)
+	}
+	for i := 0; i < 5; i++ { // random chunk, random range: all must pass
+		hash, blob, err := sender.cs.challengeTarget(root, -1)
+		if err != nil {
+			t.Fatalf("target: %v", err)
+		}
+		if err := challengeBetween(t, sender, receiver, hash, blob); err != nil {
+			t.Fatalf("honest holder failed the challenge on %s: %v", hash, err)
+		}
+	}
+
+	// A holder that dropped a chunk fails a challenge on it.
+	raw, _ := sender.cs.store.Get(root)
+	m, _ := content.DecodeManifest(raw)
+	chunk, _ := sender.cs.store.Get(m.Chunks[1])
+	if err := receiver.cs.store.Delete(m.Chunks[1]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := challengeBetween(t, sender, receiver, m.Chunks[1], chunk); !errors.Is(err, errProofFailed) {
+		t.Fatalf("missing chunk: err=%v, want errProofFailed", err)
+	}
+
+	// A challenger whose copy differs (the holder has other bytes under the
+	// hash) sees a digest mismatch.
+	first, _ := sender.cs.store.Get(m.Chunks[0])
+	other := append([]byte(nil), first...)
+	for i := range other {
+		other[i] ^= 0xff
+	}
+	if err := challengeBetween(t, sender, receiver, m.Chunks[0], other); !errors.Is(err, errProofFailed) {
+		t.Fatalf("mismatched bytes: err=%v, want errProofFailed", err)
+	}
+}
+
+func TestChallengeTargetColumn(t *testing.T) {
+	cs := testContentService(t)
+	root, _, m := putErasureCoded(t, cs)
+
+	for j := 0; j < m.Erasure.Shards(); j++ {
+		hash, data, err := cs.challengeTarget(root, j)
+		if err != nil {
+			t.Fatalf("column %d: %v", j, err)
+		}
+		found := false
+		for _, h := range m.Column(j) {
+			found = found || h == hash
+		}
+		if got, _ := content.ContentHash(data); !found || got != hash {
+			t.Fatalf("column %d: target %s is not a verified shard of the column", j, hash)
+		}
+	}
+	if _, _, err := cs.challengeTarget(root, m.Erasure.Shards()); err == nil {
+		t.Fatalf("challenge target for a column past the layout")
+	}
+}
+
+// --- which holders heal counts (fakes, no network) ---
+
+func TestHealCountsOnlyProvenHolders(t *testing.T) {
+	ids := testPeerIDs(6)
+	self := ids[0]
+	f := &fakeSwarm{peers: ids, provs: []peer.ID{ids[1], ids[2]}}
+	r := newFakeReplicator(f, self, 2) // target 3 holders
+	challenged := map[peer.ID]int{}
+	r.prove = func(ctx context.Context, p peer.ID, root string, column int) error {
+		challenged[p]++
+		if p == ids[2] {
+			return errProofFailed // provides, but no longer has the bytes
+		}
+		return nil
+	}
+
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	// self + ids[1] are live; ids[2] failed and is not pushed to again, so the
+	// missing replica goes to ids[3].
+	if len(f.pushed) != 1 || f.pushed[0] != ids[3] {
+		t.Fatalf("pushed %v, want [%s]", f.pushed, ids[3])
+	}
+
+	// A second pass relies on recorded proofs: ids[1] passed and ids[3]
+	// accepted a push, so neither is challenged again; ids[2] is.
+	f.provs = []peer.ID{ids[1], ids[2], ids[3]}
+	f.pushed = nil
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	if len(f.pushed) != 0 {
+		t.Fatalf("second pass pushed %v", f.pushed)
+	}
+	if challenged[ids[1]] != 1 || challenged[ids[3]] != 0 || challenged[ids[2]] != 2 {
+		t.Fatalf("challenges: %v", challenged)
+	}
+
+	// Proofs expire.
+	now := time.Now().Add(proofValidity)
+	r.clock = func() time.Time { return now }
+	r.pruneProofs()
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	if challenged[ids[1]] != 2 || challenged[ids[3]] != 1 {
+		t.Fatalf("challenges after expiry: %v", challenged)
+	}
+}
+
+func TestHealPushHaveMustProve(t *testing.T) {
+	ids := testPeerIDs(5)
+	f := &fakeSwarm{peers: ids, accepts: map[peer.ID]byte{ids[1]: pushHave}}
+	r := newFakeReplicator(f, ids[0], 1)
+	r.prove = func(ctx context.Context, p peer.ID, root string, column int) error {
+		return errProofFailed
+	}
+
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	// ids[1] claims to hold the set but cannot prove it; ids[2] takes a copy.
+	if len(f.pushed) != 2 || f.pushed[1] != ids[2] {
+		t.Fatalf("pushed %v, want %s then %s", f.pushed, ids[1], ids[2])
+	}
+}
+
+func TestHealColumnsChallengesColumnHolders(t *testing.T) {
+	m := &content.ChunkManifest{Erasure: &content.Erasure{K: 2, M: 1}, Shards: [][]string{{"s0", "s1", "s2"}}}
+	ids := testPeerIDs(6)
+	f := &fakeColumnSwarm{
+		peers: ids,
+		providers: map[string][]peer.ID{
+			"root": {ids[1], ids[2], ids[3]},
+			"s0":   {ids[1]},
+			"s1":   {ids[2]},
+			"s2":   {ids[3]},
+		},
+	}
+	r := newFakeColumnReplicator(f, ids[0], m)
+	r.prove = func(ctx context.Context, p peer.ID, root string, column int) error {
+		if p == ids[2] && column == 1 {
+			return errProofFailed
+		}
+		return nil
+	}
+
+	if err := r.heal(context.Background(), "root"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	if len(f.pushed) != 1 || f.pushed[ids[4]] != 1 {
+		t.Fatalf("heal pushed %v, want column 1 to %s", f.pushed, ids[4])
+	}
+}
+
+// TestChallengeManifestOnlyHolderFails has a challenger that holds only the
+// manifest challenge a peer that also holds only the manifest: the challenge
+// is on a data chunk, fetched whole from the holder, and fails until the
+// holder stores the data.
+func TestChallengeManifestOnlyHolderFails(t *testing.T) {
+	holder, challenger := wantPeers(t, false)
+	data := testsupport.TestBytes(content.ChunkSize + 999)
+	source := testContentService(t)
+	root, _, err := source.PutStream(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	top, _ := source.store.Get(root)
+	for _, cs := range []*ContentService{holder.cs, challenger.cs} {
+		if _, err := cs.store.Put(top); err != nil {
+			t.Fatalf("put manifest: %v", err)
+		}
+	}
+
+	hash, blob, err := challenger.cs.challengeTarget(root, -1)
+	if err != nil {
+		t.Fatalf("target: %v", err)
+	}
+	m, _ := content.DecodeManifest(top)
+	if blob != nil || !slices.Contains(m.Chunks, hash) {
+		t.Fatalf("target %s (%d bytes local), want a data chunk to fetch", hash, len(blob))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := challenger.cs.proveByFetch(ctx, challenger.host, holder.host.ID(), hash); !errors.Is(err, errProofFailed) {
+		t.Fatalf("manifest-only holder: err=%v, want errProofFailed", err)
+	}
+
+	if _, _, err := holder.cs.PutStream(context.Background(), bytes.NewReader(data)); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := challenger.cs.proveByFetch(ctx, challenger.host, holder.host.ID(), hash); err != nil {
+		t.Fatalf("full holder failed: %v", err)
+	}
+}
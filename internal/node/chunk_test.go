@@ -3,6 +3,7 @@ package node
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
@@ -126,6 +127,128 @@ func TestPutStreamChunkBoundary(t *testing.T) {
 	}
 }
 
+// TestPutStreamCDCDedup stores two versions of a large file with
+// content-defined chunking and checks the edited version reuses most of the
+// original's chunk blobs, and that both read back intact.
+func TestPutStreamCDCDedup(t *testing.T) {
+	cs := testContentService(t)
+	ctx := context.Background()
+	opts := PutOptions{Chunking: content.ChunkingCDC}
+
+	orig := testsupport.TestBytes(3 * content.ChunkSize)
+	edited := append([]byte("a new first paragraph\n"), orig...)
+
+	h1, _, err := cs.PutStreamWith(ctx, bytes.NewReader(orig), opts)
+	if err != nil {
+		t.Fatalf("PutStreamWith(orig): %v", err)
+	}
+	h2, n, err := cs.PutStreamWith(ctx, bytes.NewReader(edited), opts)
+	if err != nil {
+		t.Fatalf("PutStreamWith(edited): %v", err)
+	}
+	if n != int64(len(edited)) {
+		t.Fatalf("reported %d bytes, want %d", n, len(edited))
+	}
+
+	manifest := func(hash string) *content.ChunkManifest {
+		blob, err := cs.store.Get(hash)
+		if err != nil {
+			t.Fatalf("manifest blob: %v", err)
+		}
+		m, ok := content.DecodeManifest(blob)
+		if !ok || m.Sizes == nil {
+			t.Fatalf("%s is not a v2 manifest", hash)
+		}
+		return m
+	}
+	m1, m2 := manifest(h1), manifest(h2)
+	old := map[string]bool{}
+	for _, c := range m1.Chunks {
+		old[c] = true
+	}
+	shared := 0
+	for _, c := range m2.Chunks {
+		if old[c] {
+			shared++
+		}
+	}
+	if shared < len(m2.Chunks)-2 {
+		t.Fatalf("edited version shares only %d of %d chunks", shared, len(m2.Chunks))
+	}
+
+	for hash, want := range map[string][]byte{h1: orig, h2: edited} {
+		got, err := cs.Fetch(ctx, hash)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("fetch back %s: err=%v equal=%v", hash, err, bytes.Equal(got, want))
+		}
+	}
+}
+
+// TestPutStreamCDCSmallContentIsPlain checks the chunking mode does not change
+// the address of content that fits in a single blob.
+func TestPutStreamCDCSmallContentIsPlain(t *testing.T) {
+	cs := testContentService(t)
+	data := testsupport.TestBytes(4096)
+	hash, _, err := cs.PutStreamWith(context.Background(), bytes.NewReader(data), PutOptions{Chunking: content.ChunkingCDC})
+	if err != nil {
+		t.Fatalf("PutStreamWith: %v", err)
+	}
+	if want, _ := content.ContentHash(data); hash != want {
+		t.Fatalf("small CDC upload stored as %s, want plain content hash %s", hash, want)
+	}
+}
+
+// TestPutStreamEncrypted stores content under a key and checks that only
+// ciphertext reaches the store, that FetchStreamKey returns the plaintext with
+// its plaintext size, and that the wrong key is refused.
+func TestPutStreamEncrypted(t *testing.T) {
+	cs := testContentService(t)
+	ctx := context.Background()
+	key, err := content.NewContentKey()
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+
+	for _, size := range []int{100, content.ChunkSize + 4096} {
+		data := testsupport.TestBytes(size)
+		hash, stored, err := cs.PutStreamWith(ctx, bytes.NewReader(data), PutOptions{Key: key})
+		if err != nil {
+			t.Fatalf("PutStreamWith(%d): %v", size, err)
+		}
+		if stored != content.EncryptedSize(int64(size)) {
+			t.Fatalf("size %d: stored %d bytes, want %d", size, stored, content.EncryptedSize(int64(size)))
+		}
+		raw, err := cs.Fetch(ctx, hash)
+		if err != nil {
+			t.Fatalf("fetch ciphertext: %v", err)
+		}
+		if bytes.Contains(raw, data[:64]) {
+			t.Fatalf("size %d: stored blobs contain plaintext", size)
+		}
+
+		rc, n, err := cs.FetchStreamKey(ctx, hash, key)
+		if err != nil {
+			t.Fatalf("FetchStreamKey: %v", err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || n != int64(size) || !bytes.Equal(got, data) {
+			t.Fatalf("size %d: decrypt err=%v size=%d equal=%v", size, err, n, bytes.Equal(got, data))
+		}
+
+		wrong, _ := content.NewContentKey()
+		if rc, _, err := cs.FetchStreamKey(ctx, hash, wrong); err == nil {
+			_, err = io.ReadAll(rc)
+			rc.Close()
+			if !errors.Is(err, content.ErrBadContentKey) {
+				t.Fatalf("size %d: wrong key read gave %v", size, err)
+			}
+		} else if !errors.Is(err, content.ErrBadContentKey) {
+			t.Fatalf("size %d: wrong key gave %v", size, err)
+		}
+	}
+}
+
 // TestChunkReaderRejectsWrongLength checks a chunk whose length disagrees with
 // the manifest fails the read instead of silently corrupting the output.
 
@@ -134,7 +257,7 @@ func TestChunkReaderRejectsWrongLength(t *testing.T) {
 	h2, _ := content.ContentHash([]byte("chunk two"))
 	m := &content.ChunkManifest{TotalSize: 10, ChunkSize: 8, Chunks: []string{h1, h2}}
 
-	cr := &chunkReader{manifest: m, fetch: func(hash string) ([]byte, error) {
+	cr := &chunkReader{manifest: m, fetch: func(i int) ([]byte, error) {
 		return []byte("wrong-size-chunk"), nil // 16 bytes, manifest says 8
 	}}
 	if _, err := io.ReadAll(cr); err == nil {
@@ -150,7 +273,7 @@ func TestChunkReaderPropagatesFetchError(t *testing.T) {
 	h2, _ := content.ContentHash([]byte("chunk two"))
 	m := &content.ChunkManifest{TotalSize: 10, ChunkSize: 8, Chunks: []string{h1, h2}}
 
-	cr := &chunkReader{manifest: m, fetch: func(hash string) ([]byte, error) {
+	cr := &chunkReader{manifest: m, fetch: func(i int) ([]byte, error) {
 		return nil, fmt.Errorf("no providers")
 	}}
 	if _, err := io.ReadAll(cr); err == nil {
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// This file is the operator's handle on what the store keeps: listing sets,
+// pinning and unpinning roots, removing them and collecting garbage. Pinned
+// is the index's "owned" — published here, or adopted by the operator — and is
+// never evicted; everything else is hosted on the network's behalf under the
+// hosting budget (see content.ContentIndex).
+//
+// Removing content here only affects this node. Replicas already pushed to
+// other peers stay there under their own hosting policy, and provider records
+// this node announced expire on their own within a day or two.
+
+// ErrIndexUnavailable means the content index failed to load (or this is a
+// store-only service), so there is nothing to pin, list or collect.
+var ErrIndexUnavailable = errors.New("content index unavailable")
+
+// ListSets returns every content set this node holds.
+func (cs *ContentService) ListSets() ([]content.SetInfo, error) {
+	if cs.index == nil {
+		return nil, ErrIndexUnavailable
+	}
+	return cs.index.Sets(), nil
+}
+
+// Pin keeps a set this node holds for good: it is never evicted and stops
+// counting against the hosting budget. Content not held locally must be
+// fetched first; a missing root is content.ErrBlobNotFound.
+func (cs *ContentService) Pin(root string) error {
+	return cs.indexOp(root, cs.index.Pin)
+}
+
+// Unpin releases a pinned set to the hosting budget: it stays available to
+// the network until eviction needs its space (see GC).
+func (cs *ContentService) Unpin(root string) error {
+	return cs.indexOp(root, cs.index.Unpin)
+}
+
+// Remove drops a set from this node now, deleting every blob no other set
+// still needs.
+func (cs *ContentService) Remove(root string) error {
+	return cs.indexOp(root, cs.index.Remove)
+}
+
+func (cs *ContentService) indexOp(root string, op func(string) bool) error {
+	if cs.index == nil {
+		return ErrIndexUnavailable
+	}
+	if !op(root) {
+		return fmt.Errorf("%s: %w", root, content.ErrBlobNotFound)
+	}
+	return nil
+}
+
+// GC evicts hosted sets until the hosting budget holds again and deletes
+// blobs no set references; see content.ContentIndex.GC.
+func (cs *ContentService) GC() (content.GCResult, error) {
+	if cs.index == nil {
+		return content.GCResult{}, ErrIndexUnavailable
+	}
+	return cs.index.GC(cs.hostBudget.Load(), cs.hostTTL, time.Now())
+}
+
+// HostedUsage describes the hosting budget and who is filling it.
+type HostedUsage struct {
+	Budget    int64               `json:"budget"`
+	Used      int64               `json:"used"` // hosted bytes, including transfers in flight
+	PeerQuota content.PeerQuota   `json:"peerQuota"`
+	Peers     []content.PeerUsage `json:"peers"`
+}
+
+// Hosted reports hosted content grouped by the peer it came from, against
+// the hosting budget and the per-peer quota.
+func (cs *ContentService) Hosted() (HostedUsage, error) {
+	if cs.index == nil {
+		return HostedUsage{}, ErrIndexUnavailable
+	}
+	return HostedUsage{
+		Budget:    cs.hostBudget.Load(),
+		Used:      cs.index.HostedBytes(),
+		PeerQuota: cs.peerQuota,
+		Peers:     cs.index.HostedByPeer(),
+	}, nil
+}
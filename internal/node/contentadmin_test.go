@@ -0,0 +1,50 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// TestContentAdminWithoutIndex checks a store-only service reports
+// ErrIndexUnavailable instead of pretending there is nothing to manage.
+func TestContentAdminWithoutIndex(t *testing.T) {
+	cs := testContentService(t)
+	if _, err := cs.ListSets(); !errors.Is(err, ErrIndexUnavailable) {
+		t.Fatalf("ListSets: %v", err)
+	}
+	if err := cs.Pin("anything"); !errors.Is(err, ErrIndexUnavailable) {
+		t.Fatalf("Pin: %v", err)
+	}
+	if _, err := cs.GC(); !errors.Is(err, ErrIndexUnavailable) {
+		t.Fatalf("GC: %v", err)
+	}
+}
+
+// TestContentAdminRemoveChunked uploads a chunked set and removes it: the
+// manifest and every chunk go, and an unknown root is ErrBlobNotFound.
+func TestContentAdminRemoveChunked(t *testing.T) {
+	cs, store := testIndexedContentService(t)
+	data := testsupport.TestBytes(2*content.ChunkSize + 10)
+	root, _, err := cs.PutStream(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	if sets, _ := cs.ListSets(); len(sets) != 1 || !sets[0].Pinned || sets[0].Chunks != 3 {
+		t.Fatalf("sets after upload: %+v", sets)
+	}
+
+	if err := cs.Remove(root); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if hashes, _ := store.List(); len(hashes) != 0 {
+		t.Fatalf("%d blobs left after removing the only set", len(hashes))
+	}
+	if err := cs.Remove(root); !errors.Is(err, content.ErrBlobNotFound) {
+		t.Fatalf("second Remove: %v, want ErrBlobNotFound", err)
+	}
+}
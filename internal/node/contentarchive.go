@@ -0,0 +1,136 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// Export writes the content set rooted at root to w as a content archive (see
+// content/archive.go): the root blob, then each distinct chunk in manifest
+// order. Blobs missing locally are fetched from the network like any read,
+// but not cached, so exporting content this node does not hold leaves no
+// trace in its store.
+//
+// Nothing is written until the root has been found, so a caller can still
+// report a missing root (content.ErrBlobNotFound) cleanly; a failure after
+// that leaves a truncated archive, which Import rejects.
+func (cs *ContentService) Export(ctx context.Context, root string, w io.Writer) error {
+	top, src, err := cs.fetchBlob(ctx, root)
+	if err != nil {
+		return err
+	}
+	aw, err := content.NewArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := aw.WriteBlob(root, top); err != nil {
+		return err
+	}
+	m, ok := content.DecodeManifest(top)
+	if !ok {
+		return nil
+	}
+	written := map[string]bool{}
+	for i, h := range m.Chunks {
+		if written[h] {
+			continue
+		}
+		data, err := cs.fetchManifestChunk(ctx, root, m, i, src, false)
+		if err != nil {
+			return fmt.Errorf("chunk %d/%d: %w", i+1, len(m.Chunks), err)
+		}
+		if err := aw.WriteBlob(h, data); err != nil {
+			return err
+		}
+		written[h] = true
+	}
+	return nil
+}
+
+// Import reads a content archive and stores the set it holds as owned content,
+// exactly as if it had been uploaded here: indexed, announced and replicated.
+// It returns the root hash and the content size.
+//
+// Every blob is verified against its hash as it is read (content.ArchiveReader)
+// and must belong to the set its root describes; a chunk the store already
+// holds may be left out of the archive. The set is recorded only once the
+// archive has been read to the end and every chunk is present, and blobs
+// written on the way are claimed like any transfer's (see content.BlobClaims),
+// so a corrupt or incomplete archive leaves nothing behind. Anything wrong
+// with the archive itself is content.ErrBadArchive.
+func (cs *ContentService) Import(ctx context.Context, r io.Reader) (string, int64, error) {
+	claims := cs.index.BeginWrite()
+	defer claims.Discard()
+
+	ar, err := content.NewArchiveReader(r)
+	if err != nil {
+		return "", 0, err
+	}
+	root, top, err := ar.Next()
+	if err == io.EOF {
+		return "", 0, fmt.Errorf("%w: archive is empty", content.ErrBadArchive)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	put := func(hash string, data []byte) error {
+		claims.Claim(hash)
+		_, err := cs.store.Put(data)
+		return err
+	}
+	if err := put(root, top); err != nil {
+		return "", 0, err
+	}
+
+	// Chunks the set needs, with the length each must have.
+	m, chunked := content.DecodeManifest(top)
+	want := map[string]int64{}
+	if chunked {
+		for i, h := range m.Chunks {
+			want[h] = m.ChunkLen(i)
+		}
+	}
+	for {
+		hash, data, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		size, needed := want[hash]
+		if !needed {
+			return "", 0, fmt.Errorf("%w: blob %s is not part of %s", content.ErrBadArchive, hash, root)
+		}
+		if int64(len(data)) != size {
+			return "", 0, fmt.Errorf("%w: chunk %s length %d does not match manifest", content.ErrBadArchive, hash, len(data))
+		}
+		if err := put(hash, data); err != nil {
+			return "", 0, err
+		}
+		delete(want, hash)
+	}
+	for h := range want {
+		// Not in the archive, but a chunk already held locally completes the
+		// set just as well; claim it so it cannot be evicted meanwhile.
+		claims.Claim(h)
+		if !cs.store.Has(h) {
+			return "", 0, fmt.Errorf("%w: chunk %s missing", content.ErrBadArchive, h)
+		}
+	}
+
+	if !chunked {
+		cs.index.MarkOwned(root, int64(len(top)), nil, claims)
+		cs.announce(ctx, root)
+		cs.replicateOwned(root)
+		return root, int64(len(top)), nil
+	}
+	cs.index.MarkOwned(root, int64(len(top))+m.TotalSize, m.Chunks, claims)
+	cs.announce(ctx, root)
+	go cs.announceChunks(m.Chunks)
+	cs.replicateOwned(root)
+	return root, m.TotalSize, nil
+}
@@ -0,0 +1,126 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func testIndexedContentService(t *testing.T) (*ContentService, *content.BlobStore) {
+	t.Helper()
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	cs, err := NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	return cs, store
+}
+
+// TestExportImportChunked moves a chunked set with a repeated chunk from one
+// store to an empty one and checks it arrives whole, owned, and byte-identical.
+func TestExportImportChunked(t *testing.T) {
+	ctx := context.Background()
+	src, _ := testIndexedContentService(t)
+	chunk := testsupport.TestBytes(content.ChunkSize)
+	data := append(append(bytes.Clone(chunk), chunk...), "tail"...)
+	root, _, err := src.PutStream(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := src.Export(ctx, root, &archive); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if archive.Len() > len(data)-content.ChunkSize+4096 {
+		t.Fatalf("archive of %d bytes repeats the duplicated chunk", archive.Len())
+	}
+
+	dst, store := testIndexedContentService(t)
+	got, size, err := dst.Import(ctx, &archive)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if got != root || size != int64(len(data)) {
+		t.Fatalf("Import = %s, %d; want %s, %d", got, size, root, len(data))
+	}
+	if sets, _ := dst.ListSets(); len(sets) != 1 || !sets[0].Pinned {
+		t.Fatalf("imported set not owned: %+v", sets)
+	}
+	back, err := dst.Fetch(ctx, root)
+	if err != nil || !bytes.Equal(back, data) {
+		t.Fatalf("Fetch after import: err=%v equal=%v", err, bytes.Equal(back, data))
+	}
+	if hashes, _ := store.List(); len(hashes) != 3 {
+		t.Fatalf("%d blobs stored, want manifest + 2 distinct chunks", len(hashes))
+	}
+}
+
+// TestImportRejectsIncomplete checks an archive missing a chunk the store does
+// not hold, or carrying a blob foreign to the set, is refused and leaves no
+// blob behind.
+func TestImportRejectsIncomplete(t *testing.T) {
+	ctx := context.Background()
+	src, _ := testIndexedContentService(t)
+	data := testsupport.TestBytes(content.ChunkSize + 100)
+	root, _, err := src.PutStream(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	manifest, _ := src.store.Get(root)
+	m, _ := content.DecodeManifest(manifest)
+	first, _ := src.store.Get(m.Chunks[0])
+
+	build := func(extra ...[]byte) *bytes.Buffer {
+		var buf bytes.Buffer
+		aw, _ := content.NewArchiveWriter(&buf)
+		aw.WriteBlob(root, manifest)
+		aw.WriteBlob(m.Chunks[0], first)
+		for _, b := range extra {
+			h, _ := content.ContentHash(b)
+			aw.WriteBlob(h, b)
+		}
+		return &buf
+	}
+
+	for name, archive := range map[string]*bytes.Buffer{
+		"missing chunk": build(),
+		"foreign blob":  build([]byte("not part of this set")),
+	} {
+		dst, store := testIndexedContentService(t)
+		if _, _, err := dst.Import(ctx, archive); !errors.Is(err, content.ErrBadArchive) {
+			t.Fatalf("%s: %v, want ErrBadArchive", name, err)
+		}
+		if hashes, _ := store.List(); len(hashes) != 0 {
+			t.Fatalf("%s: %d blobs left behind", name, len(hashes))
+		}
+	}
+
+	// The same incomplete archive is enough for a store that already holds
+	// the missing chunk.
+	dst, store := testIndexedContentService(t)
+	last, _ := src.store.Get(m.Chunks[1])
+	store.Put(last)
+	if _, _, err := dst.Import(ctx, build()); err != nil {
+		t.Fatalf("import completed by a local chunk: %v", err)
+	}
+}
+
+func TestExportMissingRoot(t *testing.T) {
+	cs, _ := testIndexedContentService(t)
+	missing, _ := content.ContentHash([]byte("nowhere"))
+	var buf bytes.Buffer
+	if err := cs.Export(context.Background(), missing, &buf); !errors.Is(err, content.ErrBlobNotFound) {
+		t.Fatalf("Export: %v, want ErrBlobNotFound", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Export wrote %d bytes for a missing root", buf.Len())
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -18,6 +19,7 @@ import (
 	mh "github.com/multiformats/go-multihash"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
 	"golang.org/x/time/rate"
 )
 
@@ -28,7 +30,8 @@ import (
 //
 // Flow:
 //   - PutStream(r): store locally (chunking content larger than content.ChunkSize into
-//     chunk blobs plus a manifest), then dht.Provide(cid) so others can find us.
+//     chunk blobs plus a manifest, at fixed or content-defined boundaries),
+//     then dht.Provide(cid) so others can find us.
 //   - FetchStream(hash): return local bytes, or FindProvidersAsync -> dial a
 //     provider -> stream the blob -> verify the hash -> cache locally. If the
 //     blob is a manifest, chunks are fetched the same way, one at a time.
@@ -38,24 +41,53 @@ type ContentService struct {
 
 	// Replication + hosting policy (see replicate.go / internal/content). All
 	// nil/zero in store-only test construction: index nil-guards, limiters
-	// pass through, and rep is only used when a node is attached.
+	// pass through, and rep is only used when a node is attached. hostBudget
+	// and the limiters' rates change on a config reload (see Retune).
 	index        *content.ContentIndex
 	rep          *replicator
-	hostBudget   int64
+	hostBudget   atomic.Int64
 	maxPushSize  int64
 	hostTTL      time.Duration
 	healInterval time.Duration
 	upLimit      *rate.Limiter
 	downLimit    *rate.Limiter
+
+	// erasure, when enabled, is the Reed–Solomon layout recorded in the
+	// manifest of every chunked upload, which the replicator then spreads as
+	// shard columns instead of full copies (see erasure.go).
+	erasure content.Erasure
+
+	// Who may push content here, and how much of the hosting budget any one
+	// pusher may fill (see pushpolicy.go). Zero values admit everyone up to
+	// the budget.
+	pushPolicy pushPolicy
+	peerQuota  content.PeerQuota
+
+	// groups are the replication groups this node is in (see groups.go).
+	groups contentGroups
+
+	// reprovide is the strategy deciding which blobs get provider records,
+	// and reprov runs the periodic sweeps (see reprovide.go). reprov is nil
+	// without a node.
+	reprovide string
+	reprov    *reprovider
+
+	// sessions are the open v2 transfer streams to other peers, one per peer
+	// (see wantlist.go).
+	sessionMu sync.Mutex
+	sessions  map[peer.ID]*wantSession
 }
 
-// contentProtocol is the libp2p stream protocol id for blob transfer.
-const contentProtocol = protocol.ID("/freedomnames/content/1.0.0")
+// contentProtocol is the libp2p stream protocol id for blob transfer, version
+// 1: one blob per stream. Nodes still serve it for peers that do not speak
+// contentProtocolV2 (see wantlist.go). It is a suffix to the node's protocol
+// prefix, as are the other content protocols (see protocols.go).
+const contentProtocol = protocol.ID("/content/1.0.0")
 
 // Wire-format limits for a request.
 const maxHashRequestLen = 128
 
-// provideInterval is how often owned content is re-provided so the provider
+// provideInterval is how often held content is re-provided so the provider
 // records do not expire (DHT provider records last ~24h/48h depending on config).
 const provideInterval = 12 * time.Hour
 
@@ -69,29 +101,49 @@ func NewLocalContentService(store *content.BlobStore) *ContentService {
 	return &ContentService{store: store}
 }
 
-// NewContentService creates the service, registers the fetch and push stream
-// handlers on the node's libp2p host, and starts the keep-providing and
-// replica-healing loops.
+// NewIndexedLocalContentService is NewLocalContentService plus the content
+// index kept in the store's directory, so the store-management operations
+// (ListSets, Pin, Unpin, Remove, GC) work without a network: for tools that
+// open a node's store directly, and tests.
+func NewIndexedLocalContentService(store *content.BlobStore) (*ContentService, error) {
+	ix, err := content.LoadContentIndex(store.Dir(), store)
+	if err != nil {
+		return nil, err
+	}
+	return &ContentService{store: store, index: ix}, nil
+}
+
+// NewContentService creates the service, registers the fetch (both protocol
+// versions), push and challenge stream handlers on the node's libp2p host, and
+// starts the keep-providing and replica-healing loops.
 func NewContentService(node *FreedomNameNode, store *content.BlobStore, cfg *config.Config) *ContentService {
 	cs := &ContentService{
 		store:        store,
 		node:         node,
-		hostBudget:   cfg.ContentHostBudget,
 		maxPushSize:  cfg.ContentMaxPushSize,
 		hostTTL:      cfg.ContentHostTTL,
 		healInterval: cfg.ContentHealInterval,
-		upLimit:      content.NewRateLimiter(cfg.ContentUpRate),
-		downLimit:    content.NewRateLimiter(cfg.ContentDownRate),
-	}
+		upLimit:      content.NewAdjustableRateLimiter(cfg.ContentUpRate),
+		downLimit:    content.NewAdjustableRateLimiter(cfg.ContentDownRate),
+		erasure:      cfg.ContentErasure,
+		pushPolicy:   newPushPolicy(cfg.ContentAllowPeers, cfg.ContentDenyPeers),
+		peerQuota:    cfg.ContentPeerQuota,
+		groups:       newContentGroups(cfg.ContentGroups, node.kadDHT.Host().ID()),
+		reprovide:    cfg.ContentReprovide,
+	}
+	cs.hostBudget.Store(cfg.ContentHostBudget)
 	ix, err := content.LoadContentIndex(store.Dir(), store)
 	if err != nil {
-		log.Printf("WARNING: content index unavailable (hosting policy and healing disabled): %v", err)
+		contentLog.Warn("content index unavailable, hosting policy and healing disabled", "err", err)
 	} else {
 		cs.index = ix
 	}
 	cs.rep = cs.newReplicator(cfg.ContentReplicas)
-	node.kadDHT.Host().SetStreamHandler(contentProtocol, cs.handleStream)
-	node.kadDHT.Host().SetStreamHandler(pushProtocol, cs.handlePushStream)
+	cs.reprov = cs.newReprovider(cfg.ContentReprovide)
+	node.kadDHT.Host().SetStreamHandler(cs.protocol(contentProtocol), cs.handleStream)
+	node.kadDHT.Host().SetStreamHandler(cs.protocol(contentProtocolV2), cs.handleWantStream)
+	node.kadDHT.Host().SetStreamHandler(cs.protocol(pushProtocol), cs.handlePushStream)
+	node.kadDHT.Host().SetStreamHandler(cs.protocol(challengeProtocol), cs.handleChallengeStream)
 	go cs.provideLoop()
 	if cs.index != nil && cs.healInterval > 0 {
 		go cs.healLoop()
@@ -99,6 +151,20 @@ func NewContentService(node *FreedomNameNode, store *content.BlobStore, cfg *con
 	return cs
 }
 
+// Retune applies the content settings a running node may change from a
+// reloaded config: the hosting budget and the bandwidth caps. Transfers in
+// progress pick up new caps as they go; hosted content over a lowered budget
+// stays until the next GC. Everything else needs a restart.
+func (cs *ContentService) Retune(cfg *config.Config) {
+	cs.hostBudget.Store(cfg.ContentHostBudget)
+	if cs.upLimit != nil {
+		content.SetRate(cs.upLimit, cfg.ContentUpRate)
+	}
+	if cs.downLimit != nil {
+		content.SetRate(cs.downLimit, cfg.ContentDownRate)
+	}
+}
+
 // hashToCID wraps a base36 sha2-256 multihash content hash in a raw CIDv1, the
 // key the DHT provider index uses.
 func hashToCID(hash string) (cid.Cid, error) {
@@ -118,14 +184,33 @@ func (cs *ContentService) Put(ctx context.Context, data []byte) (string, error)
 	return hash, err
 }
 
+// PutOptions are the per-upload choices PutStreamWith accepts. The zero value
+// is what PutStream uses.
+type PutOptions struct {
+	// Chunking selects how content larger than one chunk is split; the
+	// default is content.ChunkingFixed.
+	Chunking content.Chunking
+	// Key, when set, encrypts the content under it before anything is
+	// stored (see content.NewEncryptReader): the returned hash then
+	// addresses ciphertext, and reading it back takes the key too (see
+	// FetchStreamKey and content.FormatReadCap). The stored size includes the
+	// encryption overhead.
+	Key []byte
+}
+
 // PutStream stores content of any size up to content.MaxContentSize, reading r to the
-// end. Content that fits in one chunk is stored as a single blob whose hash is
-// the plain content hash (identical to pre-chunking addresses); larger content
-// becomes chunk blobs plus a manifest, and the manifest's hash is returned.
-// Memory use stays bounded at one chunk regardless of content size.
+// end, with the default options. See PutStreamWith.
 func (cs *ContentService) PutStream(ctx context.Context, r io.Reader) (string, int64, error) {
-	// Read one byte past content.ChunkSize to learn whether this is single- or
-	// multi-chunk content before committing to either layout.
+	return cs.PutStreamWith(ctx, r, PutOptions{})
+}
+
+// PutStreamWith stores content of any size up to content.MaxContentSize,
+// reading r to the end. Content that fits in one chunk is stored as a single
+// blob whose hash is the plain content hash (identical to pre-chunking
+// addresses, whatever the chunking mode); larger content becomes chunk blobs
+// plus a manifest, and the manifest's hash is returned. Memory use stays
+// bounded at one chunk regardless of content size.
+func (cs *ContentService) PutStreamWith(ctx context.Context, r io.Reader, opts PutOptions) (string, int64, error) {
 	// Local content is assembled blob by blob just like an inbound push, and is
 	// just as invisible to the index until the set is recorded. It takes the
 	// same claims, so a concurrent rollback or eviction cannot delete a chunk
@@ -133,27 +218,50 @@ func (cs *ContentService) PutStream(ctx context.Context, r io.Reader) (string, i
 	claims := cs.index.BeginWrite()
 	defer claims.Discard()
 
-	head := make([]byte, content.ChunkSize+1)
-	hn, err := readFill(r, head)
+	if opts.Key != nil {
+		enc, err := content.NewEncryptReader(r, opts.Key)
+		if err != nil {
+			return "", 0, err
+		}
+		r = enc
+	}
+
+	// Read one byte past content.ChunkSize to learn whether this is single- or
+	// multi-chunk content before committing to either layout. The same buffer
+	// then serves as the chunking window: every cut is taken from a full
+	// buffer until the stream ends, which is what Chunking.Cut requires.
+	buf := make([]byte, content.ChunkSize+1)
+	fill, err := readFill(r, buf)
 	if err != nil {
 		return "", 0, err
 	}
-	if hn <= content.ChunkSize {
-		hash, err := content.ContentHash(head[:hn])
+	if fill <= content.ChunkSize {
+		hash, err := content.ContentHash(buf[:fill])
 		if err != nil {
 			return "", 0, err
 		}
 		claims.Claim(hash)
-		if _, err := cs.store.Put(head[:hn]); err != nil {
+		if _, err := cs.store.Put(buf[:fill]); err != nil {
 			return "", 0, err
 		}
-		cs.index.MarkOwned(hash, int64(hn), nil, claims)
+		cs.index.MarkOwned(hash, int64(fill), nil, claims)
 		cs.announce(ctx, hash)
 		cs.replicateOwned(hash)
-		return hash, int64(hn), nil
+		return hash, int64(fill), nil
 	}
 
-	m := content.ChunkManifest{ChunkSize: content.ChunkSize}
+	var m content.ChunkManifest
+	if opts.Chunking == content.ChunkingCDC || cs.erasure.Enabled() {
+		// An erasure layout is a version 2 feature, so erasure-coded
+		// fixed-size chunks list their sizes too.
+		m.Sizes = []int64{}
+	} else {
+		m.ChunkSize = content.ChunkSize
+	}
+	if cs.erasure.Enabled() {
+		e := cs.erasure
+		m.Erasure = &e
+	}
 	putChunk := func(b []byte) error {
 		if m.TotalSize+int64(len(b)) > content.MaxContentSize {
 			return content.ErrContentTooLarge
@@ -167,29 +275,35 @@ func (cs *ContentService) PutStream(ctx context.Context, r io.Reader) (string, i
 			return err
 		}
 		m.Chunks = append(m.Chunks, h)
+		if m.Sizes != nil {
+			m.Sizes = append(m.Sizes, int64(len(b)))
+		}
+		if m.Erasure != nil {
+			// Only the shard hashes are kept here: this node holds the
+			// chunk itself, and derives shards from it when pushing.
+			row, err := shardHashes(*m.Erasure, b)
+			if err != nil {
+				return err
+			}
+			m.Shards = append(m.Shards, row)
+		}
 		m.TotalSize += int64(len(b))
 		return nil
 	}
-	if err := putChunk(head[:content.ChunkSize]); err != nil {
-		return "", 0, err
-	}
-	buf := make([]byte, content.ChunkSize)
-	off := copy(buf, head[content.ChunkSize:hn]) // the one look-ahead byte
-	for {
-		n, err := readFill(r, buf[off:])
-		if err != nil {
+	eof := false
+	for fill > 0 {
+		cut := opts.Chunking.Cut(buf[:fill])
+		if err := putChunk(buf[:cut]); err != nil {
 			return "", 0, err
 		}
-		fill := off + n
-		if fill == 0 {
-			break
-		}
-		if err := putChunk(buf[:fill]); err != nil {
-			return "", 0, err
-		}
-		off = 0
-		if fill < content.ChunkSize {
-			break
+		fill = copy(buf, buf[cut:fill])
+		if !eof {
+			n, err := readFill(r, buf[fill:])
+			if err != nil {
+				return "", 0, err
+			}
+			fill += n
+			eof = fill < len(buf)
 		}
 	}
 
@@ -207,8 +321,8 @@ func (cs *ContentService) PutStream(ctx context.Context, r io.Reader) (string, i
 	}
 	cs.index.MarkOwned(hash, int64(len(data))+m.TotalSize, m.Chunks, claims)
 	cs.announce(ctx, hash)
-	// Providing every chunk means one DHT walk each; do it in the background
-	// so a large Put returns promptly. provideLoop re-announces on schedule.
+	// Only under the "all" strategy: one DHT walk per chunk, so in the
+	// background for a large Put to return promptly.
 	go cs.announceChunks(m.Chunks)
 	cs.replicateOwned(hash)
 	return hash, m.TotalSize, nil
@@ -223,7 +337,7 @@ func (cs *ContentService) replicateOwned(root string) {
 	}
 	go func() {
 		placed := cs.rep.replicate(cs.node.ctx, root)
-		log.Printf("content: %s replicated to %d peer(s)", root, placed)
+		contentLog.Info("replicated", "root", root, "peers", placed)
 	}()
 }
 
@@ -250,7 +364,7 @@ func (cs *ContentService) announce(ctx context.Context, hash string) {
 	provideCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 	if err := cs.node.kadDHT.Provide(provideCtx, c, true); err != nil {
-		log.Printf("content: provide %s: %v", hash, err)
+		contentLog.Warn("provide failed", "hash", hash, "err", err)
 	}
 }
 
@@ -305,10 +419,14 @@ func (cs *ContentService) FetchStream(ctx context.Context, hash string) (io.Read
 		} else {
 			cs.index.TouchBlob(hash)
 		}
-		fetch := func(chunkHash string) ([]byte, error) { return cs.fetchChunk(ctx, chunkHash, src, cache) }
+		fetch := func(i int) ([]byte, error) { return cs.fetchManifestChunk(ctx, hash, m, i, src, cache) }
+		if remote {
+			fetch = reportFetch(hash, m, src, fetch)
+		}
 		return &chunkReader{manifest: m, fetch: fetch}, m.TotalSize, nil
 	}
 	if remote {
+		events.Publish(events.Content, "content.fetch.done", map[string]any{"hash": hash, "from": src.String(), "bytes": len(top), "size": len(top)})
 		if cs.admitHosted(int64(len(top))) {
 			claims.Claim(hash)
 			cs.cacheBlob(hash, top)
@@ -320,19 +438,59 @@ func (cs *ContentService) FetchStream(ctx context.Context, hash string) (io.Read
 	return io.NopCloser(bytes.NewReader(top)), int64(len(top)), nil
 }
 
-// fetchBlob returns one blob: from the local store, or by discovering a
-// provider via the DHT and streaming it (hash-verified by fetchFrom). The
+// FetchStreamKey is FetchStream for encrypted content: it fetches the
+// ciphertext behind hash exactly as FetchStream does (so it is cached and
+// hosted as ciphertext, like any other set) and returns a reader over the
+// plaintext, plus the plaintext size. A wrong key, or a hash that does not
+// address encrypted content, fails with content.ErrBadContentKey — at once if
+// the size already rules it out, otherwise from Read before any unauthenticated
+// byte is returned.
+func (cs *ContentService) FetchStreamKey(ctx context.Context, hash string, key []byte) (io.ReadCloser, int64, error) {
+	rc, size, err := cs.FetchStream(ctx, hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	plain, ok := content.DecryptedSize(size)
+	if !ok {
+		rc.Close()
+		return nil, 0, content.ErrBadContentKey
+	}
+	dec, err := content.NewDecryptReader(rc, key)
+	if err != nil {
+		rc.Close()
+		return nil, 0, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{dec, rc}, plain, nil
+}
+
+// fetchBlob returns one blob: from the local store, from a peer this node
+// already has a transfer session with, or by discovering a provider via the
+// DHT and streaming it (hash-verified by fetchFrom). The
 // serving peer's ID is returned so callers can request related blobs (chunks)
 // from it directly and decide whether to cache the set.
 func (cs *ContentService) fetchBlob(ctx context.Context, hash string) ([]byte, peer.ID, error) {
+	return cs.fetchBlobVia(ctx, hash, hash)
+}
+
+// fetchBlobVia is fetchBlob with the providers looked up under key rather
+// than the blob's own hash: the root of the set a chunk belongs to, or the
+// marker of a shard's column, which is what has provider records under the
+// default reprovide strategy (see reprovide.go).
+func (cs *ContentService) fetchBlobVia(ctx context.Context, hash, key string) ([]byte, peer.ID, error) {
 	if data, err := cs.store.Get(hash); err == nil {
 		return data, "", nil
 	}
 	if cs.node == nil {
 		return nil, "", content.ErrBlobNotFound // store-only service (tests)
 	}
+	if data, p, ok := cs.fetchFromSessions(ctx, cs.node.kadDHT.Host(), hash); ok {
+		return data, p, nil
+	}
 
-	c, err := hashToCID(hash)
+	c, err := hashToCID(key)
 	if err != nil {
 		return nil, "", err
 	}
@@ -357,33 +515,74 @@ func (cs *ContentService) fetchBlob(ctx context.Context, hash string) ([]byte, p
 	return nil, "", lastErr
 }
 
-// fetchChunk returns one chunk of a manifest: from the local store, from the
-// peer that served the manifest, or via full provider discovery last. cache
-// says whether the set was admitted for local hosting.
-func (cs *ContentService) fetchChunk(ctx context.Context, hash string, src peer.ID, cache bool) ([]byte, error) {
+// fetchChunk returns one chunk of the manifest at root: from the local store,
+// from the peer that served the manifest, or via provider discovery last.
+// cache says whether the set was admitted for local hosting.
+func (cs *ContentService) fetchChunk(ctx context.Context, hash, root string, src peer.ID, cache bool) ([]byte, error) {
 	if data, err := cs.store.Get(hash); err == nil {
 		return data, nil
 	}
 	if src != "" {
 		if data, err := cs.fetchFrom(ctx, peer.AddrInfo{ID: src}, hash); err == nil {
 			if cache {
-				cs.cacheBlob(hash, data)
+				cs.cacheChunk(hash, data)
 			}
 			return data, nil
 		}
 	}
-	data, _, err := cs.fetchBlob(ctx, hash)
+	data, err := cs.fetchMember(ctx, hash, root)
 	if err == nil && cache {
-		cs.cacheBlob(hash, data)
+		cs.cacheChunk(hash, data)
 	}
 	return data, err
 }
 
+// fetchMember fetches a blob belonging to a set: from the providers of key
+// (see fetchBlobVia), then from providers of the blob itself, which nodes
+// running the "all" reprovide strategy announce.
+func (cs *ContentService) fetchMember(ctx context.Context, hash, key string) ([]byte, error) {
+	data, _, err := cs.fetchBlobVia(ctx, hash, key)
+	if err != nil && key != hash {
+		data, _, err = cs.fetchBlob(ctx, hash)
+	}
+	return data, err
+}
+
+// fetchManifestChunk returns chunk i of a manifest. For an erasure-coded set
+// the chunk itself is often held only by its publisher, so after the local
+// store and the manifest's source it is rebuilt from any K of its shards,
+// falling back to looking for the whole chunk last.
+func (cs *ContentService) fetchManifestChunk(ctx context.Context, root string, m *content.ChunkManifest, i int, src peer.ID, cache bool) ([]byte, error) {
+	hash := m.Chunks[i]
+	if m.Erasure == nil {
+		return cs.fetchChunk(ctx, hash, root, src, cache)
+	}
+	if data, err := cs.store.Get(hash); err == nil {
+		return data, nil
+	}
+	if src != "" {
+		if data, err := cs.fetchFrom(ctx, peer.AddrInfo{ID: src}, hash); err == nil {
+			if cache {
+				cs.cacheChunk(hash, data)
+			}
+			return data, nil
+		}
+	}
+	data, err := cs.rebuildChunk(ctx, m, i)
+	if err != nil {
+		return cs.fetchChunk(ctx, hash, root, "", cache)
+	}
+	if cache {
+		cs.cacheChunk(hash, data)
+	}
+	return data, nil
+}
+
 // cacheBlob stores a fetched (already hash-verified) blob and announces this
 // node as a provider for it, so content gains replicas as it spreads.
 func (cs *ContentService) cacheBlob(hash string, data []byte) {
 	if _, err := cs.store.Put(data); err != nil {
-		log.Printf("content: cache %s: %v", hash, err)
+		contentLog.Warn("cache failed", "hash", hash, "err", err)
 		return
 	}
 	if cs.node != nil {
@@ -391,9 +590,22 @@ func (cs *ContentService) cacheBlob(hash string, data []byte) {
 	}
 }
 
-// announceChunks best-effort provides each chunk of a freshly stored manifest.
+// cacheChunk is cacheBlob for a chunk of a set, announced only under the
+// "all" reprovide strategy: otherwise the set's root stands for it.
+func (cs *ContentService) cacheChunk(hash string, data []byte) {
+	if _, err := cs.store.Put(data); err != nil {
+		contentLog.Warn("cache failed", "hash", hash, "err", err)
+		return
+	}
+	if cs.node != nil && cs.reprovide == config.ReprovideAll {
+		go cs.announce(cs.node.ctx, hash)
+	}
+}
+
+// announceChunks best-effort provides each chunk of a freshly stored
+// manifest, under the "all" reprovide strategy only.
 func (cs *ContentService) announceChunks(hashes []string) {
-	if cs.node == nil {
+	if cs.node == nil || cs.reprovide != config.ReprovideAll {
 		return
 	}
 	for _, h := range hashes {
@@ -410,9 +622,38 @@ func (cs *ContentService) announceChunks(hashes []string) {
 // chunk arrives hash-verified (fetchFrom checks it) and must match the length
 // the manifest implies, so the reader yields exactly TotalSize correct bytes
 // or fails.
+// reportFetch wraps the chunk fetcher of a remote manifest to publish the
+// transfer's progress: started now, then once per chunk, then done or failed.
+func reportFetch(hash string, m *content.ChunkManifest, src peer.ID, fetch func(int) ([]byte, error)) func(int) ([]byte, error) {
+	events.Publish(events.Content, "content.fetch.started", map[string]any{
+		"hash": hash, "from": src.String(), "size": m.TotalSize, "chunks": len(m.Chunks),
+	})
+	var received int64
+	return func(i int) ([]byte, error) {
+		data, err := fetch(i)
+		if err != nil {
+			events.Publish(events.Content, "content.fetch.failed", map[string]any{
+				"hash": hash, "chunk": i, "error": err.Error(),
+			})
+			return nil, err
+		}
+		received += int64(len(data))
+		progress := map[string]any{
+			"hash": hash, "chunk": i, "chunks": len(m.Chunks), "bytes": received, "size": m.TotalSize,
+		}
+		events.Publish(events.Content, "content.fetch.progress", progress)
+		if i == len(m.Chunks)-1 {
+			events.Publish(events.Content, "content.fetch.done", map[string]any{
+				"hash": hash, "from": src.String(), "bytes": received, "size": m.TotalSize,
+			})
+		}
+		return data, nil
+	}
+}
+
 type chunkReader struct {
 	manifest *content.ChunkManifest
-	fetch    func(hash string) ([]byte, error)
+	fetch    func(i int) ([]byte, error)
 	next     int    // index of the next chunk to fetch
 	cur      []byte // unread remainder of the current chunk
 }
@@ -422,7 +663,7 @@ func (cr *chunkReader) Read(p []byte) (int, error) {
 		if cr.next >= len(cr.manifest.Chunks) {
 			return 0, io.EOF
 		}
-		data, err := cr.fetch(cr.manifest.Chunks[cr.next])
+		data, err := cr.fetch(cr.next)
 		if err != nil {
 			return 0, fmt.Errorf("chunk %d/%d: %w", cr.next+1, len(cr.manifest.Chunks), err)
 		}
@@ -439,37 +680,24 @@ func (cr *chunkReader) Read(p []byte) (int, error) {
 
 func (cr *chunkReader) Close() error { return nil }
 
-// fetchFrom opens a content stream to a peer, requests a hash, reads the blob,
-// and verifies it matches the requested hash.
+// fetchFrom requests a hash from a peer, over the v2 session to it when the
+// peer speaks that protocol and a single v1 stream otherwise (see fetchVia),
+// and verifies the blob matches the requested hash.
 func (cs *ContentService) fetchFrom(ctx context.Context, p peer.AddrInfo, hash string) ([]byte, error) {
-	cs.node.kadDHT.Host().Peerstore().AddAddrs(p.ID, p.Addrs, time.Hour)
+	h := cs.node.kadDHT.Host()
+	h.Peerstore().AddAddrs(p.ID, p.Addrs, time.Hour)
+	return cs.fetchVia(ctx, h, p.ID, hash)
+}
 
-	streamCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
-	stream, err := cs.node.kadDHT.Host().NewStream(streamCtx, p.ID, contentProtocol)
-	if err != nil {
-		return nil, fmt.Errorf("open stream to %s: %w", p.ID, err)
-	}
+// fetchOnStream runs one version 1 request on stream, which it closes. The
+// blob is not verified here.
+func fetchOnStream(stream network.Stream, hash string, downLimit *rate.Limiter) ([]byte, error) {
 	defer stream.Close()
 	stream.SetDeadline(time.Now().Add(20 * time.Second))
-
 	if err := writeRequest(stream, hash); err != nil {
 		return nil, err
 	}
-	data, err := readBlob(content.LimitReader(stream, cs.downLimit))
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify the peer served the bytes we asked for.
-	got, err := content.ContentHash(data)
-	if err != nil {
-		return nil, err
-	}
-	if got != hash {
-		return nil, fmt.Errorf("provider served wrong content (asked %s, got %s)", hash, got)
-	}
-	return data, nil
+	return readBlob(content.LimitReader(stream, downLimit))
 }
 
 // handleStream serves an inbound content request: read a hash, write the blob
@@ -495,8 +723,8 @@ func (cs *ContentService) handleStream(stream network.Stream) {
 	io.Copy(content.LimitWriter(stream, cs.upLimit), rc)
 }
 
-// provideLoop re-announces every locally stored blob periodically so provider
-// records stay fresh while this node is up.
+// provideLoop re-announces what the reprovide strategy covers periodically so
+// provider records stay fresh while this node is up.
 func (cs *ContentService) provideLoop() {
 	// Announce shortly after start (once peers are likely connected), then on a
 	// steady interval via a single ticker (no per-iteration timer allocation).
@@ -520,19 +748,7 @@ func (cs *ContentService) provideLoop() {
 }
 
 func (cs *ContentService) provideAll() {
-	hashes, err := cs.store.List()
-	if err != nil {
-		log.Printf("content: list for provide: %v", err)
-		return
-	}
-	for _, h := range hashes {
-		select {
-		case <-cs.node.ctx.Done():
-			return
-		default:
-		}
-		cs.announce(cs.node.ctx, h)
-	}
+	cs.reprov.run(cs.node.ctx)
 }
 
 // --- wire format: request = varint-len + hash string; blob = varint-len + bytes ---
@@ -70,7 +70,7 @@ func TestContentStreamTransfer(t *testing.T) {
 	data := []byte("# A page served peer-to-peer")
 	hash, _ := store.Put(data)
 
-	server.SetStreamHandler(contentProtocol, func(stream network.Stream) {
+	server.SetStreamHandler(defaultPrefix.id(contentProtocol), func(stream network.Stream) {
 		defer stream.Close()
 		reqHash, err := readRequest(stream)
 		if err != nil {
@@ -94,7 +94,7 @@ func TestContentStreamTransfer(t *testing.T) {
 	}
 
 	// Client requests the blob.
-	stream, err := client.NewStream(ctx, server.ID(), contentProtocol)
+	stream, err := client.NewStream(ctx, server.ID(), defaultPrefix.id(contentProtocol))
 	if err != nil {
 		t.Fatalf("new stream: %v", err)
 	}
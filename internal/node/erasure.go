@@ -0,0 +1,147 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// This file connects erasure coding (content/erasure.go) to storage and
+// transfer. An erasure-coded set's manifest lists, per chunk, the hashes of
+// its K+M shards. The publisher stores only the chunks and derives shards
+// when it pushes them; each replica stores one shard *column* (shard j of
+// every chunk) as ordinary blobs; a reader without the chunk rebuilds it from
+// any K shards it can find. See replicate.go for placement and healing.
+
+// shardHashes returns the hashes of the K+M shards of chunk.
+func shardHashes(e content.Erasure, chunk []byte) ([]string, error) {
+	shards := e.Encode(chunk)
+	row := make([]string, len(shards))
+	for j, shard := range shards {
+		h, err := content.ContentHash(shard)
+		if err != nil {
+			return nil, err
+		}
+		row[j] = h
+	}
+	return row, nil
+}
+
+// rebuildChunk reconstructs chunk i of an erasure-coded manifest from its
+// shards: those in the local store first, then fetched from the holders of
+// their columns until K are in hand. Every shard is hash-verified on arrival
+// (fetchFrom), and so is
+// the rebuilt chunk. Shards fetched here are not cached; the caller decides
+// whether to keep the chunk.
+func (cs *ContentService) rebuildChunk(ctx context.Context, m *content.ChunkManifest, i int) ([]byte, error) {
+	e := *m.Erasure
+	row := m.Shards[i]
+	shards := make([][]byte, e.Shards())
+	have := 0
+	for j, h := range row {
+		if data, err := cs.store.Get(h); err == nil {
+			shards[j] = data
+			have++
+		}
+	}
+	var lastErr error = content.ErrTooFewShards
+	for j, h := range row {
+		if have >= e.K {
+			break
+		}
+		if shards[j] != nil {
+			continue
+		}
+		data, err := cs.fetchMember(ctx, h, m.Shards[0][j])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		shards[j] = data
+		have++
+	}
+	if have < e.K {
+		return nil, fmt.Errorf("chunk %d: %d of %d shards: %w", i+1, have, e.K, lastErr)
+	}
+	chunk, err := e.Reconstruct(shards, m.ChunkLen(i))
+	if err != nil {
+		return nil, err
+	}
+	if h, err := content.ContentHash(chunk); err != nil || h != m.Chunks[i] {
+		return nil, fmt.Errorf("chunk %d: rebuilt bytes do not match the manifest", i+1)
+	}
+	return chunk, nil
+}
+
+// columnBlob returns shard j of chunk i: from the store if this node holds
+// it, otherwise derived from the chunk (held locally, or rebuilt from other
+// shards — how healing regenerates a lost column).
+func (cs *ContentService) columnBlob(ctx context.Context, m *content.ChunkManifest, i, j int) ([]byte, error) {
+	hash := m.Shards[i][j]
+	if data, err := cs.store.Get(hash); err == nil {
+		return data, nil
+	}
+	chunk, err := cs.store.Get(m.Chunks[i])
+	if err != nil {
+		if chunk, err = cs.rebuildChunk(ctx, m, i); err != nil {
+			return nil, err
+		}
+	}
+	shard := m.Erasure.Shard(chunk, j)
+	if h, err := content.ContentHash(shard); err != nil || h != hash {
+		return nil, fmt.Errorf("shard %d of chunk %d does not match the manifest", j, i+1)
+	}
+	return shard, nil
+}
+
+// erasureManifest returns the manifest of root if it is an erasure-coded set
+// held locally, and nil otherwise (plain content, full-copy manifests, or a
+// root this node does not hold).
+func (cs *ContentService) erasureManifest(root string) *content.ChunkManifest {
+	data, err := cs.store.Get(root)
+	if err != nil {
+		return nil
+	}
+	m, ok := content.DecodeManifest(data)
+	if !ok || m.Erasure == nil {
+		return nil
+	}
+	return m
+}
+
+// loadColumnSet is loadContentSet for one shard column: the manifest plus
+// shard j of every chunk, produced by columnBlob when not stored here.
+func (cs *ContentService) loadColumnSet(ctx context.Context, root string, j int) (*contentSet, error) {
+	data, err := cs.store.Get(root)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := content.DecodeManifest(data)
+	if !ok || m.Erasure == nil {
+		return nil, fmt.Errorf("%s is not an erasure-coded set", root)
+	}
+	if j < 0 || j >= m.Erasure.Shards() {
+		return nil, fmt.Errorf("%s has no shard column %d", root, j)
+	}
+	set := &contentSet{root: root, size: int64(len(data)), chunks: m.Column(j)}
+	for i := range m.Chunks {
+		set.size += m.Erasure.ShardLen(m.ChunkLen(i))
+	}
+	set.load = func(i int) ([]byte, error) { return cs.columnBlob(ctx, m, i, j) }
+	return set, nil
+}
+
+// holdsColumn reports whether every shard of column j of root is stored here.
+func (cs *ContentService) holdsColumn(root string, j int) bool {
+	m := cs.erasureManifest(root)
+	if m == nil {
+		return false
+	}
+	for _, h := range m.Column(j) {
+		if !cs.store.Has(h) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// putErasureCoded stores two-chunk content on cs under a 2+1 layout and
+// returns its root and manifest.
+func putErasureCoded(t *testing.T, cs *ContentService) (string, []byte, *content.ChunkManifest) {
+	t.Helper()
+	cs.erasure = content.Erasure{K: 2, M: 1}
+	data := testsupport.TestBytes(content.ChunkSize + 4096)
+	root, _, err := cs.PutStream(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	raw, err := cs.store.Get(root)
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	m, ok := content.DecodeManifest(raw)
+	if !ok || m.Erasure == nil {
+		t.Fatalf("upload did not record an erasure layout")
+	}
+	return root, data, m
+}
+
+func TestPutStreamRecordsShardHashes(t *testing.T) {
+	cs := testContentService(t)
+	_, data, m := putErasureCoded(t, cs)
+	if len(m.Shards) != 2 || m.Sizes == nil {
+		t.Fatalf("manifest: %d shard rows, sizes %v", len(m.Shards), m.Sizes)
+	}
+	row, _ := shardHashes(*m.Erasure, data[:content.ChunkSize])
+	for j, h := range row {
+		if m.Shards[0][j] != h {
+			t.Fatalf("shard %d hash %s, want %s", j, m.Shards[0][j], h)
+		}
+		// The publisher keeps chunks, not shards.
+		if cs.store.Has(h) {
+			t.Fatalf("shard %d stored on the publisher", j)
+		}
+	}
+}
+
+// TestFetchRebuildsChunksFromShards leaves a store with the manifest and two
+// of the three shard columns but none of the chunks, and checks the content
+// still reads back whole.
+func TestFetchRebuildsChunksFromShards(t *testing.T) {
+	cs := testContentService(t)
+	root, data, m := putErasureCoded(t, cs)
+	ctx := context.Background()
+	for i := range m.Chunks {
+		for _, j := range []int{1, 2} { // one data column lost
+			shard, err := cs.columnBlob(ctx, m, i, j)
+			if err != nil {
+				t.Fatalf("column %d: %v", j, err)
+			}
+			cs.store.Put(shard)
+		}
+	}
+	for _, h := range m.Chunks {
+		cs.store.Delete(h)
+	}
+
+	got, err := cs.Fetch(ctx, root)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Fetch: err=%v equal=%v", err, bytes.Equal(got, data))
+	}
+
+	// And a node holding those two columns can regenerate the third.
+	for i := range m.Chunks {
+		shard, err := cs.columnBlob(ctx, m, i, 0)
+		if err != nil {
+			t.Fatalf("regenerate column 0 of chunk %d: %v", i, err)
+		}
+		if h, _ := content.ContentHash(shard); h != m.Shards[i][0] {
+			t.Fatalf("regenerated shard does not match the manifest")
+		}
+	}
+}
+
+// TestPushShardColumn pushes one column of an erasure-coded set over a real
+// stream: the receiver stores and indexes the manifest plus that column only.
+func TestPushShardColumn(t *testing.T) {
+	sender := newPushTestPeer(t, 1<<30)
+	receiver := newPushTestPeer(t, 1<<30)
+	root, _, m := putErasureCoded(t, sender.cs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := sender.host.Connect(ctx, peer.AddrInfo{ID: receiver.host.ID(), Addrs: receiver.host.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	stream, err := sender.host.NewStream(ctx, receiver.host.ID(), defaultPrefix.id(pushProtocol))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Close()
+	set, err := sender.cs.loadColumnSet(ctx, root, 2)
+	if err != nil {
+		t.Fatalf("load column: %v", err)
+	}
+	if status, err := sender.cs.pushOnStream(stream, set); err != nil || status != pushAccept {
+		t.Fatalf("push: status=%d err=%v", status, err)
+	}
+
+	if !receiver.cs.index.Has(root) || !receiver.cs.holdsColumn(root, 2) {
+		t.Fatalf("receiver does not hold column 2")
+	}
+	for i, h := range m.Chunks {
+		if receiver.cs.store.Has(h) || receiver.cs.store.Has(m.Shards[i][0]) {
+			t.Fatalf("receiver holds more than its column")
+		}
+	}
+	sets := receiver.cs.index.Sets()
+	if len(sets) != 1 || sets[0].Size != set.size {
+		t.Fatalf("receiver indexed %+v, want one set of %d bytes", sets, set.size)
+	}
+}
+
+// --- column placement and healing (fakes, no network) ---
+
+type fakeColumnSwarm struct {
+	peers     []peer.ID
+	providers map[string][]peer.ID // by hash: root or a column's first shard
+	accepts   map[peer.ID]byte     // default pushAccept
+	pushed    map[peer.ID]int      // peer -> column pushed
+}
+
+func newFakeColumnReplicator(f *fakeColumnSwarm, self peer.ID, m *content.ChunkManifest) *replicator {
+	f.pushed = map[peer.ID]int{}
+	return &replicator{
+		self:     self,
+		replicas: 3,
+		closest: func(ctx context.Context, root string, n int) ([]peer.ID, error) {
+			return f.peers, nil
+		},
+		providers: func(ctx context.Context, hash string, max int) ([]peer.ID, error) {
+			return f.providers[hash], nil
+		},
+		push: func(ctx context.Context, p peer.ID, root string) (byte, error) {
+			panic("full copy pushed for an erasure-coded set")
+		},
+		layout: func(root string) *content.ChunkManifest { return m },
+		pushColumn: func(ctx context.Context, p peer.ID, root string, j int) (byte, error) {
+			if status, ok := f.accepts[p]; ok {
+				return status, nil
+			}
+			f.pushed[p] = j
+			return pushAccept, nil
+		},
+		holdsColumn: func(root string, j int) bool { return false },
+	}
+}
+
+func TestReplicateColumnsOnePerPeer(t *testing.T) {
+	m := &content.ChunkManifest{Erasure: &content.Erasure{K: 2, M: 1}, Shards: [][]string{{"s0", "s1", "s2"}}}
+	ids := testPeerIDs(6)
+	f := &fakeColumnSwarm{peers: ids, accepts: map[peer.ID]byte{ids[1]: pushHave, ids[2]: pushDecline}}
+	r := newFakeColumnReplicator(f, ids[0], m)
+
+	if placed := r.replicate(context.Background(), "root"); placed != 3 {
+		t.Fatalf("placed %d columns, want 3", placed)
+	}
+	seen := map[int]bool{}
+	for p, j := range f.pushed {
+		if p == ids[0] || p == ids[1] || p == ids[2] {
+			t.Fatalf("column placed on %s (self, holder or decliner)", p)
+		}
+		seen[j] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("columns placed: %v", f.pushed)
+	}
+}
+
+func TestHealColumnsPushesOnlyMissing(t *testing.T) {
+	m := &content.ChunkManifest{Erasure: &content.Erasure{K: 2, M: 1}, Shards: [][]string{{"s0", "s1", "s2"}}}
+	ids := testPeerIDs(6)
+	f := &fakeColumnSwarm{
+		peers: ids,
+		providers: map[string][]peer.ID{
+			"root": {ids[1], ids[3]},
+			"s0":   {ids[1]},
+			"s2":   {ids[3]},
+		},
+	}
+	r := newFakeColumnReplicator(f, ids[0], m)
+
+	if err := r.heal(context.Background(), "root"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	if len(f.pushed) != 1 || f.pushed[ids[2]] != 1 {
+		t.Fatalf("heal pushed %v, want column 1 to the first non-holder", f.pushed)
+	}
+
+	// Once every column has a holder, heal does nothing.
+	f.providers["s1"] = []peer.ID{ids[2]}
+	r = newFakeColumnReplicator(f, ids[0], m)
+	if err := r.heal(context.Background(), "root"); err != nil || len(f.pushed) != 0 {
+		t.Fatalf("heal with every column held: err=%v pushed=%v", err, f.pushed)
+	}
+}
@@ -2,15 +2,17 @@ package node
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/multiformats/go-multiaddr"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
 )
 
 // eventLoop listens for events from the libp2p event bus and handles them accordingly.
-// TODO: Move the output to a separate log file instead of stdout.
+// Everything goes to the p2p subsystem: per-peer events at debug, this node's
+// own addresses and reachability at info. Set FREEDOM_LOG_FILES=p2p=<path> to
+// keep the stream out of the main log.
 func (freedomName *FreedomNameNode) eventLoop() {
 	// Subscribe to events we want to listen for
 	sub, err := freedomName.kadDHT.Host().EventBus().Subscribe([]interface{}{
@@ -26,12 +28,12 @@ func (freedomName *FreedomNameNode) eventLoop() {
 	if err != nil {
 		// sub is nil here: continuing would panic on the deferred Close and on
 		// the first receive from sub.Out().
-		log.Printf("failed to subscribe to libp2p events, event logging disabled: %s", err)
+		p2pLog.Error("failed to subscribe to libp2p events, event logging disabled", "err", err)
 		return
 	}
 	defer sub.Close()
 
-	log.Println("Event listener started")
+	p2pLog.Info("event listener started")
 
 	for {
 		select {
@@ -41,63 +43,66 @@ func (freedomName *FreedomNameNode) eventLoop() {
 			// and disconnecting — spawning an unbounded number of goroutines
 			// from remote input is a denial-of-service lever, and the ordering
 			// of the log lines was lost for nothing.
+			//
+			// Values a remote peer chose (protocol IDs, reasons) are passed as
+			// attributes, which the log handler quotes, so they cannot forge
+			// lines of their own.
 			func(evt interface{}) {
 				switch e := evt.(type) {
 				case event.EvtLocalProtocolsUpdated:
-					log.Printf("Event: 'Local protocols updated' - added: %+v, removed: %+v", e.Added, e.Removed)
+					p2pLog.Info("local protocols updated", "added", e.Added, "removed", e.Removed)
 				case event.EvtLocalAddressesUpdated:
 					p2pAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/p2p/%s", freedomName.kadDHT.Host().ID()))
 					if err != nil {
-						log.Printf("error computing p2p address: %s", err)
+						p2pLog.Error("computing p2p address failed", "err", err)
 					} else {
+						current := make([]string, 0, len(e.Current))
 						// Added
 						for _, addr := range e.Current {
-							addr := addr.Address.Encapsulate(p2pAddr)
-							log.Printf("Event: 'Local address updated': %s", addr)
+							current = append(current, addr.Address.String())
+							p2pLog.Info("local address updated", "addr", addr.Address.Encapsulate(p2pAddr))
 						}
 						// Removed
 						for _, addr := range e.Removed {
-							addr := addr.Address.Encapsulate(p2pAddr)
-							log.Printf("Event: 'Local address removed': %s", addr)
+							p2pLog.Info("local address removed", "addr", addr.Address.Encapsulate(p2pAddr))
 						}
+						events.Publish(events.Connectivity, "addresses", map[string]any{"current": current})
 					}
 				case event.EvtLocalReachabilityChanged:
-					log.Printf("Event: 'Local reachability changed': %+v", e.Reachability)
+					p2pLog.Info("local reachability changed", "reachability", e.Reachability)
+					events.Publish(events.Connectivity, "reachability", map[string]any{"reachability": e.Reachability.String()})
 				case event.EvtNATDeviceTypeChanged:
-					log.Printf("Event: 'NAT device type changed' - DeviceType %v, transport: %v", e.NatDeviceType.String(), e.TransportProtocol.String())
+					p2pLog.Info("NAT device type changed", "deviceType", e.NatDeviceType.String(), "transport", e.TransportProtocol.String())
 				case event.EvtPeerProtocolsUpdated:
-					// %q: protocol IDs are strings a remote peer chose and sent
-					// us during identify, so they are untrusted input on their
-					// way into the log.
-					log.Printf("Event: 'Peer protocols updated' - added: %q, removed: %q, peer: %v", e.Added, e.Removed, e.Peer)
+					p2pLog.Debug("peer protocols updated", "peer", e.Peer, "added", e.Added, "removed", e.Removed)
 				case event.EvtPeerIdentificationCompleted:
-					log.Printf("Event: 'Peer identification completed' - %v", e.Peer)
+					p2pLog.Debug("peer identification completed", "peer", e.Peer)
 				case event.EvtPeerIdentificationFailed:
-					log.Printf("Event 'Peer identification failed' - peer: %v, reason: %v", e.Peer, e.Reason.Error())
+					p2pLog.Debug("peer identification failed", "peer", e.Peer, "reason", e.Reason)
 				case event.EvtPeerConnectednessChanged:
-					// Get the peer info
-					peerInfo := freedomName.kadDHT.Host().Network().Peerstore().PeerInfo(e.Peer)
-					// Get the peer ID
-					peerID := peerInfo.ID
-					// Get the peer protocols
-					peerProtocols, err := freedomName.kadDHT.Host().Network().Peerstore().GetProtocols(peerID)
+					peerstore := freedomName.kadDHT.Host().Network().Peerstore()
+					peerID := peerstore.PeerInfo(e.Peer).ID
+					peerProtocols, err := peerstore.GetProtocols(peerID)
 					if err != nil {
-						log.Printf("Error getting peer protocols: %s", err)
+						p2pLog.Debug("getting peer protocols failed", "peer", peerID, "err", err)
 					}
-					// Get the peer addresses
-					peerAddresses := freedomName.kadDHT.Host().Network().Peerstore().Addrs(peerID)
-					log.Printf("Event: 'Peer connectedness change' - Peer %s is now %s, protocols: %q, addresses: %v", peerID.String(), e.Connectedness, peerProtocols, peerAddresses)
+					p2pLog.Debug("peer connectedness changed", "peer", peerID, "connectedness", e.Connectedness,
+						"protocols", peerProtocols, "addrs", peerstore.Addrs(peerID))
+					events.Publish(events.Connectivity, "peer.connectedness", map[string]any{
+						"peer":          peerID.String(),
+						"connectedness": e.Connectedness.String(),
+					})
 
 					// Q: Do we really need to manage the peersstore ourselves?
 					if e.Connectedness == network.NotConnected {
-						freedomName.kadDHT.Host().Network().Peerstore().RemovePeer(peerID)
+						peerstore.RemovePeer(peerID)
 					}
 				default:
-					log.Printf("Received unknown event (type: %T): %+v", e, e)
+					p2pLog.Debug("unknown event", "type", fmt.Sprintf("%T", e), "event", fmt.Sprintf("%+v", e))
 				}
 			}(evt)
 		case <-freedomName.ctx.Done():
-			log.Println("Stopping event listener")
+			p2pLog.Info("stopping event listener")
 			return
 		}
 	}
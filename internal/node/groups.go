@@ -0,0 +1,162 @@
+package node
+
+import (
+	"context"
+	"slices"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// This file implements replication groups: named sets of peers, typically
+// the nodes one team runs, that keep each other's content. DHT placement puts
+// replicas on whichever strangers are closest to a hash, and a stranger may
+// drop them when its budget fills. A group is placement the operator chose:
+//
+//   - content published here, and every set a member pushes to us, is pushed
+//     to every member of the group (on publish and again on every heal), in
+//     addition to the usual DHT replicas;
+//   - a push from a member is accepted outside the hosting budget, the
+//     per-peer quota and the allow/deny lists, and the set is kept for the
+//     group: never evicted, like owned content (content.ContentIndex.AddGroupSet).
+//
+// Membership is configured on every node (FREEDOM_CONTENT_GROUPS), so trust
+// runs both ways only if each member lists the others.
+
+// replicationGroup is one configured group, minus this node itself.
+type replicationGroup struct {
+	name    string
+	members []peer.ID
+}
+
+// contentGroups is every group this node is configured into.
+type contentGroups []replicationGroup
+
+// newContentGroups decodes the configured groups. Invalid peer IDs are logged
+// and skipped, and self is left out of every member list.
+func newContentGroups(cfg []config.ContentGroup, self peer.ID) contentGroups {
+	var groups contentGroups
+	for _, g := range cfg {
+		rg := replicationGroup{name: g.Name}
+		for _, m := range g.Members {
+			p, err := peer.Decode(m)
+			if err != nil {
+				contentLog.Warn("replication group has an invalid peer ID", "group", g.Name, "peer", m, "err", err)
+				continue
+			}
+			if p != self {
+				rg.members = append(rg.members, p)
+			}
+		}
+		groups = append(groups, rg)
+	}
+	return groups
+}
+
+// shared returns the names of the groups p is a member of.
+func (gs contentGroups) shared(p peer.ID) []string {
+	var names []string
+	for _, g := range gs {
+		for _, m := range g.members {
+			if m == p {
+				names = append(names, g.name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// members returns the distinct members of the named groups, or of every group
+// when all is set.
+func (gs contentGroups) members(names []string, all bool) []peer.ID {
+	var out []peer.ID
+	seen := map[peer.ID]bool{}
+	for _, g := range gs {
+		if !all && !slices.Contains(names, g.name) {
+			continue
+		}
+		for _, m := range g.members {
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// groupMembers returns the peers root must be placed on for its groups: every
+// member of every group for content this node owns, the members of the groups
+// it is kept for otherwise, and nobody for ordinary hosted content. A node
+// holding only one shard column of a group set has no full copy to give, so
+// it leaves placement to the members that do.
+func (cs *ContentService) groupMembers(root string) []peer.ID {
+	if len(cs.groups) == 0 {
+		return nil
+	}
+	owned, groups, ok := cs.index.Membership(root)
+	if !ok {
+		return nil
+	}
+	if owned {
+		return cs.groups.members(nil, true)
+	}
+	if len(groups) == 0 || !cs.holdsAllChunks(root) {
+		return nil
+	}
+	return cs.groups.members(groups, false)
+}
+
+// holdsAllChunks reports whether the whole set rooted at root is stored here.
+func (cs *ContentService) holdsAllChunks(root string) bool {
+	data, err := cs.store.Get(root)
+	if err != nil {
+		return false
+	}
+	if m, ok := content.DecodeManifest(data); ok {
+		for _, h := range m.Chunks {
+			if !cs.store.Has(h) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// placeGroup pushes root to every member of its groups that does not already
+// hold it, returning how many members hold it afterwards. With a prove seam, a
+// member counts as holding only once it passes a storage challenge (or has
+// just accepted the push); without one, pushHave is taken at its word.
+func (r *replicator) placeGroup(ctx context.Context, root string) int {
+	if r.group == nil {
+		return 0
+	}
+	held := 0
+	for _, p := range r.group(root) {
+		if p == r.self {
+			continue
+		}
+		if r.prove != nil && r.live(ctx, p, root, -1) {
+			held++
+			continue
+		}
+		status, err := r.push(ctx, p, root)
+		if err != nil {
+			contentLog.Warn("placing on group member failed", "root", root, "peer", p, "err", err)
+			continue
+		}
+		switch {
+		case status == pushAccept:
+			r.accepted(p, root, -1)
+			held++
+		case status == pushHave && r.prove == nil:
+			r.claimed(p, root, -1)
+			held++
+		case status == pushDecline:
+			contentLog.Warn("group member declined (is this node in its group?)", "peer", p, "root", root)
+		}
+	}
+	return held
+}
@@ -0,0 +1,94 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func TestContentGroupsMembership(t *testing.T) {
+	self := testPeerID(t)
+	a := testPeerID(t)
+	b := testPeerID(t)
+	groups := newContentGroups([]config.ContentGroup{
+		{Name: "team", Members: []string{self.String(), a.String(), "not-a-peer-id"}},
+		{Name: "family", Members: []string{a.String(), b.String()}},
+	}, self)
+
+	if got := groups.members([]string{"team"}, false); len(got) != 1 || got[0] != a {
+		t.Fatalf("team members %v, want [%s] (self and invalid IDs dropped)", got, a)
+	}
+	if got := groups.members(nil, true); len(got) != 2 {
+		t.Fatalf("all members %v, want a and b once each", got)
+	}
+	if got := groups.shared(a); len(got) != 2 {
+		t.Fatalf("groups shared with a: %v", got)
+	}
+	if got := groups.shared(self); got != nil {
+		t.Fatalf("self is in groups %v", got)
+	}
+}
+
+// TestPushFromGroupMemberBypassesBudget: a member's push is kept for the group
+// even when the hosting budget has no room, and is never evicted.
+func TestPushFromGroupMemberBypassesBudget(t *testing.T) {
+	sender := newPushTestPeer(t, 1<<30)
+	receiver := newPushTestPeer(t, 100) // far too small for the set
+	receiver.cs.groups = contentGroups{{name: "team", members: []peer.ID{sender.host.ID()}}}
+	receiver.cs.pushPolicy = newPushPolicy(nil, []string{sender.host.ID().String()}) // groups win
+
+	root, err := sender.cs.Put(context.Background(), testsupport.TestBytes(4096))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if status, err := pushBetween(t, sender, receiver, root); err != nil || status != pushAccept {
+		t.Fatalf("group push: status=%d err=%v", status, err)
+	}
+	sets, _ := receiver.cs.ListSets()
+	if len(sets) != 1 || len(sets[0].Groups) != 1 || sets[0].Groups[0] != "team" {
+		t.Fatalf("receiver sets: %+v", sets)
+	}
+	if used := receiver.cs.index.HostedBytes(); used != 0 {
+		t.Fatalf("group set counted against the budget: %d", used)
+	}
+	if res, err := receiver.cs.GC(); err != nil || res.EvictedSets != 0 || !receiver.cs.store.Has(root) {
+		t.Fatalf("gc evicted a group set: %+v %v", res, err)
+	}
+	// Owned by nobody here, the set is still placed on the group's members.
+	if got := receiver.cs.groupMembers(root); len(got) != 1 || got[0] != sender.host.ID() {
+		t.Fatalf("group members of a group set: %v", got)
+	}
+}
+
+func TestHealPlacesOnGroupMembers(t *testing.T) {
+	ids := testPeerIDs(6)
+	// Enough DHT providers that ordinary healing has nothing to do.
+	f := &fakeSwarm{peers: ids, provs: ids[1:5], accepts: map[peer.ID]byte{ids[5]: pushHave}}
+	r := newFakeReplicator(f, ids[0], 2)
+	r.group = func(root string) []peer.ID { return []peer.ID{ids[0], ids[4], ids[5]} }
+
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	if len(f.pushed) != 2 || f.pushed[0] != ids[4] || f.pushed[1] != ids[5] {
+		t.Fatalf("pushed %v, want both group members (not self)", f.pushed)
+	}
+
+	// With challenges, a member that proves it holds the set is left alone.
+	f.pushed = nil
+	r.prove = func(ctx context.Context, p peer.ID, root string, column int) error {
+		if p == ids[4] {
+			return nil
+		}
+		return errProofFailed
+	}
+	if held := r.placeGroup(context.Background(), "roothash"); held != 1 {
+		t.Fatalf("held %d, want 1 (ids[5] answers have without proof)", held)
+	}
+	if len(f.pushed) != 1 || f.pushed[0] != ids[5] {
+		t.Fatalf("pushed %v, want only the unproven member", f.pushed)
+	}
+}
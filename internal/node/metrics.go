@@ -0,0 +1,69 @@
+package node
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
+)
+
+// Most of what /metrics reports is recorded into internal/metrics as it
+// happens. What lives on the node itself — libp2p's per-protocol byte counts
+// and the hosting index — is read at scrape time instead, by nodeCollector.
+
+var (
+	contentBytesDesc = prometheus.NewDesc(
+		"freedomnames_content_bytes_total",
+		"Content bytes transferred over libp2p, by content protocol and direction (in or out).",
+		[]string{"protocol", "direction"}, nil,
+	)
+	hostedBytesDesc = prometheus.NewDesc(
+		"freedomnames_content_hosted_bytes",
+		"Bytes of other peers' content this node holds against its hosting budget.",
+		nil, nil,
+	)
+)
+
+// contentProtocolPrefix selects the content protocols (transfer v1 and v2,
+// push, challenge) out of everything the bandwidth counter tracks. Like their
+// ids, it follows the node's protocol prefix.
+const contentProtocolPrefix = "/content/"
+
+// nodeCollector exports a node's scrape-time state; see Collector.
+type nodeCollector struct {
+	node *FreedomNameNode
+}
+
+// Collector returns a Prometheus collector for this node's content bandwidth
+// per protocol and hosted bytes. Register it once (metrics.Register); the
+// content service may be attached later, it is looked up on every scrape.
+func (freedomName *FreedomNameNode) Collector() prometheus.Collector {
+	return nodeCollector{node: freedomName}
+}
+
+func (c nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- contentBytesDesc
+	ch <- hostedBytesDesc
+}
+
+func (c nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.node.bandwidthCounter != nil {
+		prefix := string(c.node.prefix.id(contentProtocolPrefix))
+		for proto, st := range c.node.bandwidthCounter.GetBandwidthByProtocol() {
+			if !strings.HasPrefix(string(proto), prefix) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(contentBytesDesc, prometheus.CounterValue, float64(st.TotalIn), string(proto), "in")
+			ch <- prometheus.MustNewConstMetric(contentBytesDesc, prometheus.CounterValue, float64(st.TotalOut), string(proto), "out")
+		}
+	}
+	if cs := c.node.content; cs != nil {
+		ch <- prometheus.MustNewConstMetric(hostedBytesDesc, prometheus.GaugeValue, float64(cs.index.HostedBytes()))
+	}
+}
+
+// observeDHT records the latency and outcome of one DHT record operation.
+func observeDHT(op string, start time.Time, err error) {
+	metrics.DHTOpDuration.WithLabelValues(op, metrics.Result(err)).Observe(metrics.Since(start))
+}
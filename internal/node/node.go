@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"errors"
-	"log"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -19,15 +19,25 @@ import (
 	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	"github.com/multiformats/go-multiaddr"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/logging"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 )
 
+// Loggers for the subsystems this package spans.
+var (
+	nodeLog    = logging.For(logging.Node)
+	p2pLog     = logging.For(logging.P2P)
+	dhtLog     = logging.For(logging.DHT)
+	contentLog = logging.For(logging.Content)
+)
+
 // The interface this node satisfies for the HTTP API lives with its consumer,
 // in internal/httpapi (httpapi.FreedomDHT). Go satisfies interfaces
 // structurally, so *FreedomNameNode implements it without either package
@@ -54,6 +64,9 @@ type FreedomNameNode struct {
 	// Content service: the peer-to-peer page-bytes layer (set by AttachContent).
 	content *ContentService
 
+	// prefix namespaces the DHT and content protocols (see protocols.go).
+	prefix protocolPrefix
+
 	// dualkadDHT *dual.DHT
 }
 
@@ -68,7 +81,7 @@ func (n *mDNSNotifee) HandlePeerFound(pi peer.AddrInfo) {
 	if n.host.Network().Connectedness(pi.ID) == network.NotConnected {
 		// Attempt to connect to the discovered peer
 		if err := n.host.Connect(context.Background(), pi); err != nil {
-			log.Printf("Error connecting to peer %s: %v", pi.ID.String(), err)
+			p2pLog.Debug("connecting to mDNS peer failed", "peer", pi.ID, "err", err)
 		}
 	}
 }
@@ -104,6 +117,26 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 	// them twice: as DHT bootstrap peers, and as its relay candidates below.
 	bootstrapInfos := BootstrapPeerInfos(cfg.Bootstrap)
 
+	// A private network is a separate swarm: the pre-shared key keeps every
+	// other peer out at the transport, before any protocol is spoken. A key
+	// or prefix that does not check out stops the node here instead of
+	// falling back to the public network (see config.loadNetworkConfig).
+	if err := config.CheckProtocolPrefix(cfg.ProtocolPrefix); err != nil {
+		panic(err)
+	}
+	var psk pnet.PSK
+	if cfg.SwarmKeyFile != "" {
+		if psk, err = config.LoadSwarmKey(cfg.SwarmKeyFile); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Private() {
+		nodeLog.Info("private network", "swarmKey", cfg.SwarmKeyFile != "", "protocolPrefix", cfg.ProtocolPrefix, "mdns", cfg.MDNSService)
+		if len(bootstrapInfos) == 0 && !cfg.BootstrapMode {
+			nodeLog.Warn("private network without bootstrap peers: only peers found by mDNS will be reached; set FREEDOM_BOOTSTRAP to the network's bootstrap nodes")
+		}
+	}
+
 	// Common options
 	opts := []libp2p.Option{
 		// routing,
@@ -114,17 +147,26 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 		libp2p.Security(noise.ID, noise.New),
 		libp2p.Ping(false),
 	}
+	if psk != nil {
+		// libp2p then picks the transports that support a PSK: TCP and
+		// websockets, not QUIC, WebTransport or WebRTC.
+		opts = append(opts, libp2p.PrivateNetwork(psk))
+	}
 
 	// In case of the bootstrap node, we need to listen on a specific port
 	if cfg.BootstrapMode {
-		log.Println("Starting bootstrap node!")
+		nodeLog.Info("starting bootstrap node")
+		listen := []string{
+			"/ip4/0.0.0.0/tcp/4020",
+			"/ip4/0.0.0.0/udp/4020/quic-v1",
+			"/ip4/0.0.0.0/udp/4021/quic-v1/webtransport",
+			"/ip4/0.0.0.0/udp/4022/webrtc-direct",
+		}
+		if psk != nil {
+			listen = listen[:1]
+		}
 		opts = append(opts, []libp2p.Option{
-			libp2p.ListenAddrStrings(
-				"/ip4/0.0.0.0/tcp/4020",
-				"/ip4/0.0.0.0/udp/4020/quic-v1",
-				"/ip4/0.0.0.0/udp/4021/quic-v1/webtransport",
-				"/ip4/0.0.0.0/udp/4022/webrtc-direct",
-			),
+			libp2p.ListenAddrStrings(listen...),
 			libp2p.ForceReachabilityPublic(), // Ignore auto detection NAT, assuming you are opening your ports in your router/firewall.
 			libp2p.EnableRelayService(),      // Enable relay service
 			libp2p.EnableHolePunching(),      // Enable hole punching
@@ -157,6 +199,9 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 			opts = append(opts, libp2p.EnableAutoRelayWithStaticRelays(bootstrapInfos))
 		}
 		opts = append(opts, libp2p.EnableHolePunching())
+		if psk != nil {
+			opts = append(opts, libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0", "/ip6/::/tcp/0"))
+		}
 	}
 
 	p2pHost, err := libp2p.New(opts...)
@@ -164,27 +209,46 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 		panic(err)
 	}
 
-	log.Printf("Peer ID: %s", p2pHost.ID().String())
-	log.Printf("Connect to me on:")
-	hostAddrs := p2pHost.Addrs()
-	for _, addr := range hostAddrs {
-		log.Printf("  %s/p2p/%s", addr, p2pHost.ID().String())
+	nodeLog.Info("node identity", "peer", p2pHost.ID())
+	for _, addr := range p2pHost.Addrs() {
+		nodeLog.Info("connect to me on", "addr", fmt.Sprintf("%s/p2p/%s", addr, p2pHost.ID()))
 	}
 
 	// Set up mDNS discovery to find peers on the local network.
-	mdnsService := mdns.NewMdnsService(p2pHost, "localfreedomnames", &mDNSNotifee{host: p2pHost})
+	mdnsService := mdns.NewMdnsService(p2pHost, cfg.MDNSService, &mDNSNotifee{host: p2pHost})
 	if err := mdnsService.Start(); err != nil {
 		panic(err)
 	} else {
-		log.Println("mDNS service started")
+		p2pLog.Info("mDNS service started")
 	}
 
 	logBootstrapPeers(cfg, bootstrapInfos)
 
+	freedomName, err := newNode(ctx, p2pHost, cfg, bootstrapInfos, bwctr)
+	if err != nil {
+		panic(err)
+	}
+	return freedomName
+}
+
+// NewNodeOnHost builds a node over a libp2p host the caller made, with the DHT
+// NewNode would run, changed by extra options. The host's transports,
+// identity and discovery are the caller's: nothing here listens, relays or
+// runs mDNS. internal/simnet uses it to run many nodes in one process over a
+// mock network.
+func NewNodeOnHost(ctx context.Context, h host.Host, cfg *config.Config, extra ...dht.Option) (*FreedomNameNode, error) {
+	if err := config.CheckProtocolPrefix(cfg.ProtocolPrefix); err != nil {
+		return nil, err
+	}
+	return newNode(ctx, h, cfg, BootstrapPeerInfos(cfg.Bootstrap), metrics.NewBandwidthCounter(), extra...)
+}
+
+// newNode starts the DHT on p2pHost and the node's background loops.
+func newNode(ctx context.Context, p2pHost host.Host, cfg *config.Config, bootstrapInfos []peer.AddrInfo, bwctr *metrics.BandwidthCounter, extra ...dht.Option) (*FreedomNameNode, error) {
 	// DHT options
 	dhtOpts := []dht.Option{
 		dht.BucketSize(10),
-		dht.ProtocolPrefix(protocol.ID("/freedomnames")),
+		dht.ProtocolPrefix(protocol.ID(cfg.ProtocolPrefix)),
 		dht.Concurrency(15),
 		dht.EnableOptimisticProvide(), // Enable experimental optimistic provide, which will store the provider record that has a even closer peer.
 		dht.Resiliency(2),
@@ -204,23 +268,25 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 	}
 
 	// Create a new Kademlia DHT instance using the host
-	dht, err := dht.New(p2pHost, dhtOpts...)
+	kad, err := dht.New(p2pHost, append(dhtOpts, extra...)...)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Bootstrap the DHT node
-	if err = dht.Bootstrap(ctx); err != nil {
-		panic(err)
+	if err = kad.Bootstrap(ctx); err != nil {
+		kad.Close()
+		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	freedomName := &FreedomNameNode{
 		ctx:              ctx,
 		cancel:           cancel,
-		kadDHT:           dht,
+		kadDHT:           kad,
 		bandwidthCounter: bwctr,
 		owned:            make(map[string]*record.FNRecord),
+		prefix:           protocolPrefix(cfg.ProtocolPrefix),
 	}
 
 	// Start additional services now
@@ -228,7 +294,7 @@ func NewNode(ctx context.Context, cfg *config.Config) *FreedomNameNode {
 	go freedomName.statsLoop()
 	go freedomName.republishLoop()
 
-	return freedomName
+	return freedomName, nil
 }
 
 // AttachContent creates the peer-to-peer content service over the given
@@ -255,8 +321,11 @@ func (freedomName *FreedomNameNode) IsInitialized() bool {
 	return freedomName.kadDHT != nil && freedomName.kadDHT.Host() != nil
 }
 
-// Shutdown shuts down the host and the DHT
+// Shutdown stops the node's background loops and shuts down the host and the
+// DHT.
 func (freedomName *FreedomNameNode) Shutdown() {
+	freedomName.cancel()
+
 	// Close the host
 	if host := freedomName.kadDHT.Host(); host != nil {
 		host.Close()
@@ -265,7 +334,7 @@ func (freedomName *FreedomNameNode) Shutdown() {
 	if freedomName.kadDHT != nil {
 		// Close the DHT
 		if err := freedomName.kadDHT.Close(); err != nil {
-			log.Printf("Error closing DHT: %v", err)
+			dhtLog.Error("closing DHT failed", "err", err)
 		}
 	}
 }
@@ -334,7 +403,10 @@ func (freedomName *FreedomNameNode) PutValue(key string, value []byte) error {
 		ctx, cancel := context.WithTimeout(freedomName.ctx, dhtOpTimeout)
 		defer cancel()
 
-		return freedomName.kadDHT.PutValue(ctx, key, value)
+		start := time.Now()
+		err := freedomName.kadDHT.PutValue(ctx, key, value)
+		observeDHT("put", start, err)
+		return err
 	}
 	return errors.New("DHT not initialized")
 }
@@ -346,7 +418,10 @@ func (freedomName *FreedomNameNode) GetValue(key string) ([]byte, error) {
 		ctx, cancel := context.WithTimeout(freedomName.ctx, dhtOpTimeout)
 		defer cancel()
 
-		return freedomName.kadDHT.GetValue(ctx, key)
+		start := time.Now()
+		value, err := freedomName.kadDHT.GetValue(ctx, key)
+		observeDHT("get", start, err)
+		return value, err
 	}
 	return nil, errors.New("DHT not initialized")
 }
@@ -388,26 +463,26 @@ func logBootstrapPeers(cfg *config.Config, infos []peer.AddrInfo) {
 	if cfg.BootstrapMode {
 		// A bootstrap node is the rendezvous point; it never dials the list, so
 		// reporting a count it will not use would be misleading.
-		log.Println("Bootstrap mode: serving as a rendezvous peer, not dialing the bootstrap list")
+		dhtLog.Info("bootstrap mode: serving as a rendezvous peer, not dialing the bootstrap list")
 		return
 	}
 	switch {
 	case len(cfg.Bootstrap) == 0:
-		log.Println("No bootstrap peers configured: discovery is limited to mDNS on the local network")
+		dhtLog.Warn("no bootstrap peers configured: discovery is limited to mDNS on the local network")
 	case len(infos) == 0:
-		log.Printf("None of the %d configured bootstrap peer(s) could be used: discovery is limited to mDNS on the local network", len(cfg.Bootstrap))
+		dhtLog.Warn("none of the configured bootstrap peers could be used: discovery is limited to mDNS on the local network", "configured", len(cfg.Bootstrap))
 	case !cfg.BootstrapFromEnv:
 		// The built-in list needs no verifying and grows over time, so keep it to
 		// one line. Peers that actually connect are logged individually by the
 		// event listener anyway.
-		log.Printf("Dialing %d built-in bootstrap peer(s) across %d addresses", len(infos), countAddrs(infos))
+		dhtLog.Info("dialing built-in bootstrap peers", "peers", len(infos), "addrs", countAddrs(infos))
 	default:
 		// A hand-supplied FREEDOM_BOOTSTRAP is the one worth echoing back, since
 		// it is the part a typo can silently break.
-		log.Printf("Dialing %d bootstrap peer(s) from FREEDOM_BOOTSTRAP:", len(infos))
+		dhtLog.Info("dialing bootstrap peers from FREEDOM_BOOTSTRAP", "peers", len(infos))
 		for _, info := range infos {
 			for _, addr := range info.Addrs {
-				log.Printf("  %s/p2p/%s", addr, info.ID)
+				dhtLog.Info("bootstrap peer", "addr", fmt.Sprintf("%s/p2p/%s", addr, info.ID))
 			}
 		}
 	}
@@ -438,12 +513,12 @@ func BootstrapPeerInfos(addrs []string) []peer.AddrInfo {
 	for _, s := range addrs {
 		maddr, err := multiaddr.NewMultiaddr(s)
 		if err != nil {
-			log.Printf("error parsing multiaddr %s: %v", s, err)
+			dhtLog.Warn("invalid bootstrap multiaddr", "addr", s, "err", err)
 			continue
 		}
 		info, err := peer.AddrInfoFromP2pAddr(maddr)
 		if err != nil {
-			log.Printf("error converting multiaddr %s to AddrInfo: %v", s, err)
+			dhtLog.Warn("bootstrap multiaddr has no peer ID", "addr", s, "err", err)
 			continue
 		}
 		if at, ok := index[info.ID]; ok {
@@ -483,7 +558,7 @@ func loadOrGenerateKey() (crypto.PrivKey, error) {
 	// Check if key file exists
 	if info, err := os.Stat(keyFile); err == nil {
 		if mode := info.Mode().Perm(); mode&0077 != 0 {
-			log.Printf("WARNING: node identity key %s is group/world readable (mode %04o); run: chmod 600 %s", keyFile, mode, keyFile)
+			nodeLog.Warn("node identity key is group/world readable; run: chmod 600 "+keyFile, "path", keyFile, "mode", fmt.Sprintf("%04o", mode))
 		}
 		// Load key from file
 		keyData, err := os.ReadFile(keyFile)
@@ -507,7 +582,7 @@ func loadOrGenerateKey() (crypto.PrivKey, error) {
 	if err := os.WriteFile(keyFile, keyData, 0600); err != nil { // Store securely
 		return nil, err
 	}
-	log.Printf("Generated node identity key at %s", keyFile)
+	nodeLog.Info("generated node identity key", "path", keyFile)
 
 	return priv, nil
 }
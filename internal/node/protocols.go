@@ -0,0 +1,32 @@
+package node
+
+import (
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+)
+
+// protocolPrefix is the namespace every protocol this node speaks lives
+// under: the DHT's (dht.ProtocolPrefix) and the content protocols, whose ids
+// are declared as suffixes (contentProtocol, pushProtocol, ...). Nodes with
+// different prefixes share no protocol, so a private network with a prefix
+// of its own never exchanges records or content with the public one, even
+// over a connection.
+type protocolPrefix string
+
+// defaultPrefix is the public network's, and the one services built without
+// a node (tests) use.
+const defaultPrefix = protocolPrefix(config.DefaultProtocolPrefix)
+
+// id returns the full protocol id for a suffix.
+func (p protocolPrefix) id(suffix protocol.ID) protocol.ID {
+	return protocol.ID(p) + suffix
+}
+
+// protocol returns the full id of one of the content protocols for this
+// service's node.
+func (cs *ContentService) protocol(suffix protocol.ID) protocol.ID {
+	if cs.node == nil {
+		return defaultPrefix.id(suffix)
+	}
+	return cs.node.prefix.id(suffix)
+}
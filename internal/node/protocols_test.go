@@ -0,0 +1,73 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+)
+
+func TestContentProtocolIDs(t *testing.T) {
+	public := &ContentService{}
+	if got := public.protocol(pushProtocol); got != "/freedomnames/content/push/1.0.0" {
+		t.Errorf("default push protocol %q", got)
+	}
+	private := &ContentService{node: &FreedomNameNode{prefix: "/acme-names"}}
+	if got := private.protocol(contentProtocolV2); got != "/acme-names/content/2.0.0" {
+		t.Errorf("prefixed v2 protocol %q", got)
+	}
+	if got := private.node.prefix.id(dhtProtocol); got != "/acme-names/kad/1.0.0" {
+		t.Errorf("prefixed DHT protocol %q", got)
+	}
+}
+
+// pskHost starts a TCP host in the private network of the swarm key with
+// the given hex body.
+func pskHost(t *testing.T, hexKey string) host.Host {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "swarm.key")
+	if err := os.WriteFile(path, []byte("/key/swarm/psk/1.0.0/\n/base16/\n"+hexKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	psk, err := config.LoadSwarmKey(path)
+	if err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	h, err := libp2p.New(libp2p.PrivateNetwork(psk), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("new host: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// TestSwarmKeyIsolates checks that a swarm key read the way NewNode reads it
+// admits peers holding the same key and keeps everyone else out.
+func TestSwarmKeyIsolates(t *testing.T) {
+	const keyA = "8a3c1a2b5e7d9f0c4b6a8e1d3f5a7c9b2d4e6f8a0c1b3d5e7f9a2c4b6d8e0f1a"
+	const keyB = "1f0e8d6b4c2a9f7e5d3b1c0a8f6e4d2b9c7a5f3d1e8a6c4f0b9d7e5a3b2c1a8f"
+	a, b, other := pskHost(t, keyA), pskHost(t, keyA), pskHost(t, keyB)
+	public := newTestHost(t)
+	t.Cleanup(func() { public.Close() })
+
+	connect := func(from, to host.Host) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		return from.Connect(ctx, peer.AddrInfo{ID: to.ID(), Addrs: to.Addrs()})
+	}
+	if err := connect(a, b); err != nil {
+		t.Fatalf("same key: %v", err)
+	}
+	if err := connect(a, other); err == nil {
+		t.Error("connected across swarm keys")
+	}
+	if err := connect(public, a); err == nil {
+		t.Error("public host connected into the private network")
+	}
+}
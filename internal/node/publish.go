@@ -3,9 +3,9 @@ package node
 import (
 	"context"
 	"errors"
-	"log"
 	"time"
 
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 )
 
@@ -31,7 +31,8 @@ func (freedomName *FreedomNameNode) PublishRecord(rec *record.FNRecord) error {
 	freedomName.ownedMu.Lock()
 	freedomName.owned[key] = rec
 	freedomName.ownedMu.Unlock()
-	log.Printf("Published record for %s (seq %d)", key, rec.Seq)
+	dhtLog.Info("published record", "key", key, "seq", rec.Seq)
+	events.Publish(events.Records, "record.published", map[string]any{"key": key, "label": rec.Label, "seq": rec.Seq})
 	return nil
 }
 
@@ -45,7 +46,9 @@ func (freedomName *FreedomNameNode) ResolveRecord(ctx context.Context, key strin
 	ctx, cancel := context.WithTimeout(ctx, dhtOpTimeout)
 	defer cancel()
 
+	start := time.Now()
 	value, err := freedomName.kadDHT.GetValue(ctx, key)
+	observeDHT("get", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -62,12 +65,18 @@ func (freedomName *FreedomNameNode) republishLoop() {
 		case <-ticker.C:
 			freedomName.republishOwned()
 		case <-freedomName.ctx.Done():
-			log.Println("Stopping republish service.")
+			dhtLog.Info("stopping republish service")
 			return
 		}
 	}
 }
 
+// Republish re-puts the owned records now, as the republish loop does every
+// republishInterval.
+func (freedomName *FreedomNameNode) Republish() {
+	freedomName.republishOwned()
+}
+
 // republishOwned re-puts each still-valid owned record into the DHT so it does
 // not fall out at the DHT's ~36h record expiry. It cannot extend a record's
 // signed EOL (the republisher does not retain owner keys): records whose EOL
@@ -79,8 +88,9 @@ func (freedomName *FreedomNameNode) republishOwned() {
 	live := make(map[string]*record.FNRecord, len(freedomName.owned))
 	for key, rec := range freedomName.owned {
 		if rec.EOL != 0 && now > rec.EOL {
-			log.Printf("WARNING: record %s (label %q) passed its signed EOL and was dropped from republishing; the owner must re-publish (re-sign) it", key, rec.Label)
+			dhtLog.Warn("record passed its signed EOL and was dropped from republishing; the owner must re-publish (re-sign) it", "key", key, "label", rec.Label)
 			delete(freedomName.owned, key)
+			events.Publish(events.Records, "record.expired", map[string]any{"key": key, "label": rec.Label, "seq": rec.Seq})
 			continue
 		}
 		live[key] = rec
@@ -90,13 +100,14 @@ func (freedomName *FreedomNameNode) republishOwned() {
 	for key, rec := range live {
 		value, err := rec.Marshal()
 		if err != nil {
-			log.Printf("republish: marshal %s: %v", key, err)
+			dhtLog.Error("republish: marshal failed", "key", key, "err", err)
 			continue
 		}
 		if err := freedomName.PutValue(key, value); err != nil {
-			log.Printf("republish: put %s: %v", key, err)
+			dhtLog.Warn("republish: put failed", "key", key, "err", err)
 			continue
 		}
-		log.Printf("Republished record for %s (seq %d)", key, rec.Seq)
+		dhtLog.Info("republished record", "key", key, "seq", rec.Seq)
+		events.Publish(events.Records, "record.republished", map[string]any{"key": key, "label": rec.Label, "seq": rec.Seq})
 	}
 }
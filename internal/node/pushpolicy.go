@@ -0,0 +1,44 @@
+package node
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// pushPolicy is the operator's say over WHO may push content here, on top of
+// the hosting budget and per-peer quota that decide how much. A push carries no
+// publisher signature, so a pusher is known only by its peer ID. A set
+// re-pushed by a healer is therefore judged by the healer, not by whoever
+// first published it.
+type pushPolicy struct {
+	allow map[peer.ID]bool // non-empty: only these may push
+	deny  map[peer.ID]bool // never these, even if allowed
+}
+
+// newPushPolicy builds a policy from configured peer IDs. Invalid peer IDs
+// are logged and skipped.
+func newPushPolicy(allow, deny []string) pushPolicy {
+	set := func(list string, ids []string) map[peer.ID]bool {
+		if len(ids) == 0 {
+			return nil
+		}
+		m := make(map[peer.ID]bool, len(ids))
+		for _, id := range ids {
+			p, err := peer.Decode(id)
+			if err != nil {
+				contentLog.Warn("push "+list+" list has an invalid peer ID", "peer", id, "err", err)
+				continue
+			}
+			m[p] = true
+		}
+		return m
+	}
+	return pushPolicy{allow: set("allow", allow), deny: set("deny", deny)}
+}
+
+// permits reports whether p may push content to this node.
+func (pp pushPolicy) permits(p peer.ID) bool {
+	if pp.deny[p] {
+		return false
+	}
+	return pp.allow == nil || pp.allow[p]
+}
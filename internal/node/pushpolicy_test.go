@@ -0,0 +1,91 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func testPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("peer id: %v", err)
+	}
+	return id
+}
+
+func TestPushPolicyPermits(t *testing.T) {
+	a, b := testPeerID(t), testPeerID(t)
+
+	if !newPushPolicy(nil, nil).permits(a) {
+		t.Fatalf("empty policy refused a pusher")
+	}
+	// An allowlist admits its members, and no one else.
+	byPeer := newPushPolicy([]string{a.String()}, nil)
+	if !byPeer.permits(a) || byPeer.permits(b) {
+		t.Fatalf("allow by peer ID")
+	}
+	// An entry that is not a peer ID matches nothing.
+	byName := newPushPolicy([]string{"site.k51qzi5uqu5dexample.fn"}, nil)
+	if byName.permits(a) || byName.permits(b) {
+		t.Fatalf("a name in the allowlist admitted a pusher")
+	}
+	// The denylist wins over the allowlist.
+	both := newPushPolicy([]string{a.String(), b.String()}, []string{a.String()})
+	if both.permits(a) || !both.permits(b) {
+		t.Fatalf("deny did not take precedence")
+	}
+}
+
+func TestPushDeclinedByPolicy(t *testing.T) {
+	sender := newPushTestPeer(t, 1<<30)
+	receiver := newPushTestPeer(t, 1<<30)
+	receiver.cs.pushPolicy = newPushPolicy(nil, []string{sender.host.ID().String()})
+
+	root, err := sender.cs.Put(context.Background(), []byte("unwanted page"))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	status, err := pushBetween(t, sender, receiver, root)
+	if err != nil || status != pushDecline {
+		t.Fatalf("denied push: status=%d err=%v", status, err)
+	}
+	if receiver.cs.store.Has(root) {
+		t.Fatalf("denied push stored")
+	}
+}
+
+func TestPushPeerQuota(t *testing.T) {
+	sender := newPushTestPeer(t, 1<<30)
+	receiver := newPushTestPeer(t, 1<<30)
+	receiver.cs.peerQuota = content.PeerQuota{Sets: 1}
+
+	first, _ := sender.cs.Put(context.Background(), testsupport.TestBytes(100))
+	second, _ := sender.cs.Put(context.Background(), testsupport.TestBytes(200))
+	if status, err := pushBetween(t, sender, receiver, first); err != nil || status != pushAccept {
+		t.Fatalf("first push: status=%d err=%v", status, err)
+	}
+	if status, err := pushBetween(t, sender, receiver, second); err != nil || status != pushDecline {
+		t.Fatalf("push over quota: status=%d err=%v", status, err)
+	}
+
+	usage, err := receiver.cs.Hosted()
+	if err != nil {
+		t.Fatalf("hosted: %v", err)
+	}
+	if len(usage.Peers) != 1 || usage.Peers[0].From != sender.host.ID().String() || usage.Peers[0].Sets != 1 || usage.Peers[0].Bytes != 100 {
+		t.Fatalf("usage: %+v", usage)
+	}
+	if usage.Used != 100 || usage.PeerQuota.Sets != 1 {
+		t.Fatalf("totals: %+v", usage)
+	}
+}
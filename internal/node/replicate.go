@@ -1,19 +1,21 @@
 package node
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
 )
 
 // This file makes content distribution proactive: a publish PUSHES copies of
@@ -24,22 +26,28 @@ import (
 // root hash host it, so all healers converge on the same target set.
 
 // pushProtocol transfers a whole content set (a blob, or manifest + chunks)
-// to one peer in a single session.
-const pushProtocol = protocol.ID("/freedomnames/content/push/1.0.0")
+// to one peer in a single session. Like the other protocol ids it is a
+// suffix to the node's protocol prefix (see protocols.go).
+const pushProtocol = protocol.ID("/content/push/1.0.0")
 
 // Push replies: the receiver's one-byte answer to an offer.
 const (
 	pushDecline byte = 0 // policy refused (budget/size); pusher tries another peer
 	pushAccept  byte = 1 // send the blobs
-	pushHave    byte = 2 // already holding the set; counts as a live replica
+	pushHave    byte = 2 // already holding the set; counts as a live replica once proven
 )
 
 // contentSet is the unit of replication: the root blob plus, for chunked
-// content, every chunk. size is the total bytes across all blobs.
+// content, every chunk — or, for one column of an erasure-coded set, shard j
+// of every chunk in their place. size is the total bytes across all blobs.
 type contentSet struct {
 	root   string
 	size   int64
 	chunks []string // nil for single-blob content
+
+	// load produces chunks[i] when it is not in the local store (a shard
+	// derived from its chunk); nil means every blob must be stored.
+	load func(i int) ([]byte, error)
 }
 
 // loadContentSet resolves a root hash to its full set from the local store.
@@ -113,11 +121,18 @@ func readPushOffer(r io.Reader) (root string, size, nblobs uint64, err error) {
 
 // pushTo offers a content set to one peer and, if accepted, streams every
 // blob. Returns the receiver's status byte (pushHave counts as success for
-// replication purposes).
-func (cs *ContentService) pushTo(ctx context.Context, p peer.ID, set *contentSet) (byte, error) {
+// replication purposes). The outcome is published as a content.push event.
+func (cs *ContentService) pushTo(ctx context.Context, p peer.ID, set *contentSet) (status byte, err error) {
+	defer func() {
+		pushed := map[string]any{"root": set.root, "peer": p.String(), "size": set.size, "status": pushStatusName(status)}
+		if err != nil {
+			pushed["error"] = err.Error()
+		}
+		events.Publish(events.Content, "content.push", pushed)
+	}()
 	streamCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-	stream, err := cs.node.kadDHT.Host().NewStream(streamCtx, p, pushProtocol)
+	stream, err := cs.node.kadDHT.Host().NewStream(streamCtx, p, cs.protocol(pushProtocol))
 	if err != nil {
 		return pushDecline, fmt.Errorf("open push stream to %s: %w", p, err)
 	}
@@ -126,6 +141,17 @@ func (cs *ContentService) pushTo(ctx context.Context, p peer.ID, set *contentSet
 	return cs.pushOnStream(stream, set)
 }
 
+// pushStatusName names a push status byte for the content.push event.
+func pushStatusName(status byte) string {
+	switch status {
+	case pushAccept:
+		return "accepted"
+	case pushHave:
+		return "have"
+	}
+	return "declined"
+}
+
 // pushOnStream runs the pusher's side of the protocol on an already-open
 // stream (separated from dialing so it tests over any transport).
 func (cs *ContentService) pushOnStream(stream io.ReadWriter, set *contentSet) (byte, error) {
@@ -142,8 +168,14 @@ func (cs *ContentService) pushOnStream(stream io.ReadWriter, set *contentSet) (b
 
 	w := content.LimitWriter(stream, cs.upLimit)
 	blobs := append([]string{set.root}, set.chunks...)
-	for _, h := range blobs {
+	for n, h := range blobs {
 		rc, size, err := cs.store.Open(h)
+		if err != nil && set.load != nil && n > 0 {
+			var data []byte
+			if data, err = set.load(n - 1); err == nil {
+				rc, size = io.NopCloser(bytes.NewReader(data)), int64(len(data))
+			}
+		}
 		if err != nil {
 			return pushDecline, fmt.Errorf("push %s: local blob %s: %w", set.root, h, err)
 		}
@@ -177,6 +209,10 @@ func (cs *ContentService) pushOnStream(stream io.ReadWriter, set *contentSet) (b
 // offer, then receive and verify each blob against the hashes the root
 // commits to. Nothing is indexed (and so nothing is announced) unless the
 // whole set verifies.
+//
+// For an erasure-coded set the blobs after the manifest may be one shard
+// column instead of the chunks; the first of them says which column, and the
+// rest must follow it.
 func (cs *ContentService) handlePushStream(stream network.Stream) {
 	defer stream.Close()
 	stream.SetDeadline(time.Now().Add(30 * time.Second))
@@ -186,23 +222,38 @@ func (cs *ContentService) handlePushStream(stream network.Stream) {
 		return
 	}
 
+	from := stream.Conn().RemotePeer()
+	// A replication group member is trusted by configuration: its sets are
+	// kept for the group, outside the budget, quota and allow/deny lists.
+	groups := cs.groups.shared(from)
+	if groups == nil && !cs.pushPolicy.permits(from) {
+		contentLog.Info("declined push: not permitted by allow/deny list", "root", root, "peer", from)
+		stream.Write([]byte{pushDecline})
+		return
+	}
 	if cs.index.Has(root) {
 		cs.index.Touch(root) // a live re-push refreshes the TTL
+		if groups != nil {
+			cs.index.JoinGroups(root, groups)
+		}
 		stream.Write([]byte{pushHave})
 		return
 	}
 	// Reserve rather than merely check: the bytes do not land until the
 	// transfer finishes, and concurrent pushes would otherwise all be admitted
 	// against the same pre-transfer usage and blow past the hosting budget.
-	// Reserving deletes nothing — see content.ContentIndex.Reserve.
-	if !cs.reserveHosted(int64(size)) {
+	// Reserving deletes nothing — see content.ContentIndex.Reserve. The
+	// pusher's own quota is checked in the same step (ReserveFrom). A group
+	// set reserves nothing: only the wire-level size cap applies.
+	if groups != nil && int64(size) > cs.maxPushSize ||
+		groups == nil && !cs.reserveHosted(from.String(), int64(size)) {
 		stream.Write([]byte{pushDecline})
 		return
 	}
-	reserved := true
+	reserved := groups == nil
 	defer func() {
 		if reserved {
-			cs.releaseHosted(int64(size))
+			cs.releaseHosted(from.String(), int64(size))
 		}
 	}()
 	if _, err := stream.Write([]byte{pushAccept}); err != nil {
@@ -221,6 +272,8 @@ func (cs *ContentService) handlePushStream(stream network.Stream) {
 	var (
 		manifest *content.ChunkManifest
 		received uint64
+		column   = -1 // shard column being received; -1 for whole chunks
+		blobs    []string
 	)
 	// A push that never completes is an abandoned transfer, not a replica:
 	// nothing was admitted, nothing was indexed, and no peer has been told we
@@ -234,7 +287,7 @@ func (cs *ContentService) handlePushStream(stream network.Stream) {
 	defer claims.Discard()
 	fail := func(why string, args ...any) {
 		claims.Discard()
-		log.Printf("content: reject push %s from %s: %s", root, stream.Conn().RemotePeer(), fmt.Sprintf(why, args...))
+		contentLog.Info("rejected push", "root", root, "peer", from, "reason", fmt.Sprintf(why, args...))
 		stream.Write([]byte{0})
 	}
 	for i := uint64(0); i < nblobs; i++ {
@@ -273,14 +326,26 @@ func (cs *ContentService) handlePushStream(stream network.Stream) {
 				return
 			}
 		} else {
-			if hash != manifest.Chunks[i-1] {
+			if i == 1 && hash != manifest.Chunks[0] {
+				column = shardColumn(manifest, hash)
+				if column < 0 {
+					fail("first chunk is neither chunk 1 nor one of its shards")
+					return
+				}
+			}
+			want, wantLen := manifest.Chunks[i-1], manifest.ChunkLen(int(i-1))
+			if column >= 0 {
+				want, wantLen = manifest.Shards[i-1][column], manifest.Erasure.ShardLen(wantLen)
+			}
+			if hash != want {
 				fail("chunk %d out of order", i)
 				return
 			}
-			if int64(len(data)) != manifest.ChunkLen(int(i-1)) {
+			if int64(len(data)) != wantLen {
 				fail("chunk %d length mismatch", i)
 				return
 			}
+			blobs = append(blobs, hash)
 		}
 		// Claim before the write, so the blob is never on disk unspoken for.
 		// Blobs already present are claimed too: this set depends on them just
@@ -298,21 +363,29 @@ func (cs *ContentService) handlePushStream(stream network.Stream) {
 		return
 	}
 
-	var chunks []string
-	if manifest != nil {
-		chunks = manifest.Chunks
-	}
+	// The set references what was actually received: the chunks, or the one
+	// shard column this node now holds.
+	chunks := blobs
 	// The bytes are here and verified: this is where making room may finally
-	// delete something. commitHosted consumes the reservation either way.
-	reserved = false
-	if !cs.commitHosted(root, int64(size), chunks, stream.Conn().RemotePeer().String(), claims) {
-		fail("hosting budget filled while the transfer was in flight")
-		return
+	// delete something. commitHosted consumes the reservation either way. A
+	// group set needs no room.
+	if groups != nil {
+		cs.index.AddGroupSet(root, int64(size), chunks, from.String(), groups, claims)
+	} else {
+		reserved = false
+		if !cs.commitHosted(root, int64(size), chunks, from.String(), claims) {
+			fail("hosting budget filled while the transfer was in flight")
+			return
+		}
 	}
-	// This node is now a holder: make that discoverable right away.
+	// This node is now a holder: make that discoverable right away. A shard
+	// column is found by its first shard (see healColumns).
 	if cs.node != nil {
 		go func() {
 			cs.announce(cs.node.ctx, root)
+			if column >= 0 {
+				cs.announce(cs.node.ctx, manifest.Shards[0][column])
+			}
 			cs.announceChunks(chunks)
 		}()
 	}
@@ -327,21 +400,23 @@ func (cs *ContentService) admitHosted(size int64) bool {
 	if cs.index == nil {
 		return true // store-only service (tests): no policy
 	}
-	return cs.index.Admit(size, cs.hostBudget, cs.maxPushSize, cs.hostTTL, time.Now())
+	return cs.index.Admit(size, cs.hostBudget.Load(), cs.maxPushSize, cs.hostTTL, time.Now())
 }
 
-// reserveHosted admits a set and holds its size against the budget until
-// releaseHosted is called. Every successful reserve needs exactly one release.
-func (cs *ContentService) reserveHosted(size int64) bool {
+// reserveHosted admits a set pushed by the peer from, within both the budget
+// and that peer's quota, and holds its size against them until releaseHosted
+// or commitHosted is called. Every successful reserve needs exactly one of
+// those.
+func (cs *ContentService) reserveHosted(from string, size int64) bool {
 	if cs.index == nil {
 		return true // store-only service (tests): no policy
 	}
-	return cs.index.Reserve(size, cs.hostBudget, cs.maxPushSize, cs.hostTTL, time.Now())
+	return cs.index.ReserveFrom(from, cs.peerQuota, size, cs.hostBudget.Load(), cs.maxPushSize, cs.hostTTL, time.Now())
 }
 
 // releaseHosted drops a reservation taken by reserveHosted whose transfer never
 // completed.
-func (cs *ContentService) releaseHosted(size int64) { cs.index.Release(size) }
+func (cs *ContentService) releaseHosted(from string, size int64) { cs.index.ReleaseFrom(from, size) }
 
 // commitHosted records a fully received set, evicting if the budget needs it,
 // and hands over the transfer's blob claims so recording the set and releasing
@@ -350,7 +425,21 @@ func (cs *ContentService) commitHosted(root string, size int64, chunks []string,
 	if cs.index == nil {
 		return true // store-only service (tests): no policy
 	}
-	return cs.index.CommitHosted(root, size, chunks, from, cs.hostBudget, cs.maxPushSize, cs.hostTTL, time.Now(), claims)
+	return cs.index.CommitHosted(root, size, chunks, from, cs.hostBudget.Load(), cs.maxPushSize, cs.hostTTL, time.Now(), claims)
+}
+
+// shardColumn returns which shard column of an erasure-coded manifest a hash
+// starts (shard j of the first chunk), or -1.
+func shardColumn(m *content.ChunkManifest, hash string) int {
+	if m.Erasure == nil {
+		return -1
+	}
+	for j, h := range m.Shards[0] {
+		if h == hash {
+			return j
+		}
+	}
+	return -1
 }
 
 func readStatusByte(r io.Reader) (byte, error) {
@@ -373,15 +462,58 @@ type replicator struct {
 	closest   func(ctx context.Context, root string, n int) ([]peer.ID, error)
 	providers func(ctx context.Context, root string, max int) ([]peer.ID, error)
 	push      func(ctx context.Context, p peer.ID, root string) (byte, error)
+
+	// Erasure-coded sets are placed as shard columns, one per peer, instead
+	// of R full copies. layout returns the manifest of an erasure-coded root
+	// held here (nil for every other set), pushColumn pushes shard column j,
+	// and holdsColumn reports whether this node stores column j itself. All
+	// may be nil, which disables the column path.
+	layout      func(root string) *content.ChunkManifest
+	pushColumn  func(ctx context.Context, p peer.ID, root string, j int) (byte, error)
+	holdsColumn func(root string, j int) bool
+
+	// prove challenges p to show it still stores root (column -1) or shard
+	// column j of it (see challenge.go). Holders count toward a replica
+	// target only once proven, and a proof stays good for proofValidity. nil
+	// trusts provider records and pushHave answers as they are.
+	prove   func(ctx context.Context, p peer.ID, root string, column int) error
+	clock   func() time.Time // nil = time.Now
+	proofMu sync.Mutex
+	proven  map[proofKey]time.Time
+
+	// group returns the replication-group members root must be placed on
+	// (see groups.go), who get full copies on top of the DHT placement
+	// below; nil means no groups.
+	group func(root string) []peer.ID
+
+	// status is what replication learned about each root's other holders,
+	// for the status API (see replstatus.go).
+	statusMu sync.Mutex
+	status   map[string]*rootStatus
+}
+
+// erasureLayout returns root's manifest if it is to be placed as columns.
+func (r *replicator) erasureLayout(root string) *content.ChunkManifest {
+	if r.layout == nil || r.pushColumn == nil {
+		return nil
+	}
+	return r.layout(root)
 }
 
 // replicate pushes a freshly published set toward the R closest peers,
-// returning how many replicas were placed (or already existed there).
+// returning how many replicas were placed (or already existed there). An
+// erasure-coded set is spread as K+M shard columns instead, and the count is
+// of columns placed. Members of the set's replication groups get a full copy
+// first, and are included in the count.
 func (r *replicator) replicate(ctx context.Context, root string) int {
+	grouped := r.placeGroup(ctx, root)
+	if m := r.erasureLayout(root); m != nil {
+		return grouped + r.replicateColumns(ctx, root, m)
+	}
 	peers, err := r.closest(ctx, root, r.replicas*2+2)
 	if err != nil {
-		log.Printf("content: replicate %s: closest peers: %v", root, err)
-		return 0
+		contentLog.Warn("replicate: closest peers lookup failed", "root", root, "err", err)
+		return grouped
 	}
 	placed := 0
 	for _, p := range peers {
@@ -393,10 +525,46 @@ func (r *replicator) replicate(ctx context.Context, root string) int {
 		}
 		status, err := r.push(ctx, p, root)
 		if err != nil {
-			log.Printf("content: replicate %s to %s: %v", root, p, err)
+			contentLog.Debug("replicate to peer failed", "root", root, "peer", p, "err", err)
+			continue
+		}
+		if status == pushAccept {
+			r.accepted(p, root, -1)
+			placed++
+		} else if status == pushHave && r.live(ctx, p, root, -1) {
+			r.claimed(p, root, -1)
+			placed++
+		}
+	}
+	return grouped + placed
+}
+
+// replicateColumns places each shard column of an erasure-coded set on its own
+// peer, closest first. A peer answering pushHave already holds some column of
+// the set, so it is passed over rather than counted: two columns on one peer
+// would both be lost with it.
+func (r *replicator) replicateColumns(ctx context.Context, root string, m *content.ChunkManifest) int {
+	n := m.Erasure.Shards()
+	peers, err := r.closest(ctx, root, n*2+2)
+	if err != nil {
+		contentLog.Warn("replicate: closest peers lookup failed", "root", root, "err", err)
+		return 0
+	}
+	placed := 0
+	for _, p := range peers {
+		if placed >= n {
+			break
+		}
+		if p == r.self {
+			continue
+		}
+		status, err := r.pushColumn(ctx, p, root, placed)
+		if err != nil {
+			contentLog.Debug("replicate column to peer failed", "root", root, "column", placed, "peer", p, "err", err)
 			continue
 		}
-		if status == pushAccept || status == pushHave {
+		if status == pushAccept {
+			r.accepted(p, root, placed)
 			placed++
 		}
 	}
@@ -439,6 +607,17 @@ func (cs *ContentService) newReplicator(replicas int) *replicator {
 			}
 			return cs.pushTo(ctx, p, set)
 		},
+		layout: cs.erasureManifest,
+		pushColumn: func(ctx context.Context, p peer.ID, root string, j int) (byte, error) {
+			set, err := cs.loadColumnSet(ctx, root, j)
+			if err != nil {
+				return pushDecline, err
+			}
+			return cs.pushTo(ctx, p, set)
+		},
+		holdsColumn: cs.holdsColumn,
+		prove:       cs.prove,
+		group:       cs.groupMembers,
 	}
 }
 
@@ -464,12 +643,25 @@ func (cs *ContentService) healLoop() {
 	}
 }
 
+// Heal runs one heal pass over every held set now, as the heal loop does each
+// ContentHealInterval, and returns when it is done. It does nothing on a
+// service without a node or a content index.
+func (cs *ContentService) Heal() {
+	if cs.node == nil || cs.index == nil {
+		return
+	}
+	cs.healAll()
+	cs.index.Flush()
+}
+
 // healAll runs one heal pass over all held sets in random order.
 func (cs *ContentService) healAll() {
 	if cs.node.kadDHT.RoutingTable().Size() == 0 {
 		return // not bootstrapped into the network yet
 	}
+	cs.rep.pruneProofs()
 	roots := cs.index.Roots()
+	cs.rep.pruneStatus(roots)
 	rand.Shuffle(len(roots), func(i, j int) { roots[i], roots[j] = roots[j], roots[i] })
 	for _, root := range roots {
 		select {
@@ -478,15 +670,30 @@ func (cs *ContentService) healAll() {
 		default:
 		}
 		if err := cs.rep.heal(cs.node.ctx, root); err != nil {
-			log.Printf("content: heal %s: %v", root, err)
+			contentLog.Warn("heal failed", "root", root, "err", err)
 		}
 	}
 }
 
 // heal counts live providers of a set and, if below target, pushes it to
-// enough new closest peers to top the count back up.
-func (r *replicator) heal(ctx context.Context, root string) error {
+// enough new closest peers to top the count back up. A provider is live only
+// if it passes a storage challenge (see challenge.go), and so is a peer that
+// answers a push with pushHave; one that fails is neither counted nor pushed
+// to again this pass. Erasure-coded sets are healed column by column instead
+// (healColumns).
+//
+// Members of the set's replication groups are kept supplied first
+// (placeGroup), independently of the DHT: whether they are among the closest
+// peers has no bearing on it.
+func (r *replicator) heal(ctx context.Context, root string) (err error) {
+	r.placeGroup(ctx, root)
+	res := HealResult{At: r.now()}
+	defer func() { r.noteHeal(root, res, err) }()
+	if m := r.erasureLayout(root); m != nil {
+		return r.healColumns(ctx, root, m, &res)
+	}
 	target := r.replicas + 1 // holders including this node
+	res.Target, res.Holders = target, 1
 	found, err := r.providers(ctx, root, target+2)
 	if err != nil {
 		return err
@@ -494,11 +701,15 @@ func (r *replicator) heal(ctx context.Context, root string) error {
 	known := map[peer.ID]bool{r.self: true}
 	holders := 1 // this node
 	for _, p := range found {
-		if !known[p] {
-			known[p] = true
+		if known[p] {
+			continue
+		}
+		known[p] = true
+		if r.live(ctx, p, root, -1) {
 			holders++
 		}
 	}
+	res.Holders = holders
 	if holders >= target {
 		return nil
 	}
@@ -519,9 +730,85 @@ func (r *replicator) heal(ctx context.Context, root string) error {
 		if err != nil {
 			continue
 		}
-		if status == pushAccept || status == pushHave {
+		if status == pushAccept {
+			r.accepted(p, root, -1)
+			res.Pushed++
+			res.Holders++
+			need--
+		} else if status == pushHave && r.live(ctx, p, root, -1) {
+			r.claimed(p, root, -1)
+			res.Holders++
 			need--
 		}
 	}
 	return nil
 }
+
+// healColumns checks every shard column of an erasure-coded set for a live
+// holder — a provider of the column's first shard that passes a challenge on
+// the column, or this node — and places
+// each missing column on a new peer that holds no part of the set yet. The
+// column's bytes come from wherever this node can get them: its own chunks if
+// it published the set, otherwise shards rebuilt from the surviving columns
+// (see columnBlob), so any holder can heal.
+func (r *replicator) healColumns(ctx context.Context, root string, m *content.ChunkManifest, res *HealResult) error {
+	n := m.Erasure.Shards()
+	res.Target = n
+	var missing []int
+	for j := 0; j < n; j++ {
+		if r.holdsColumn != nil && r.holdsColumn(root, j) {
+			continue
+		}
+		found, err := r.providers(ctx, m.Shards[0][j], 3)
+		if err != nil {
+			return err
+		}
+		live := false
+		for _, p := range found {
+			if p != r.self && r.live(ctx, p, root, j) {
+				live = true
+				break
+			}
+		}
+		if !live {
+			missing = append(missing, j)
+		}
+	}
+	res.Holders = n - len(missing)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// Anyone already providing the root holds some column (or the whole set)
+	// and would only answer pushHave.
+	known := map[peer.ID]bool{r.self: true}
+	if holders, err := r.providers(ctx, root, n+4); err == nil {
+		for _, p := range holders {
+			known[p] = true
+		}
+	}
+	peers, err := r.closest(ctx, root, n*2+2)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if len(missing) == 0 {
+			break
+		}
+		if known[p] {
+			continue
+		}
+		known[p] = true
+		status, err := r.pushColumn(ctx, p, root, missing[0])
+		if err != nil {
+			continue
+		}
+		if status == pushAccept {
+			r.accepted(p, root, missing[0])
+			res.Pushed++
+			res.Holders++
+			missing = missing[1:]
+		}
+	}
+	return nil
+}
@@ -46,7 +46,7 @@ func openPushStream(t *testing.T, sender, receiver *pushTestPeer) network.Stream
 	if err := sender.host.Connect(ctx, peer.AddrInfo{ID: receiver.host.ID(), Addrs: receiver.host.Addrs()}); err != nil {
 		t.Fatalf("connect: %v", err)
 	}
-	stream, err := sender.host.NewStream(ctx, receiver.host.ID(), pushProtocol)
+	stream, err := sender.host.NewStream(ctx, receiver.host.ID(), defaultPrefix.id(pushProtocol))
 	if err != nil {
 		t.Fatalf("stream: %v", err)
 	}
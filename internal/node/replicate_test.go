@@ -11,6 +11,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
 )
@@ -50,7 +51,7 @@ func TestPushOfferFraming(t *testing.T) {
 	}
 }
 
-// pushTestPeer is one side of a two-real-hosts push test: a ContentService
+// pushTestPeer is one side of a two-real-hosts push (or challenge) test: a ContentService
 // with a real store and index but no DHT node.
 type pushTestPeer struct {
 	cs   *ContentService
@@ -73,11 +74,12 @@ func newPushTestPeer(t *testing.T, budget int64) *pushTestPeer {
 	cs := &ContentService{
 		store:       store,
 		index:       ix,
-		hostBudget:  budget,
 		maxPushSize: content.MaxContentSize,
 		hostTTL:     24 * time.Hour,
 	}
-	h.SetStreamHandler(pushProtocol, cs.handlePushStream)
+	cs.hostBudget.Store(budget)
+	h.SetStreamHandler(defaultPrefix.id(pushProtocol), cs.handlePushStream)
+	h.SetStreamHandler(defaultPrefix.id(challengeProtocol), cs.handleChallengeStream)
 	return &pushTestPeer{cs: cs, host: h}
 }
 
@@ -90,7 +92,7 @@ func pushBetween(t *testing.T, sender, receiver *pushTestPeer, root string) (byt
 	if err := sender.host.Connect(ctx, peer.AddrInfo{ID: receiver.host.ID(), Addrs: receiver.host.Addrs()}); err != nil {
 		t.Fatalf("connect: %v", err)
 	}
-	stream, err := sender.host.NewStream(ctx, receiver.host.ID(), pushProtocol)
+	stream, err := sender.host.NewStream(ctx, receiver.host.ID(), defaultPrefix.id(pushProtocol))
 	if err != nil {
 		t.Fatalf("stream: %v", err)
 	}
@@ -170,6 +172,12 @@ func TestPushDeclinedOverBudget(t *testing.T) {
 	if receiver.cs.store.Has(root) || receiver.cs.index.Has(root) {
 		t.Fatalf("declined content was stored anyway")
 	}
+
+	// Raising the budget on a reload admits the same push.
+	receiver.cs.Retune(&config.Config{ContentHostBudget: 1 << 30})
+	if status, err := pushBetween(t, sender, receiver, root); err != nil || status != pushAccept {
+		t.Fatalf("after retune: status %d err %v", status, err)
+	}
 }
 
 // TestPushCorruptBlobRejected: a pusher whose bytes do not match the offered
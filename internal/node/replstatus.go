@@ -0,0 +1,265 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
+)
+
+// This file answers "did my content actually reach anyone?". Replication runs
+// in the background after a publish and then on every heal pass, so the
+// replicator keeps a small in-memory record per root of what it learned about
+// other holders: who accepted a push, who claimed to have the set, who passed
+// or failed a storage challenge, and how the last heal went. It is not
+// persisted: after a restart it fills up again from the first heal pass.
+
+// Replica states, as reported in ReplicaPeer.State.
+const (
+	replicaAccepted = "accepted" // took a push from this node
+	replicaHave     = "have"     // answered a push with pushHave
+	replicaProven   = "proven"   // passed a storage challenge
+	replicaFailed   = "failed"   // failed a storage challenge
+)
+
+// ReplicaPeer is what this node last learned about one other holder of a set.
+type ReplicaPeer struct {
+	Peer   string    `json:"peer"`
+	Column *int      `json:"column,omitempty"` // shard column, for erasure-coded sets
+	State  string    `json:"state"`
+	At     time.Time `json:"at"`
+}
+
+// HealResult is the outcome of the last heal pass over a set. Holders and
+// Target count this node; for an erasure-coded set they count shard columns.
+type HealResult struct {
+	At      time.Time `json:"at"`
+	Target  int       `json:"target"`
+	Holders int       `json:"holders"`
+	Pushed  int       `json:"pushed"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Durability estimates how many holders the set can lose, whichever they are,
+// and stay complete: for full copies every holder but one; shard columns of an
+// erasure-coded set count only beyond the K needed to rebuild it.
+type Durability struct {
+	Holders   int `json:"holders"`
+	Tolerates int `json:"tolerates"`
+}
+
+// ReplicationStatus is everything this node knows about where a set lives.
+type ReplicationStatus struct {
+	Hash    string   `json:"hash"`
+	Held    bool     `json:"held"` // this node has the set indexed
+	Pinned  bool     `json:"pinned"`
+	Groups  []string `json:"groups,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	Chunks  int      `json:"chunks,omitempty"`
+	Erasure string   `json:"erasure,omitempty"`
+
+	Replicas  []ReplicaPeer `json:"replicas"`
+	Confirmed int           `json:"confirmed"` // other peers known to hold it (not failed)
+	LastHeal  *HealResult   `json:"lastHeal,omitempty"`
+
+	// Providers is how many other peers the DHT lists as providers, when a
+	// lookup was asked for and possible.
+	Providers *int `json:"providers,omitempty"`
+
+	Durability Durability `json:"durability"`
+}
+
+// rootStatus is the replicator's record for one root.
+type rootStatus struct {
+	peers    map[peer.ID]*ReplicaPeer
+	lastHeal *HealResult
+}
+
+// notePeer records what this node just learned about p as a holder of root
+// (column -1 for a full copy).
+func (r *replicator) notePeer(root string, p peer.ID, column int, state string) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	st := r.rootStatusLocked(root)
+	rp := &ReplicaPeer{Peer: p.String(), State: state, At: r.now()}
+	if column >= 0 {
+		rp.Column = &column
+	}
+	st.peers[p] = rp
+}
+
+// noteHeal records the outcome of a heal pass.
+func (r *replicator) noteHeal(root string, res HealResult, err error) {
+	if err != nil {
+		res.Error = err.Error()
+	}
+	metrics.HealResults.WithLabelValues(healOutcome(res, err)).Inc()
+	events.Publish(events.Heal, "heal", map[string]any{"root": root, "outcome": healOutcome(res, err), "result": res})
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.rootStatusLocked(root).lastHeal = &res
+}
+
+// healOutcome classifies a heal pass for the heal results metric: the set was
+// already at target, was brought back to it, is still short, or the pass
+// failed.
+func healOutcome(res HealResult, err error) string {
+	switch {
+	case err != nil:
+		return metrics.ResultError
+	case res.Holders < res.Target:
+		return "short"
+	case res.Pushed > 0:
+		return "repaired"
+	default:
+		return "healthy"
+	}
+}
+
+func (r *replicator) rootStatusLocked(root string) *rootStatus {
+	if r.status == nil {
+		r.status = map[string]*rootStatus{}
+	}
+	st := r.status[root]
+	if st == nil {
+		st = &rootStatus{peers: map[peer.ID]*ReplicaPeer{}}
+		r.status[root] = st
+	}
+	return st
+}
+
+// accepted records that p has just taken a push of root (or its column):
+// every blob it received was verified, so that is as good as a proof.
+func (r *replicator) accepted(p peer.ID, root string, column int) {
+	r.recordProof(p, root, column)
+	r.notePeer(root, p, column, replicaAccepted)
+}
+
+// claimed records that p answered a push of root with pushHave. With
+// challenges on, live has already recorded it as proven instead.
+func (r *replicator) claimed(p peer.ID, root string, column int) {
+	if r.prove == nil {
+		r.notePeer(root, p, column, replicaHave)
+	}
+}
+
+// snapshot returns the recorded peers of root, oldest first, and its last
+// heal result.
+func (r *replicator) snapshot(root string) ([]ReplicaPeer, *HealResult) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	st := r.status[root]
+	if st == nil {
+		return nil, nil
+	}
+	peers := make([]ReplicaPeer, 0, len(st.peers))
+	for _, rp := range st.peers {
+		peers = append(peers, *rp)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].At.Before(peers[j].At) })
+	var heal *HealResult
+	if st.lastHeal != nil {
+		h := *st.lastHeal
+		heal = &h
+	}
+	return peers, heal
+}
+
+// pruneStatus drops the records of roots no longer held, so the table does not
+// outlive evictions and unpins.
+func (r *replicator) pruneStatus(held []string) {
+	keep := make(map[string]bool, len(held))
+	for _, root := range held {
+		keep[root] = true
+	}
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	for root := range r.status {
+		if !keep[root] {
+			delete(r.status, root)
+		}
+	}
+}
+
+// ReplicationStatus reports what this node knows about where root lives. With
+// lookup set, it also counts the DHT's provider records for root, which takes
+// a network round trip (bounded to ten seconds).
+func (cs *ContentService) ReplicationStatus(ctx context.Context, root string, lookup bool) ReplicationStatus {
+	st := ReplicationStatus{Hash: root, Replicas: []ReplicaPeer{}}
+	if info, ok := cs.index.Set(root); ok {
+		st.Held, st.Pinned, st.Groups = true, info.Pinned, info.Groups
+		st.Size, st.Chunks = info.Size, info.Chunks
+	}
+	m := cs.erasureManifest(root)
+	if m != nil {
+		st.Erasure = m.Erasure.String()
+	}
+	if cs.rep == nil {
+		st.Durability = replicaDurability(st.Held, nil, m)
+		return st
+	}
+	peers, heal := cs.rep.snapshot(root)
+	if peers != nil {
+		st.Replicas = peers
+	}
+	st.LastHeal = heal
+	for _, rp := range st.Replicas {
+		if rp.State != replicaFailed {
+			st.Confirmed++
+		}
+	}
+	if lookup && cs.rep.providers != nil {
+		lctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		found, err := cs.rep.providers(lctx, root, 20)
+		cancel()
+		if err == nil {
+			n := 0
+			for _, p := range found {
+				if p != cs.rep.self {
+					n++
+				}
+			}
+			st.Providers = &n
+		}
+	}
+	st.Durability = replicaDurability(st.Held && cs.holdsAllChunks(root), st.Replicas, m)
+	return st
+}
+
+// replicaDurability estimates Durability from the confirmed replicas; self
+// says whether this node holds the whole set. The set is lost only once every
+// full copy is gone and fewer than K shard columns remain, so the worst case
+// is losing all full copies plus all but K-1 columns: one fewer than that
+// can go.
+func replicaDurability(self bool, replicas []ReplicaPeer, m *content.ChunkManifest) Durability {
+	var d Durability
+	full := 0
+	if self {
+		full++
+	}
+	columns := map[int]bool{}
+	for _, rp := range replicas {
+		if rp.State == replicaFailed {
+			continue
+		}
+		if rp.Column != nil {
+			columns[*rp.Column] = true
+		} else {
+			full++
+		}
+		d.Holders++
+	}
+	if self {
+		d.Holders++
+	}
+	lose := full
+	if m != nil && m.Erasure != nil {
+		lose += max(len(columns)-m.Erasure.K+1, 0)
+	}
+	d.Tolerates = max(lose-1, 0)
+	return d
+}
@@ -0,0 +1,168 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// TestReplicationStatusRecordsPlacement follows a set through replicate and
+// heal and checks what the status API reports about it.
+func TestReplicationStatusRecordsPlacement(t *testing.T) {
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	cs, err := NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	root, err := cs.Put(context.Background(), testsupport.TestBytes(4096))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	ids := testPeerIDs(5)
+	f := &fakeSwarm{peers: ids, provs: ids[:3], accepts: map[peer.ID]byte{ids[2]: pushHave}}
+	cs.rep = newFakeReplicator(f, ids[0], 2)
+
+	if placed := cs.rep.replicate(context.Background(), root); placed != 2 {
+		t.Fatalf("placed %d, want 2", placed)
+	}
+	st := cs.ReplicationStatus(context.Background(), root, true)
+	if !st.Held || !st.Pinned || st.Confirmed != 2 || len(st.Replicas) != 2 {
+		t.Fatalf("status after replicate: %+v", st)
+	}
+	states := map[string]string{}
+	for _, rp := range st.Replicas {
+		states[rp.Peer] = rp.State
+	}
+	if states[ids[1].String()] != replicaAccepted || states[ids[2].String()] != replicaHave {
+		t.Fatalf("replica states: %v", states)
+	}
+	if st.Providers == nil || *st.Providers != 2 {
+		t.Fatalf("providers %v, want 2 (self excluded)", st.Providers)
+	}
+	if st.Durability.Holders != 3 || st.Durability.Tolerates != 2 {
+		t.Fatalf("durability %+v, want 3 holders tolerating 2", st.Durability)
+	}
+	if st.LastHeal != nil {
+		t.Fatalf("heal result before any heal: %+v", st.LastHeal)
+	}
+
+	// Two providers plus self reach the target of 3: nothing to push.
+	if err := cs.rep.heal(context.Background(), root); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	h := cs.ReplicationStatus(context.Background(), root, false).LastHeal
+	if h == nil || h.Target != 3 || h.Holders != 3 || h.Pushed != 0 || h.Error != "" {
+		t.Fatalf("heal result: %+v", h)
+	}
+
+	// A failed heal is reported with its error.
+	cs.rep.providers = func(ctx context.Context, root string, max int) ([]peer.ID, error) {
+		return nil, errors.New("dht down")
+	}
+	cs.rep.heal(context.Background(), root)
+	st = cs.ReplicationStatus(context.Background(), root, true)
+	if st.LastHeal == nil || st.LastHeal.Error != "dht down" {
+		t.Fatalf("failed heal result: %+v", st.LastHeal)
+	}
+	if st.Providers != nil {
+		t.Fatalf("provider count reported from a failed lookup: %d", *st.Providers)
+	}
+
+	// Records of roots no longer held are pruned.
+	cs.rep.pruneStatus(nil)
+	if st := cs.ReplicationStatus(context.Background(), root, false); len(st.Replicas) != 0 || st.LastHeal != nil {
+		t.Fatalf("status after prune: %+v", st)
+	}
+}
+
+func TestReplicationStatusFailedChallenge(t *testing.T) {
+	ids := testPeerIDs(4)
+	f := &fakeSwarm{peers: ids, provs: ids[1:3]}
+	r := newFakeReplicator(f, ids[0], 2)
+	r.prove = func(ctx context.Context, p peer.ID, root string, column int) error {
+		if p == ids[2] {
+			return errProofFailed
+		}
+		return nil
+	}
+	if err := r.heal(context.Background(), "roothash"); err != nil {
+		t.Fatalf("heal: %v", err)
+	}
+	peers, heal := r.snapshot("roothash")
+	states := map[string]string{}
+	for _, rp := range peers {
+		states[rp.Peer] = rp.State
+	}
+	want := map[string]string{
+		ids[1].String(): replicaProven,
+		ids[2].String(): replicaFailed,
+		ids[3].String(): replicaAccepted, // pushed to replace the failed holder
+	}
+	if len(states) != len(want) {
+		t.Fatalf("states %v, want %v", states, want)
+	}
+	for p, s := range want {
+		if states[p] != s {
+			t.Fatalf("states %v, want %v", states, want)
+		}
+	}
+	if heal == nil || heal.Holders != 3 || heal.Pushed != 1 {
+		t.Fatalf("heal result: %+v", heal)
+	}
+}
+
+func TestReplicaDurability(t *testing.T) {
+	col := func(j int) *int { return &j }
+	full := []ReplicaPeer{{State: replicaAccepted}, {State: replicaFailed}, {State: replicaProven}}
+	if d := replicaDurability(true, full, nil); d.Holders != 3 || d.Tolerates != 2 {
+		t.Fatalf("full copies: %+v", d)
+	}
+	if d := replicaDurability(false, nil, nil); d.Holders != 0 || d.Tolerates != 0 {
+		t.Fatalf("no holders: %+v", d)
+	}
+
+	m := &content.ChunkManifest{Erasure: &content.Erasure{K: 2, M: 2}}
+	columns := []ReplicaPeer{
+		{State: replicaAccepted, Column: col(0)},
+		{State: replicaAccepted, Column: col(1)},
+		{State: replicaProven, Column: col(2)},
+		{State: replicaFailed, Column: col(3)},
+	}
+	// Three of four columns live, K=2: any one column may go, and with this
+	// node's full copy any two holders.
+	if d := replicaDurability(false, columns, m); d.Tolerates != 1 {
+		t.Fatalf("columns without self: %+v", d)
+	}
+	if d := replicaDurability(true, columns, m); d.Holders != 4 || d.Tolerates != 2 {
+		t.Fatalf("columns with self: %+v", d)
+	}
+	// Below K columns only this node's copy keeps the set alive.
+	if d := replicaDurability(true, columns[:1], m); d.Holders != 2 || d.Tolerates != 0 {
+		t.Fatalf("too few columns: %+v", d)
+	}
+}
+
+func TestHealOutcome(t *testing.T) {
+	cases := []struct {
+		res  HealResult
+		err  error
+		want string
+	}{
+		{HealResult{Target: 3, Holders: 3}, nil, "healthy"},
+		{HealResult{Target: 3, Holders: 3, Pushed: 1}, nil, "repaired"},
+		{HealResult{Target: 3, Holders: 2, Pushed: 1}, nil, "short"},
+		{HealResult{Target: 3, Holders: 1}, errors.New("no peers"), "error"},
+	}
+	for _, c := range cases {
+		if got := healOutcome(c.res, c.err); got != c.want {
+			t.Errorf("healOutcome(%+v, %v) = %q, want %q", c.res, c.err, got, c.want)
+		}
+	}
+}
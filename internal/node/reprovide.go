@@ -0,0 +1,342 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio/pbio"
+	mh "github.com/multiformats/go-multihash"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+)
+
+// This file keeps this node's provider records alive. A record expires after
+// a day or two, so everything worth finding is provided again every
+// provideInterval. Doing that one kadDHT.Provide at a time costs a full DHT
+// walk per key — a store of a thousand 1 GiB sets is over a hundred thousand
+// walks a cycle — so two things keep the cost down:
+//
+//   - The strategy (config.ContentReprovide) decides which keys get records.
+//     By default only set roots do, plus the first shard of each shard column
+//     held here, which is how healColumns and rebuildChunk find a column. A
+//     reader looks a chunk up under its root instead (see fetchBlobVia):
+//     whoever holds the root holds the chunks, and a v2 DONT_HAVE makes
+//     asking one that does not cheap.
+//   - The keys are swept in keyspace order: one walk finds the peers closest
+//     to a region of the keyspace, and every key in that region is handed to
+//     those same peers directly, without a walk of its own.
+
+// dhtProtocol is the DHT wire protocol's suffix to the protocol prefix, as
+// set up in NewNode (dht.ProtocolPrefix plus the kad suffix). The sweep
+// speaks it directly to send ADD_PROVIDER messages.
+const dhtProtocol = protocol.ID("/kad/1.0.0")
+
+// sweepConcurrency bounds the ADD_PROVIDER messages in flight during a sweep.
+const sweepConcurrency = 16
+
+// ReprovideStats reports the progress of the reprovide runs, for /info. Keys,
+// Provided and Failed count the current run, or the last one when none is
+// running. Lag is how far the records are behind schedule: how long ago the
+// next run was due to have finished, zero while on time.
+type ReprovideStats struct {
+	Strategy   string     `json:"strategy"`
+	Running    bool       `json:"running"`
+	Keys       int        `json:"keys"`
+	Provided   int        `json:"provided"`
+	Failed     int        `json:"failed"`
+	Walks      int        `json:"walks"` // DHT walks the run needed
+	LastStart  *time.Time `json:"lastStart,omitempty"`
+	LastEnd    *time.Time `json:"lastEnd,omitempty"`
+	LagSeconds int64      `json:"lagSeconds"`
+}
+
+// reprovider runs the reprovide sweeps and keeps their stats. The functions
+// are seams for tests; newReprovider wires them to the DHT.
+type reprovider struct {
+	strategy string
+	keys     func() ([]string, error)
+	closest  func(ctx context.Context, key string) ([]peer.ID, error)
+	put      func(ctx context.Context, p peer.ID, key mh.Multihash) error
+	local    func(ctx context.Context, c cid.Cid) // this node's own provider store
+	now      func() time.Time
+
+	mu    sync.Mutex
+	stats ReprovideStats
+	due   time.Time // when the next run should have finished
+}
+
+func (cs *ContentService) newReprovider(strategy string) *reprovider {
+	kadDHT := cs.node.kadDHT
+	pm, _ := dhtpb.NewProtocolMessenger(dhtSender{h: kadDHT.Host(), id: cs.protocol(dhtProtocol)})
+	return &reprovider{
+		strategy: strategy,
+		keys:     cs.reprovideKeys,
+		closest:  kadDHT.GetClosestPeers,
+		put: func(ctx context.Context, p peer.ID, key mh.Multihash) error {
+			pctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			h := kadDHT.Host()
+			return pm.PutProviderAddrs(pctx, p, key, peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+		},
+		local: func(ctx context.Context, c cid.Cid) { kadDHT.Provide(ctx, c, false) },
+		now:   time.Now,
+		// The first run starts after provideLoop's initial delay; until it
+		// has finished once, the records are due a cycle after startup.
+		due: time.Now().Add(provideInterval),
+	}
+}
+
+// reprovideKeys returns the hashes the configured strategy provides. Without
+// an index there is nothing to tell roots from chunks, so everything is.
+func (cs *ContentService) reprovideKeys() ([]string, error) {
+	if cs.reprovide == config.ReprovideAll || cs.index == nil {
+		return cs.store.List()
+	}
+	roots := cs.index.Roots()
+	keys := slices.Clone(roots)
+	for _, root := range roots {
+		keys = append(keys, cs.columnMarkers(root)...)
+	}
+	return keys, nil
+}
+
+// columnMarkers returns, for each shard column of root held here, the hash of
+// its first shard: the key column holders are looked up by.
+func (cs *ContentService) columnMarkers(root string) []string {
+	m := cs.erasureManifest(root)
+	if m == nil {
+		return nil
+	}
+	var markers []string
+	for j := range m.Erasure.Shards() {
+		held := true
+		for _, h := range m.Column(j) {
+			if !cs.store.Has(h) {
+				held = false
+				break
+			}
+		}
+		if held {
+			markers = append(markers, m.Shards[0][j])
+		}
+	}
+	return markers
+}
+
+// run provides every key of the strategy once, recording progress as it
+// goes.
+func (rp *reprovider) run(ctx context.Context) {
+	start := rp.now()
+	hashes, err := rp.keys()
+	if err != nil {
+		contentLog.Error("listing blobs to provide failed", "err", err)
+		return
+	}
+	var keys []mh.Multihash
+	bad := 0
+	for _, h := range hashes {
+		c, err := hashToCID(h)
+		if err != nil {
+			bad++
+			continue
+		}
+		keys = append(keys, c.Hash())
+		rp.local(ctx, c)
+	}
+
+	rp.mu.Lock()
+	rp.stats = ReprovideStats{
+		Strategy:  rp.strategy,
+		Running:   true,
+		Keys:      len(hashes),
+		Failed:    bad,
+		LastStart: &start,
+		LastEnd:   rp.stats.LastEnd,
+	}
+	rp.mu.Unlock()
+
+	walks := sweepProvide(ctx, keys, rp.closest, rp.put, func(ok bool) {
+		rp.mu.Lock()
+		if ok {
+			rp.stats.Provided++
+		} else {
+			rp.stats.Failed++
+		}
+		rp.mu.Unlock()
+	})
+
+	end := rp.now()
+	rp.mu.Lock()
+	rp.stats.Running = false
+	rp.stats.Walks = walks
+	rp.stats.LastEnd = &end
+	if ctx.Err() == nil {
+		rp.due = start.Add(provideInterval)
+	}
+	st := rp.stats
+	rp.mu.Unlock()
+	contentLog.Info("reprovided", "provided", st.Provided, "keys", st.Keys, "walks", walks, "took", end.Sub(start).Round(time.Second))
+}
+
+// snapshot returns the stats with the lag as of now.
+func (rp *reprovider) snapshot() ReprovideStats {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	st := rp.stats
+	st.Strategy = rp.strategy
+	if lag := rp.now().Sub(rp.due); lag > 0 {
+		st.LagSeconds = int64(lag / time.Second)
+	}
+	return st
+}
+
+// ReprovideStats reports the reprovide progress; false for a service with no
+// node (nothing is provided).
+func (cs *ContentService) ReprovideStats() (ReprovideStats, bool) {
+	if cs.reprov == nil {
+		return ReprovideStats{}, false
+	}
+	return cs.reprov.snapshot(), true
+}
+
+// sweepProvide stores a provider record for every key with the peers closest
+// to it, and returns how many DHT walks that took. done is called once per
+// key with whether any peer took the record.
+//
+// The keys are sorted by their position in the keyspace (the SHA-256 of the
+// multihash, as kbucket computes it) and walked in that order. A walk for the
+// first key of a region returns its closest peers; the farthest of them shares
+// cpl leading bits with the key. Every peer sharing more bits than that is in
+// the set, so for the keys that follow and share more than cpl bits with the
+// first one, the same set is (near enough) their closest peers as well: they
+// are sent straight to it. The next key outside the region starts a new walk.
+func sweepProvide(ctx context.Context, keys []mh.Multihash,
+	closest func(ctx context.Context, key string) ([]peer.ID, error),
+	put func(ctx context.Context, p peer.ID, key mh.Multihash) error,
+	done func(ok bool)) int {
+	type sweepKey struct {
+		mh  mh.Multihash
+		kad kb.ID
+	}
+	sorted := make([]sweepKey, len(keys))
+	for i, k := range keys {
+		sorted[i] = sweepKey{k, kb.ConvertKey(string(k))}
+	}
+	slices.SortFunc(sorted, func(a, b sweepKey) int { return bytes.Compare(a.kad, b.kad) })
+
+	walks := 0
+	for i := 0; i < len(sorted); {
+		if ctx.Err() != nil {
+			return walks
+		}
+		first := sorted[i]
+		peers, err := closest(ctx, string(first.mh))
+		walks++
+		if err != nil || len(peers) == 0 {
+			done(false)
+			i++
+			continue
+		}
+		cpl := kb.CommonPrefixLen(first.kad, kb.ConvertPeerID(peers[0]))
+		for _, p := range peers[1:] {
+			cpl = min(cpl, kb.CommonPrefixLen(first.kad, kb.ConvertPeerID(p)))
+		}
+		j := i + 1
+		for j < len(sorted) && kb.CommonPrefixLen(first.kad, sorted[j].kad) > cpl {
+			j++
+		}
+		region := make([]mh.Multihash, 0, j-i)
+		for _, k := range sorted[i:j] {
+			region = append(region, k.mh)
+		}
+		putRegion(ctx, region, peers, put, done)
+		i = j
+	}
+	return walks
+}
+
+// putRegion sends every key of a region to every one of its peers, at most
+// sweepConcurrency messages at a time.
+func putRegion(ctx context.Context, keys []mh.Multihash, peers []peer.ID,
+	put func(ctx context.Context, p peer.ID, key mh.Multihash) error, done func(ok bool)) {
+	taken := make([]atomic.Int32, len(keys))
+	sem := make(chan struct{}, sweepConcurrency)
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		for _, p := range peers {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				if put(ctx, p, k) == nil {
+					taken[i].Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	for i := range keys {
+		done(taken[i].Load() > 0)
+	}
+}
+
+// dhtSender is a dhtpb.MessageSender on a fresh stream per message. The DHT
+// keeps its own sender unexported; ADD_PROVIDER needs no reply, so a stream
+// that is written and closed is all the sweep needs.
+type dhtSender struct {
+	h  host.Host
+	id protocol.ID
+}
+
+// maxDHTMessage bounds a DHT reply, as the DHT itself does.
+const maxDHTMessage = 4 << 20
+
+func (s dhtSender) SendMessage(ctx context.Context, p peer.ID, msg *dhtpb.Message) error {
+	stream, err := s.h.NewStream(ctx, p, s.id)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(dl)
+	}
+	if err := pbio.NewDelimitedWriter(stream).WriteMsg(msg); err != nil {
+		stream.Reset()
+		return err
+	}
+	return nil
+}
+
+func (s dhtSender) SendRequest(ctx context.Context, p peer.ID, msg *dhtpb.Message) (*dhtpb.Message, error) {
+	stream, err := s.h.NewStream(ctx, p, s.id)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(dl)
+	}
+	if err := pbio.NewDelimitedWriter(stream).WriteMsg(msg); err != nil {
+		stream.Reset()
+		return nil, err
+	}
+	reply := new(dhtpb.Message)
+	if err := pbio.NewDelimitedReader(stream, maxDHTMessage).ReadMsg(reply); err != nil {
+		stream.Reset()
+		return nil, err
+	}
+	if reply.GetType() != msg.GetType() {
+		return nil, errors.New("dht reply of the wrong type")
+	}
+	return reply, nil
+}
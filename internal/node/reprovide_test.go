@@ -0,0 +1,215 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// kadSwarm is a fake DHT of n peers whose walks return the true k closest
+// peers to a key, and which records every provider record it is sent.
+type kadSwarm struct {
+	peers []peer.ID
+	k     int
+
+	mu      sync.Mutex
+	walks   int
+	records map[string][]peer.ID // multihash -> peers holding a record
+}
+
+func newKadSwarm(n, k int) *kadSwarm {
+	s := &kadSwarm{k: k, records: map[string][]peer.ID{}}
+	for i := range n {
+		s.peers = append(s.peers, peer.ID(fmt.Sprintf("peer-%d", i)))
+	}
+	return s
+}
+
+func (s *kadSwarm) trueClosest(key string) []peer.ID {
+	target := kb.ConvertKey(key)
+	peers := slices.Clone(s.peers)
+	slices.SortFunc(peers, func(a, b peer.ID) int {
+		return bytes.Compare(kb.Xor(kb.ConvertPeerID(a), target), kb.Xor(kb.ConvertPeerID(b), target))
+	})
+	return peers[:s.k]
+}
+
+func (s *kadSwarm) closest(ctx context.Context, key string) ([]peer.ID, error) {
+	s.mu.Lock()
+	s.walks++
+	s.mu.Unlock()
+	return s.trueClosest(key), nil
+}
+
+func (s *kadSwarm) put(ctx context.Context, p peer.ID, key mh.Multihash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[string(key)] = append(s.records[string(key)], p)
+	return nil
+}
+
+func testMultihashes(n int) []mh.Multihash {
+	keys := make([]mh.Multihash, n)
+	for i := range keys {
+		keys[i], _ = mh.Sum([]byte(fmt.Sprintf("blob %d", i)), mh.SHA2_256, -1)
+	}
+	return keys
+}
+
+// TestSweepProvideBatchesRegions sweeps many more keys than the swarm has
+// peers: one walk serves a whole region of the keyspace, and every key still
+// lands on most of its true closest peers.
+func TestSweepProvideBatchesRegions(t *testing.T) {
+	s := newKadSwarm(200, 20)
+	keys := testMultihashes(2000)
+	ok := 0
+	walks := sweepProvide(context.Background(), keys, s.closest, s.put, func(provided bool) {
+		if provided {
+			ok++
+		}
+	})
+	if ok != len(keys) {
+		t.Fatalf("%d of %d keys provided", ok, len(keys))
+	}
+	if walks != s.walks || walks > len(keys)/10 {
+		t.Fatalf("%d walks for %d keys, want a walk per region", walks, len(keys))
+	}
+	for _, k := range keys {
+		held := map[peer.ID]bool{}
+		for _, p := range s.records[string(k)] {
+			held[p] = true
+		}
+		hits := 0
+		for _, p := range s.trueClosest(string(k)) {
+			if held[p] {
+				hits++
+			}
+		}
+		if hits < s.k/2 {
+			t.Fatalf("key %s reached %d of its %d closest peers", k, hits, s.k)
+		}
+	}
+}
+
+func TestSweepProvideCountsFailures(t *testing.T) {
+	keys := testMultihashes(3)
+	var results []bool
+	walks := sweepProvide(context.Background(), keys,
+		func(ctx context.Context, key string) ([]peer.ID, error) { return nil, errors.New("no peers") },
+		func(ctx context.Context, p peer.ID, key mh.Multihash) error { return nil },
+		func(ok bool) { results = append(results, ok) })
+	if walks != 3 || !slices.Equal(results, []bool{false, false, false}) {
+		t.Fatalf("walks=%d results=%v, want every key walked and failed", walks, results)
+	}
+
+	// A key is provided when any one peer takes it.
+	s := newKadSwarm(5, 3)
+	results = nil
+	sweepProvide(context.Background(), keys[:1], s.closest,
+		func(ctx context.Context, p peer.ID, key mh.Multihash) error {
+			if p == s.peers[0] {
+				return nil
+			}
+			return errors.New("refused")
+		},
+		func(ok bool) { results = append(results, ok) })
+	want := slices.Contains(s.trueClosest(string(keys[0])), s.peers[0])
+	if len(results) != 1 || results[0] != want {
+		t.Fatalf("results %v, want [%v]", results, want)
+	}
+}
+
+// TestReprovideKeysStrategy checks which hashes each strategy provides: roots
+// and held shard columns by default, every blob under "all".
+func TestReprovideKeysStrategy(t *testing.T) {
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	cs, err := NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	small, err := cs.Put(context.Background(), []byte("a page"))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	root, _, m := putErasureCoded(t, cs)
+	for i := range m.Chunks {
+		shard, err := cs.columnBlob(context.Background(), m, i, 2)
+		if err != nil {
+			t.Fatalf("column: %v", err)
+		}
+		cs.store.Put(shard)
+	}
+
+	cs.reprovide = config.ReprovideRoots
+	keys, err := cs.reprovideKeys()
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	slices.Sort(keys)
+	want := []string{small, root, m.Shards[0][2]}
+	slices.Sort(want)
+	if !slices.Equal(keys, want) {
+		t.Fatalf("roots strategy keys %v, want %v", keys, want)
+	}
+
+	cs.reprovide = config.ReprovideAll
+	all, _ := cs.reprovideKeys()
+	stored, _ := cs.store.List()
+	if len(all) != len(stored) || len(all) <= len(keys) {
+		t.Fatalf("all strategy: %d keys, store holds %d blobs", len(all), len(stored))
+	}
+}
+
+func TestReprovideStats(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newKadSwarm(30, 5)
+	hashes := []string{"not a hash"}
+	for i := range 4 {
+		h, _ := content.ContentHash([]byte(fmt.Sprintf("blob %d", i)))
+		hashes = append(hashes, h)
+	}
+	var locals int
+	rp := &reprovider{
+		strategy: config.ReprovideRoots,
+		keys:     func() ([]string, error) { return hashes, nil },
+		closest:  s.closest,
+		put:      s.put,
+		local:    func(ctx context.Context, c cid.Cid) { locals++ },
+		now:      func() time.Time { return now },
+		due:      now.Add(provideInterval),
+	}
+	if st := rp.snapshot(); st.Strategy != "roots" || st.Keys != 0 || st.LagSeconds != 0 {
+		t.Fatalf("stats before a run: %+v", st)
+	}
+
+	rp.run(context.Background())
+	st := rp.snapshot()
+	if st.Running || st.Keys != 5 || st.Provided != 4 || st.Failed != 1 || st.LastEnd == nil || st.Walks == 0 {
+		t.Fatalf("stats after a run: %+v", st)
+	}
+	if locals != 4 {
+		t.Fatalf("%d local records, want 4", locals)
+	}
+
+	// The next run is due a provideInterval after this one started; past
+	// that, the lag grows.
+	now = now.Add(provideInterval + 90*time.Second)
+	if st := rp.snapshot(); st.LagSeconds != 90 {
+		t.Fatalf("lag %ds, want 90s", st.LagSeconds)
+	}
+}
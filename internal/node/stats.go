@@ -1,7 +1,6 @@
 package node
 
 import (
-	"log"
 	"time"
 )
 
@@ -12,23 +11,15 @@ func (freedomName *FreedomNameNode) statsLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			// Collect peer stats
-			hosts := freedomName.GetNetworkPeers()
-			peersConnected := len(hosts)
-			log.Printf("Stats: Number of host peers connected: %d", peersConnected)
-
-			// Collect bandwidth stats
+			// Collect peer and bandwidth stats. Per-protocol totals are on
+			// /metrics (see metrics.go).
 			bandwidth := freedomName.bandwidthCounter.GetBandwidthTotals()
-			log.Printf("Stats: Total bandwidth In: %v bytes/s", float64(bandwidth.RateIn))
-			log.Printf("Stats: Total bandwidth Out: %v bytes/s", float64(bandwidth.RateOut))
-
-			// freedomNameBw := freedomName.bandwidthCounter.GetBandwidthForProtocol("/freedomnames/1.0.0")
-			// log.Printf("Stats: Bandwidth In: %v bytes/s", float64(freedomNameBw.RateIn))
-			// log.Printf("Stats: Bandwidth Out: %v bytes/s", float64(freedomNameBw.RateOut))
-
-			// TODO: add bandwidth for other protocols if needed (eg. for pub-sub, relay, etc.)
+			nodeLog.Info("stats",
+				"peers", len(freedomName.GetNetworkPeers()),
+				"rateIn", bandwidth.RateIn,
+				"rateOut", bandwidth.RateOut)
 		case <-freedomName.ctx.Done():
-			log.Println("Stopping stats service.")
+			nodeLog.Info("stopping stats service")
 			return
 		}
 	}
@@ -0,0 +1,750 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+// This file implements version 2 of the content transfer protocol, a
+// want-list protocol in the spirit of Bitswap. Version 1 (contentProtocol) is
+// one request per stream answered by one whole blob under a fixed 20 second
+// deadline, which a 32 MiB blob on a slow link cannot meet, and a miss is only
+// told apart from an empty answer by a zero length. Version 2 keeps one
+// long-lived stream per peer (a session) and multiplexes on it:
+//
+//   - the client sends WANT frames naming a blob, each with its own request
+//     ID, either for the blob itself or only to ask whether the peer has it,
+//     and may CANCEL them; any number up to maxWantsInFlight may be
+//     outstanding at once;
+//   - the server answers every want with HAVE (and the blob's size) or
+//     DONT_HAVE, then streams the blobs wanted in DATA frames of at most
+//     64 KiB, round-robin across requests so one large blob does not hold up
+//     the small ones queued behind it;
+//   - the server never has more DATA bytes in flight than the client has
+//     granted in CREDIT frames (initialCredit to start with), so a slow
+//     reader pushes back on the sender instead of buffering without bound;
+//   - a WANT carries an offset, so a transfer cut off part way resumes on a
+//     new stream from the bytes already received.
+//
+// Instead of a deadline for the whole transfer, a session fails only when a
+// peer with wants outstanding sends nothing for wantIdleTimeout. The client
+// opens streams offering both protocol versions, and a peer that speaks only
+// version 1 is served over it on the same stream (fetchVia).
+//
+// Frames are a type byte, a uvarint body length and the body; receivers skip
+// frame types they do not know, so later versions can add some.
+
+// contentProtocolV2 is the libp2p stream protocol id for want-list transfer.
+const contentProtocolV2 = protocol.ID("/content/2.0.0")
+
+// Frame types.
+const (
+	frameWant     byte = 1 // client: id, mode, offset, hash
+	frameCancel   byte = 2 // client: id
+	frameCredit   byte = 3 // client: bytes
+	frameHave     byte = 4 // server: id, size
+	frameDontHave byte = 5 // server: id
+	frameData     byte = 6 // server: id, offset, bytes
+)
+
+// Want modes.
+const (
+	wantBlock byte = 0 // send the blob
+	wantHave  byte = 1 // only say whether it is held
+)
+
+const (
+	maxFrameData       = 64 << 10
+	maxFrameLen        = maxFrameData + 3*binary.MaxVarintLen64 + maxHashRequestLen
+	maxWantsInFlight   = 32
+	maxQueuedReplies   = 256 // HAVE/DONT_HAVE frames a server holds for a client not reading them
+	initialCredit      = 1 << 20
+	maxCredit          = 64 << 20
+	wantIdleTimeout    = 30 * time.Second
+	sessionIdleTimeout = time.Minute
+)
+
+var (
+	// errSessionClosed means the stream under a session broke or was closed;
+	// wants that were outstanding on it may be retried on a new one.
+	errSessionClosed = errors.New("content session closed")
+	errBadFrame      = errors.New("malformed content frame")
+)
+
+// --- framing ---
+
+func writeFrame(w io.Writer, typ byte, body []byte) error {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(body))
+	buf = append(buf, typ)
+	buf = binary.AppendUvarint(buf, uint64(len(body)))
+	buf = append(buf, body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n > maxFrameLen {
+		return 0, nil, fmt.Errorf("%w: %d-byte frame", errBadFrame, n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+// takeUvarint decodes a uvarint from the front of b.
+func takeUvarint(b []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, errBadFrame
+	}
+	return v, b[n:], nil
+}
+
+// takeUvarints decodes len(dst) uvarints from the front of b.
+func takeUvarints(b []byte, dst ...*uint64) ([]byte, error) {
+	var err error
+	for _, d := range dst {
+		if *d, b, err = takeUvarint(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func wantFrame(id uint64, mode byte, off int64, hash string) []byte {
+	b := binary.AppendUvarint(nil, id)
+	b = append(b, mode)
+	b = binary.AppendUvarint(b, uint64(off))
+	return append(b, hash...)
+}
+
+// --- serving ---
+
+// wantServer serves one inbound v2 stream. A reader goroutine takes wants,
+// cancels and credit off the stream; the writer (handleWantStream's own
+// goroutine) sends the replies and interleaves the DATA of every blob being
+// served.
+type wantServer struct {
+	cs     *ContentService
+	stream network.Stream
+	w      io.Writer
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	replies [][]byte // HAVE/DONT_HAVE frames, sent before any more DATA; see maxQueuedReplies
+	active  []*servedBlob
+	credit  int64
+	eof     bool // the client has sent its last frame
+	failed  bool
+}
+
+// servedBlob is one blob being streamed. busy marks it as being read by the
+// writer outside the lock, so a cancel leaves closing it to the writer.
+type servedBlob struct {
+	id        uint64
+	rc        io.ReadCloser
+	off, left int64
+	busy      bool
+	cancelled bool
+}
+
+func (cs *ContentService) handleWantStream(stream network.Stream) {
+	s := &wantServer{cs: cs, stream: stream, w: content.LimitWriter(stream, cs.upLimit), credit: initialCredit}
+	s.cond = sync.NewCond(&s.mu)
+	go s.readLoop()
+	s.writeLoop()
+
+	s.mu.Lock()
+	for _, b := range s.active {
+		if !b.busy {
+			b.rc.Close()
+		}
+	}
+	s.active = nil
+	failed := s.failed
+	s.mu.Unlock()
+	if failed {
+		stream.Reset()
+	} else {
+		stream.Close()
+	}
+}
+
+// readLoop takes frames off the stream until it ends. While maxQueuedReplies
+// replies wait to be sent it stops reading: a client that sends wants without
+// reading the answers is held back by the stream's flow control, and its
+// session fails once a reply write times out, rather than queueing answers
+// without bound.
+func (s *wantServer) readLoop() {
+	br := bufio.NewReader(s.stream)
+	for {
+		s.mu.Lock()
+		for len(s.replies) >= maxQueuedReplies && !s.failed {
+			s.cond.Wait()
+		}
+		failed := s.failed
+		s.mu.Unlock()
+		if failed {
+			return
+		}
+		s.stream.SetReadDeadline(time.Now().Add(sessionIdleTimeout))
+		typ, body, err := readFrame(br)
+		if err == nil {
+			err = s.handle(typ, body)
+		}
+		if err != nil {
+			s.mu.Lock()
+			if errors.Is(err, io.EOF) {
+				s.eof = true
+			} else {
+				s.failed = true
+			}
+			s.cond.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// handle applies one client frame. An error is a protocol violation and ends
+// the session.
+func (s *wantServer) handle(typ byte, body []byte) error {
+	switch typ {
+	case frameWant:
+		var id, off uint64
+		rest, err := takeUvarints(body, &id)
+		if err != nil || len(rest) == 0 {
+			return errBadFrame
+		}
+		mode := rest[0]
+		if rest, err = takeUvarints(rest[1:], &off); err != nil {
+			return err
+		}
+		hash := string(rest)
+		if !content.IsContentHash(hash) || (mode != wantBlock && mode != wantHave) {
+			return errBadFrame
+		}
+		return s.want(id, mode, int64(off), hash)
+	case frameCancel:
+		id, _, err := takeUvarint(body)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		for i, b := range s.active {
+			if b.id == id {
+				s.active = append(s.active[:i], s.active[i+1:]...)
+				b.cancelled = true
+				if !b.busy {
+					b.rc.Close()
+				}
+				break
+			}
+		}
+		s.mu.Unlock()
+	case frameCredit:
+		n, _, err := takeUvarint(body)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.credit = min(s.credit+int64(min(n, maxCredit)), maxCredit)
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *wantServer) want(id uint64, mode byte, off int64, hash string) error {
+	s.mu.Lock()
+	busy := len(s.active)
+	s.mu.Unlock()
+	if busy >= maxWantsInFlight {
+		return fmt.Errorf("%w: more than %d blobs wanted at once", errBadFrame, maxWantsInFlight)
+	}
+	rc, size, err := s.cs.store.Open(hash)
+	if err != nil {
+		s.reply(frameDontHave, binary.AppendUvarint(nil, id), nil)
+		return nil
+	}
+	have := binary.AppendUvarint(binary.AppendUvarint(nil, id), uint64(size))
+	if mode == wantHave || off == size {
+		rc.Close()
+		s.reply(frameHave, have, nil)
+		return nil
+	}
+	if off > size {
+		rc.Close()
+		return fmt.Errorf("%w: offset %d past the %d-byte blob", errBadFrame, off, size)
+	}
+	if off > 0 {
+		seeker, ok := rc.(io.Seeker)
+		if !ok {
+			rc.Close()
+			s.reply(frameDontHave, binary.AppendUvarint(nil, id), nil)
+			return nil
+		}
+		if _, err := seeker.Seek(off, io.SeekStart); err != nil {
+			rc.Close()
+			s.reply(frameDontHave, binary.AppendUvarint(nil, id), nil)
+			return nil
+		}
+	}
+	s.cs.index.TouchBlob(hash) // being served keeps the set alive (TTL)
+	s.reply(frameHave, have, &servedBlob{id: id, rc: rc, off: off, left: size - off})
+	return nil
+}
+
+// reply queues a HAVE/DONT_HAVE frame and, with b, starts serving its DATA
+// after it.
+func (s *wantServer) reply(typ byte, body []byte, b *servedBlob) {
+	frame := append([]byte{typ}, binary.AppendUvarint(nil, uint64(len(body)))...)
+	s.mu.Lock()
+	s.replies = append(s.replies, append(frame, body...))
+	if b != nil {
+		s.active = append(s.active, b)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *wantServer) writeLoop() {
+	buf := make([]byte, maxFrameData)
+	for {
+		s.mu.Lock()
+		for !s.failed && len(s.replies) == 0 && (len(s.active) == 0 || s.credit == 0) && !(s.eof && len(s.active) == 0) {
+			s.cond.Wait()
+		}
+		if s.failed || (s.eof && len(s.active) == 0 && len(s.replies) == 0) {
+			s.mu.Unlock()
+			return
+		}
+		if len(s.replies) > 0 {
+			frame := s.replies[0]
+			s.replies = s.replies[1:]
+			s.cond.Broadcast() // room for readLoop
+			s.mu.Unlock()
+			if !s.write(frame) {
+				return
+			}
+			continue
+		}
+		// Take the blob at the head and move it to the back: round-robin.
+		b := s.active[0]
+		s.active = append(s.active[1:], b)
+		n := min(int64(len(buf)), s.credit, b.left)
+		s.credit -= n
+		b.busy = true
+		s.mu.Unlock()
+
+		_, err := io.ReadFull(b.rc, buf[:n])
+		var frame []byte
+		if err == nil {
+			body := binary.AppendUvarint(binary.AppendUvarint(nil, b.id), uint64(b.off))
+			frame = append([]byte{frameData}, binary.AppendUvarint(nil, uint64(len(body))+uint64(n))...)
+			frame = append(append(frame, body...), buf[:n]...)
+		}
+
+		s.mu.Lock()
+		b.busy = false
+		b.off += n
+		b.left -= n
+		finished := err != nil || b.left == 0 || b.cancelled
+		if finished {
+			for i, a := range s.active {
+				if a == b {
+					s.active = append(s.active[:i], s.active[i+1:]...)
+					break
+				}
+			}
+		}
+		cancelled := b.cancelled
+		s.mu.Unlock()
+		if finished {
+			b.rc.Close()
+		}
+		switch {
+		case cancelled:
+		case err != nil:
+			// The blob went away (or the disk failed) mid-transfer.
+			s.reply(frameDontHave, binary.AppendUvarint(nil, b.id), nil)
+		case !s.write(frame):
+			return
+		}
+	}
+}
+
+func (s *wantServer) write(frame []byte) bool {
+	s.stream.SetWriteDeadline(time.Now().Add(wantIdleTimeout))
+	if _, err := s.w.Write(frame); err != nil {
+		s.mu.Lock()
+		s.failed = true
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// --- fetching ---
+
+// wantSession is the client side of one v2 stream, shared by every fetch
+// from that peer.
+type wantSession struct {
+	stream  network.Stream
+	writeMu sync.Mutex
+	slots   chan struct{} // one per want in flight
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*wantReq
+	err     error // set once the session has failed; every later want fails with it
+	idle    *time.Timer
+	onClose func()
+}
+
+// wantReq is one outstanding want. data holds the bytes received so far,
+// starting at off.
+type wantReq struct {
+	mode byte
+	off  int64
+	size int64 // -1 until HAVE
+	data []byte
+	done chan struct{}
+	err  error
+}
+
+// newWantSession runs a session on stream, reading the server's frames from r
+// (the stream, rate-limited). onClose is called once when it ends.
+func newWantSession(stream network.Stream, r io.Reader, onClose func()) *wantSession {
+	s := &wantSession{
+		stream:  stream,
+		slots:   make(chan struct{}, maxWantsInFlight),
+		pending: map[uint64]*wantReq{},
+		onClose: onClose,
+	}
+	s.mu.Lock()
+	s.idle = time.AfterFunc(sessionIdleTimeout, s.closeIfIdle)
+	s.mu.Unlock()
+	go s.readLoop(r)
+	return s
+}
+
+// alive reports whether the session can still take wants.
+func (s *wantSession) alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err == nil
+}
+
+// want asks for hash starting at byte off and waits for the answer: the bytes
+// from off to the end of the blob, or with mode wantHave nothing. A blob the
+// peer does not hold is content.ErrBlobNotFound. If the session fails part
+// way, the bytes received so far are returned with an errSessionClosed error.
+func (s *wantSession) want(ctx context.Context, hash string, off int64, mode byte) ([]byte, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	id := s.nextID
+	s.nextID++
+	req := &wantReq{mode: mode, off: off, size: -1, done: make(chan struct{})}
+	s.pending[id] = req
+	s.idle.Stop()
+	s.stream.SetReadDeadline(time.Now().Add(wantIdleTimeout))
+	s.mu.Unlock()
+
+	if err := s.send(frameWant, wantFrame(id, mode, off, hash)); err != nil {
+		s.fail(err)
+	}
+	select {
+	case <-req.done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		_, waiting := s.pending[id]
+		s.finishLocked(id, ctx.Err())
+		s.mu.Unlock()
+		if waiting {
+			s.send(frameCancel, binary.AppendUvarint(nil, id))
+		}
+		<-req.done
+	}
+	return req.data, req.err
+}
+
+func (s *wantSession) send(typ byte, body []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.stream.SetWriteDeadline(time.Now().Add(wantIdleTimeout))
+	return writeFrame(s.stream, typ, body)
+}
+
+// finishLocked completes want id with err (nil for success).
+func (s *wantSession) finishLocked(id uint64, err error) {
+	req := s.pending[id]
+	if req == nil {
+		return
+	}
+	delete(s.pending, id)
+	req.err = err
+	close(req.done)
+	if len(s.pending) == 0 && s.err == nil {
+		s.stream.SetReadDeadline(time.Time{})
+		s.idle.Reset(sessionIdleTimeout)
+	}
+}
+
+func (s *wantSession) readLoop(r io.Reader) {
+	br := bufio.NewReader(r)
+	for {
+		typ, body, err := readFrame(br)
+		var credit int
+		if err == nil {
+			credit, err = s.handle(typ, body)
+		}
+		if err == nil && credit > 0 {
+			// The server spent credit on these bytes whether or not they
+			// were still wanted, so it gets it back either way.
+			err = s.send(frameCredit, binary.AppendUvarint(nil, uint64(credit)))
+		}
+		if err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// handle applies one server frame, returning the DATA bytes it carried (the
+// credit to grant back). Answers to wants already finished (a cancel crossing
+// the reply) are dropped.
+func (s *wantSession) handle(typ byte, body []byte) (int, error) {
+	var id uint64
+	rest, err := takeUvarints(body, &id)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := s.pending[id]
+	credit := 0
+	switch typ {
+	case frameHave:
+		var size uint64
+		if _, err := takeUvarints(rest, &size); err != nil {
+			return 0, err
+		}
+		if req == nil {
+			return 0, nil
+		}
+		if size > content.MaxBlobSize || int64(size) < req.off {
+			return 0, fmt.Errorf("%w: %d-byte blob wanted from offset %d", errBadFrame, size, req.off)
+		}
+		req.size = int64(size)
+		if req.mode == wantHave || req.size == req.off {
+			s.finishLocked(id, nil)
+		} else {
+			req.data = make([]byte, 0, req.size-req.off)
+		}
+	case frameDontHave:
+		s.finishLocked(id, content.ErrBlobNotFound)
+	case frameData:
+		var off uint64
+		if rest, err = takeUvarints(rest, &off); err != nil {
+			return 0, err
+		}
+		if req == nil {
+			return len(rest), nil
+		}
+		if req.size < 0 || int64(off) != req.off+int64(len(req.data)) || int64(off)+int64(len(rest)) > req.size {
+			return 0, fmt.Errorf("%w: unexpected data at offset %d", errBadFrame, off)
+		}
+		req.data = append(req.data, rest...)
+		if req.off+int64(len(req.data)) == req.size {
+			s.finishLocked(id, nil)
+		}
+		credit = len(rest)
+	}
+	if len(s.pending) > 0 {
+		s.stream.SetReadDeadline(time.Now().Add(wantIdleTimeout))
+	}
+	return credit, nil
+}
+
+// fail ends the session, failing every outstanding want with errSessionClosed.
+func (s *wantSession) fail(cause error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = fmt.Errorf("%w: %v", errSessionClosed, cause)
+	for id := range s.pending {
+		s.finishLocked(id, s.err)
+	}
+	s.idle.Stop()
+	s.mu.Unlock()
+	s.stream.Reset()
+	s.onClose()
+}
+
+func (s *wantSession) closeIfIdle() {
+	s.mu.Lock()
+	idle := len(s.pending) == 0
+	s.mu.Unlock()
+	if idle {
+		s.fail(errors.New("idle"))
+	}
+}
+
+// session returns the open v2 session to p, or opens a stream offering both
+// protocol versions. A peer that only speaks version 1 gets the stream back
+// as v1 instead, for a single request.
+func (cs *ContentService) session(ctx context.Context, h host.Host, p peer.ID) (*wantSession, network.Stream, error) {
+	cs.sessionMu.Lock()
+	if s := cs.sessions[p]; s != nil && s.alive() {
+		cs.sessionMu.Unlock()
+		return s, nil, nil
+	}
+	cs.sessionMu.Unlock()
+
+	streamCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	v2 := cs.protocol(contentProtocolV2)
+	stream, err := h.NewStream(streamCtx, p, v2, cs.protocol(contentProtocol))
+	if err != nil {
+		return nil, nil, fmt.Errorf("open stream to %s: %w", p, err)
+	}
+	if stream.Protocol() != v2 {
+		return nil, stream, nil
+	}
+	// The session is registered before it starts, so that when it ends it
+	// finds itself in the table to remove. Another fetch may have opened one
+	// while this stream was being negotiated: the first to register wins.
+	cs.sessionMu.Lock()
+	defer cs.sessionMu.Unlock()
+	if s := cs.sessions[p]; s != nil && s.alive() {
+		stream.Close()
+		return s, nil, nil
+	}
+	if cs.sessions == nil {
+		cs.sessions = map[peer.ID]*wantSession{}
+	}
+	var s *wantSession
+	s = newWantSession(stream, content.LimitReader(stream, cs.downLimit), func() {
+		cs.sessionMu.Lock()
+		if cs.sessions[p] == s {
+			delete(cs.sessions, p)
+		}
+		cs.sessionMu.Unlock()
+	})
+	cs.sessions[p] = s
+	return s, nil, nil
+}
+
+// fetchVia fetches one blob from p over host h and verifies it against hash.
+// On a v2 session a transfer cut off part way is resumed on a new stream
+// from the bytes already received, a few times before giving up.
+func (cs *ContentService) fetchVia(ctx context.Context, h host.Host, p peer.ID, hash string) ([]byte, error) {
+	var data []byte
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		s, v1, serr := cs.session(ctx, h, p)
+		if serr != nil {
+			return nil, serr
+		}
+		if v1 != nil {
+			data, err = fetchOnStream(v1, hash, cs.downLimit)
+			break
+		}
+		var got []byte
+		got, err = s.want(ctx, hash, int64(len(data)), wantBlock)
+		data = append(data, got...)
+		if err == nil || !errors.Is(err, errSessionClosed) || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	got, err := content.ContentHash(data)
+	if err != nil {
+		return nil, err
+	}
+	if got != hash {
+		return nil, fmt.Errorf("provider served wrong content (asked %s, got %s)", hash, got)
+	}
+	return data, nil
+}
+
+// fetchFromSessions asks every peer this node already has a session with
+// whether it holds hash, and fetches the blob from the first that does. It
+// finds blobs among connected peers without a DHT walk, as Bitswap does.
+func (cs *ContentService) fetchFromSessions(ctx context.Context, h host.Host, hash string) ([]byte, peer.ID, bool) {
+	cs.sessionMu.Lock()
+	peers := make([]peer.ID, 0, len(cs.sessions))
+	for p := range cs.sessions {
+		peers = append(peers, p)
+	}
+	cs.sessionMu.Unlock()
+	if len(peers) == 0 {
+		return nil, "", false
+	}
+
+	askCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	has := make(chan peer.ID, len(peers))
+	for _, p := range peers {
+		go func() {
+			cs.sessionMu.Lock()
+			s := cs.sessions[p]
+			cs.sessionMu.Unlock()
+			if s != nil {
+				if _, err := s.want(askCtx, hash, 0, wantHave); err == nil {
+					has <- p
+					return
+				}
+			}
+			has <- ""
+		}()
+	}
+	for range peers {
+		p := <-has
+		if p == "" {
+			continue
+		}
+		if data, err := cs.fetchVia(ctx, h, p, hash); err == nil {
+			return data, p, true
+		}
+	}
+	return nil, "", false
+}
@@ -0,0 +1,303 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func TestWantFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, frameWant, wantFrame(7, wantHave, 1234, "somehash")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	typ, body, err := readFrame(bufio.NewReader(&buf))
+	if err != nil || typ != frameWant {
+		t.Fatalf("read: %d %v", typ, err)
+	}
+	var id, off uint64
+	rest, err := takeUvarints(body, &id)
+	if err != nil || id != 7 || rest[0] != wantHave {
+		t.Fatalf("id/mode: %d %v", id, err)
+	}
+	if rest, err = takeUvarints(rest[1:], &off); err != nil || off != 1234 || string(rest) != "somehash" {
+		t.Fatalf("offset/hash: %d %q %v", off, rest, err)
+	}
+
+	// An oversized frame is refused before its body is read.
+	var big bytes.Buffer
+	big.WriteByte(frameData)
+	big.Write(binary.AppendUvarint(nil, maxFrameLen+1))
+	if _, _, err := readFrame(bufio.NewReader(&big)); !errors.Is(err, errBadFrame) {
+		t.Fatalf("oversized frame: %v", err)
+	}
+}
+
+// wantPeers returns a server holding blobs and a client connected to it. With
+// v1Only the server registers only the version 1 handler, like an older node.
+func wantPeers(t *testing.T, v1Only bool) (server, client *pushTestPeer) {
+	t.Helper()
+	server = newPushTestPeer(t, 1<<30)
+	client = newPushTestPeer(t, 1<<30)
+	server.host.SetStreamHandler(defaultPrefix.id(contentProtocol), server.cs.handleStream)
+	if !v1Only {
+		server.host.SetStreamHandler(defaultPrefix.id(contentProtocolV2), server.cs.handleWantStream)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: server.host.ID(), Addrs: server.host.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return server, client
+}
+
+func putBlob(t *testing.T, cs *ContentService, data []byte) string {
+	t.Helper()
+	hash, err := cs.store.Put(data)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	return hash
+}
+
+// TestWantSessionFetchesConcurrently fetches several blobs at once over one
+// session, including one larger than the initial credit, and a missing one.
+func TestWantSessionFetchesConcurrently(t *testing.T) {
+	server, client := wantPeers(t, false)
+	blobs := [][]byte{[]byte("small page"), testsupport.TestBytes(3 << 20), testsupport.TestBytes(200 << 10)}
+	var hashes []string
+	for _, b := range blobs {
+		hashes = append(hashes, putBlob(t, server.cs, b))
+	}
+	missing, _ := content.ContentHash([]byte("not held"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(blobs))
+	for i := range blobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := client.cs.fetchVia(ctx, client.host, server.host.ID(), hashes[i])
+			if err == nil && !bytes.Equal(got, blobs[i]) {
+				err = errors.New("wrong bytes")
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("blob %d: %v", i, err)
+		}
+	}
+	if _, err := client.cs.fetchVia(ctx, client.host, server.host.ID(), missing); !errors.Is(err, content.ErrBlobNotFound) {
+		t.Fatalf("missing blob: %v, want ErrBlobNotFound", err)
+	}
+	if n := len(client.cs.sessions); n != 1 {
+		t.Fatalf("%d sessions, want every fetch on one", n)
+	}
+
+	// The open session also answers want-have, without a DHT walk.
+	got, from, ok := client.cs.fetchFromSessions(ctx, client.host, hashes[0])
+	if !ok || from != server.host.ID() || !bytes.Equal(got, blobs[0]) {
+		t.Fatalf("fetch from sessions: ok=%v from=%s", ok, from)
+	}
+	if _, _, ok := client.cs.fetchFromSessions(ctx, client.host, missing); ok {
+		t.Fatalf("fetch from sessions found a missing blob")
+	}
+}
+
+// TestWantSessionOpenedOnce has many fetches ask for a session to the same
+// peer at once: they all get the same one.
+func TestWantSessionOpenedOnce(t *testing.T) {
+	server, client := wantPeers(t, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// More than one P lets the fetches overlap even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	sessions := make([]*wantSession, 16)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			sessions[i], _, _ = client.cs.session(ctx, client.host, server.host.ID())
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for i, s := range sessions {
+		if s == nil || s != sessions[0] {
+			t.Fatalf("fetch %d got session %p, fetch 0 %p", i, s, sessions[0])
+		}
+	}
+}
+
+func TestWantFallsBackToV1(t *testing.T) {
+	server, client := wantPeers(t, true)
+	data := []byte("served the old way")
+	hash := putBlob(t, server.cs, data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := client.cs.fetchVia(ctx, client.host, server.host.ID(), hash)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("v1 fetch: %v", err)
+	}
+	if len(client.cs.sessions) != 0 {
+		t.Fatalf("session kept for a v1 peer")
+	}
+}
+
+func TestWantFromOffset(t *testing.T) {
+	server, client := wantPeers(t, false)
+	data := testsupport.TestBytes(300 << 10)
+	hash := putBlob(t, server.cs, data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, _, err := client.cs.session(ctx, client.host, server.host.ID())
+	if err != nil || s == nil {
+		t.Fatalf("session: %v", err)
+	}
+	got, err := s.want(ctx, hash, 100_000, wantBlock)
+	if err != nil || !bytes.Equal(got, data[100_000:]) {
+		t.Fatalf("want from offset: %d bytes, %v", len(got), err)
+	}
+	if got, err := s.want(ctx, hash, 0, wantHave); err != nil || got != nil {
+		t.Fatalf("want-have of a held blob: %d bytes, %v", len(got), err)
+	}
+}
+
+// TestWantResumesBrokenTransfer cuts the first stream off after one DATA
+// frame; the fetch resumes on a new stream from where it stopped.
+func TestWantResumesBrokenTransfer(t *testing.T) {
+	server, client := wantPeers(t, false)
+	data := testsupport.TestBytes(500 << 10)
+	hash := putBlob(t, server.cs, data)
+
+	var streams atomic.Int32
+	server.host.SetStreamHandler(defaultPrefix.id(contentProtocolV2), func(stream network.Stream) {
+		if streams.Add(1) > 1 {
+			server.cs.handleWantStream(stream)
+			return
+		}
+		br := bufio.NewReader(stream)
+		if _, _, err := readFrame(br); err != nil {
+			stream.Reset()
+			return
+		}
+		writeFrame(stream, frameHave, binary.AppendUvarint(binary.AppendUvarint(nil, 0), uint64(len(data))))
+		body := binary.AppendUvarint(binary.AppendUvarint(nil, 0), 0)
+		writeFrame(stream, frameData, append(body, data[:maxFrameData]...))
+		time.Sleep(50 * time.Millisecond)
+		stream.Reset()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := client.cs.fetchVia(ctx, client.host, server.host.ID(), hash)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("resumed fetch: %v", err)
+	}
+	if n := streams.Load(); n != 2 {
+		t.Fatalf("%d streams, want 2", n)
+	}
+}
+
+// TestWantCreditBackpressure checks the server stops after the initial credit
+// until the client grants more.
+func TestWantCreditBackpressure(t *testing.T) {
+	server, client := wantPeers(t, false)
+	data := testsupport.TestBytes(3 << 20)
+	hash := putBlob(t, server.cs, data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.host.NewStream(ctx, server.host.ID(), defaultPrefix.id(contentProtocolV2))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Reset()
+	if err := writeFrame(stream, frameWant, wantFrame(1, wantBlock, 0, hash)); err != nil {
+		t.Fatalf("want: %v", err)
+	}
+	br := bufio.NewReader(stream)
+	received := 0
+	readUntil := func(limit int) {
+		t.Helper()
+		for received < limit {
+			stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+			typ, body, err := readFrame(br)
+			if err != nil {
+				t.Fatalf("read after %d bytes: %v", received, err)
+			}
+			if typ == frameData {
+				rest, _ := takeUvarints(body, new(uint64), new(uint64))
+				received += len(rest)
+			}
+		}
+	}
+	readUntil(initialCredit)
+	if received != initialCredit {
+		t.Fatalf("received %d bytes, want exactly the initial credit", received)
+	}
+	stream.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, _, err := readFrame(br); err == nil {
+		t.Fatalf("server sent past its credit")
+	}
+
+	// Granting credit lets the rest through.
+	if err := writeFrame(stream, frameCredit, binary.AppendUvarint(nil, uint64(len(data)))); err != nil {
+		t.Fatalf("credit: %v", err)
+	}
+	readUntil(len(data))
+}
+
+// TestWantServerStopsReadingUnreadReplies floods want-have frames without
+// reading a reply: the server must stop taking frames once its reply queue is
+// full, so the client's writes stall instead of the server's memory growing.
+func TestWantServerStopsReadingUnreadReplies(t *testing.T) {
+	server, client := wantPeers(t, false)
+	hash := putBlob(t, server.cs, []byte("asked about over and over"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.host.NewStream(ctx, server.host.ID(), defaultPrefix.id(contentProtocolV2))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Reset()
+
+	const batch, limit = 1000, 1 << 20
+	var buf bytes.Buffer
+	for sent := 0; sent < limit; sent += batch {
+		buf.Reset()
+		for i := range batch {
+			writeFrame(&buf, frameWant, wantFrame(uint64(sent+i), wantHave, 0, hash))
+		}
+		stream.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := stream.Write(buf.Bytes()); err != nil {
+			t.Logf("writes stalled after %d wants: %v", sent, err)
+			return
+		}
+	}
+	t.Fatalf("server took %d wants whose replies were never read", limit)
+}
@@ -26,7 +26,10 @@ const (
 	// RecordTypeCONTENT points a name at content: its value is a base36
 	// sha2-256 multihash of a blob served over the content network. This is
 	// how a name maps to a page's bytes (the decentralized-web equivalent of
-	// an IPFS dnslink), resolved via GET /resolve-content.
+	// an IPFS dnslink), resolved via GET /resolve-content. The value may also
+	// be a read capability ("<hash>:<key>", see content.FormatReadCap) for
+	// encrypted content; publishing one makes the content readable by anyone
+	// who resolves the name, while replicas still hold only ciphertext.
 	RecordTypeCONTENT = "CONTENT"
 )
 
@@ -184,8 +187,8 @@ func (r *FNRecord) ValidateRecords() error {
 				return fmt.Errorf("CNAME target is %d bytes, max %d", len(rr.Value), maxDNSNameLen)
 			}
 		case RecordTypeCONTENT:
-			if !content.IsContentHash(rr.Value) {
-				return fmt.Errorf("CONTENT record value %q is not a valid content hash", rr.Value)
+			if !content.IsContentRef(rr.Value) {
+				return fmt.Errorf("CONTENT record value %q is not a valid content hash or read capability", rr.Value)
 			}
 		case RecordTypeTXT:
 			// Any UTF-8 string, up to the DNS character-string limit: a longer
@@ -36,6 +36,18 @@ func TestContentRecordValidation(t *testing.T) {
 	if err := bad.ValidateRecords(); err == nil {
 		t.Fatal("expected CONTENT record with invalid hash to be rejected")
 	}
+
+	// A read capability for encrypted content is a valid CONTENT value too,
+	// but a malformed key part is not.
+	key, _ := content.NewContentKey()
+	capRec := &FNRecord{Label: "mysite", Records: []RR{{Type: RecordTypeCONTENT, Value: content.FormatReadCap(goodHash, key), TTL: 300}}}
+	if err := capRec.ValidateRecords(); err != nil {
+		t.Fatalf("CONTENT record with a read capability rejected: %v", err)
+	}
+	capRec.Records[0].Value = goodHash + ":not-a-key"
+	if err := capRec.ValidateRecords(); err == nil {
+		t.Fatal("expected CONTENT record with a malformed capability to be rejected")
+	}
 }
 
 func TestSignVerifyRoundTrip(t *testing.T) {
@@ -5,6 +5,7 @@
 package registry
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -29,6 +30,49 @@ type NameRegistry interface {
 	ResolveOwner(name string) (pubKey []byte, err error)
 }
 
+// OwnerProof is the chain evidence behind a bare name's owner, in the raw
+// transaction bytes the registry read, so a client that does not trust the
+// node answering can redo the registry's checks itself:
+//
+//   - Claim is the FN01 claim that minted the name NFT,
+//   - Custody is every transaction that moved the NFT since, in order, each
+//     spending the NFT output of the one before,
+//   - Binding is the FN01/FN02 transaction revealing the owner pubkey whose
+//     hash160 is the NFT's current commitment.
+//
+// Each transaction comes with an Inclusion showing the block it was mined in
+// (ClaimBlock, CustodyBlocks in the order of Custody, BindingBlock), which a
+// client checks against a header chain of its own. What no proof can show is
+// that the claim is the earliest one for the name, or that the last NFT output
+// is still unspent: for those the client relies on the chain server it reads
+// headers from not withholding transactions.
+type OwnerProof struct {
+	Claim         []byte       `json:"claim"`
+	Custody       [][]byte     `json:"custody,omitempty"`
+	Binding       []byte       `json:"binding"`
+	ClaimBlock    *Inclusion   `json:"claimBlock,omitempty"`
+	CustodyBlocks []*Inclusion `json:"custodyBlocks,omitempty"`
+	BindingBlock  *Inclusion   `json:"bindingBlock,omitempty"`
+}
+
+// Inclusion shows a transaction is in a block: the block's height and 80-byte
+// header, and the Merkle branch (sibling hashes from the transaction up, in
+// internal byte order) joining the transaction at position Pos to the
+// header's Merkle root.
+type Inclusion struct {
+	Height int64    `json:"height"`
+	Header []byte   `json:"header"`
+	Branch [][]byte `json:"branch"`
+	Pos    uint64   `json:"pos"`
+}
+
+// Prover is implemented by a NameRegistry that can back an owner with an
+// OwnerProof. Building one reads the chain afresh, so it is for callers that
+// asked for evidence rather than for every lookup.
+type Prover interface {
+	ProveOwner(ctx context.Context, name string) (pubKey []byte, proof *OwnerProof, err error)
+}
+
 // IsBareName reports whether a name is a bare "<labels>.fn" name with no
 // self-certifying pubkey suffix (i.e. it needs the registry to resolve an
 // owner). A name is self-certifying iff its second-to-last label actually
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 )
 
@@ -49,7 +50,7 @@ func NewMemoryCache() (*MemoryCache, error) {
 }
 
 // Get retrieves the resource records for a name, treating expired entries as a
-// miss (and evicting them).
+// miss (and evicting them, which is published as a cache.invalidated event).
 func (c *MemoryCache) Get(name string) ([]record.RR, bool) {
 	value, ok := c.cache.Get(name)
 	if !ok {
@@ -57,6 +58,7 @@ func (c *MemoryCache) Get(name string) ([]record.RR, bool) {
 	}
 	if time.Now().After(value.ExpiresAt) {
 		c.cache.Remove(name)
+		events.Publish(events.Cache, "cache.invalidated", map[string]any{"name": name, "reason": "expired"})
 		return nil, false
 	}
 	return value.Records, true
@@ -80,7 +82,9 @@ func (c *MemoryCache) Add(name string, records []record.RR, eol int64) {
 
 // Expire removes a single cache entry by name.
 func (c *MemoryCache) Expire(name string) {
-	c.cache.Remove(name)
+	if c.cache.Remove(name) {
+		events.Publish(events.Cache, "cache.invalidated", map[string]any{"name": name, "reason": "removed"})
+	}
 }
 
 // Length returns the number of items in the cache.
@@ -90,7 +94,9 @@ func (c *MemoryCache) Length() int {
 
 // Clear removes all items from the cache.
 func (c *MemoryCache) Clear() {
+	entries := c.cache.Len()
 	c.cache.Purge()
+	events.Publish(events.Cache, "cache.cleared", map[string]any{"entries": entries})
 }
 
 // cacheTTL returns the smallest positive TTL across the records, or a default.
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+)
+
+// ErrNoProof is returned for a bare name when the configured registry cannot
+// back its owner with evidence (it does not implement registry.Prover).
+var ErrNoProof = errors.New("name registry cannot prove owners")
+
+// Proof is everything a client needs to check a resolution without trusting
+// the node that made it: the full signed record and, for a bare name, the
+// chain evidence naming the owner whose key signed it.
+type Proof struct {
+	Record *record.FNRecord     `json:"record"`
+	Owner  *registry.OwnerProof `json:"owner,omitempty"`
+}
+
+// ResolveProof resolves a name the way Resolve does, but returns the signed
+// record and its evidence instead of just the resource records. It bypasses
+// the cache, which holds only resource records, so every call goes to the
+// DHT (and for a bare name, to the chain).
+func (r *Resolver) ResolveProof(ctx context.Context, name string) (*Proof, error) {
+	canonical := record.CanonicalName(name)
+	var (
+		key   string
+		owner *registry.OwnerProof
+		err   error
+	)
+	if registry.IsBareName(canonical) {
+		if r.registry == nil {
+			return nil, registry.ErrRegistryNotFound
+		}
+		prover, ok := r.registry.(registry.Prover)
+		if !ok {
+			return nil, ErrNoProof
+		}
+		var pubKey []byte
+		pubKey, owner, err = prover.ProveOwner(ctx, canonical)
+		if err != nil {
+			return nil, err
+		}
+		key, err = record.DHTKeyForPubKey(pubKey)
+	} else {
+		key, err = record.DHTKeyForName(canonical)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec, err := r.store.ResolveRecord(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Proof{Record: rec, Owner: owner}, nil
+}
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
@@ -63,3 +64,45 @@ func TestBareNameUnknownIsNotFound(t *testing.T) {
 		t.Fatal("expected bare-name resolution to fail when unclaimed")
 	}
 }
+
+// provingRegistry is a mockRegistry that also backs its answers with a
+// (placeholder) owner proof.
+type provingRegistry struct{ mockRegistry }
+
+func (p *provingRegistry) ProveOwner(_ context.Context, name string) ([]byte, *registry.OwnerProof, error) {
+	pub, err := p.ResolveOwner(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, &registry.OwnerProof{Claim: []byte("claim"), Binding: []byte("claim")}, nil
+}
+
+func TestResolveProof(t *testing.T) {
+	res, priv, name := mustResolver(t)
+	proof, err := res.ResolveProof(context.Background(), name)
+	if err != nil {
+		t.Fatalf("self-certifying name: %v", err)
+	}
+	if proof.Record.Label != "mysite" || proof.Owner != nil {
+		t.Errorf("proof %+v", proof)
+	}
+
+	// A bare name needs a registry that can prove its owner.
+	pub, _ := crypto.MarshalPublicKey(priv.GetPublic())
+	owners := mockRegistry{owners: map[string][]byte{"mysite.fn": pub}}
+	res.WithRegistry(&owners)
+	if _, err := res.ResolveProof(context.Background(), "mysite.fn"); !errors.Is(err, ErrNoProof) {
+		t.Errorf("unprovable registry: err = %v, want ErrNoProof", err)
+	}
+	res.WithRegistry(&provingRegistry{owners})
+	proof, err = res.ResolveProof(context.Background(), "MySite.fn.")
+	if err != nil {
+		t.Fatalf("bare name: %v", err)
+	}
+	if proof.Owner == nil || proof.Record.Label != "mysite" {
+		t.Errorf("bare-name proof %+v", proof)
+	}
+	if _, err := res.ResolveProof(context.Background(), "ghost.fn"); !errors.Is(err, registry.ErrRegistryNotFound) {
+		t.Errorf("unclaimed: err = %v", err)
+	}
+}
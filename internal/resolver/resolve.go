@@ -2,7 +2,9 @@ package resolver
 
 import (
 	"context"
+	"sync"
 
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
 )
@@ -45,8 +47,10 @@ func (r *Resolver) WithRegistry(registry registry.NameRegistry) *Resolver {
 func (r *Resolver) Resolve(ctx context.Context, name string) ([]record.RR, error) {
 	canonical := record.CanonicalName(name)
 	if records, ok := r.cache.Get(canonical); ok {
+		metrics.ResolverCache.WithLabelValues("hit").Inc()
 		return records, nil
 	}
+	metrics.ResolverCache.WithLabelValues("miss").Inc()
 
 	key, err := r.dhtKeyForName(canonical)
 	if err != nil {
@@ -93,3 +97,51 @@ func (r *Resolver) ResolveType(ctx context.Context, name, recordType string) ([]
 	}
 	return filtered, nil
 }
+
+// BatchResult is the outcome for one name of a ResolveBatch.
+type BatchResult struct {
+	Name    string // as given
+	Records []record.RR
+	Err     error
+}
+
+// ResolveBatch resolves names concurrently, on at most workers goroutines
+// sharing this resolver and its cache, and sends each result as soon as it
+// is known. A name given more than once, in any spelling, is resolved and
+// answered once. The channel is closed when every name is answered, or early
+// when ctx is done; a receiver that stops reading must cancel ctx.
+func (r *Resolver) ResolveBatch(ctx context.Context, names []string, workers int) <-chan BatchResult {
+	seen := make(map[string]bool, len(names))
+	todo := make(chan string, len(names))
+	for _, name := range names {
+		if canonical := record.CanonicalName(name); !seen[canonical] {
+			seen[canonical] = true
+			todo <- name
+		}
+	}
+	close(todo)
+	workers = max(1, min(workers, len(todo)))
+
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for name := range todo {
+				if ctx.Err() != nil {
+					return
+				}
+				records, err := r.Resolve(ctx, name)
+				select {
+				case results <- BatchResult{Name: name, Records: records, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -2,10 +2,18 @@ package resolver
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/metrics"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
 	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
 )
@@ -60,3 +68,157 @@ func TestResolverNormalizesCacheKey(t *testing.T) {
 		t.Fatalf("expected 1 shared cache entry across spellings, got %d", got)
 	}
 }
+
+// TestResolverCountsCacheLookups checks that the first resolve of a name is
+// counted as a cache miss and the next one as a hit.
+func TestResolverCountsCacheLookups(t *testing.T) {
+	resolver, _, name := mustResolver(t)
+	hits := metrics.ResolverCache.WithLabelValues("hit")
+	misses := metrics.ResolverCache.WithLabelValues("miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	for range 2 {
+		if _, err := resolver.Resolve(context.Background(), name); err != nil {
+			t.Fatalf("resolve %s: %v", name, err)
+		}
+	}
+	if got := testutil.ToFloat64(misses) - missesBefore; got != 1 {
+		t.Errorf("misses = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(hits) - hitsBefore; got != 1 {
+		t.Errorf("hits = %v, want 1", got)
+	}
+}
+
+// slowStore counts lookups and how many were in flight at once.
+type slowStore struct {
+	RecordStore
+	mu                      sync.Mutex
+	lookups, inFlight, peak int
+}
+
+func (s *slowStore) ResolveRecord(ctx context.Context, key string) (*record.FNRecord, error) {
+	s.mu.Lock()
+	s.lookups++
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	return s.RecordStore.ResolveRecord(ctx, key)
+}
+
+func TestResolveBatch(t *testing.T) {
+	dhtStore := testsupport.NewFakeDHT()
+	var names []string
+	for i := range 20 {
+		rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), fmt.Sprintf("site%d", i),
+			[]record.RR{{Type: "A", Value: fmt.Sprintf("10.0.0.%d", i), TTL: 300}}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dhtStore.PublishRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+		name, _ := rec.FullName()
+		names = append(names, name)
+	}
+	store := &slowStore{RecordStore: dhtStore}
+	cache, _ := NewMemoryCache()
+	resolver := NewResolver(store, cache)
+
+	unpublished, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "gone", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, _ := unpublished.FullName()
+	batch := append(slices.Clone(names), strings.ToUpper(names[3])+".", missing, "not-a-name")
+	got := map[string]BatchResult{}
+	for res := range resolver.ResolveBatch(context.Background(), batch, 4) {
+		got[res.Name] = res
+	}
+
+	if len(got) != len(names)+2 {
+		t.Errorf("%d results for %d distinct names", len(got), len(names)+2)
+	}
+	for i, name := range names {
+		if res := got[name]; res.Err != nil || len(res.Records) != 1 || res.Records[0].Value != fmt.Sprintf("10.0.0.%d", i) {
+			t.Errorf("%s: %+v", name, res)
+		}
+	}
+	if got[missing].Err == nil || got["not-a-name"].Err == nil {
+		t.Errorf("unresolvable names: %+v, %+v", got[missing], got["not-a-name"])
+	}
+	if store.peak > 4 || store.peak < 2 {
+		t.Errorf("%d lookups in flight at once with 4 workers", store.peak)
+	}
+	if store.lookups != len(names)+1 { // the malformed name never reaches the store
+		t.Errorf("%d store lookups", store.lookups)
+	}
+	if cache.Length() != len(names) {
+		t.Errorf("%d names cached", cache.Length())
+	}
+}
+
+func TestResolveBatchStopsOnCancel(t *testing.T) {
+	resolver, _, name := mustResolver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	results := resolver.ResolveBatch(ctx, []string{name, "a." + name, "b." + name}, 1)
+	<-results
+	cancel()
+	for range results {
+	}
+}
+
+// risingStore answers each lookup with the next of its records, then keeps
+// answering the last one.
+type risingStore struct {
+	records []*record.FNRecord
+	lookups int
+}
+
+func (s *risingStore) ResolveRecord(context.Context, string) (*record.FNRecord, error) {
+	s.lookups++
+	if s.lookups <= len(s.records) {
+		return s.records[s.lookups-1], nil
+	}
+	return s.records[len(s.records)-1], nil
+}
+
+func TestWaitSeq(t *testing.T) {
+	priv := testsupport.NewTestKey(t)
+	var store risingStore
+	for seq := range uint64(3) {
+		rec, err := record.BuildAndSignRecord(priv, "mysite",
+			[]record.RR{{Type: "A", Value: fmt.Sprintf("10.0.0.%d", seq+1), TTL: 300}}, seq+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.records = append(store.records, rec)
+	}
+	name, _ := store.records[0].FullName()
+	cache, _ := NewMemoryCache()
+	cache.Add(record.CanonicalName(name), store.records[0].Records, 0)
+	r := NewResolver(&store, cache)
+
+	rec, err := r.WaitSeq(t.Context(), name, 2, time.Millisecond)
+	if err != nil || rec.Seq != 2 || store.lookups != 2 {
+		t.Fatalf("WaitSeq(2) = %+v, %v after %d lookups; want seq 2 on the second", rec, err, store.lookups)
+	}
+	if records, _ := cache.Get(record.CanonicalName(name)); len(records) != 1 || records[0].Value != "10.0.0.2" {
+		t.Errorf("cache holds %+v, want the record waited for", records)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.WaitSeq(ctx, name, 9, time.Millisecond); !errors.Is(err, ErrSeqNotVisible) || !strings.Contains(err.Error(), "latest is 3") {
+		t.Errorf("WaitSeq(9) = %v, want ErrSeqNotVisible naming seq 3", err)
+	}
+	if _, err := r.WaitSeq(t.Context(), "not-a-name", 1, time.Millisecond); !errors.Is(err, record.ErrNotFNName) {
+		t.Errorf("WaitSeq(not-a-name) = %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+)
+
+// ErrSeqNotVisible is returned by WaitSeq when no record with the wanted
+// sequence number showed up in time.
+var ErrSeqNotVisible = errors.New("record sequence not visible")
+
+// WaitSeq blocks until the DHT returns a record for name with Seq >= seq, and
+// returns it. It bypasses the cache and asks again every poll, so it sees an
+// update as the network does rather than as this node last cached it; the
+// record it returns replaces the cached one. A bare name's owner is looked up
+// on every attempt, so a claim still confirming does not end the wait.
+//
+// When ctx is done first it returns ErrSeqNotVisible, saying what it saw last.
+// A name that is not well-formed fails at once.
+func (r *Resolver) WaitSeq(ctx context.Context, name string, seq uint64, poll time.Duration) (*record.FNRecord, error) {
+	canonical := record.CanonicalName(name)
+	var (
+		latest  *record.FNRecord
+		lastErr error
+	)
+	for {
+		key, err := r.dhtKeyForName(canonical)
+		if errors.Is(err, record.ErrNotFNName) {
+			return nil, err
+		}
+		if err == nil {
+			var rec *record.FNRecord
+			rec, err = r.store.ResolveRecord(ctx, key)
+			if err == nil && (latest == nil || rec.Seq > latest.Seq) {
+				latest = rec
+			}
+		}
+		if latest != nil && latest.Seq >= seq {
+			r.cache.Add(canonical, latest.Records, latest.EOL)
+			return latest, nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			if latest != nil {
+				return nil, fmt.Errorf("%w: want seq %d, latest is %d", ErrSeqNotVisible, seq, latest.Seq)
+			}
+			return nil, fmt.Errorf("%w: want seq %d, last lookup: %v", ErrSeqNotVisible, seq, lastErr)
+		case <-time.After(poll):
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package simnet runs a network of real nodes in one process, for end-to-end
+// tests. Each node is a node.FreedomNameNode with a content service, a
+// resolver and its own blobstore, as cmd/freedom-names wires them, but its
+// host lives on libp2p's in-memory mock network instead of the wire: the DHT
+// is private to the test, nothing is dialled outside the process and the
+// network can be cut up at will.
+//
+// The background loops that run on a timer in a real node (healing,
+// republishing) are left to the test, which advances them with Heal and
+// Republish, so what a test checks does not depend on how long it waited.
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/config"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/dnsserver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+)
+
+// Net is a simulated network of nodes.
+type Net struct {
+	t     testing.TB
+	mn    mocknet.Mocknet
+	Nodes []*Node
+}
+
+// Node is one node of a Net.
+type Node struct {
+	*node.FreedomNameNode
+	ID       peer.ID
+	Content  *node.ContentService
+	Cache    resolver.Cache
+	Resolver *resolver.Resolver
+	alive    bool
+}
+
+// An Option changes the configuration every node of a Net starts with.
+type Option func(*config.Config)
+
+// Config returns the configuration a simulated node starts with before
+// options: the defaults of a real node, minus everything that would reach
+// outside the process, and with healing left to Net.Heal.
+func Config() *config.Config {
+	return &config.Config{
+		ProtocolPrefix:      config.DefaultProtocolPrefix,
+		ContentReplicas:     3,
+		ContentHostBudget:   1 << 30,
+		ContentHostTTL:      30 * 24 * time.Hour,
+		ContentMaxPushSize:  content.MaxContentSize,
+		ContentReprovide:    config.ReprovideRoots,
+		ContentHealInterval: 0, // no heal loop: Net.Heal runs the passes
+	}
+}
+
+// New starts n nodes, all linked to and connected with each other, and stops
+// them when the test ends. Every node is a DHT server, as nodes with public
+// addresses are.
+func New(t testing.TB, n int, opts ...Option) *Net {
+	t.Helper()
+	cfg := Config()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	sn := &Net{t: t, mn: mocknet.New()}
+	t.Cleanup(sn.close)
+
+	for i := range n {
+		h, err := sn.mn.GenPeer()
+		if err != nil {
+			t.Fatalf("simnet: peer %d: %v", i, err)
+		}
+		fn, err := node.NewNodeOnHost(t.Context(), h, cfg, dht.Mode(dht.ModeServer))
+		if err != nil {
+			t.Fatalf("simnet: node %d: %v", i, err)
+		}
+		store, err := content.NewBlobStore(t.TempDir())
+		if err != nil {
+			fn.Shutdown()
+			t.Fatalf("simnet: node %d store: %v", i, err)
+		}
+		cache, err := resolver.NewMemoryCache()
+		if err != nil {
+			fn.Shutdown()
+			t.Fatalf("simnet: node %d cache: %v", i, err)
+		}
+		sn.Nodes = append(sn.Nodes, &Node{
+			FreedomNameNode: fn,
+			ID:              h.ID(),
+			Content:         fn.AttachContent(store, cfg),
+			Cache:           cache,
+			Resolver:        resolver.NewResolver(fn, cache),
+			alive:           true,
+		})
+	}
+	if err := sn.mn.LinkAll(); err != nil {
+		t.Fatalf("simnet: link: %v", err)
+	}
+	if err := sn.mn.ConnectAllButSelf(); err != nil {
+		t.Fatalf("simnet: connect: %v", err)
+	}
+	sn.waitForRoutingTables()
+	return sn
+}
+
+// waitForRoutingTables waits until every node has every other in its routing
+// table, which happens once identify has told it the other speaks the DHT.
+func (sn *Net) waitForRoutingTables() {
+	sn.t.Helper()
+	Eventually(sn.t, 10*time.Second, func() error {
+		for i, n := range sn.Nodes {
+			if got := len(n.GetRoutingPeers()); got < len(sn.Nodes)-1 {
+				return fmt.Errorf("node %d has %d of %d peers in its routing table", i, got, len(sn.Nodes)-1)
+			}
+		}
+		return nil
+	})
+}
+
+func (sn *Net) close() {
+	for _, n := range sn.Nodes {
+		if n.alive {
+			n.alive = false
+			n.Shutdown()
+		}
+	}
+	sn.mn.Close()
+}
+
+// Alive reports whether node i is still running.
+func (sn *Net) Alive(i int) bool { return sn.Nodes[i].alive }
+
+// Kill stops node i as a crash would: its links go first, so no peer hears
+// from it again, then the node shuts down.
+func (sn *Net) Kill(i int) {
+	sn.t.Helper()
+	n := sn.Nodes[i]
+	if !n.alive {
+		return
+	}
+	for _, other := range sn.Nodes {
+		if other != n {
+			sn.cut(n.ID, other.ID)
+		}
+	}
+	n.alive = false
+	n.Shutdown()
+}
+
+// Partition splits the network into groups of node indexes that can reach
+// only each other: every link between nodes of different groups is cut. A
+// node in no group keeps its links.
+func (sn *Net) Partition(groups ...[]int) {
+	sn.t.Helper()
+	for gi, g := range groups {
+		for _, other := range groups[gi+1:] {
+			for _, a := range g {
+				for _, b := range other {
+					sn.cut(sn.Nodes[a].ID, sn.Nodes[b].ID)
+				}
+			}
+		}
+	}
+}
+
+// Rejoin undoes Partition: every pair of live nodes is linked and connected
+// again.
+func (sn *Net) Rejoin() {
+	sn.t.Helper()
+	for i, a := range sn.Nodes {
+		for _, b := range sn.Nodes[i+1:] {
+			if !a.alive || !b.alive || len(sn.mn.LinksBetweenPeers(a.ID, b.ID)) > 0 {
+				continue
+			}
+			if _, err := sn.mn.LinkPeers(a.ID, b.ID); err != nil {
+				sn.t.Fatalf("simnet: link %s-%s: %v", a.ID, b.ID, err)
+			}
+			if _, err := sn.mn.ConnectPeers(a.ID, b.ID); err != nil {
+				sn.t.Fatalf("simnet: connect %s-%s: %v", a.ID, b.ID, err)
+			}
+		}
+	}
+}
+
+// cut removes the link between a and b and closes their connections.
+func (sn *Net) cut(a, b peer.ID) {
+	if len(sn.mn.LinksBetweenPeers(a, b)) == 0 {
+		return
+	}
+	if err := sn.mn.UnlinkPeers(a, b); err != nil {
+		sn.t.Fatalf("simnet: unlink %s-%s: %v", a, b, err)
+	}
+	if err := sn.mn.DisconnectPeers(a, b); err != nil {
+		sn.t.Fatalf("simnet: disconnect %s-%s: %v", a, b, err)
+	}
+}
+
+// Heal runs one heal pass on every live node, as their heal loops would after
+// ContentHealInterval.
+func (sn *Net) Heal() {
+	for _, n := range sn.Nodes {
+		if n.alive {
+			n.Content.Heal()
+		}
+	}
+}
+
+// Republish has every live node re-put the records it published, as their
+// republish loops would.
+func (sn *Net) Republish() {
+	for _, n := range sn.Nodes {
+		if n.alive {
+			n.Republish()
+		}
+	}
+}
+
+// Holders returns the indexes of the live nodes holding the content set root
+// in their stores.
+func (sn *Net) Holders(root string) []int {
+	var holders []int
+	for i, n := range sn.Nodes {
+		if !n.alive {
+			continue
+		}
+		if sets, err := n.Content.ListSets(); err == nil {
+			for _, s := range sets {
+				if s.Root == root {
+					holders = append(holders, i)
+					break
+				}
+			}
+		}
+	}
+	return holders
+}
+
+// ServeDNS starts the DNS server on node i's resolver, listening on a free
+// loopback port until the test ends, and returns its address.
+func (n *Node) ServeDNS(t testing.TB) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("simnet: dns port: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	srv := dnsserver.NewDNSServer(addr, "127.0.0.1:1", n.Resolver, false)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("simnet: dns: %v", err)
+	}
+	t.Cleanup(srv.Shutdown)
+	return addr
+}
+
+// Eventually calls check until it returns nil, failing the test with its last
+// error if that does not happen within timeout.
+func Eventually(t testing.TB, timeout time.Duration, check func() error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
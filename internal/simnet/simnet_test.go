@@ -0,0 +1,132 @@
+package simnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+func buildRecord(t *testing.T, label, ip string, seq uint64) (*record.FNRecord, string) {
+	t.Helper()
+	rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), label, []record.RR{{Type: record.RecordTypeA, Value: ip, TTL: 300}}, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := rec.FullName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec, name
+}
+
+// TestRecordResolvesAcrossNodes publishes on one node and resolves the name on
+// every other, then over DNS from the last.
+func TestRecordResolvesAcrossNodes(t *testing.T) {
+	sn := New(t, 4)
+	rec, name := buildRecord(t, "site", "10.0.0.7", 1)
+	if err := sn.Nodes[0].PublishRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range sn.Nodes[1:] {
+		rrs, err := n.Resolver.Resolve(t.Context(), name)
+		if err != nil || len(rrs) != 1 || rrs[0].Value != "10.0.0.7" {
+			t.Fatalf("node %d: %+v, %v", i+1, rrs, err)
+		}
+	}
+
+	addr := sn.Nodes[3].ServeDNS(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	resp, err := dns.Exchange(ctx, dns.NewMsg(name, dns.TypeA), "udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("answer %+v, want one A", resp.Answer)
+	}
+	if a, ok := resp.Answer[0].(*dns.A); !ok || a.Addr.String() != "10.0.0.7" {
+		t.Fatalf("answer %v, want 10.0.0.7", resp.Answer[0])
+	}
+}
+
+// TestRepublishReachesRejoinedPartition publishes while half the network is
+// cut off; the other half learns the record once the partition heals and the
+// publisher republishes.
+func TestRepublishReachesRejoinedPartition(t *testing.T) {
+	sn := New(t, 4)
+	sn.Partition([]int{0, 1}, []int{2, 3})
+	rec, name := buildRecord(t, "site", "10.0.0.8", 1)
+	if err := sn.Nodes[0].PublishRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	if rrs, err := sn.Nodes[3].Resolver.Resolve(ctx, name); err == nil {
+		t.Fatalf("resolved across the partition: %+v", rrs)
+	}
+
+	sn.Rejoin()
+	sn.waitForRoutingTables()
+	sn.Republish()
+	rrs, err := sn.Nodes[3].Resolver.Resolve(t.Context(), name)
+	if err != nil || len(rrs) != 1 || rrs[0].Value != "10.0.0.8" {
+		t.Fatalf("after rejoin: %+v, %v", rrs, err)
+	}
+}
+
+// TestHealReplacesKilledHolder stores content, kills a node holding a replica
+// and checks a heal pass brings the set back to the wanted replica count,
+// still fetchable from a node that never held it.
+func TestHealReplacesKilledHolder(t *testing.T) {
+	sn := New(t, 6)
+	data := bytes.Repeat([]byte("simnet "), 1000)
+	root, err := sn.Nodes[0].Content.Put(t.Context(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 1 + Config().ContentReplicas
+	Eventually(t, 10*time.Second, func() error {
+		if got := sn.Holders(root); len(got) < want {
+			return fmt.Errorf("held by %v, want %d nodes", got, want)
+		}
+		return nil
+	})
+
+	holders := sn.Holders(root)
+	victim := holders[len(holders)-1]
+	if victim == 0 {
+		t.Fatalf("holders %v: no replica besides the owner", holders)
+	}
+	sn.Kill(victim)
+	if got := sn.Holders(root); len(got) >= want {
+		t.Fatalf("held by %v after the kill", got)
+	}
+
+	Eventually(t, 10*time.Second, func() error {
+		sn.Heal()
+		if got := sn.Holders(root); len(got) < want {
+			return fmt.Errorf("held by %v after heal, want %d nodes", got, want)
+		}
+		return nil
+	})
+
+	for i, n := range sn.Nodes {
+		if !sn.Alive(i) || slices.Contains(sn.Holders(root), i) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		got, err := n.Content.Fetch(ctx, root)
+		cancel()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("fetch from node %d: %d bytes, %v", i, len(got), err)
+		}
+		return
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BatchResult is one name of a ResolveBatch. Err is the *Error /resolve
+// would have answered for the name alone, so errors.Is(Err, ErrNotFound)
+// tells a name that does not exist apart from one the node could not look up.
+type BatchResult struct {
+	Name    string
+	Records []RR
+	Err     error
+}
+
+// BatchStream is the answer to a ResolveBatch, read one name at a time as the
+// node resolves them. The caller must Close it.
+type BatchStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+// ResolveBatch resolves many names at once. The node resolves them
+// concurrently and answers each distinct name once, in the order they
+// complete; only records of types are kept unless none are given. Resolved
+// names are cached on the node, so a batch also warms its DNS server.
+func (c *Client) ResolveBatch(ctx context.Context, names []string, types ...string) (*BatchStream, error) {
+	payload, err := json.Marshal(map[string][]string{"names": names, "types": types})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/resolve/batch", nil, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	return &BatchStream{body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// Next returns the next name's result. After the last one it returns io.EOF.
+func (s *BatchStream) Next() (BatchResult, error) {
+	var line struct {
+		Name    string `json:"name"`
+		Status  int    `json:"status"`
+		Records []RR   `json:"records"`
+		Error   string `json:"error"`
+	}
+	if err := s.dec.Decode(&line); err == io.EOF {
+		return BatchResult{}, io.EOF
+	} else if err != nil {
+		return BatchResult{}, fmt.Errorf("read batch results: %w", err)
+	}
+	result := BatchResult{Name: line.Name, Records: line.Records}
+	if line.Status != http.StatusOK {
+		result.Err = &Error{Method: http.MethodPost, Path: "/resolve/batch", Status: line.Status, Message: line.Error}
+	}
+	return result, nil
+}
+
+// Close ends the stream; the node stops resolving the names not yet answered.
+func (s *BatchStream) Close() error { return s.body.Close() }
@@ -0,0 +1,184 @@
+// Package client is a typed Go client for a Freedom Names node's HTTP API and
+// its loopback authoring API. The `freedom` CLI is built on it, and programs
+// that drive a node (a LibreWeb host, a deploy script) can use it instead of
+// hand-writing requests.
+//
+// Every method takes a context and returns a *Error for an answer the node
+// refused, which errors.Is matches against ErrNotFound, ErrBadRequest and the
+// other status sentinels. Content moves as streams in both directions, so a
+// large upload or download never sits in memory.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultURL is the API of a node running with the default FREEDOM_HTTP_ADDR.
+const DefaultURL = "http://localhost:8420"
+
+// DefaultAuthoringURL is the authoring API of a node running with the default
+// FREEDOM_AUTHORING_ADDR. Health reports the one a node actually uses.
+const DefaultAuthoringURL = "http://127.0.0.1:8421"
+
+// Client talks to one node API. The zero value is not usable; call New.
+type Client struct {
+	base  string
+	http  *http.Client
+	token string
+}
+
+// New returns a client for the API rooted at baseURL, e.g.
+// "http://localhost:8420". For the authoring methods, baseURL is the
+// authoring API instead.
+func New(baseURL string) *Client {
+	return &Client{base: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+}
+
+// WithHTTPClient makes the client send its requests through hc.
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.http = hc
+	return c
+}
+
+// WithToken makes the client authenticate with an API token, which a node
+// whose API is bound beyond loopback requires (see `freedom token`). An empty
+// token sends none.
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+// URL returns the API root the client talks to.
+func (c *Client) URL() string { return c.base }
+
+// Status sentinels, matched by errors.Is against a *Error. They follow the
+// node's status mapping: a 404 means the thing asked for does not exist, a
+// 502, 503 or 504 that the node could not find out right now.
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrUnauthorized  = errors.New("missing or invalid API token")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrTooLarge      = errors.New("too large")
+	ErrNotSupported  = errors.New("not supported by this node")
+	ErrUnavailable   = errors.New("temporarily unavailable")
+	ErrInternalError = errors.New("node internal error")
+)
+
+// Error is an answer the node refused, carrying its status and message.
+type Error struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s (%d): %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// Is matches the status sentinels.
+func (e *Error) Is(target error) bool {
+	switch e.Status {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusRequestEntityTooLarge:
+		return target == ErrTooLarge
+	case http.StatusNotImplemented:
+		return target == ErrNotSupported
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return target == ErrUnavailable
+	case http.StatusInternalServerError:
+		return target == ErrInternalError
+	}
+	return false
+}
+
+// maxErrorBody bounds how much of a refusal is read for its message.
+const maxErrorBody = 64 << 10
+
+// errorFrom builds the Error for a refused response. A node answers every
+// error with {"error": "..."}; older nodes, and proxies in front of one, may
+// answer in plain text.
+func errorFrom(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	msg := strings.TrimSpace(string(body))
+	var structured struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error != "" {
+		msg = structured.Error
+	}
+	return &Error{Method: resp.Request.Method, Path: resp.Request.URL.Path, Status: resp.StatusCode, Message: msg}
+}
+
+// send performs a request and returns the response if the node accepted it
+// (any 2xx status). The caller closes the body.
+func (c *Client) send(ctx context.Context, method, path string, params url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	target := c.base + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, errorFrom(resp)
+	}
+	return resp, nil
+}
+
+// call performs a request and decodes the JSON answer into out, unless out is
+// nil.
+func (c *Client) call(ctx context.Context, method, path string, params url.Values, contentType string, body io.Reader, out any) error {
+	resp, err := c.send(ctx, method, path, params, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
+
+// callJSON sends in as a JSON body and decodes the answer into out.
+func (c *Client) callJSON(ctx context.Context, method, path string, in, out any) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, method, path, nil, "application/json", bytes.NewReader(payload), out)
+}
@@ -0,0 +1,387 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/routing"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/events"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/httpapi"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/node"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// memoryDHT keeps published records in a map by DHT key. The embedded interface is nil:
+// the handlers under test only call the methods defined here.
+type memoryDHT struct {
+	httpapi.FreedomDHT
+	mu      sync.Mutex
+	records map[string]*record.FNRecord
+}
+
+func (d *memoryDHT) IsInitialized() bool { return true }
+
+func (d *memoryDHT) PublishRecord(rec *record.FNRecord) error {
+	key, err := rec.DHTKey()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records[key] = rec
+	return nil
+}
+
+func (d *memoryDHT) ResolveRecord(_ context.Context, key string) (*record.FNRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rec, ok := d.records[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return rec, nil
+}
+
+// testNode serves the name, content and authoring routes the way
+// StartHTTPServer wires them, over one in-memory DHT and store.
+func testNode(t *testing.T) *Client {
+	t.Helper()
+	dht := &memoryDHT{records: map[string]*record.FNRecord{}}
+	store, err := content.NewBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := node.NewIndexedLocalContentService(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := authoring.New(t.TempDir(), dht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := resolver.NewMemoryCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := resolver.NewResolver(dht, cache)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/publish", httpapi.PublishHandler(dht))
+	mux.HandleFunc("/resolve", httpapi.ResolveHandler(dht, res))
+	mux.HandleFunc("/resolve/batch", httpapi.BatchResolveHandler(dht, res))
+	mux.HandleFunc("/record", httpapi.RecordHandler(dht))
+	mux.HandleFunc("/content", httpapi.ContentHandler(cs))
+	mux.HandleFunc("/content/sets", httpapi.ContentSetsHandler(cs))
+	mux.HandleFunc("/content/pin", httpapi.ContentPinHandler(cs, true))
+	mux.HandleFunc("/content/unpin", httpapi.ContentPinHandler(cs, false))
+	mux.HandleFunc("/content/export", httpapi.ContentExportHandler(cs))
+	mux.HandleFunc("/content/import", httpapi.ContentImportHandler(cs))
+	mux.HandleFunc("/resolve-content", httpapi.ResolveContentHandler(res, cs))
+	mux.HandleFunc("/events", httpapi.EventsHandler(nil))
+	mux.HandleFunc("/authoring/names", httpapi.NamesHandler(names))
+	mux.HandleFunc("/authoring/names/", httpapi.NamePublishHandler(names))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return New(server.URL + "/")
+}
+
+func TestPublishAndResolve(t *testing.T) {
+	c := testNode(t)
+	ctx := t.Context()
+	rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "site",
+		[]RR{{Type: record.RecordTypeA, Value: "10.0.0.7", TTL: 300}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := c.Publish(ctx, rec)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	records, err := c.Resolve(ctx, name, record.RecordTypeA)
+	if err != nil || len(records) != 1 || records[0].Value != "10.0.0.7" {
+		t.Fatalf("resolve: %v %+v", err, records)
+	}
+	current, err := c.Record(ctx, name)
+	if err != nil || current.Seq != 1 {
+		t.Fatalf("record: %v %+v", err, current)
+	}
+	if records, err := c.WaitResolve(ctx, name, 1, time.Second); err != nil || len(records) != 1 {
+		t.Fatalf("wait for seq 1: %v %+v", err, records)
+	}
+	if _, err := c.WaitResolve(ctx, name, 2, time.Millisecond); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("wait for seq 2: err = %v, want ErrUnavailable", err)
+	}
+	proof, err := c.ResolveProof(ctx, name)
+	if err != nil || proof.Record == nil || !bytes.Equal(proof.Record.Sig, rec.Sig) {
+		t.Fatalf("proof: %v %+v", err, proof)
+	}
+
+	// A forged record is refused, and the refusal is typed.
+	rec.Records[0].Value = "10.6.6.6"
+	if _, err := c.Publish(ctx, rec); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("forged publish: err = %v, want ErrBadRequest", err)
+	}
+	unpublished, _ := record.BuildAndSignRecord(testsupport.NewTestKey(t), "gone", nil, 1)
+	gone, _ := unpublished.FullName()
+	if _, err := c.Resolve(ctx, gone, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing name: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestResolveBatch(t *testing.T) {
+	c := testNode(t)
+	ctx := t.Context()
+	rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "site", []RR{
+		{Type: record.RecordTypeA, Value: "10.0.0.7", TTL: 300},
+		{Type: record.RecordTypeTXT, Value: "hello", TTL: 300},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := c.Publish(ctx, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpublished, _ := record.BuildAndSignRecord(testsupport.NewTestKey(t), "gone", nil, 1)
+	gone, _ := unpublished.FullName()
+
+	stream, err := c.ResolveBatch(ctx, []string{name, gone}, record.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	got := map[string]BatchResult{}
+	for {
+		result, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[result.Name] = result
+	}
+	if r := got[name]; r.Err != nil || len(r.Records) != 1 || r.Records[0].Value != "10.0.0.7" {
+		t.Errorf("%s: %+v", name, r)
+	}
+	if r := got[gone]; !errors.Is(r.Err, ErrNotFound) {
+		t.Errorf("missing name: err = %v, want ErrNotFound", r.Err)
+	}
+
+	if _, err := c.ResolveBatch(ctx, nil); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("no names: err = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestContentStreams(t *testing.T) {
+	c := testNode(t)
+	ctx := t.Context()
+	data := testsupport.TestBytes(content.ChunkSize + 1024)
+
+	put, err := c.PutContent(ctx, bytes.NewReader(data), PutOptions{})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if put.Ref() != put.Hash {
+		t.Errorf("plain upload ref %q, want its hash", put.Ref())
+	}
+	dl, err := c.Content(ctx, put.Hash)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, _ := io.ReadAll(dl)
+	dl.Close()
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want %d", len(got), len(data))
+	}
+
+	sealed, err := c.PutContent(ctx, bytes.NewReader(data), PutOptions{Encrypt: true})
+	if err != nil || sealed.Cap == "" || sealed.Ref() != sealed.Cap {
+		t.Fatalf("encrypted put: %v %+v", err, sealed)
+	}
+	dl, err = c.Content(ctx, sealed.Ref())
+	if err != nil {
+		t.Fatalf("get encrypted: %v", err)
+	}
+	got, _ = io.ReadAll(dl)
+	dl.Close()
+	if !bytes.Equal(got, data) {
+		t.Error("encrypted round trip changed the content")
+	}
+
+	export, err := c.Export(ctx, put.Hash)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	archive, err := io.ReadAll(export)
+	export.Close()
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if err := c.RemoveContent(ctx, put.Hash); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := c.Content(ctx, put.Hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removed content: err = %v, want ErrNotFound", err)
+	}
+	hash, size, err := c.Import(ctx, bytes.NewReader(archive))
+	if err != nil || hash != put.Hash || size != int64(len(data)) {
+		t.Fatalf("import: %v %s %d", err, hash, size)
+	}
+	sets, err := c.ContentSets(ctx)
+	if err != nil || len(sets) != 2 {
+		t.Fatalf("sets: %v %+v", err, sets)
+	}
+}
+
+func TestAuthoring(t *testing.T) {
+	c := testNode(t)
+	ctx := t.Context()
+	created, err := c.CreateName(ctx, "blog")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := c.CreateName(ctx, "blog"); !errors.Is(err, ErrConflict) {
+		t.Errorf("second create: err = %v, want ErrConflict", err)
+	}
+	names, err := c.Names(ctx)
+	if err != nil || len(names) != 1 || names[0].Name != created.Name {
+		t.Fatalf("names: %v %+v", err, names)
+	}
+
+	published, err := c.PublishName(ctx, "blog", []RR{{Type: record.RecordTypeTXT, Value: "hello", TTL: 60}})
+	if err != nil || published.Name != created.Name {
+		t.Fatalf("publish: %v %+v", err, published)
+	}
+	records, err := c.Resolve(ctx, created.Name, "")
+	if err != nil || len(records) != 1 || records[0].Value != "hello" {
+		t.Fatalf("resolve: %v %+v", err, records)
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"registry unreachable"}`))
+		default:
+			http.Error(w, "no such thing", http.StatusNotFound)
+		}
+	}))
+	defer node.Close()
+	c := New(node.URL)
+
+	err := c.call(t.Context(), http.MethodGet, "/json", nil, "", nil, nil)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Message != "registry unreachable" || !errors.Is(err, ErrUnavailable) {
+		t.Errorf("JSON refusal: %v", err)
+	}
+	err = c.call(t.Context(), http.MethodGet, "/text", nil, "", nil, nil)
+	if !errors.As(err, &apiErr) || apiErr.Message != "no such thing" || !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnavailable) {
+		t.Errorf("plain refusal: %v", err)
+	}
+	if got := err.Error(); got != "GET /text (404): no such thing" {
+		t.Errorf("message %q", got)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := testNode(t)
+	ctx := t.Context()
+	stream, err := c.Events(ctx, "records", "heal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	events.Publish(events.Cache, "cache.cleared", map[string]any{"entries": 1})
+	events.Publish(events.Heal, "heal", map[string]any{"root": "abc", "outcome": "healed"})
+	e, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Topic != "heal" || e.Type != "heal" || e.Seq == 0 || e.At.IsZero() {
+		t.Fatalf("got %+v", e)
+	}
+	var data struct{ Root, Outcome string }
+	if err := json.Unmarshal(e.Data, &data); err != nil || data.Root != "abc" {
+		t.Errorf("data %s: %v", e.Data, err)
+	}
+	if e.Dropped() != 0 {
+		t.Errorf("a heal event reports %d dropped", e.Dropped())
+	}
+
+	if _, err := c.Events(ctx, "gossip"); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("unknown topic: %v", err)
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fnt_1234abcd_secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"invalid or revoked API token"}`)
+			return
+		}
+		io.WriteString(w, `{"name":"site.fn","records":[]}`)
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL).Resolve(t.Context(), "site.fn", ""); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("without a token: %v", err)
+	}
+	if _, err := New(server.URL).WithToken("fnt_1234abcd_secret").Resolve(t.Context(), "site.fn", ""); err != nil {
+		t.Errorf("with the token: %v", err)
+	}
+}
+
+// TestStatusTypesMatchNode checks the response types this package defines for
+// itself decode everything the node sends, field for field.
+func TestStatusTypesMatchNode(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	column, providers := 2, 3
+	for _, tc := range []struct {
+		sent any
+		into any
+	}{
+		{&node.ReplicationStatus{
+			Hash: "k2jm", Held: true, Pinned: true, Groups: []string{"team"}, Size: 10, Chunks: 1, Erasure: "4+2",
+			Replicas:   []node.ReplicaPeer{{Peer: "12D3KooW", Column: &column, State: "proven", At: now}},
+			Confirmed:  1,
+			LastHeal:   &node.HealResult{At: now, Target: 3, Holders: 2, Pushed: 1, Error: "short"},
+			Providers:  &providers,
+			Durability: node.Durability{Holders: 2, Tolerates: 1},
+		}, &ReplicationStatus{}},
+		{&node.ReprovideStats{Strategy: "roots", Running: true, Keys: 4, Provided: 3, Failed: 1, Walks: 2,
+			LastStart: &now, LastEnd: &now, LagSeconds: 5}, &ReprovideStats{}},
+	} {
+		sent, err := json.Marshal(tc.sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(sent))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(tc.into); err != nil {
+			t.Fatalf("%T: %v", tc.into, err)
+		}
+		if got, _ := json.Marshal(tc.into); !bytes.Equal(got, sent) {
+			t.Errorf("%T:\n got %s\nwant %s", tc.into, got, sent)
+		}
+	}
+}
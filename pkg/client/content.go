@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/content"
+)
+
+type (
+	// SetInfo describes one content set a node holds.
+	SetInfo = content.SetInfo
+	// GCResult is what a garbage collection removed.
+	GCResult = content.GCResult
+)
+
+// ReplicationStatus is where a content set is replicated, as the node knows
+// it (/content/status).
+type ReplicationStatus struct {
+	Hash    string   `json:"hash"`
+	Held    bool     `json:"held"` // the node has the set indexed
+	Pinned  bool     `json:"pinned"`
+	Groups  []string `json:"groups,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	Chunks  int      `json:"chunks,omitempty"`
+	Erasure string   `json:"erasure,omitempty"`
+
+	Replicas  []ReplicaPeer `json:"replicas"`
+	Confirmed int           `json:"confirmed"` // other peers known to hold it (not failed)
+	LastHeal  *HealResult   `json:"lastHeal,omitempty"`
+	Providers *int          `json:"providers,omitempty"` // only when a lookup was asked for
+
+	Durability Durability `json:"durability"`
+}
+
+// ReplicaPeer is what the node last learned about one other holder of a set.
+type ReplicaPeer struct {
+	Peer   string    `json:"peer"`
+	Column *int      `json:"column,omitempty"` // shard column, for erasure-coded sets
+	State  string    `json:"state"`            // "accepted", "have", "proven" or "failed"
+	At     time.Time `json:"at"`
+}
+
+// HealResult is the outcome of the last heal pass over a set.
+type HealResult struct {
+	At      time.Time `json:"at"`
+	Target  int       `json:"target"`
+	Holders int       `json:"holders"`
+	Pushed  int       `json:"pushed"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Durability is how many holders a set can lose and stay complete.
+type Durability struct {
+	Holders   int `json:"holders"`
+	Tolerates int `json:"tolerates"`
+}
+
+// PutOptions are per-upload options; the zero value uses the node's defaults.
+type PutOptions struct {
+	Chunking string // "fixed" or "cdc"; empty for the node's default
+	Encrypt  bool   // store encrypted; the result carries the read capability
+}
+
+// PutResult is the reference a node assigned to uploaded content.
+type PutResult struct {
+	Hash string `json:"hash"`
+	Key  string `json:"key,omitempty"` // encrypted uploads only
+	Cap  string `json:"cap,omitempty"` // encrypted uploads only: hash and key together
+}
+
+// Ref returns the reference to publish in a CONTENT record: the read
+// capability for encrypted content (the only way to read it back), the hash
+// otherwise.
+func (p *PutResult) Ref() string {
+	if p.Cap != "" {
+		return p.Cap
+	}
+	return p.Hash
+}
+
+// Download is content being read from a node. The caller must Close it.
+type Download struct {
+	io.ReadCloser
+	Size        int64  // byte length, -1 if the node did not say
+	ContentType string // sniffed by the node from the first bytes
+	Hash        string // root hash; set by ResolveContent only
+}
+
+// PutContent uploads r as one content set, streaming it.
+func (c *Client) PutContent(ctx context.Context, r io.Reader, opts PutOptions) (*PutResult, error) {
+	params := url.Values{}
+	if opts.Chunking != "" {
+		params.Set("chunking", opts.Chunking)
+	}
+	if opts.Encrypt {
+		params.Set("encrypt", "1")
+	}
+	var out PutResult
+	if err := c.call(ctx, http.MethodPost, "/content", params, "application/octet-stream", r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Content fetches content by hash, or decrypts it given a read capability.
+// The node fetches it from the network if it does not hold it.
+func (c *Client) Content(ctx context.Context, ref string) (*Download, error) {
+	return c.download(ctx, "/content", url.Values{"hash": {ref}})
+}
+
+// ResolveContent fetches the content a name's CONTENT record points at.
+func (c *Client) ResolveContent(ctx context.Context, name string) (*Download, error) {
+	return c.download(ctx, "/resolve-content", url.Values{"name": {name}})
+}
+
+// ContentProof returns the content hash a name points at and the proof it was
+// read from, without fetching the content. pkg/verify checks the proof.
+func (c *Client) ContentProof(ctx context.Context, name string) (string, *Proof, error) {
+	var out struct {
+		Hash  string `json:"hash"`
+		Proof *Proof `json:"proof"`
+	}
+	params := url.Values{"name": {name}, "proof": {"1"}}
+	if err := c.call(ctx, http.MethodGet, "/resolve-content", params, "", nil, &out); err != nil {
+		return "", nil, err
+	}
+	return out.Hash, out.Proof, nil
+}
+
+func (c *Client) download(ctx context.Context, path string, params url.Values) (*Download, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, params, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		ReadCloser:  resp.Body,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		Hash:        resp.Header.Get("X-Freedom-Content-Hash"),
+	}, nil
+}
+
+// RemoveContent drops a content set from the node now, pinned or not.
+func (c *Client) RemoveContent(ctx context.Context, hash string) error {
+	return c.call(ctx, http.MethodDelete, "/content", url.Values{"hash": {hash}}, "", nil, nil)
+}
+
+// ContentSets lists the content sets the node holds.
+func (c *Client) ContentSets(ctx context.Context) ([]SetInfo, error) {
+	var out struct {
+		Sets []SetInfo `json:"sets"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/content/sets", nil, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Sets, nil
+}
+
+// Pin keeps a content set for good.
+func (c *Client) Pin(ctx context.Context, hash string) error {
+	return c.call(ctx, http.MethodPost, "/content/pin", url.Values{"hash": {hash}}, "", nil, nil)
+}
+
+// Unpin releases a content set to the node's hosting budget.
+func (c *Client) Unpin(ctx context.Context, hash string) error {
+	return c.call(ctx, http.MethodPost, "/content/unpin", url.Values{"hash": {hash}}, "", nil, nil)
+}
+
+// GC applies the hosting budget and sweeps unreferenced blobs.
+func (c *Client) GC(ctx context.Context) (*GCResult, error) {
+	var res GCResult
+	if err := c.call(ctx, http.MethodPost, "/content/gc", nil, "", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ContentStatus reports where a content set is replicated. providers adds a
+// DHT provider lookup, which is slow; leave it off when polling.
+func (c *Client) ContentStatus(ctx context.Context, hash string, providers bool) (*ReplicationStatus, error) {
+	params := url.Values{"hash": {hash}}
+	if !providers {
+		params.Set("providers", "0")
+	}
+	var st ReplicationStatus
+	if err := c.call(ctx, http.MethodGet, "/content/status", params, "", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Export streams a content set as one archive. The caller must Close it.
+func (c *Client) Export(ctx context.Context, hash string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/content/export", url.Values{"hash": {hash}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Import uploads an archive, streaming it, and returns the root hash and size
+// of the set it held. The node pins it.
+func (c *Client) Import(ctx context.Context, archive io.Reader) (string, int64, error) {
+	var out struct {
+		Hash string `json:"hash"`
+		Size int64  `json:"size"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/content/import", nil, "application/octet-stream", archive, &out); err != nil {
+		return "", 0, err
+	}
+	return out.Hash, out.Size, nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event is one thing that happened on a node, as /events streams it. Data is
+// specific to the type; see the HTTP API documentation.
+type Event struct {
+	Seq   uint64          `json:"seq"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	At    time.Time       `json:"at"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// EventLagged is the Type of the event an EventStream yields when the node
+// dropped events because the stream fell behind; Dropped says how many.
+const EventLagged = "lagged"
+
+// EventStream is a node's activity, read one event at a time. The caller must
+// Close it.
+type EventStream struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+// Events streams the node's activity on the given topics (connectivity,
+// records, cache, content, heal), or on all of them if none are given. The
+// stream lasts until ctx is done, the node shuts down or it is closed.
+func (c *Client) Events(ctx context.Context, topics ...string) (*EventStream, error) {
+	params := url.Values{}
+	if len(topics) > 0 {
+		params.Set("topics", strings.Join(topics, ","))
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/events", params, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// Next returns the next event. A lag notice comes back as an Event whose Type
+// is EventLagged; its Dropped says how many were lost. At the end of the
+// stream Next returns io.EOF.
+func (s *EventStream) Next() (Event, error) {
+	var name, data string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return Event{}, io.EOF
+			}
+			return Event{}, fmt.Errorf("read event stream: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return decodeEvent(name, data)
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// Dropped returns how many events a lag notice says were lost, and 0 for any
+// other event.
+func (e Event) Dropped() uint64 {
+	if e.Type != EventLagged {
+		return 0
+	}
+	var lag struct {
+		Dropped uint64 `json:"dropped"`
+	}
+	json.Unmarshal(e.Data, &lag)
+	return lag.Dropped
+}
+
+func decodeEvent(name, data string) (Event, error) {
+	if name == EventLagged {
+		return Event{Type: EventLagged, Data: json.RawMessage(data)}, nil
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return Event{}, fmt.Errorf("decode %s event: %w", name, err)
+	}
+	return e, nil
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error { return s.body.Close() }
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/authoring"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+)
+
+type (
+	// RR is a resource record.
+	RR = record.RR
+	// Record is a signed name record, as published and stored in the DHT.
+	Record = record.FNRecord
+	// Proof is the evidence behind a resolution (see pkg/verify).
+	Proof = resolver.Proof
+	// Name is a locally owned name on the authoring API.
+	Name = authoring.Name
+)
+
+// ReprovideStats is the progress of a node's content reprovide sweep.
+type ReprovideStats struct {
+	Strategy   string     `json:"strategy"`
+	Running    bool       `json:"running"`
+	Keys       int        `json:"keys"`
+	Provided   int        `json:"provided"`
+	Failed     int        `json:"failed"`
+	Walks      int        `json:"walks"` // DHT walks the run needed
+	LastStart  *time.Time `json:"lastStart,omitempty"`
+	LastEnd    *time.Time `json:"lastEnd,omitempty"`
+	LagSeconds int64      `json:"lagSeconds"`
+}
+
+// Health is a node's /health answer. It is served before the node is ready,
+// so it is the way to wait for a freshly started one.
+type Health struct {
+	Status       string   `json:"status"`
+	Version      string   `json:"version"`
+	Ready        bool     `json:"ready"`
+	Role         string   `json:"role"` // "node" or "bootstrap"
+	Capabilities []string `json:"capabilities"`
+	AuthoringAPI string   `json:"authoringAPI,omitempty"`
+}
+
+// Info is a node's /info answer.
+type Info struct {
+	Version         string          `json:"version"`
+	Role            string          `json:"role"`
+	Mode            string          `json:"mode"`
+	PeerID          string          `json:"peerID"`
+	ListenAddresses []string        `json:"listenAddresses"`
+	Peers           []string        `json:"peers"`
+	HostsConnected  int             `json:"hostsConnected"`
+	NetworkSize     int32           `json:"networkSize"`
+	Protocols       []string        `json:"protocols"`
+	Reprovide       *ReprovideStats `json:"reprovide,omitempty"`
+}
+
+// Published is the answer to an authoring publish.
+type Published struct {
+	Name    string `json:"published"`
+	Seq     uint64 `json:"seq"`
+	Expires int64  `json:"expires"` // unix seconds
+}
+
+// Health reports the node's liveness, version and role.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.call(ctx, http.MethodGet, "/health", nil, "", nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Info reports the node's peer identity, addresses and view of the network.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.call(ctx, http.MethodGet, "/info", nil, "", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Publish stores a signed record, returning the full name it was published
+// under. The node verifies the record and refuses one it cannot (ErrBadRequest).
+func (c *Client) Publish(ctx context.Context, rec *Record) (string, error) {
+	payload, err := rec.Marshal()
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Published string `json:"published"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/publish", nil, "application/json", bytes.NewReader(payload), &out); err != nil {
+		return "", err
+	}
+	return out.Published, nil
+}
+
+// Resolve returns the records of a name, only those of recordType unless it
+// is empty. A name that does not exist is ErrNotFound.
+func (c *Client) Resolve(ctx context.Context, name, recordType string) ([]RR, error) {
+	params := url.Values{"name": {name}}
+	if recordType != "" {
+		params.Set("type", recordType)
+	}
+	var out struct {
+		Records []RR `json:"records"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/resolve", params, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Records, nil
+}
+
+// WaitResolve blocks until the node's DHT lookups, bypassing its cache, return
+// the record of name at seq or later, then returns its records. It waits up to
+// timeout (at most 5m; the node's default of 30s if zero) and then fails with
+// ErrUnavailable. Deploy scripts use it to wait for a publish to be visible.
+func (c *Client) WaitResolve(ctx context.Context, name string, seq uint64, timeout time.Duration) ([]RR, error) {
+	params := url.Values{"name": {name}, "wait-seq": {strconv.FormatUint(seq, 10)}}
+	if timeout > 0 {
+		params.Set("timeout", timeout.String())
+	}
+	var out struct {
+		Records []RR `json:"records"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/resolve", params, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Records, nil
+}
+
+// ResolveProof returns the signed record of a name and, for a bare name, the
+// chain evidence for its owner. The node is not trusted to have checked it;
+// pkg/verify does.
+func (c *Client) ResolveProof(ctx context.Context, name string) (*Proof, error) {
+	var out struct {
+		Proof *Proof `json:"proof"`
+	}
+	params := url.Values{"name": {name}, "proof": {"1"}}
+	if err := c.call(ctx, http.MethodGet, "/resolve", params, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Proof, nil
+}
+
+// Record returns the current signed record of a self-certifying name,
+// bypassing the node's cache: the record to raise Seq above when publishing an
+// update.
+func (c *Client) Record(ctx context.Context, name string) (*Record, error) {
+	var rec Record
+	if err := c.call(ctx, http.MethodGet, "/record", url.Values{"name": {name}}, "", nil, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Names lists the names whose owner keys the node holds. Authoring API only.
+func (c *Client) Names(ctx context.Context) ([]Name, error) {
+	var out struct {
+		Names []Name `json:"names"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/authoring/names", nil, "", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Names, nil
+}
+
+// CreateName makes a new owner key for label; ErrConflict if one exists.
+// Authoring API only.
+func (c *Client) CreateName(ctx context.Context, label string) (*Name, error) {
+	var name Name
+	if err := c.callJSON(ctx, http.MethodPost, "/authoring/names", map[string]string{"label": label}, &name); err != nil {
+		return nil, err
+	}
+	return &name, nil
+}
+
+// PublishName has the node sign and publish records as the complete record
+// set of label, using the owner key it holds. Authoring API only.
+func (c *Client) PublishName(ctx context.Context, label string, records []RR) (*Published, error) {
+	var out Published
+	in := map[string][]RR{"records": records}
+	if err := c.callJSON(ctx, http.MethodPost, "/authoring/names/"+url.PathEscape(label)+"/publish", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,187 @@
+// Package verify resolves Freedom Names through a node's HTTP API without
+// trusting the node. It asks for proofs (/resolve?proof=1) and checks them
+// locally: the record signature and expiry, the binding between the name and
+// the signing key, and for a bare name the chain transactions that make that
+// key the owner.
+//
+// For a self-certifying name that is the whole story: a node that lies can
+// make a lookup fail, not succeed with records the owner never signed. A bare
+// name's owner is only as good as the chain behind it, so its transactions
+// are checked against a Chain the client keeps itself, from Electrum servers
+// of its choosing; without one, bare names are refused with ErrNeedsChain.
+// Even then the client relies on its chain servers not withholding
+// transactions, such as an earlier claim: see registry.OwnerProof.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/bch"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/registry"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/resolver"
+	"gitlab.melroy.org/freedom-names/freedom-names/pkg/client"
+)
+
+type (
+	// Proof is the evidence a node returns with ?proof=1.
+	Proof = resolver.Proof
+	// OwnerProof is the chain evidence for a bare name's owner.
+	OwnerProof = registry.OwnerProof
+	// RR is a resource record.
+	RR = record.RR
+)
+
+var (
+	// ErrInvalidProof marks an answer that does not check out: whatever the
+	// node claimed, the records cannot be shown to come from the name's owner.
+	ErrInvalidProof = errors.New("invalid resolution proof")
+	// ErrNeedsChain means a bare name's proof was not checked because there
+	// was no Chain to check its transactions against.
+	ErrNeedsChain = errors.New("bare names need a chain to verify against")
+)
+
+// Chain is the Bitcoin Cash header chain bare-name proofs are checked
+// against, read from Electrum servers the client chooses and verified as it
+// is read (see bch.HeaderChain).
+type Chain struct {
+	client  *bch.ElectrumClient
+	headers *bch.HeaderChain
+}
+
+// NewChain returns a Chain for network ("mainnet", "chipnet", …) read from
+// servers, tried in order with failover. checkpoint is as for
+// FREEDOM_BCH_CHECKPOINT: "height:hash", "tofu", or empty for the network's
+// built-in one.
+func NewChain(network, checkpoint string, servers ...string) (*Chain, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("no electrum server")
+	}
+	client := bch.NewElectrumClient(servers...)
+	headers, err := bch.NewHeaderChain(client, network, checkpoint)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Chain{client: client, headers: headers}, nil
+}
+
+// Close closes the chain's server connections.
+func (c *Chain) Close() { c.client.Close() }
+
+// Check verifies a proof for a self-certifying name and returns the records
+// it establishes. A bare name is refused with ErrNeedsChain: use CheckOnChain.
+func Check(name string, p *Proof) ([]RR, error) {
+	return CheckOnChain(context.Background(), name, p, nil)
+}
+
+// CheckOnChain verifies a proof for name and returns the records it
+// establishes. For a bare name every transaction of the owner proof must be
+// in a block of chain; an error reading chain is returned as is.
+func CheckOnChain(ctx context.Context, name string, p *Proof, chain *Chain) ([]RR, error) {
+	if p == nil || p.Record == nil {
+		return nil, fmt.Errorf("%w: no record", ErrInvalidProof)
+	}
+	canonical := record.CanonicalName(name)
+	if registry.IsBareName(canonical) {
+		if chain == nil {
+			return nil, fmt.Errorf("%s: %w", canonical, ErrNeedsChain)
+		}
+		owner, err := bch.VerifyOwnerProofInChain(ctx, canonical, p.Owner, chain.headers)
+		if errors.Is(err, bch.ErrInvalidOwnerProof) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(owner, p.Record.PubKey) {
+			return nil, fmt.Errorf("%w: record is not signed by the owner of %s", ErrInvalidProof, canonical)
+		}
+	} else {
+		_, keyID, err := record.ParseName(canonical)
+		if err != nil {
+			return nil, err
+		}
+		id, err := record.PubKeyID(p.Record.PubKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+		}
+		if id != keyID {
+			return nil, fmt.Errorf("%w: record key does not match %s", ErrInvalidProof, canonical)
+		}
+	}
+	if err := p.Record.Verify(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+	return p.Record.Records, nil
+}
+
+// Client resolves names through one node's HTTP API, verifying every answer.
+type Client struct {
+	api   *client.Client
+	chain *Chain
+}
+
+// NewClient returns a Client for the node API at baseURL.
+func NewClient(baseURL string) *Client {
+	return Over(client.New(baseURL))
+}
+
+// Over returns a Client sending its requests through api, e.g. one built
+// with its own *http.Client.
+func Over(api *client.Client) *Client {
+	return &Client{api: api}
+}
+
+// WithChain returns a copy of c that resolves bare names too, checking their
+// owners against chain.
+func (c *Client) WithChain(chain *Chain) *Client {
+	return &Client{api: c.api, chain: chain}
+}
+
+// Resolve returns the verified records for name, filtered to recordType
+// unless it is empty. The filter is applied here, to the verified set, so the
+// node cannot drop records of the type asked for without failing the check.
+func (c *Client) Resolve(ctx context.Context, name, recordType string) ([]RR, error) {
+	proof, err := c.api.ResolveProof(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	records, err := CheckOnChain(ctx, name, proof, c.chain)
+	if err != nil {
+		return nil, err
+	}
+	if recordType == "" {
+		return records, nil
+	}
+	filtered := make([]RR, 0, len(records))
+	for _, rr := range records {
+		if rr.Type == recordType {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered, nil
+}
+
+// ResolveContent returns the verified CONTENT reference for name: a content
+// hash, or a read capability for encrypted content. Content is addressed by
+// its hash, so the bytes can then be fetched from any node.
+func (c *Client) ResolveContent(ctx context.Context, name string) (string, error) {
+	_, proof, err := c.api.ContentProof(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	records, err := CheckOnChain(ctx, name, proof, c.chain)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range records {
+		if rr.Type == record.RecordTypeCONTENT {
+			return rr.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%s has no CONTENT record", name)
+}
@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/record"
+	"gitlab.melroy.org/freedom-names/freedom-names/internal/testsupport"
+)
+
+// signedProof returns a proof for a fresh "site" record and its full name.
+func signedProof(t *testing.T) (*Proof, string) {
+	t.Helper()
+	rec, err := record.BuildAndSignRecord(testsupport.NewTestKey(t), "site",
+		[]RR{{Type: record.RecordTypeA, Value: "10.0.0.7", TTL: 300}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _ := rec.FullName()
+	return &Proof{Record: rec}, name
+}
+
+func TestCheck(t *testing.T) {
+	proof, name := signedProof(t)
+	records, err := Check(name+".", proof)
+	if err != nil {
+		t.Fatalf("honest proof: %v", err)
+	}
+	if len(records) != 1 || records[0].Value != "10.0.0.7" {
+		t.Errorf("records %+v", records)
+	}
+
+	// Records edited by the relay no longer match the signature.
+	edited, _ := signedProof(t)
+	edited.Record.Records[0].Value = "10.6.6.6"
+	// A record validly signed by someone else, for a name that is not theirs.
+	other, _ := signedProof(t)
+	// A record that was valid once.
+	stale, staleName := signedProof(t)
+	stale.Record.EOL = time.Now().Add(-time.Hour).Unix()
+
+	for _, tc := range []struct {
+		what  string
+		name  string
+		proof *Proof
+	}{
+		{"edited records", name, &Proof{Record: edited.Record}},
+		{"another key's record", name, other},
+		{"expired record", staleName, stale},
+		{"no record", name, &Proof{}},
+	} {
+		if _, err := Check(tc.name, tc.proof); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("%s: err = %v, want ErrInvalidProof", tc.what, err)
+		}
+	}
+	// A bare name's owner cannot be checked without a chain.
+	if _, err := Check("site.fn", proof); !errors.Is(err, ErrNeedsChain) {
+		t.Errorf("bare name: err = %v, want ErrNeedsChain", err)
+	}
+}
+
+// TestClientRejectsLyingNode runs the client against a node that answers
+// with a forged record, and against one that fails outright.
+func TestClientRejectsLyingNode(t *testing.T) {
+	honest, name := signedProof(t)
+	forged, _ := signedProof(t)
+	forged.Record.Records = []RR{{Type: record.RecordTypeCONTENT, Value: "k2jmtxtest", TTL: 60}}
+	serve := honest
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("proof") != "1" {
+			http.Error(w, "proof not requested", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("name") != name {
+			http.Error(w, "no such name", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": name, "proof": serve})
+	}))
+	defer node.Close()
+	c := NewClient(node.URL + "/")
+
+	records, err := c.Resolve(t.Context(), name, record.RecordTypeA)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("honest node: %v %+v", err, records)
+	}
+	if _, err := c.ResolveContent(t.Context(), name); err == nil || errors.Is(err, ErrInvalidProof) {
+		t.Errorf("name without CONTENT: err = %v", err)
+	}
+
+	serve = forged
+	if _, err := c.ResolveContent(t.Context(), name); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("forged record: err = %v, want ErrInvalidProof", err)
+	}
+	if _, err := c.Resolve(t.Context(), "other.fn", ""); err == nil || errors.Is(err, ErrInvalidProof) {
+		t.Errorf("node error: err = %v, want a plain failure", err)
+	}
+}